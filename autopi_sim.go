@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/DIMO-Network/edge-network/internal/autopisim"
+	"github.com/google/subcommands"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const autopiSimCmdName = "autopi-sim"
+
+// autopiSimCmd runs a fake autopi local api so edge-network can run on a laptop.
+// Start it, then run edge-network with AUTOPI_BASE_URL=http://localhost:9000
+type autopiSimCmd struct {
+	logger      zerolog.Logger
+	listen      string
+	vehicleFile string
+	unitID      string
+	modem       string
+}
+
+func (*autopiSimCmd) Name() string { return autopiSimCmdName }
+func (*autopiSimCmd) Synopsis() string {
+	return "runs a simulated autopi api backed by a scriptable vehicle model, for local development"
+}
+func (*autopiSimCmd) Usage() string {
+	return `autopi-sim [-listen <addr>] [-vehicle <vehicle.json>] [-unit-id <uuid>] [-modem <ec2x|le910cx>]`
+}
+
+func (p *autopiSimCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&p.listen, "listen", "localhost:9000", "address to listen on")
+	f.StringVar(&p.vehicleFile, "vehicle", "", "optional vehicle model json file, uses a default idling car if empty")
+	f.StringVar(&p.unitID, "unit-id", "", "unit id to report, random if empty")
+	f.StringVar(&p.modem, "modem", "ec2x", "modem type to simulate")
+}
+
+func (p *autopiSimCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	unit := uuid.New()
+	if p.unitID != "" {
+		u, err := uuid.Parse(p.unitID)
+		if err != nil {
+			p.logger.Error().Err(err).Msg("invalid unit id")
+			return subcommands.ExitUsageError
+		}
+		unit = u
+	}
+	var vehicle *autopisim.Vehicle
+	if p.vehicleFile != "" {
+		v, err := autopisim.LoadVehicle(p.vehicleFile)
+		if err != nil {
+			p.logger.Error().Err(err).Msg("failed to load vehicle model")
+			return subcommands.ExitFailure
+		}
+		vehicle = v
+	}
+	sim, err := autopisim.NewServer(p.logger, unit, vehicle)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("failed to create simulator")
+		return subcommands.ExitFailure
+	}
+	sim.SetDevice(autopisim.Device{Modem: p.modem, HardwareVersion: 7.0, SoftwareVersion: "v1.23.0",
+		IMEI: "867698040000000", IMSI: "310260000000000", SSID: "autopi-sim"})
+
+	fmt.Printf("autopi simulator listening on %s. unit id: %s, eth addr: %s\n", p.listen, unit, sim.Address().Hex())
+	fmt.Printf("update the vehicle model with: curl -X PUT --data @vehicle.json http://%s/sim/vehicle\n", p.listen)
+	if err := http.ListenAndServe(p.listen, sim); err != nil { //nolint:gosec // local dev tool
+		p.logger.Error().Err(err).Msg("simulator stopped")
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
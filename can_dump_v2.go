@@ -5,12 +5,19 @@ import (
 	"encoding/hex"
 	"flag"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
-	"github.com/rs/zerolog"
-
+	"github.com/DIMO-Network/edge-network/commands"
+	dimoConfig "github.com/DIMO-Network/edge-network/config"
 	"github.com/DIMO-Network/edge-network/internal/canbus"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/network"
 	"github.com/google/subcommands"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/segmentio/ksuid"
 	"golang.org/x/sys/unix"
 )
 
@@ -18,25 +25,58 @@ import (
 
 type canDumpV2Cmd struct {
 	headerFilter uint
+	filters      canFilterFlags
 	logger       zerolog.Logger
+	unitID       uuid.UUID
 	cycleCount   int
+	iface        string
+	format       string
+	outPath      string
+	maxSizeKB    int64
+	uploadChunk  int
 }
 
 func (*canDumpV2Cmd) Name() string { return "can-dump-v2" }
 func (*canDumpV2Cmd) Synopsis() string {
-	return "can-dump prints data flowing on CAN bus, with optional filters"
+	return "can-dump prints data flowing on CAN bus, or writes it to candump/asc/blf log files, with optional filters"
 }
 func (*canDumpV2Cmd) Usage() string {
-	return `can-dump-v2 [-header <uint>] [-cycles <int>]`
+	return `can-dump-v2 [-header <uint>] [-filter <id[:mask]>]... [-cycles <int>] [-iface <can interface>]
+	[-format <hex|candump|asc|blf>] [-out <base path>] [-max-size <KB>] [-upload <chunk bytes>]
+`
 }
 
 func (p *canDumpV2Cmd) SetFlags(f *flag.FlagSet) {
 	f.UintVar(&p.headerFilter, "header", 0, "optional header filter in numeric form eg. 7e8 would be 2024")
+	f.Var(&p.filters, "filter", "hex filter in candump syntax, repeatable. eg. 7E8, 7E0:7F0 (mask) or 7DF~7FF (inverted)")
 	f.IntVar(&p.cycleCount, "cycles", 0, "the qty of cycles to record in can dump. Useful when running from cloud console")
+	f.StringVar(&p.iface, "iface", canbus.DefaultInterface, "can interface to dump, eg. vcan0")
+	f.StringVar(&p.format, "format", "hex", "output format: hex (console only), candump, asc or blf")
+	f.StringVar(&p.outPath, "out", "", "base file path, eg. /tmp/dump writes /tmp/dump.0.log. Prints to console if empty, except blf")
+	f.Int64Var(&p.maxSizeKB, "max-size", 0, "rotate to a new file after this many KB, 0 for a single file")
+	f.IntVar(&p.uploadChunk, "upload", 0, "upload the written files over mqtt in chunks of this many bytes once done, 0 to not upload")
 }
 
 func (p *canDumpV2Cmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	fmt.Println("Starting can-dump-v2... all outputs will be in hex, including header:")
+	var format canbus.LogFormat
+	if p.format != "hex" {
+		f, err := canbus.ParseLogFormat(p.format)
+		if err != nil {
+			p.logger.Error().Err(err).Msg("invalid format")
+			return subcommands.ExitUsageError
+		}
+		format = f
+	}
+	if (format == canbus.FormatBLF || p.uploadChunk > 0) && p.outPath == "" {
+		p.logger.Error().Msg("-out is required for blf format and uploading")
+		return subcommands.ExitUsageError
+	}
+	if p.outPath != "" && format == "" {
+		format = canbus.FormatCandump
+	}
+	if format == "" {
+		fmt.Println("Starting can-dump-v2... all outputs will be in hex, including header:")
+	}
 
 	sck, err := canbus.New()
 	if err != nil {
@@ -44,42 +84,120 @@ func (p *canDumpV2Cmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interfac
 	}
 	defer sck.Close()
 
+	uf := p.filters
 	if p.headerFilter > 0 {
-		fmt.Printf("setting filter to %d\n", p.headerFilter)
-
-		uf := make([]unix.CanFilter, 1)
-		uf[0].Id = uint32(p.headerFilter)
-		if p.headerFilter > 4095 {
-			uf[0].Mask = unix.CAN_EFF_MASK // extended frame
-		} else {
-			uf[0].Mask = unix.CAN_SFF_MASK // standard frame
+		hf, err := canbus.ParseFilter(fmt.Sprintf("%X", p.headerFilter))
+		if err != nil {
+			p.logger.Fatal().Err(err).Msg("invalid header filter")
 		}
+		uf = append(uf, hf)
+	}
+	if len(uf) > 0 {
+		p.logger.Info().Msgf("setting %d filters: %s", len(uf), uf.String())
 		err = sck.SetFilters(uf)
 		if err != nil {
 			p.logger.Fatal().Err(err).Msg("failed to set filters")
 		}
 	}
 
-	err = sck.Bind("can0")
+	err = sck.Bind(p.iface)
 	if err != nil {
-		p.logger.Fatal().Err(err).Msg("failed to bind can0")
+		p.logger.Fatal().Err(err).Msgf("failed to bind %s", p.iface)
 	}
 
-	var blank = strings.Repeat(" ", 24)
-
 	if p.cycleCount == 0 {
 		p.cycleCount = 9999 // if nothing set let's just have a high number
 	}
 
+	var writer canbus.LogWriter
+	var rotating *canbus.RotatingLogWriter
+	switch {
+	case p.outPath != "":
+		rotating, err = canbus.NewRotatingLogWriter(p.outPath, format, p.maxSizeKB*1024)
+		writer = rotating
+	case format != "":
+		writer, err = canbus.NewLogWriter(format, os.Stdout)
+	}
+	if err != nil {
+		p.logger.Fatal().Err(err).Msg("failed to create can log writer")
+	}
+
+	var blank = strings.Repeat(" ", 24)
 	for i := 0; i < p.cycleCount; i++ {
 		msg, err := sck.Recv()
 		if err != nil {
 			p.logger.Fatal().Err(err).Msg("failed to recv")
 		}
-		ascii := strings.ToUpper(hex.Dump(msg.Data))
-		ascii = strings.TrimRight(strings.ReplaceAll(ascii, blank, ""), "\n")
-		fmt.Printf("%7s  %03x %s\n", sck.Name(), msg.ID, ascii)
+		if writer == nil {
+			ascii := strings.ToUpper(hex.Dump(msg.Data))
+			ascii = strings.TrimRight(strings.ReplaceAll(ascii, blank, ""), "\n")
+			fmt.Printf("%7s  %03x %s\n", sck.Name(), msg.ID, ascii)
+			continue
+		}
+		if err := writer.Write(canbus.LogFrame{Timestamp: time.Now(), Interface: sck.Name(), Frame: msg}); err != nil {
+			p.logger.Fatal().Err(err).Msg("failed to write can log")
+		}
+	}
+	if writer != nil {
+		if err := writer.Close(); err != nil {
+			p.logger.Fatal().Err(err).Msg("failed to close can log")
+		}
 	}
+	if rotating == nil {
+		return subcommands.ExitSuccess
+	}
+	p.logger.Info().Msgf("wrote can log files: %s", strings.Join(rotating.Files(), ", "))
 
+	if p.uploadChunk > 0 {
+		if err := p.upload(rotating.Files(), format); err != nil {
+			p.logger.Error().Err(err).Msg("failed to upload can log files")
+			return subcommands.ExitFailure
+		}
+	}
 	return subcommands.ExitSuccess
 }
+
+// upload sends each file in chunks through the DataSender candump topic
+func (p *canDumpV2Cmd) upload(files []string, format canbus.LogFormat) error {
+	addr, err := commands.GetEthereumAddress(p.unitID)
+	if err != nil {
+		return fmt.Errorf("could not get eth address: %w", err)
+	}
+	conf, err := dimoConfig.ReadConfigFromPath("/opt/autopi/config.yaml")
+	if err != nil {
+		return fmt.Errorf("unable to read config file: %w", err)
+	}
+	ds := network.NewDataSender(p.unitID, *addr, p.logger, models.VehicleInfo{}, *conf)
+	dumpID := ksuid.New().String()
+	for _, file := range files {
+		sent, err := network.SendCanDumpFile(ds, dumpID, file, string(format), p.uploadChunk, 0)
+		if err != nil {
+			return err
+		}
+		p.logger.Info().Msgf("uploaded %s in %d chunks, dump id: %s", file, sent, dumpID)
+	}
+	return nil
+}
+
+// canFilterFlags collects repeated -filter flags
+type canFilterFlags []unix.CanFilter
+
+func (c *canFilterFlags) String() string {
+	if c == nil {
+		return ""
+	}
+	s := make([]string, len(*c))
+	for i, f := range *c {
+		s[i] = fmt.Sprintf("%X:%X", f.Id, f.Mask)
+	}
+	return strings.Join(s, ",")
+}
+
+func (c *canFilterFlags) Set(value string) error {
+	f, err := canbus.ParseFilter(value)
+	if err != nil {
+		return err
+	}
+	*c = append(*c, f)
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/DIMO-Network/edge-network/internal/autopisim"
+	"github.com/DIMO-Network/edge-network/internal/canbus"
+	"github.com/DIMO-Network/edge-network/internal/ecusim"
+	"github.com/google/subcommands"
+	"github.com/rs/zerolog"
+)
+
+const (
+	canReplayCmdName = "can-replay"
+	ecuSimCmdName    = "ecu-sim"
+)
+
+// canReplayCmd plays a recorded candump log onto a (v)can interface so the native logger can be exercised without a car.
+// Setup a virtual interface with: sudo ip link add dev vcan0 type vcan && sudo ip link set up vcan0
+type canReplayCmd struct {
+	logger zerolog.Logger
+	file   string
+	iface  string
+	speed  float64
+	loop   bool
+}
+
+func (*canReplayCmd) Name() string { return canReplayCmdName }
+func (*canReplayCmd) Synopsis() string {
+	return "replays a candump log file onto a can interface, eg. vcan0"
+}
+func (*canReplayCmd) Usage() string {
+	return `can-replay -file <candump.log> [-iface <can interface>] [-speed <float>] [-loop]`
+}
+
+func (p *canReplayCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&p.file, "file", "", "candump -l formatted log file")
+	f.StringVar(&p.iface, "iface", "vcan0", "can interface to replay onto")
+	f.Float64Var(&p.speed, "speed", 1, "playback speed multiplier, 0 sends as fast as possible")
+	f.BoolVar(&p.loop, "loop", false, "replay the file continuously")
+}
+
+func (p *canReplayCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if p.file == "" {
+		p.logger.Error().Msg("file is required")
+		return subcommands.ExitUsageError
+	}
+	f, err := os.Open(p.file)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("failed to open candump log")
+		return subcommands.ExitFailure
+	}
+	frames, err := canbus.ReadCandumpLog(f)
+	_ = f.Close()
+	if err != nil {
+		p.logger.Error().Err(err).Msg("failed to read candump log")
+		return subcommands.ExitFailure
+	}
+
+	sck, err := canbus.New()
+	if err != nil {
+		p.logger.Error().Err(err).Msg("failed to create can socket")
+		return subcommands.ExitFailure
+	}
+	defer sck.Close() //nolint
+	if err := sck.Bind(p.iface); err != nil {
+		p.logger.Error().Err(err).Msgf("failed to bind %s", p.iface)
+		return subcommands.ExitFailure
+	}
+
+	stop := make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		close(stop)
+	}()
+
+	fmt.Printf("replaying %d frames from %s onto %s\n", len(frames), p.file, p.iface)
+	for {
+		if err := canbus.Replay(sck, frames, p.speed, stop); err != nil {
+			p.logger.Error().Err(err).Msg("replay failed")
+			return subcommands.ExitFailure
+		}
+		select {
+		case <-stop:
+			return subcommands.ExitSuccess
+		default:
+		}
+		if !p.loop {
+			return subcommands.ExitSuccess
+		}
+	}
+}
+
+// ecuSimCmd answers obd2 and uds pid requests on a (v)can interface using the autopi-sim vehicle model
+type ecuSimCmd struct {
+	logger      zerolog.Logger
+	iface       string
+	vehicleFile string
+}
+
+func (*ecuSimCmd) Name() string { return ecuSimCmdName }
+func (*ecuSimCmd) Synopsis() string {
+	return "simulates an ecu answering pid requests on a can interface, eg. vcan0"
+}
+func (*ecuSimCmd) Usage() string {
+	return `ecu-sim [-iface <can interface>] [-vehicle <vehicle.json>]`
+}
+
+func (p *ecuSimCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&p.iface, "iface", "vcan0", "can interface to answer on")
+	f.StringVar(&p.vehicleFile, "vehicle", "", "optional vehicle model json file, same format as autopi-sim")
+}
+
+func (p *ecuSimCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	vehicle := autopisim.DefaultVehicle()
+	if p.vehicleFile != "" {
+		v, err := autopisim.LoadVehicle(p.vehicleFile)
+		if err != nil {
+			p.logger.Error().Err(err).Msg("failed to load vehicle model")
+			return subcommands.ExitFailure
+		}
+		vehicle = v
+	}
+	responder := ecusim.NewResponder(p.logger, p.iface, vehicle)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		_ = responder.Close()
+	}()
+
+	fmt.Printf("ecu simulator answering on %s for vin %s\n", p.iface, vehicle.VIN)
+	if err := responder.Run(); err != nil {
+		p.logger.Error().Err(err).Msg("ecu simulator stopped")
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
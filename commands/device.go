@@ -106,6 +106,24 @@ func ExtendSleepTimer(unitID uuid.UUID) (err error) {
 	return
 }
 
+// SetSleepTimer adds or replaces the named sleep timer, the device goes to sleep after period seconds unless it is cleared
+func SetSleepTimer(unitID uuid.UUID, name string, period int) (err error) {
+	req := api.ExecuteRawRequest{Command: fmt.Sprintf(api.SleepTimerAddCommand, name, period)}
+	path := fmt.Sprintf("/dongle/%s/execute_raw", unitID)
+
+	var resp api.ExecuteRawResponse
+	return api.ExecuteRequest("POST", path, req, &resp)
+}
+
+// ClearSleepTimer removes the named sleep timer, other timers eg. pairing are left as they are
+func ClearSleepTimer(unitID uuid.UUID, name string) (err error) {
+	req := api.ExecuteRawRequest{Command: fmt.Sprintf(api.SleepTimerClearCommand, name)}
+	path := fmt.Sprintf("/dongle/%s/execute_raw", unitID)
+
+	var resp api.ExecuteRawResponse
+	return api.ExecuteRequest("POST", path, req, &resp)
+}
+
 func AnnounceCode(unitID uuid.UUID, intro string, code uint32, logger zerolog.Logger) (err error) {
 	announcement := `audio.speak '` + intro + ` , `
 
@@ -290,6 +308,15 @@ func GetGPSLocation(unitID uuid.UUID, modem string) (location api.GPSLocationRes
 	return
 }
 
+// GetAccelerometer reads the device accelerometer, not all hardware versions have one
+func GetAccelerometer(unitID uuid.UUID) (acc api.AccelerometerResponse, err error) {
+	req := api.ExecuteRawRequest{Command: api.AccelerometerCommand}
+	url := fmt.Sprintf("/dongle/%s/execute_raw", unitID)
+
+	err = api.ExecuteRequest("POST", url, req, &acc)
+	return
+}
+
 func GetQMICellInfo(unitID uuid.UUID) (cell api.QMICellInfoResponse, err error) {
 	req := api.ExecuteRawRequest{Command: api.GetQMICellInfoCommand}
 	url := fmt.Sprintf("/dongle/%s/execute_raw", unitID)
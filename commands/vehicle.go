@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/DIMO-Network/edge-network/internal/clock"
 	"github.com/DIMO-Network/edge-network/internal/util"
 
 	"github.com/DIMO-Network/edge-network/internal/models"
@@ -158,7 +159,8 @@ func RequestPIDRaw(logger *zerolog.Logger, unitID uuid.UUID, request models.PIDR
 		err = fmt.Errorf("no response received")
 	}
 	ts, errParse := time.Parse("2006-01-02T15:04:05.000000", resp.Timestamp)
-	ts = ts.UTC() // just in case
+	// autopi stamps with the same clock, correct it the same way
+	ts = clock.Correct(ts).UTC()
 	if errParse != nil {
 		err = fmt.Errorf("error parsing timestamp: %w", errParse)
 	}
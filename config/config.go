@@ -19,6 +19,13 @@ import (
 type Config struct {
 	Mqtt     Mqtt     `yaml:"mqtt"`
 	Services Services `yaml:"services"`
+	CAN      CAN      `yaml:"can"`
+}
+
+// CAN settings for the native can bus logger
+type CAN struct {
+	// Interface is the socketcan interface to bind to, defaults to can0. eg. vcan0 for testing with replayed logs
+	Interface string `yaml:"interface"`
 }
 
 type Mqtt struct {
@@ -43,6 +50,24 @@ type Topics struct {
 	Logs        string `yaml:"logs"`
 	Fingerprint string `yaml:"fingerprint"`
 	Candump     string `yaml:"candump"`
+	// Encodings of the payloads per topic, topics without one are sent as json
+	Encodings TopicEncodings `yaml:"encodings"`
+}
+
+// PayloadEncoding how a payload is serialized before it is published
+type PayloadEncoding string
+
+const (
+	// EncodingJSON the cloud event as json, gzip compressed and base64 encoded for the compressed topics
+	EncodingJSON PayloadEncoding = "json"
+	// EncodingCBOR the versioned binary status payload, signal names in a dictionary and delta encoded timestamps, gzip
+	// compressed without the base64
+	EncodingCBOR PayloadEncoding = "cbor"
+)
+
+// TopicEncodings only the status topic supports the binary encoding for now
+type TopicEncodings struct {
+	Status PayloadEncoding `yaml:"status"`
 }
 
 type Client struct {
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/canbus"
+	"github.com/DIMO-Network/edge-network/internal/loggers"
+	"github.com/google/subcommands"
+	"github.com/rs/zerolog"
+)
+
+type dbcDiscoverCmd struct {
+	logger     zerolog.Logger
+	windowSecs int
+	iface      string
+}
+
+func (*dbcDiscoverCmd) Name() string { return "dbc-discover" }
+func (*dbcDiscoverCmd) Synopsis() string {
+	return "listens to passive can traffic and prints per id stats (frequency, entropy, counters, checksums) to help write a dbc"
+}
+func (*dbcDiscoverCmd) Usage() string {
+	return `dbc-discover [-window <seconds>] [-iface <can interface>]`
+}
+
+func (p *dbcDiscoverCmd) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&p.windowSecs, "window", 60, "seconds to listen for")
+	f.StringVar(&p.iface, "iface", canbus.DefaultInterface, "can interface to listen on, eg. vcan0")
+}
+
+func (p *dbcDiscoverCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	fmt.Printf("listening on %s for %ds...\n", p.iface, p.windowSecs)
+	dbcLogger := loggers.NewDBCPassiveLogger(p.logger, nil, "7", nil, p.iface)
+	// no polled references from the terminal, so no correlations
+	report, err := dbcLogger.DiscoverDBCCandidates(time.Duration(p.windowSecs)*time.Second, nil, nil)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("failed dbc discovery")
+		return subcommands.ExitFailure
+	}
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		p.logger.Error().Err(err).Msg("failed to marshal report")
+		return subcommands.ExitFailure
+	}
+	fmt.Println(string(out))
+	return subcommands.ExitSuccess
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/DIMO-Network/edge-network/internal/hooks"
 	"os"
 
+	"github.com/DIMO-Network/edge-network/internal/canbus"
 	"github.com/DIMO-Network/edge-network/internal/loggers"
 	"github.com/DIMO-Network/edge-network/internal/models"
 	"github.com/google/subcommands"
@@ -16,6 +17,7 @@ import (
 type dbcScanCmd struct {
 	logger      zerolog.Logger
 	dbcFilePath string
+	iface       string
 }
 
 func (*dbcScanCmd) Name() string { return "dbc-scan" }
@@ -23,11 +25,12 @@ func (*dbcScanCmd) Synopsis() string {
 	return "starts scanning canbus with the passed in dbc file or default on in autopi directory if no parameter"
 }
 func (*dbcScanCmd) Usage() string {
-	return `dbc-scan -file <dbc.file path>`
+	return `dbc-scan -file <dbc.file path> [-iface <can interface>]`
 }
 
 func (p *dbcScanCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&p.dbcFilePath, "file", "", "dbc file path")
+	f.StringVar(&p.iface, "iface", canbus.DefaultInterface, "can interface to scan, eg. vcan0")
 }
 
 func (p *dbcScanCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -45,7 +48,7 @@ func (p *dbcScanCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{
 	d := string(content)
 	fmt.Println(d)
 
-	dbcLogger := loggers.NewDBCPassiveLogger(p.logger, &d, "7", nil) // always try, v7 will allow
+	dbcLogger := loggers.NewDBCPassiveLogger(p.logger, &d, "7", nil, p.iface) // always try, v7 will allow
 	ch := make(chan models.SignalData)
 	go func() {
 		err := dbcLogger.StartScanning(ch)
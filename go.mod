@@ -6,6 +6,7 @@ require (
 	github.com/DIMO-Network/shared v0.12.4
 	github.com/eclipse/paho.mqtt.golang v1.5.0
 	github.com/ethereum/go-ethereum v1.14.8
+	github.com/fxamacker/cbor/v2 v2.7.0
 	github.com/godbus/dbus/v5 v5.1.0
 	github.com/google/subcommands v1.2.0
 	github.com/google/uuid v1.6.0
@@ -54,7 +55,6 @@ require (
 	github.com/dgryski/go-farm v0.0.0-20200201041132-a6ae2369ad13 // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/fatih/structs v1.1.0 // indirect
-	github.com/fxamacker/cbor/v2 v2.7.0 // indirect
 	github.com/go-chi/chi/v5 v5.1.0 // indirect
 	github.com/go-jose/go-jose/v3 v3.0.3 // indirect
 	github.com/go-kit/kit v0.13.0 // indirect
@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"math"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/util"
+)
+
+// TrackPoint a gps fix of the track, Keep marks turns that survive simplification
+type TrackPoint struct {
+	Time     time.Time
+	Location models.Location
+	Keep     bool
+}
+
+// AdaptiveLocationSampler decides how often to poll gps from motion and heading changes, and buffers the track while moving
+// so it can be simplified before it is enqueued. Not safe for concurrent use, it is driven by the location query loop.
+type AdaptiveLocationSampler struct {
+	settings models.AdaptiveLocationSettings
+	// flushEvery how much track to buffer before simplifying, the status payload interval
+	flushEvery time.Duration
+	track      []TrackPoint
+	moving     bool
+	lastCog    float64
+	hasCog     bool
+	lastSent   time.Time
+}
+
+func NewAdaptiveLocationSampler(settings models.AdaptiveLocationSettings, flushEvery time.Duration) *AdaptiveLocationSampler {
+	if settings.MovingIntervalSecs <= 0 {
+		settings.MovingIntervalSecs = 5
+	}
+	if settings.TurnIntervalSecs <= 0 {
+		settings.TurnIntervalSecs = 1
+	}
+	if settings.HeartbeatSecs <= 0 {
+		settings.HeartbeatSecs = 300
+	}
+	if settings.HeadingChangeDeg <= 0 {
+		settings.HeadingChangeDeg = 15
+	}
+	if settings.MovingSpeedKph <= 0 {
+		settings.MovingSpeedKph = 5
+	}
+	if settings.SimplifyToleranceMeters <= 0 {
+		settings.SimplifyToleranceMeters = 10
+	}
+	return &AdaptiveLocationSampler{settings: settings, flushEvery: flushEvery}
+}
+
+// Add a fix. Returns how long to wait until the next poll, and the simplified track to enqueue when it is due.
+func (a *AdaptiveLocationSampler) Add(ts time.Time, loc models.Location) (time.Duration, []TrackPoint) {
+	moving := loc.SogKm >= a.settings.MovingSpeedKph
+	wasMoving := a.moving
+	a.moving = moving
+
+	if !moving {
+		a.hasCog = false
+		var out []TrackPoint
+		if wasMoving || ts.Sub(a.lastSent) >= a.heartbeat() {
+			// the stop point ends the track, otherwise a heartbeat
+			a.track = append(a.track, TrackPoint{Time: ts, Location: loc, Keep: true})
+			out = a.flush(ts)
+		}
+		return a.heartbeat(), out
+	}
+
+	next := seconds(a.settings.MovingIntervalSecs)
+	point := TrackPoint{Time: ts, Location: loc}
+	if !wasMoving {
+		point.Keep = true // start of the track
+	} else if a.hasCog && headingChange(a.lastCog, loc.Cog) >= a.settings.HeadingChangeDeg {
+		point.Keep = true
+		next = seconds(a.settings.TurnIntervalSecs)
+	}
+	a.lastCog, a.hasCog = loc.Cog, true
+	a.track = append(a.track, point)
+	if ts.Sub(a.track[0].Time) >= a.flushEvery {
+		return next, a.flush(ts)
+	}
+	return next, nil
+}
+
+// Moving true if the last fix was moving
+func (a *AdaptiveLocationSampler) Moving() bool {
+	return a.moving
+}
+
+func (a *AdaptiveLocationSampler) heartbeat() time.Duration {
+	return seconds(a.settings.HeartbeatSecs)
+}
+
+// flush simplifies and empties the buffered track
+func (a *AdaptiveLocationSampler) flush(ts time.Time) []TrackPoint {
+	out := SimplifyTrack(a.track, a.settings.SimplifyToleranceMeters)
+	a.track = nil
+	a.lastSent = ts
+	return out
+}
+
+// SimplifyTrack Douglas-Peucker: keeps the end points, points marked Keep, and any point further than toleranceMeters from
+// the line between the points kept around it
+func SimplifyTrack(track []TrackPoint, toleranceMeters float64) []TrackPoint {
+	if len(track) <= 2 {
+		return track
+	}
+	keep := make([]bool, len(track))
+	keep[0], keep[len(track)-1] = true, true
+	for i, p := range track {
+		keep[i] = keep[i] || p.Keep
+	}
+	// simplify each segment between forced points on its own
+	start := 0
+	for i := 1; i < len(track); i++ {
+		if keep[i] {
+			douglasPeucker(track, start, i, toleranceMeters, keep)
+			start = i
+		}
+	}
+	out := make([]TrackPoint, 0, len(track))
+	for i, p := range track {
+		if keep[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func douglasPeucker(track []TrackPoint, first, last int, tolerance float64, keep []bool) {
+	if last-first < 2 {
+		return
+	}
+	maxDist, index := 0.0, 0
+	for i := first + 1; i < last; i++ {
+		d := perpendicularMeters(track[i].Location, track[first].Location, track[last].Location)
+		if d > maxDist {
+			maxDist, index = d, i
+		}
+	}
+	if maxDist <= tolerance {
+		return
+	}
+	keep[index] = true
+	douglasPeucker(track, first, index, tolerance, keep)
+	douglasPeucker(track, index, last, tolerance, keep)
+}
+
+// perpendicularMeters distance from p to the segment a-b, on a plane centered on p
+func perpendicularMeters(p, a, b models.Location) float64 {
+	cosLat := math.Cos(p.Latitude * math.Pi / 180)
+	project := func(l models.Location) (float64, float64) {
+		x := (l.Longitude - p.Longitude) * math.Pi / 180 * util.EarthRadiusKm * 1000 * cosLat
+		y := (l.Latitude - p.Latitude) * math.Pi / 180 * util.EarthRadiusKm * 1000
+		return x, y
+	}
+	x1, y1 := project(a)
+	x2, y2 := project(b)
+	return distanceToSegment(x1, y1, x2, y2)
+}
+
+// headingChange smallest angle between two courses in degrees
+func headingChange(from, to float64) float64 {
+	return math.Abs(math.Mod(to-from+540, 360) - 180)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
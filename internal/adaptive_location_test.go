@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveLocationSampler(t *testing.T) {
+	a := NewAdaptiveLocationSampler(models.AdaptiveLocationSettings{Enabled: true}, 20*time.Second)
+	start := time.Now()
+
+	// stationary: first fix is a heartbeat, then nothing until the next one
+	next, track := a.Add(start, models.Location{Latitude: 40, Longitude: -3})
+	assert.Equal(t, 300*time.Second, next)
+	require.Len(t, track, 1)
+	next, track = a.Add(start.Add(time.Minute), models.Location{Latitude: 40, Longitude: -3})
+	assert.Equal(t, 300*time.Second, next)
+	assert.Empty(t, track)
+
+	// driving north in a straight line, buffered until 20s of track
+	ts := start.Add(2 * time.Minute)
+	lat := 40.0
+	for i := 0; i < 4; i++ {
+		next, track = a.Add(ts, models.Location{Latitude: lat, Longitude: -3, Cog: 0, SogKm: 50})
+		assert.Equal(t, 5*time.Second, next)
+		assert.Empty(t, track)
+		ts = ts.Add(5 * time.Second)
+		lat += 0.0006
+	}
+	// a turn east polls faster
+	next, track = a.Add(ts, models.Location{Latitude: lat, Longitude: -3, Cog: 90, SogKm: 50})
+	assert.Equal(t, time.Second, next)
+	// 20s buffered: straight line points are dropped, start, turn and last are kept
+	require.Len(t, track, 2)
+	assert.Equal(t, 40.0, track[0].Location.Latitude)
+	assert.Equal(t, lat, track[1].Location.Latitude)
+
+	ts = ts.Add(time.Second)
+	next, _ = a.Add(ts, models.Location{Latitude: lat, Longitude: -2.9997, Cog: 92, SogKm: 50})
+	assert.Equal(t, 5*time.Second, next)
+
+	// stopping flushes what is buffered, with the stop point
+	ts = ts.Add(5 * time.Second)
+	next, track = a.Add(ts, models.Location{Latitude: lat, Longitude: -2.999, SogKm: 0})
+	assert.Equal(t, 300*time.Second, next)
+	require.Len(t, track, 2)
+	assert.Equal(t, -2.999, track[1].Location.Longitude)
+	assert.False(t, a.Moving())
+}
+
+func TestSimplifyTrack(t *testing.T) {
+	pt := func(lat, lon float64) TrackPoint {
+		return TrackPoint{Location: models.Location{Latitude: lat, Longitude: lon}}
+	}
+	// north then east: a few meters of noise on each leg is dropped, the corner is kept
+	track := []TrackPoint{
+		pt(40.000, -3.0),
+		pt(40.001, -3.00005),
+		pt(40.002, -3.0),
+		pt(40.002, -2.9988),
+		pt(40.00203, -2.9976),
+		pt(40.002, -2.9964),
+	}
+	out := SimplifyTrack(track, 10)
+	require.Len(t, out, 3)
+	assert.Equal(t, track[0], out[0])
+	assert.Equal(t, track[2], out[1])
+	assert.Equal(t, track[5], out[2])
+
+	// forced points are kept
+	track[1].Keep = true
+	assert.Len(t, SimplifyTrack(track, 10), 4)
+	// nothing to simplify
+	assert.Len(t, SimplifyTrack(track[:2], 10), 2)
+}
+
+func Test_headingChange(t *testing.T) {
+	assert.Equal(t, 20.0, headingChange(350, 10))
+	assert.Equal(t, 20.0, headingChange(10, 350))
+	assert.Equal(t, 180.0, headingChange(0, 180))
+}
@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 )
 
 const (
 	DetectCanbusCommand        = `obd.protocol set=auto`
 	SleepTimerDelayCommand     = `power.sleep_timer add=pairing period=900 clear=*`
+	SleepTimerAddCommand       = `power.sleep_timer add=%[1]s period=%[2]d clear=%[1]s`
+	SleepTimerClearCommand     = `power.sleep_timer clear=%s`
 	GetEthereumAddressCommand  = `crypto.query ethereum_address`
 	SignHashCommand            = `crypto.sign_string `
 	GetDeviceIDCommand         = `config.get device.id`
@@ -33,11 +37,24 @@ const (
 	ObdPIDQueryCommand         = `obd.query`
 	GetIMEILe910cxCommand      = `modem.connection imei`
 	GetIMEIEc2xCommand         = `ec2x.imei`
+	AccelerometerCommand       = `acc.xyz`
 )
 
-const autoPiBaseURL = "http://192.168.4.1:9000"
+// DefaultBaseURL is where the autopi local api listens on the device
+const DefaultBaseURL = "http://192.168.4.1:9000"
 const contentTypeJSON = "application/json"
 
+// autoPiBaseURL can be overridden with SetBaseURL, eg. to point to the autopi simulator when running on a laptop
+var autoPiBaseURL = DefaultBaseURL
+
+// SetBaseURL changes the autopi api base url used by ExecuteRequest. Empty string resets to DefaultBaseURL
+func SetBaseURL(baseURL string) {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	autoPiBaseURL = strings.TrimSuffix(baseURL, "/")
+}
+
 type KwargType struct {
 	Destructive bool `json:"destructive,omitempty"`
 	Force       bool `json:"force,omitempty"`
@@ -182,6 +199,36 @@ type GPSLocationResponse struct {
 	Nsat int64 `json:"nsat"`
 	// le910cx
 	NsatGPS int64 `json:"nsat_gps"`
+	// Fix 2D or 3D, empty without a fix
+	Fix string `json:"fix"`
+	// Cog course over ground in degrees
+	Cog float64 `json:"cog"`
+	// SogKm speed over ground in km/h
+	SogKm float64 `json:"sog_km"`
+	// TimeUTC and DateUTC of the fix from the gnss receiver, eg. 02:04:27 and 2024-02-28
+	TimeUTC string `json:"time_utc"`
+	DateUTC string `json:"date_utc"`
+	// le910cx
+	NsatGlonass int64 `json:"nsat_glonass"`
+}
+
+// UTC returns the time of the fix as reported by the gnss receiver, false if it was not reported
+func (g GPSLocationResponse) UTC() (time.Time, bool) {
+	if g.TimeUTC == "" || g.DateUTC == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("2006-01-02 15:04:05", g.DateUTC+" "+g.TimeUTC)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// AccelerometerResponse in g, axes are relative to how the device is mounted
+type AccelerometerResponse struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
 }
 
 type QMICellInfoResponse struct {
@@ -0,0 +1,411 @@
+package autopisim
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/api"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// stampFormat is how the autopi formats _stamp, always UTC
+const stampFormat = "2006-01-02T15:04:05.000000"
+
+// Device is the autopi hardware the simulator pretends to be
+type Device struct {
+	Modem           string  `json:"modem"`
+	HardwareVersion float64 `json:"hw_version"`
+	SoftwareVersion string  `json:"software_version"`
+	IMEI            string  `json:"imei"`
+	IMSI            string  `json:"imsi"`
+	SSID            string  `json:"ssid"`
+}
+
+// Server is an in-process fake of the autopi local api (execute_raw), backed by a scriptable Vehicle.
+// Use it with httptest.NewServer in tests, or from the autopi-sim subcommand, and point api.SetBaseURL at it.
+type Server struct {
+	mu       sync.Mutex
+	logger   zerolog.Logger
+	vehicle  *Vehicle
+	device   Device
+	unitID   uuid.UUID
+	key      *ecdsa.PrivateKey
+	start    time.Time
+	now      func() time.Time
+	rnd      *rand.Rand
+	failures map[int]int
+	dtcs     []DTC
+}
+
+// NewServer creates a simulator with a fresh ethereum key. vehicle nil uses DefaultVehicle
+func NewServer(logger zerolog.Logger, unitID uuid.UUID, vehicle *Vehicle) (*Server, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate simulator key: %w", err)
+	}
+	if vehicle == nil {
+		vehicle = DefaultVehicle()
+	}
+	s := &Server{
+		logger: logger,
+		unitID: unitID,
+		key:    key,
+		device: Device{Modem: "ec2x", HardwareVersion: 7.0, SoftwareVersion: "v1.23.0", IMEI: "867698040000000",
+			IMSI: "310260000000000", SSID: "autopi-sim"},
+		now: time.Now,
+		rnd: rand.New(rand.NewSource(1)), //nolint:gosec // deterministic on purpose
+	}
+	s.start = s.now()
+	s.SetVehicle(vehicle)
+	return s, nil
+}
+
+// SetVehicle swaps the vehicle model, resetting failure counters and dtcs
+func (s *Server) SetVehicle(vehicle *Vehicle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vehicle = vehicle
+	s.failures = make(map[int]int)
+	s.dtcs = append([]DTC{}, vehicle.DTCs...)
+}
+
+// SetDevice overrides the hardware info reported by the simulator
+func (s *Server) SetDevice(device Device) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.device = device
+}
+
+// SetClock replaces time.Now and resets the start time, useful for deterministic tests
+func (s *Server) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+	s.start = now()
+}
+
+// Address is the ethereum address matching the key used by crypto.sign_string
+func (s *Server) Address() common.Address {
+	return crypto.PubkeyToAddress(s.key.PublicKey)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/sim/vehicle") {
+		s.handleVehicle(w, r)
+		return
+	}
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.URL.Path, "/dongle/") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found: " + r.URL.Path})
+		return
+	}
+	req := api.ExecuteRawRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logger.Debug().Msgf("autopi-sim command: %s", req.Command)
+	if status, msg, fail := s.shouldFail(req.Command); fail {
+		writeJSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	resp, err := s.execute(req)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleVehicle lets you drive the model while running: GET returns the current vehicle, PUT replaces it
+func (s *Server) handleVehicle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusOK, s.vehicle)
+	case http.MethodPut, http.MethodPost:
+		v := &Vehicle{}
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		s.SetVehicle(v)
+		writeJSON(w, http.StatusOK, v)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+// shouldFail checks the failure injection rules for the command, first match wins
+func (s *Server) shouldFail(command string) (int, string, bool) {
+	for i, f := range s.vehicle.Failures {
+		if !strings.HasPrefix(command, f.Command) {
+			continue
+		}
+		s.failures[i]++
+		fail := false
+		switch {
+		case f.FailFirst > 0:
+			fail = s.failures[i] <= f.FailFirst
+		case f.Rate > 0:
+			fail = s.rnd.Float64() < f.Rate
+		default:
+			fail = true
+		}
+		if !fail {
+			return 0, "", false
+		}
+		status := f.Status
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		msg := f.Message
+		if msg == "" {
+			msg = "simulated failure for: " + command
+		}
+		return status, msg, true
+	}
+	return 0, "", false
+}
+
+// execute answers the command the same way the autopi would, the response shapes mirror what internal/api expects
+func (s *Server) execute(req api.ExecuteRawRequest) (any, error) {
+	name, args, kwargs := parseCommand(req.Command)
+	elapsed := s.now().Sub(s.start).Seconds()
+	stamp := s.now().UTC().Format(stampFormat)
+
+	switch name {
+	case "power.status":
+		ps := api.PowerStatusResponse{}
+		ps.Spm.Battery.Voltage = interpolate(s.vehicle.Voltage, elapsed, s.vehicle.Loop)
+		ps.Spm.LastTrigger.Up = s.vehicle.LastTriggerUp
+		ps.Spm.CurrentState = "on"
+		ps.Rpi.Uptime.Seconds = int(elapsed)
+		return ps, nil
+	case "power.sleep_timer", "audio.speak":
+		return api.ExecuteRawResponse{Timestamp: stamp}, nil
+	case "obd.query":
+		return s.obdQuery(args, kwargs, elapsed, stamp)
+	case "obd.dtc":
+		if kwargs["clear"] == "true" {
+			s.dtcs = nil
+			return api.ExecuteRawResponse{Value: true, Timestamp: stamp}, nil
+		}
+		resp := api.DTCResponse{Stamp: stamp, Type: "dtc"}
+		for _, d := range s.dtcs {
+			resp.Values = append(resp.Values, struct {
+				Code string `json:"code"`
+				Text string `json:"text"`
+			}{Code: d.Code, Text: d.Text})
+		}
+		return resp, nil
+	case "obd.protocol":
+		return api.ObdAutoDetectResponse{Stamp: stamp, CanbusInfo: api.CanbusInfo{Autodetected: true, Baudrate: 500000,
+			ID: s.vehicle.Protocol, Name: "ISO 15765-4 (CAN 11/500)", Ecus: []int{0x7e8}}}, nil
+	case "crypto.query":
+		return api.ExecuteRawResponse{Value: s.Address().Hex(), Timestamp: stamp}, nil
+	case "crypto.sign_string":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("missing hash to sign")
+		}
+		hash, err := hex.DecodeString(strings.TrimPrefix(args[0], "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash: %w", err)
+		}
+		sig, err := crypto.Sign(hash, s.key)
+		if err != nil {
+			return nil, err
+		}
+		return api.ExecuteRawResponse{Value: hex.EncodeToString(sig), Timestamp: stamp}, nil
+	case "config.get":
+		return s.configGet(args)
+	case "ec2x.gnss_location":
+		return s.gnssLocation(elapsed, stamp, "nsat")
+	case "ec2x.imei":
+		return api.ExecuteRawResponse{Value: s.device.IMEI, Timestamp: stamp}, nil
+	case "ec2x.query":
+		return api.ExecuteRawResponse{Data: s.device.IMSI, Timestamp: stamp}, nil
+	case "modem.connection":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("missing modem.connection function")
+		}
+		switch args[0] {
+		case "gnss_location":
+			return s.gnssLocation(elapsed, stamp, "nsat_gps")
+		case "imei":
+			return api.ExecuteRawResponse{Value: s.device.IMEI, Timestamp: stamp}, nil
+		case "execute":
+			return api.ExecuteRawResponse{Data: s.device.IMSI, Timestamp: stamp}, nil
+		}
+	case "qmi.cell_info":
+		return qmiCellInfo(), nil
+	case "qmi.signal_strength":
+		return api.SignalStrengthResponse{Current: api.GenericSignalStrengthResponse{Network: "lte", Unit: "dBm", Value: -71}}, nil
+	case "wifi.status":
+		return api.WifiConnectionsResponse{WPAState: "COMPLETED", SSID: s.device.SSID}, nil
+	case "grains.set":
+		resp := api.SetWifiConnectionResponse{Result: true}
+		if len(req.Arg) > 1 {
+			b, _ := json.Marshal(req.Arg[1])
+			_ = json.Unmarshal(b, &resp.Changes.WPASupplicant.Networks)
+		}
+		return resp, nil
+	case "network.ip_addrs":
+		return []string{"100.64.0.2"}, nil
+	}
+
+	return nil, fmt.Errorf("'%s' is not available", name)
+}
+
+func (s *Server) configGet(args []string) (any, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing config key")
+	}
+	switch args[0] {
+	case "device.id":
+		return s.unitID.String(), nil
+	case "hw.version":
+		return s.device.HardwareVersion, nil
+	case "latest_release_version":
+		return s.device.SoftwareVersion, nil
+	case "modem":
+		return s.device.Modem, nil
+	}
+	return nil, fmt.Errorf("unknown config key: %s", args[0])
+}
+
+// obdQuery answers obd.query. Python formulas get the current numeric value, otherwise raw hex frames
+func (s *Server) obdQuery(args []string, kwargs map[string]string, elapsed float64, stamp string) (any, error) {
+	// only python formulas are passed through to the autopi
+	request := models.PIDRequest{}
+	if kwargs["formula"] != "" {
+		request.Formula = "python:" + kwargs["formula"]
+	}
+	if len(args) > 0 {
+		request.Name = args[0]
+	}
+	for key, dst := range map[string]*uint32{"header": &request.Header, "mode": &request.Mode, "pid": &request.Pid} {
+		v := strings.TrimPrefix(strings.Trim(kwargs[key], `"`), "x")
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(v, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", key, kwargs[key])
+		}
+		*dst = uint32(n)
+	}
+	if kwargs["flow_control_id_pair"] != "" {
+		request.CanFlowControlIDPair = kwargs["flow_control_id_pair"]
+	}
+
+	if request.FormulaType() == models.Python {
+		pid := s.vehicle.findPID(request.Mode, request.Pid)
+		if pid == nil {
+			return nil, fmt.Errorf("no data")
+		}
+		return api.ExecuteRawResponse{Value: interpolate(pid.Values, elapsed, s.vehicle.Loop), Timestamp: stamp}, nil
+	}
+	frames, err := s.vehicle.ResponseFrames(request, elapsed)
+	if err != nil {
+		return nil, err
+	}
+	return api.ExecuteRawResponse{Value: strings.Join(frames, "\n"), Timestamp: stamp}, nil
+}
+
+// gnssLocation mirrors the modem response, nsatKey differs per modem: nsat for ec2x, nsat_gps for le910cx
+func (s *Server) gnssLocation(elapsed float64, stamp, nsatKey string) (any, error) {
+	fix, ok := s.vehicle.gpsAt(elapsed)
+	if !ok {
+		return nil, fmt.Errorf("Error on query gps - no fix") //nolint:stylecheck // mimic autopi msg
+	}
+	now := s.now().UTC()
+	return map[string]any{
+		"_type":        "gnss_location",
+		"_stamp":       stamp,
+		"lat":          fix.Lat,
+		"lon":          fix.Lon,
+		"alt":          fix.Alt,
+		"hdop":         fix.Hdop,
+		nsatKey:        fix.Nsat,
+		"nsat_glonass": 0,
+		"fix":          "3D",
+		"cog":          fix.Course,
+		"sog_km":       fix.SpeedKm,
+		"sog_kn":       fix.SpeedKm / 1.852,
+		"time_utc":     now.Format("15:04:05"),
+		"date_utc":     now.Format("2006-01-02"),
+	}, nil
+}
+
+func qmiCellInfo() api.QMICellInfoResponse {
+	resp := api.QMICellInfoResponse{}
+	resp.IntrafrequencyLteInfo.Plmn = 310260
+	resp.IntrafrequencyLteInfo.GlobalCellID = 12345678
+	resp.IntrafrequencyLteInfo.ServingCellID = 1
+	resp.IntrafrequencyLteInfo.TrackingAreaCode = 2305
+	resp.IntrafrequencyLteInfo.EutraAbsoluteRfChannelNumber = "5110"
+	resp.IntrafrequencyLteInfo.Cell0.PhysicalCellID = 101
+	resp.IntrafrequencyLteInfo.Cell0.Rsrp = "-95.0"
+	resp.IntrafrequencyLteInfo.Cell0.Rsrq = "-10.0"
+	resp.IntrafrequencyLteInfo.Cell0.Rssi = "-65.0"
+	return resp
+}
+
+// parseCommand splits an autopi command into its name, positional args and key=value kwargs. Single quotes group.
+func parseCommand(command string) (string, []string, map[string]string) {
+	var tokens []string
+	var current strings.Builder
+	inQuote := false
+	for _, r := range command {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case r == ' ' && !inQuote:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	if len(tokens) == 0 {
+		return "", nil, nil
+	}
+	var args []string
+	kwargs := map[string]string{}
+	for _, t := range tokens[1:] {
+		if k, v, ok := strings.Cut(t, "="); ok && !strings.ContainsAny(k, "(") {
+			kwargs[k] = v
+			continue
+		}
+		args = append(args, t)
+	}
+	return tokens[0], args, kwargs
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,129 @@
+package autopisim
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/commands"
+	"github.com/DIMO-Network/edge-network/internal/api"
+	"github.com/DIMO-Network/edge-network/internal/loggers"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startSim(t *testing.T, vehicle *Vehicle) (*Server, uuid.UUID) {
+	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+	unitID := uuid.New()
+	sim, err := NewServer(logger, unitID, vehicle)
+	require.NoError(t, err)
+	now := time.Date(2024, 2, 29, 17, 17, 30, 0, time.UTC)
+	sim.SetClock(func() time.Time { return now })
+
+	srv := httptest.NewServer(sim)
+	api.SetBaseURL(srv.URL)
+	t.Cleanup(func() {
+		srv.Close()
+		api.SetBaseURL("")
+	})
+	return sim, unitID
+}
+
+func TestServer_DeviceCommands(t *testing.T) {
+	sim, unitID := startSim(t, nil)
+
+	ps, err := commands.GetPowerStatus(unitID)
+	require.NoError(t, err)
+	assert.Equal(t, 12.6, ps.VoltageFound)
+
+	addr, err := commands.GetEthereumAddress(unitID)
+	require.NoError(t, err)
+	assert.Equal(t, sim.Address(), *addr)
+
+	hash := crypto.Keccak256Hash([]byte(`{"foo":"bar"}`))
+	sig, err := commands.SignHash(unitID, hash.Bytes())
+	require.NoError(t, err)
+	pub, err := crypto.SigToPub(hash.Bytes(), sig)
+	require.NoError(t, err)
+	assert.Equal(t, sim.Address(), crypto.PubkeyToAddress(*pub))
+
+	loc, err := commands.GetGPSLocation(unitID, "le910cx")
+	require.NoError(t, err)
+	assert.Equal(t, 37.7749, loc.Lat)
+	assert.Equal(t, int64(9), loc.Nsat)
+
+	modem, err := commands.GetModemType(unitID)
+	require.NoError(t, err)
+	assert.Equal(t, "ec2x", modem)
+
+	codes, err := commands.GetDiagnosticCodes(unitID, zerolog.Nop())
+	require.NoError(t, err)
+	assert.Equal(t, "P0420", codes)
+	require.NoError(t, commands.ClearDiagnosticCodes(unitID))
+	codes, err = commands.GetDiagnosticCodes(unitID, zerolog.Nop())
+	require.NoError(t, err)
+	assert.Equal(t, "", codes)
+}
+
+func TestServer_OBDQuery(t *testing.T) {
+	_, unitID := startSim(t, nil)
+	logger := zerolog.Nop()
+
+	request := models.PIDRequest{Name: "rpm", Header: 0x7df, Mode: 0x01, Pid: 0x0c, Protocol: "6",
+		Formula: `dbc:31|16@0+ (0.25,0) [0|16383.75] "rpm"`}
+	resp, _, err := commands.RequestPIDRaw(&logger, unitID, request)
+	require.NoError(t, err)
+	require.True(t, resp.IsHex)
+	assert.Equal(t, []string{"7E804410C0C80000000"}, resp.ValueHex)
+	value, _, err := loggers.ExtractAndDecodeWithDBCFormula(resp.ValueHex[0], "0C", request.FormulaValue())
+	require.NoError(t, err)
+	assert.Equal(t, 800.0, value)
+
+	request.Formula = "python:bytes_to_int(messages[0].data[-2:]) * 0.25"
+	resp, _, err = commands.RequestPIDRaw(&logger, unitID, request)
+	require.NoError(t, err)
+	assert.Equal(t, 800.0, resp.Value)
+
+	vin, err := loggers.NewVINLogger(logger).GetVIN(unitID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1HGCM82633A004352", vin.VIN)
+
+	_, _, err = commands.RequestPIDRaw(&logger, unitID, models.PIDRequest{Name: "nope", Header: 0x7df, Mode: 0x01, Pid: 0x99})
+	assert.Error(t, err)
+}
+
+func TestServer_FailureInjection(t *testing.T) {
+	v := DefaultVehicle()
+	v.Failures = []Failure{{Command: "power.status", FailFirst: 2, Message: "spm timeout"}}
+	_, unitID := startSim(t, v)
+
+	for i := 0; i < 2; i++ {
+		_, err := commands.GetPowerStatus(unitID)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "spm timeout")
+	}
+	_, err := commands.GetPowerStatus(unitID)
+	assert.NoError(t, err)
+}
+
+func Test_interpolate(t *testing.T) {
+	points := []Point{{AtSecs: 0, Value: 10}, {AtSecs: 10, Value: 20}}
+	assert.Equal(t, 10.0, interpolate(points, -1, false))
+	assert.Equal(t, 15.0, interpolate(points, 5, false))
+	assert.Equal(t, 20.0, interpolate(points, 50, false))
+	assert.Equal(t, 15.0, interpolate(points, 15, true))
+}
+
+func Test_parseCommand(t *testing.T) {
+	name, args, kwargs := parseCommand(`obd.query rpm header='"7DF"' mode='x01' pid='x0C' protocol=6 force=true formula='bytes_to_int(messages[0].data[-2:]) * 0.25'`)
+	assert.Equal(t, "obd.query", name)
+	assert.Equal(t, []string{"rpm"}, args)
+	assert.Equal(t, `"7DF"`, kwargs["header"])
+	assert.Equal(t, "x0C", kwargs["pid"])
+	assert.Equal(t, "bytes_to_int(messages[0].data[-2:]) * 0.25", kwargs["formula"])
+}
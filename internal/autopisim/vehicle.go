@@ -0,0 +1,253 @@
+package autopisim
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/util"
+)
+
+// Vehicle is the scriptable model the simulator answers from. Anything time based (voltage, gps, pid values)
+// is expressed as points at an offset in seconds from when the simulator started, and is linearly interpolated.
+type Vehicle struct {
+	VIN string `json:"vin"`
+	// Protocol is reported back by obd.protocol, eg. 6 for CAN 11bit 500kbps
+	Protocol string `json:"protocol"`
+	// LastTriggerUp is what power.status reports as the wake reason, eg. "plug" for a cold boot
+	LastTriggerUp string   `json:"last_trigger_up"`
+	PIDs          []PID    `json:"pids"`
+	DTCs          []DTC    `json:"dtcs"`
+	Voltage       []Point  `json:"voltage"`
+	GPSTrack      []GPSFix `json:"gps_track"`
+	// Failures lets you inject errors for any command, first match wins
+	Failures []Failure `json:"failures"`
+	// Loop replays voltage, gps and pid curves after the last point instead of holding the last value
+	Loop bool `json:"loop"`
+}
+
+// Point is a value at a given offset since start
+type Point struct {
+	AtSecs float64 `json:"at_secs"`
+	Value  float64 `json:"value"`
+}
+
+// PID answers obd.query for a given mode / pid. If Frames are set they are returned as is, otherwise a single
+// frame is built from the current value using Bytes, Scale and Offset (raw = (value - offset) / scale).
+type PID struct {
+	Name   string   `json:"name"`
+	Mode   uint32   `json:"mode"`
+	Pid    uint32   `json:"pid"`
+	Bytes  int      `json:"bytes"`
+	Scale  float64  `json:"scale"`
+	Offset float64  `json:"offset"`
+	Values []Point  `json:"values"`
+	Frames []string `json:"frames"`
+}
+
+type DTC struct {
+	Code string `json:"code"`
+	Text string `json:"text"`
+}
+
+// GPSFix is a point in the track. Nsat 0 means no fix at that point.
+type GPSFix struct {
+	AtSecs  float64 `json:"at_secs"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	Alt     float64 `json:"alt"`
+	Hdop    float64 `json:"hdop"`
+	Nsat    int64   `json:"nsat"`
+	SpeedKm float64 `json:"sog_km"`
+	Course  float64 `json:"cog"`
+}
+
+// Failure makes commands starting with Command fail. FailFirst fails the first N matching calls, Rate fails
+// randomly with the given probability (0-1). If both are 0 every call fails.
+type Failure struct {
+	Command   string  `json:"command"`
+	FailFirst int     `json:"fail_first"`
+	Rate      float64 `json:"rate"`
+	Status    int     `json:"status"`
+	Message   string  `json:"message"`
+}
+
+// LoadVehicle reads a vehicle model from a json file
+func LoadVehicle(path string) (*Vehicle, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vehicle file: %w", err)
+	}
+	v := &Vehicle{}
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal vehicle file %s: %w", path, err)
+	}
+	return v, nil
+}
+
+// DefaultVehicle is an idling car with a few standard PIDs, a dtc, and a short gps track
+func DefaultVehicle() *Vehicle {
+	return &Vehicle{
+		VIN:           "1HGCM82633A004352",
+		Protocol:      "6",
+		LastTriggerUp: "volt_change",
+		PIDs: []PID{
+			{Name: "rpm", Mode: 0x01, Pid: 0x0c, Bytes: 2, Scale: 0.25, Values: []Point{{0, 800}, {60, 2500}, {120, 800}}},
+			{Name: "speed", Mode: 0x01, Pid: 0x0d, Bytes: 1, Scale: 1, Values: []Point{{0, 0}, {60, 60}, {120, 0}}},
+			{Name: "coolantTemp", Mode: 0x01, Pid: 0x05, Bytes: 1, Scale: 1, Offset: -40, Values: []Point{{0, 20}, {120, 90}}},
+			{Name: "fuelLevel", Mode: 0x01, Pid: 0x2f, Bytes: 1, Scale: 100.0 / 255, Values: []Point{{0, 75}, {120, 74}}},
+		},
+		DTCs:    []DTC{{Code: "P0420", Text: "Catalyst System Efficiency Below Threshold"}},
+		Voltage: []Point{{0, 12.6}, {5, 10.5}, {8, 14.1}, {120, 14.0}},
+		GPSTrack: []GPSFix{
+			{AtSecs: 0, Lat: 37.7749, Lon: -122.4194, Alt: 16, Hdop: 0.9, Nsat: 9},
+			{AtSecs: 120, Lat: 37.7849, Lon: -122.4094, Alt: 20, Hdop: 0.8, Nsat: 10, SpeedKm: 30, Course: 45},
+		},
+		Loop: true,
+	}
+}
+
+// findPID returns the pid model matching mode and pid
+func (v *Vehicle) findPID(mode, pid uint32) *PID {
+	for i := range v.PIDs {
+		if v.PIDs[i].Mode == mode && v.PIDs[i].Pid == pid {
+			return &v.PIDs[i]
+		}
+	}
+	return nil
+}
+
+// ResponseFrames answers a request the way the vehicle would over the bus, as hex frames prefixed by the response header.
+// Knows the vin (mode 09 pid 02 and uds did f190) plus any pid in the model.
+func (v *Vehicle) ResponseFrames(request models.PIDRequest, elapsed float64) ([]string, error) {
+	if (request.Mode == 0x09 && request.Pid == 0x02) || (request.Mode == 0x22 && request.Pid == 0xf190) {
+		if v.VIN == "" {
+			return nil, fmt.Errorf("no data")
+		}
+		if request.Mode == 0x22 {
+			return udsVINFrames(request.ResponseHeader(), v.VIN), nil
+		}
+		return vinFrames(request.ResponseHeader(), v.VIN), nil
+	}
+	pid := v.findPID(request.Mode, request.Pid)
+	if pid == nil {
+		return nil, fmt.Errorf("no data")
+	}
+	return pid.pidFrames(request, elapsed, v.Loop), nil
+}
+
+// pidFrames builds the hex response frames for the pid as the autopi would return them without a formula
+func (p *PID) pidFrames(request models.PIDRequest, elapsed float64, loop bool) []string {
+	if len(p.Frames) > 0 {
+		return p.Frames
+	}
+	raw := uint64(0)
+	scale := p.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	if v := interpolate(p.Values, elapsed, loop); v > p.Offset {
+		raw = uint64(math.Round((v - p.Offset) / scale))
+	}
+	numBytes := p.Bytes
+	if numBytes == 0 {
+		numBytes = 1
+	}
+	pidHex := util.UintToHexStr(p.Pid)
+	data := util.UintToHexStr(0x40+p.Mode) + pidHex + fmt.Sprintf("%0*X", numBytes*2, raw)
+	length := fmt.Sprintf("%02X", len(data)/2)
+	frame := length + data
+	if len(frame) < 16 {
+		frame += strings.Repeat("00", 8-len(frame)/2)
+	}
+
+	return []string{fmt.Sprintf("%X", request.ResponseHeader()) + frame}
+}
+
+// vinFrames builds the iso-tp mode 09 pid 02 multi frame response for the vin
+func vinFrames(header uint32, vin string) []string {
+	payload := "490201" + fmt.Sprintf("%X", vin)
+	hdr := fmt.Sprintf("%X", header)
+	if len(payload) <= 7*2 {
+		// short vin, fits in a single frame
+		return []string{hdr + fmt.Sprintf("%02X", len(payload)/2) + payload}
+	}
+	frames := []string{hdr + "10" + fmt.Sprintf("%02X", len(payload)/2) + payload[:6*2]}
+	payload = payload[6*2:]
+	for seq := 1; len(payload) > 0; seq++ {
+		n := 7 * 2
+		if len(payload) < n {
+			n = len(payload)
+		}
+		frames = append(frames, hdr+fmt.Sprintf("2%X", seq%16)+payload[:n])
+		payload = payload[n:]
+	}
+	return frames
+}
+
+// udsVINFrames builds a 0x22 f190 response, same iso-tp framing as the mode 09 one
+func udsVINFrames(header uint32, vin string) []string {
+	frames := vinFrames(header, vin)
+	// swap the 490201 service + pid + count prefix for 62f190
+	frames[0] = strings.Replace(frames[0], "490201", "62F190", 1)
+	return frames
+}
+
+// gpsAt interpolates the track at elapsed seconds
+func (v *Vehicle) gpsAt(elapsed float64) (GPSFix, bool) {
+	track := v.GPSTrack
+	if len(track) == 0 {
+		return GPSFix{}, false
+	}
+	elapsed = wrap(elapsed, track[len(track)-1].AtSecs, v.Loop)
+	if elapsed <= track[0].AtSecs {
+		return track[0], track[0].Nsat > 0
+	}
+	for i := 1; i < len(track); i++ {
+		if elapsed <= track[i].AtSecs {
+			a, b := track[i-1], track[i]
+			f := (elapsed - a.AtSecs) / (b.AtSecs - a.AtSecs)
+			fix := GPSFix{
+				AtSecs:  elapsed,
+				Lat:     a.Lat + (b.Lat-a.Lat)*f,
+				Lon:     a.Lon + (b.Lon-a.Lon)*f,
+				Alt:     a.Alt + (b.Alt-a.Alt)*f,
+				Hdop:    b.Hdop,
+				Nsat:    b.Nsat,
+				SpeedKm: b.SpeedKm,
+				Course:  b.Course,
+			}
+			return fix, fix.Nsat > 0
+		}
+	}
+	last := track[len(track)-1]
+	return last, last.Nsat > 0
+}
+
+// interpolate returns the linearly interpolated value of the curve at elapsed seconds
+func interpolate(points []Point, elapsed float64, loop bool) float64 {
+	if len(points) == 0 {
+		return 0
+	}
+	elapsed = wrap(elapsed, points[len(points)-1].AtSecs, loop)
+	if elapsed <= points[0].AtSecs {
+		return points[0].Value
+	}
+	for i := 1; i < len(points); i++ {
+		if elapsed <= points[i].AtSecs {
+			a, b := points[i-1], points[i]
+			return a.Value + (b.Value-a.Value)*(elapsed-a.AtSecs)/(b.AtSecs-a.AtSecs)
+		}
+	}
+	return points[len(points)-1].Value
+}
+
+func wrap(elapsed, last float64, loop bool) float64 {
+	if loop && last > 0 {
+		return math.Mod(elapsed, last)
+	}
+	return elapsed
+}
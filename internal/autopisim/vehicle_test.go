@@ -0,0 +1,19 @@
+package autopisim
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_vinFrames(t *testing.T) {
+	assert.Equal(t, []string{
+		"7E81014490201314847",
+		"7E821434D3832363333",
+		"7E82241303034333532",
+	}, vinFrames(0x7e8, "1HGCM82633A004352"))
+
+	// too short for a multi frame response
+	assert.Equal(t, []string{"7E805490201314A"}, vinFrames(0x7e8, "1J"))
+	assert.Equal(t, []string{"7E80762F19031323334"}, udsVINFrames(0x7e8, "1234"))
+}
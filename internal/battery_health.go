@@ -0,0 +1,275 @@
+package internal
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/loggers"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// batteryIgnitionDrop volts below the resting voltage when the ignition is switched on, eg. the fuel pump priming
+	batteryIgnitionDrop = 0.2
+	// batteryHighRateFor sampling stays fast this long after the ignition or a crank is seen
+	batteryHighRateFor = 30 * time.Second
+	// batteryCrankTimeout a crank that hasn't recovered by then is recorded with this recovery time
+	batteryCrankTimeout = 20 * time.Second
+	// batteryRecovered volts below the voltage before the crank that count as recovered
+	batteryRecovered = 0.1
+	// batteryChargingFrom and batteryChargingTo running window the charging voltage is taken from, once warmed up
+	batteryChargingFrom = time.Minute
+	batteryChargingTo   = 3 * time.Minute
+	// batteryRecent samples kept to know the voltage before a dip
+	batteryRecent = 5 * time.Second
+)
+
+type crankState struct {
+	start time.Time
+	// pre voltage before the crank
+	pre float64
+	min float64
+}
+
+// BatteryHealthMonitor measures the cranking dip and recovery, resting voltage after hours off and alternator charging
+// voltage, scores the 12v battery and builds a daily summary. Safe for concurrent use.
+type BatteryHealthMonitor struct {
+	logger        zerolog.Logger
+	lss           loggers.SettingsStore
+	restingAfter  time.Duration
+	state         models.BatteryHealthState
+	recent        []voltageSample
+	crank         *crankState
+	highRateUntil time.Time
+	runningSince  time.Time
+	charging      []float64
+	chargingTaken bool
+	mu            sync.Mutex
+}
+
+func NewBatteryHealthMonitor(logger zerolog.Logger, lss loggers.SettingsStore, settings models.BatteryHealthSettings) *BatteryHealthMonitor {
+	restingAfter := time.Duration(settings.RestingAfterHours * float64(time.Hour))
+	if restingAfter <= 0 {
+		restingAfter = 4 * time.Hour
+	}
+	state, err := lss.ReadBatteryHealthState()
+	if err != nil || state == nil {
+		state = &models.BatteryHealthState{}
+	}
+	return &BatteryHealthMonitor{logger: logger, lss: lss, restingAfter: restingAfter, state: *state}
+}
+
+// HighRate true around ignition, voltage should be sampled as fast as possible to catch the cranking dip
+func (bh *BatteryHealthMonitor) HighRate(now time.Time) bool {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	return bh.crank != nil || now.Before(bh.highRateUntil)
+}
+
+// Observe feeds a voltage reading with the engine state from the power manager. Returns the signals for measurements
+// completed by this reading, and the summary of the previous day on the first reading of a new one.
+func (bh *BatteryHealthMonitor) Observe(at time.Time, voltage float64, engine EngineState) ([]models.SignalData, *models.BatteryHealthEvent) {
+	if voltage <= 0 {
+		return nil, nil
+	}
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	var daily *models.BatteryHealthEvent
+	date := at.UTC().Format("2006-01-02")
+	if bh.state.Day != nil && bh.state.Day.Date != date {
+		daily = bh.state.Day
+		daily.Timestamp = at.UTC().UnixMilli()
+		daily.HealthScore = batteryHealthScore(bh.state)
+		bh.state.Day = nil
+	}
+	if bh.state.Day == nil {
+		bh.state.Day = &models.BatteryHealthEvent{Date: date, MinVoltage: voltage, MaxVoltage: voltage}
+		bh.persist()
+	}
+	bh.state.Day.MinVoltage = math.Min(bh.state.Day.MinVoltage, voltage)
+	bh.state.Day.MaxVoltage = math.Max(bh.state.Day.MaxVoltage, voltage)
+
+	pre := 0.0
+	kept := bh.recent[:0]
+	for _, s := range bh.recent {
+		if at.Sub(s.at) <= batteryRecent {
+			kept = append(kept, s)
+			pre = math.Max(pre, s.voltage)
+		}
+	}
+	bh.recent = append(kept, voltageSample{at: at, voltage: voltage})
+
+	var signals []models.SignalData
+	signals = append(signals, bh.observeCrank(at, voltage, pre, engine)...)
+	switch engine {
+	case EngineRunning:
+		signals = append(signals, bh.observeRunning(at, voltage)...)
+	case EngineOff:
+		signals = append(signals, bh.observeOff(at)...)
+	}
+	return signals, daily
+}
+
+// observeCrank follows a dip from the resting voltage until it recovers. Must hold the lock.
+func (bh *BatteryHealthMonitor) observeCrank(at time.Time, voltage, pre float64, engine EngineState) []models.SignalData {
+	if bh.crank == nil {
+		if engine == EngineRunning || pre == 0 || pre >= defaultRunningVoltage {
+			return nil
+		}
+		switch drop := pre - voltage; {
+		case drop >= crankDrop:
+			bh.crank = &crankState{start: at, pre: pre, min: voltage}
+			bh.highRateUntil = at.Add(batteryHighRateFor)
+		case drop >= batteryIgnitionDrop && engine == EngineOff:
+			bh.highRateUntil = at.Add(batteryHighRateFor)
+		}
+		return nil
+	}
+
+	crank := bh.crank
+	crank.min = math.Min(crank.min, voltage)
+	elapsed := at.Sub(crank.start)
+	if voltage < crank.pre-batteryRecovered && engine != EngineRunning && elapsed < batteryCrankTimeout {
+		return nil
+	}
+	bh.crank = nil
+	minVoltage, recovery := round2(crank.min), round2(elapsed.Seconds())
+	bh.state.CrankingMinVoltage, bh.state.CrankingRecoverySecs = &minVoltage, &recovery
+	day := bh.state.Day
+	day.Cranks++
+	if day.CrankingMinVoltage == nil || minVoltage < *day.CrankingMinVoltage {
+		day.CrankingMinVoltage = &minVoltage
+	}
+	if day.CrankingRecoverySecs == nil || recovery > *day.CrankingRecoverySecs {
+		day.CrankingRecoverySecs = &recovery
+	}
+	bh.logger.Info().Msgf("crank dip to %.2fV from %.2fV, recovered in %.2fs", minVoltage, crank.pre, recovery)
+	return bh.measured(at, map[string]float64{"batteryCrankingMinVoltage": minVoltage, "batteryCrankingRecoverySecs": recovery})
+}
+
+// observeRunning takes the charging voltage once per drive, after the alternator settled. Must hold the lock.
+func (bh *BatteryHealthMonitor) observeRunning(at time.Time, voltage float64) []models.SignalData {
+	if !bh.state.EngineOffSince.IsZero() || bh.state.RestingReported {
+		bh.state.EngineOffSince, bh.state.RestingReported = time.Time{}, false
+		bh.persist()
+	}
+	if bh.runningSince.IsZero() {
+		bh.runningSince, bh.charging, bh.chargingTaken = at, nil, false
+	}
+	running := at.Sub(bh.runningSince)
+	if bh.chargingTaken || running < batteryChargingFrom {
+		return nil
+	}
+	if running < batteryChargingTo {
+		bh.charging = append(bh.charging, voltage)
+		return nil
+	}
+	bh.chargingTaken = true
+	if len(bh.charging) == 0 {
+		return nil
+	}
+	sort.Float64s(bh.charging)
+	charging := round2(bh.charging[len(bh.charging)/2])
+	bh.state.ChargingVoltage = &charging
+	bh.state.Day.ChargingVoltage = &charging
+	return bh.measured(at, map[string]float64{"batteryChargingVoltage": charging})
+}
+
+// observeOff takes the resting voltage once per off period, after restingAfter. Must hold the lock.
+func (bh *BatteryHealthMonitor) observeOff(at time.Time) []models.SignalData {
+	bh.runningSince = time.Time{}
+	if bh.state.EngineOffSince.IsZero() {
+		bh.state.EngineOffSince = at
+		bh.persist()
+		return nil
+	}
+	if bh.state.RestingReported || at.Sub(bh.state.EngineOffSince) < bh.restingAfter || bh.crank != nil {
+		return nil
+	}
+	var recent []float64
+	for _, s := range bh.recent {
+		recent = append(recent, s.voltage)
+	}
+	sort.Float64s(recent)
+	resting := round2(recent[len(recent)/2])
+	bh.state.RestingReported = true
+	bh.state.RestingVoltage = &resting
+	bh.state.Day.RestingVoltage = &resting
+	return bh.measured(at, map[string]float64{"batteryRestingVoltage": resting})
+}
+
+// measured persists the new measurements and returns them as signals with the updated health score. Must hold the lock.
+func (bh *BatteryHealthMonitor) measured(at time.Time, values map[string]float64) []models.SignalData {
+	bh.persist()
+	ts := at.UTC().UnixMilli()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	signals := make([]models.SignalData, 0, len(values)+1)
+	for _, name := range names {
+		signals = append(signals, models.SignalData{Timestamp: ts, Name: name, Value: values[name]})
+	}
+	if score := batteryHealthScore(bh.state); score != nil {
+		signals = append(signals, models.SignalData{Timestamp: ts, Name: "batteryHealth", Value: *score})
+	}
+	return signals
+}
+
+// Reset forgets the measurements of the previous vehicle's battery, after the device was moved to another one
+func (bh *BatteryHealthMonitor) Reset() {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	bh.state = models.BatteryHealthState{}
+	bh.recent, bh.crank, bh.charging = nil, nil, nil
+	bh.highRateUntil, bh.runningSince = time.Time{}, time.Time{}
+	bh.chargingTaken = false
+}
+
+func (bh *BatteryHealthMonitor) persist() {
+	if err := bh.lss.WriteBatteryHealthState(bh.state); err != nil {
+		bh.logger.Err(err).Msg("failed to persist battery health state")
+	}
+}
+
+// batteryHealthScore 0 to 100, weighted over the measurements there are. Resting voltage is the state of charge, the
+// cranking dip the capacity under load, and the charging voltage whether the alternator keeps it charged.
+func batteryHealthScore(state models.BatteryHealthState) *float64 {
+	var total, weights float64
+	if state.RestingVoltage != nil {
+		total += 0.4 * scale(*state.RestingVoltage, 11.9, 12.6)
+		weights += 0.4
+	}
+	if state.CrankingMinVoltage != nil {
+		cranking := scale(*state.CrankingMinVoltage, 9.0, 10.5)
+		if state.CrankingRecoverySecs != nil && *state.CrankingRecoverySecs > 2 {
+			cranking = math.Max(0, cranking-(*state.CrankingRecoverySecs-2)*10)
+		}
+		total += 0.45 * cranking
+		weights += 0.45
+	}
+	if state.ChargingVoltage != nil {
+		charging := math.Min(scale(*state.ChargingVoltage, 12.8, 13.5), scale(*state.ChargingVoltage, 15.5, 14.8))
+		total += 0.15 * charging
+		weights += 0.15
+	}
+	if weights == 0 {
+		return nil
+	}
+	score := math.Round(total / weights)
+	return &score
+}
+
+// scale v linearly to 0 at bad and 100 at good, clamped
+func scale(v, bad, good float64) float64 {
+	return math.Max(0, math.Min(100, (v-bad)/(good-bad)*100))
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	mock_loggers "github.com/DIMO-Network/edge-network/internal/loggers/mocks"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func newTestBatteryHealthMonitor(t *testing.T, state *models.BatteryHealthState) (*BatteryHealthMonitor, *models.BatteryHealthState) {
+	ctrl := gomock.NewController(t)
+	lss := mock_loggers.NewMockSettingsStore(ctrl)
+	if state == nil {
+		lss.EXPECT().ReadBatteryHealthState().Return(nil, fmt.Errorf("not found"))
+	} else {
+		lss.EXPECT().ReadBatteryHealthState().Return(state, nil)
+	}
+	saved := &models.BatteryHealthState{}
+	lss.EXPECT().WriteBatteryHealthState(gomock.Any()).AnyTimes().DoAndReturn(func(s models.BatteryHealthState) error {
+		*saved = s
+		return nil
+	})
+	return NewBatteryHealthMonitor(zerolog.Nop(), lss, models.BatteryHealthSettings{Enabled: true}), saved
+}
+
+func signalValues(signals []models.SignalData) map[string]any {
+	values := map[string]any{}
+	for _, s := range signals {
+		values[s.Name] = s.Value
+	}
+	return values
+}
+
+func TestBatteryHealthMonitor_crank(t *testing.T) {
+	bh, saved := newTestBatteryHealthMonitor(t, nil)
+	start := time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)
+	at := func(ms int, voltage float64, engine EngineState) []models.SignalData {
+		signals, daily := bh.Observe(start.Add(time.Duration(ms)*time.Millisecond), voltage, engine)
+		assert.Nil(t, daily)
+		return signals
+	}
+
+	assert.Empty(t, at(0, 12.6, EngineOff))
+	assert.False(t, bh.HighRate(start))
+	// ignition on
+	assert.Empty(t, at(1000, 12.35, EngineOff))
+	assert.True(t, bh.HighRate(start.Add(1000*time.Millisecond)))
+
+	assert.Empty(t, at(2000, 10.1, EngineOff))
+	assert.Empty(t, at(2100, 9.8, EngineCranking))
+	assert.Empty(t, at(2200, 11.9, EngineCranking))
+	signals := at(2500, 13.9, EngineCranking)
+	values := signalValues(signals)
+	assert.Equal(t, 9.8, values["batteryCrankingMinVoltage"])
+	assert.Equal(t, 0.5, values["batteryCrankingRecoverySecs"])
+	assert.Equal(t, 53.0, values["batteryHealth"])
+	assert.Equal(t, 1, saved.Day.Cranks)
+
+	// charging voltage is taken once the alternator settled
+	for ms := 3000; ms < 60_000; ms += 1000 {
+		assert.Empty(t, at(ms, 14.4, EngineRunning))
+	}
+	var charging []models.SignalData
+	for ms := 60_000; ms <= 184_000; ms += 1000 {
+		charging = append(charging, at(ms, 14.2, EngineRunning)...)
+	}
+	values = signalValues(charging)
+	assert.Equal(t, 14.2, values["batteryChargingVoltage"])
+	// (0.45*53.3 + 0.15*100) / 0.6
+	assert.Equal(t, 65.0, values["batteryHealth"])
+	assert.True(t, saved.EngineOffSince.IsZero())
+}
+
+func TestBatteryHealthMonitor_restingAndDaily(t *testing.T) {
+	off := time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)
+	bh, saved := newTestBatteryHealthMonitor(t, &models.BatteryHealthState{EngineOffSince: off,
+		Day: &models.BatteryHealthEvent{Date: "2024-05-01", MinVoltage: 12.5, MaxVoltage: 14.3, Cranks: 2}})
+
+	signals, daily := bh.Observe(off.Add(3*time.Hour), 12.5, EngineOff)
+	assert.Empty(t, signals)
+	require.NotNil(t, daily, "first reading of a new day")
+	assert.Equal(t, "2024-05-01", daily.Date)
+	assert.Equal(t, 2, daily.Cranks)
+	assert.Nil(t, daily.HealthScore)
+	assert.Equal(t, "2024-05-02", saved.Day.Date)
+
+	// woke up from sleep 4h after the engine stopped
+	signals, daily = bh.Observe(off.Add(4*time.Hour), 12.3, EngineOff)
+	assert.Nil(t, daily)
+	values := signalValues(signals)
+	assert.Equal(t, 12.3, values["batteryRestingVoltage"])
+	assert.Equal(t, 57.0, values["batteryHealth"])
+	assert.True(t, saved.RestingReported)
+
+	// only once per off period
+	signals, _ = bh.Observe(off.Add(5*time.Hour), 12.3, EngineOff)
+	assert.Empty(t, signals)
+}
+
+func Test_batteryHealthScore(t *testing.T) {
+	assert.Nil(t, batteryHealthScore(models.BatteryHealthState{}))
+	weak, slow := 9.2, 4.0
+	score := batteryHealthScore(models.BatteryHealthState{CrankingMinVoltage: &weak, CrankingRecoverySecs: &slow})
+	require.NotNil(t, score)
+	// 13 less 20 for the slow recovery
+	assert.Equal(t, 0.0, *score)
+	overcharging := 15.5
+	assert.Equal(t, 0.0, *batteryHealthScore(models.BatteryHealthState{ChargingVoltage: &overcharging}))
+}
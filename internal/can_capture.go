@@ -0,0 +1,357 @@
+package internal
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/canbus"
+	"github.com/DIMO-Network/edge-network/internal/hooks"
+	"github.com/DIMO-Network/edge-network/internal/loggers"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/network"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// CANCaptureDir is where recordings are kept until fully uploaded
+	CANCaptureDir           = "/opt/autopi/can-captures"
+	defaultCaptureChunkSize = 64 * 1024
+	captureRecvTimeout      = time.Second
+	captureUploadRetryAfter = time.Minute
+	// maxCaptureBytes and maxCaptureDuration bound any job, so a bad template can't fill the storage or record forever
+	maxCaptureBytes    = 50 * 1024 * 1024
+	maxCaptureDuration = time.Hour
+)
+
+// CaptureConditions is the current vehicle state that capture job triggers are checked against
+type CaptureConditions struct {
+	Voltage       float64
+	EngineRunning bool
+	Speed         float64
+	// LowPower the battery is critical, no new captures are started
+	LowPower bool
+}
+
+// frameReceiver is the part of canbus.Socket used to record, so tests can feed frames
+type frameReceiver interface {
+	Recv() (canbus.Frame, error)
+	Close() error
+}
+
+// CANCaptureRunner runs the remote can capture jobs delivered in the device settings template. Only one job runs at a time,
+// recordings are gzipped and uploaded in chunks over the candump topic. Progress is persisted so uploads resume where they
+// left off after losing connection or a restart, and finished jobs are not repeated.
+type CANCaptureRunner struct {
+	logger       zerolog.Logger
+	dataSender   network.DataSender
+	lss          loggers.SettingsStore
+	jobs         []models.CANCaptureJob
+	canInterface string
+	dir          string
+	openSocket   func(filters []unix.CanFilter) (frameReceiver, error)
+	state        models.CANCaptureState
+	busy         bool
+	running      sync.WaitGroup
+	// retryUploadAt backs off after a failed upload, eg. while offline
+	retryUploadAt time.Time
+	mu            sync.Mutex
+}
+
+func NewCANCaptureRunner(logger zerolog.Logger, sender network.DataSender, lss loggers.SettingsStore, jobs []models.CANCaptureJob, canInterface string) *CANCaptureRunner {
+	if canInterface == "" {
+		canInterface = canbus.DefaultInterface
+	}
+	state, err := lss.ReadCANCaptureState()
+	if err != nil || state == nil {
+		state = &models.CANCaptureState{}
+	}
+	if state.Jobs == nil {
+		state.Jobs = map[string]models.CANCaptureJobState{}
+	}
+	return &CANCaptureRunner{
+		logger:       logger,
+		dataSender:   sender,
+		lss:          lss,
+		jobs:         jobs,
+		canInterface: canInterface,
+		dir:          CANCaptureDir,
+		state:        *state,
+		openSocket: func(filters []unix.CanFilter) (frameReceiver, error) {
+			return openCaptureSocket(canInterface, filters)
+		},
+	}
+}
+
+func openCaptureSocket(canInterface string, filters []unix.CanFilter) (frameReceiver, error) {
+	sck, err := canbus.New()
+	if err != nil {
+		return nil, err
+	}
+	if len(filters) > 0 {
+		if err := sck.SetFilters(filters); err != nil {
+			_ = sck.Close()
+			return nil, err
+		}
+	}
+	// so we can stop on time even if the bus goes quiet
+	if err := sck.SetRecvTimeout(captureRecvTimeout); err != nil {
+		_ = sck.Close()
+		return nil, err
+	}
+	if err := sck.Bind(canInterface); err != nil {
+		_ = sck.Close()
+		return nil, errors.Wrapf(err, "could not bind capture socket to %s", canInterface)
+	}
+	return sck, nil
+}
+
+// Check starts the next job in the background if nothing is running and its triggers are met, or resumes a pending upload.
+func (c *CANCaptureRunner) Check(conditions CaptureConditions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.busy || len(c.jobs) == 0 {
+		return
+	}
+	job, ok := c.nextJob(conditions, time.Now())
+	if !ok {
+		return
+	}
+	c.busy = true
+	c.running.Add(1)
+	go func() {
+		defer c.running.Done()
+		c.run(job)
+		c.mu.Lock()
+		c.busy = false
+		c.mu.Unlock()
+	}()
+}
+
+// Wait for the running job, if any, up to timeout. false if it is still running.
+func (c *CANCaptureRunner) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		c.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// nextJob picks the first job with an unfinished upload, or the first pending job whose triggers are met.
+// Expired or invalid jobs are marked as such along the way. Must hold the lock.
+func (c *CANCaptureRunner) nextJob(conditions CaptureConditions, now time.Time) (models.CANCaptureJob, bool) {
+	for _, job := range c.jobs {
+		if c.state.Jobs[job.ID].Status == models.CANCaptureUploading {
+			// don't start new captures until the pending upload is done
+			return job, now.After(c.retryUploadAt)
+		}
+	}
+	if conditions.LowPower {
+		return models.CANCaptureJob{}, false
+	}
+	for _, job := range c.jobs {
+		st := c.state.Jobs[job.ID]
+		if st.Status != "" && st.Status != models.CANCapturePending {
+			continue
+		}
+		if job.DurationSecs <= 0 && job.MaxFrames <= 0 {
+			c.setState(job.ID, models.CANCaptureJobState{Status: models.CANCaptureFailed, Error: "duration_secs or max_frames is required"})
+			continue
+		}
+		if !job.ExpiresAt.IsZero() && now.After(job.ExpiresAt) {
+			c.setState(job.ID, models.CANCaptureJobState{Status: models.CANCaptureExpired})
+			continue
+		}
+		if triggerMet(job.Trigger, conditions) {
+			return job, true
+		}
+	}
+	return models.CANCaptureJob{}, false
+}
+
+func triggerMet(t models.CANCaptureTrigger, conditions CaptureConditions) bool {
+	if t.EngineRunning && !conditions.EngineRunning {
+		return false
+	}
+	if t.SpeedAboveZero && conditions.Speed <= 0 {
+		return false
+	}
+	if t.MinVoltage > 0 && conditions.Voltage < t.MinVoltage {
+		return false
+	}
+	return true
+}
+
+// run records the job if it has not been yet, then uploads it
+func (c *CANCaptureRunner) run(job models.CANCaptureJob) {
+	c.mu.Lock()
+	st := c.state.Jobs[job.ID]
+	c.mu.Unlock()
+
+	if st.Status != models.CANCaptureUploading {
+		c.logger.Info().Msgf("starting can capture job %s", job.ID)
+		file, frames, err := c.capture(job)
+		if err != nil {
+			hooks.LogError(c.logger, err, fmt.Sprintf("failed can capture job %s", job.ID), hooks.WithThresholdWhenLogMqtt(1))
+			c.setStateLocked(job.ID, models.CANCaptureJobState{Status: models.CANCaptureFailed, Error: err.Error()})
+			return
+		}
+		c.logger.Info().Msgf("can capture job %s recorded %d frames to %s", job.ID, frames, file)
+		st = models.CANCaptureJobState{Status: models.CANCaptureUploading, File: file, Frames: frames}
+		c.setStateLocked(job.ID, st)
+	}
+	c.upload(job, st)
+}
+
+// upload sends the remaining chunks, saving progress so a failure resumes from the failed chunk on the next Check
+func (c *CANCaptureRunner) upload(job models.CANCaptureJob, st models.CANCaptureJobState) {
+	chunkSize := job.ChunkSizeBytes
+	if chunkSize <= 0 {
+		chunkSize = defaultCaptureChunkSize
+	}
+	next, err := network.SendCanDumpFile(c.dataSender, job.ID, st.File, captureFormat(job), chunkSize, st.NextChunk)
+	st.NextChunk = next
+	if err != nil {
+		st.Error = err.Error()
+		if errors.Is(err, os.ErrNotExist) {
+			// recording is gone, eg. storage was wiped, nothing to resume
+			st.Status = models.CANCaptureFailed
+		}
+		c.logger.Warn().Err(err).Msgf("can capture job %s upload stopped at chunk %d, will resume", job.ID, next)
+		c.mu.Lock()
+		c.retryUploadAt = time.Now().Add(captureUploadRetryAfter)
+		c.setState(job.ID, st)
+		c.mu.Unlock()
+		return
+	}
+	st.Status = models.CANCaptureDone
+	st.Error = ""
+	if errRm := os.Remove(st.File); errRm != nil {
+		c.logger.Warn().Err(errRm).Msgf("failed to remove uploaded can capture %s", st.File)
+	}
+	c.logger.Info().Msgf("can capture job %s uploaded in %d chunks", job.ID, next)
+	c.setStateLocked(job.ID, st)
+}
+
+// capture records raw frames until the duration, frame count or size is reached and returns the compressed file
+func (c *CANCaptureRunner) capture(job models.CANCaptureJob) (string, int, error) {
+	filters := make([]unix.CanFilter, 0, len(job.Filters))
+	for _, f := range job.Filters {
+		cf, err := canbus.ParseFilter(f)
+		if err != nil {
+			return "", 0, err
+		}
+		filters = append(filters, cf)
+	}
+	format, err := canbus.ParseLogFormat(captureFormat(job))
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return "", 0, errors.Wrap(err, "failed to create can capture dir")
+	}
+	sck, err := c.openSocket(filters)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "failed to open can socket")
+	}
+	defer sck.Close() //nolint
+
+	writer, err := canbus.NewRotatingLogWriter(filepath.Join(c.dir, job.ID), format, 0)
+	if err != nil {
+		return "", 0, err
+	}
+	duration := maxCaptureDuration
+	if job.DurationSecs > 0 {
+		duration = min(time.Duration(job.DurationSecs*float64(time.Second)), maxCaptureDuration)
+	}
+	deadline := time.Now().Add(duration)
+	maxBytes := int64(maxCaptureBytes)
+	if job.MaxBytes > 0 {
+		maxBytes = min(job.MaxBytes, maxCaptureBytes)
+	}
+	frames := 0
+	for (job.MaxFrames <= 0 || frames < job.MaxFrames) && time.Now().Before(deadline) && writer.Size() < maxBytes {
+		frame, err := sck.Recv()
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) {
+				continue
+			}
+			_ = writer.Close()
+			return "", frames, errors.Wrap(err, "failed to read frame")
+		}
+		if err := writer.Write(canbus.LogFrame{Timestamp: time.Now(), Interface: c.canInterface, Frame: frame}); err != nil {
+			_ = writer.Close()
+			return "", frames, err
+		}
+		frames++
+	}
+	if err := writer.Close(); err != nil {
+		return "", frames, err
+	}
+	file := writer.Files()[0]
+	if format == canbus.FormatBLF {
+		return file, frames, nil // already compressed
+	}
+	gz, err := gzipFile(file)
+	return gz, frames, err
+}
+
+// gzipFile compresses the file to file.gz and removes the original
+func gzipFile(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close() //nolint
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return "", err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if errC := zw.Close(); err == nil {
+		err = errC
+	}
+	if errC := dst.Close(); err == nil {
+		err = errC
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed to compress can capture")
+	}
+	_ = os.Remove(path)
+	return path + ".gz", nil
+}
+
+func captureFormat(job models.CANCaptureJob) string {
+	if job.Format == "" {
+		return string(canbus.FormatCandump)
+	}
+	return job.Format
+}
+
+// setState updates and persists the job state. Must hold the lock.
+func (c *CANCaptureRunner) setState(jobID string, st models.CANCaptureJobState) {
+	st.UpdatedAt = time.Now().UTC()
+	c.state.Jobs[jobID] = st
+	if err := c.lss.WriteCANCaptureState(c.state); err != nil {
+		c.logger.Err(err).Msg("failed to persist can capture state")
+	}
+}
+
+func (c *CANCaptureRunner) setStateLocked(jobID string, st models.CANCaptureJobState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setState(jobID, st)
+}
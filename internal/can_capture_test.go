@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/canbus"
+	mock_loggers "github.com/DIMO-Network/edge-network/internal/loggers/mocks"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	mock_network "github.com/DIMO-Network/edge-network/internal/network/mocks"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/sys/unix"
+)
+
+type fakeReceiver struct {
+	frames []canbus.Frame
+}
+
+func (f *fakeReceiver) Recv() (canbus.Frame, error) {
+	if len(f.frames) == 0 {
+		return canbus.Frame{}, unix.EAGAIN
+	}
+	fr := f.frames[0]
+	f.frames = f.frames[1:]
+	return fr, nil
+}
+
+func (f *fakeReceiver) Close() error { return nil }
+
+func TestCANCaptureRunner_nextJob(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	lss := mock_loggers.NewMockSettingsStore(mockCtrl)
+	lss.EXPECT().ReadCANCaptureState().Return(nil, errors.New("no file"))
+	lss.EXPECT().WriteCANCaptureState(gomock.Any()).AnyTimes().Return(nil)
+
+	now := time.Now()
+	jobs := []models.CANCaptureJob{
+		{ID: "expired", MaxFrames: 10, ExpiresAt: now.Add(-time.Hour)},
+		{ID: "invalid"},
+		{ID: "moving", DurationSecs: 60, Trigger: models.CANCaptureTrigger{EngineRunning: true, SpeedAboveZero: true, MinVoltage: 13}},
+	}
+	c := NewCANCaptureRunner(zerolog.Nop(), nil, lss, jobs, "vcan0")
+
+	_, ok := c.nextJob(CaptureConditions{Voltage: 13.8, EngineRunning: true}, now)
+	assert.False(t, ok, "not moving")
+	assert.Equal(t, models.CANCaptureExpired, c.state.Jobs["expired"].Status)
+	assert.Equal(t, models.CANCaptureFailed, c.state.Jobs["invalid"].Status)
+
+	_, ok = c.nextJob(CaptureConditions{Voltage: 12.4, EngineRunning: true, Speed: 20}, now)
+	assert.False(t, ok, "voltage too low")
+
+	job, ok := c.nextJob(CaptureConditions{Voltage: 13.8, EngineRunning: true, Speed: 20}, now)
+	require.True(t, ok)
+	assert.Equal(t, "moving", job.ID)
+
+	// a pending upload takes priority, but backs off after a failure
+	c.state.Jobs["moving"] = models.CANCaptureJobState{Status: models.CANCaptureUploading}
+	c.retryUploadAt = now.Add(time.Minute)
+	_, ok = c.nextJob(CaptureConditions{}, now)
+	assert.False(t, ok)
+	job, ok = c.nextJob(CaptureConditions{}, now.Add(2*time.Minute))
+	require.True(t, ok)
+	assert.Equal(t, "moving", job.ID)
+}
+
+func TestCANCaptureRunner_run_ResumesUpload(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	lss := mock_loggers.NewMockSettingsStore(mockCtrl)
+	ds := mock_network.NewMockDataSender(mockCtrl)
+	lss.EXPECT().ReadCANCaptureState().Return(&models.CANCaptureState{}, nil)
+	var persisted models.CANCaptureState
+	lss.EXPECT().WriteCANCaptureState(gomock.Any()).AnyTimes().DoAndReturn(func(s models.CANCaptureState) error {
+		persisted = s
+		return nil
+	})
+
+	job := models.CANCaptureJob{ID: "job1", MaxFrames: 3, Filters: []string{"120", "7E0:7F0"}, ChunkSizeBytes: 32}
+	c := NewCANCaptureRunner(zerolog.Nop(), ds, lss, []models.CANCaptureJob{job}, "vcan0")
+	c.dir = t.TempDir()
+	c.openSocket = func(filters []unix.CanFilter) (frameReceiver, error) {
+		assert.Len(t, filters, 2)
+		return &fakeReceiver{frames: []canbus.Frame{
+			{ID: 0x120, Data: []byte{0, 0, 0x10, 0, 0}, Kind: canbus.SFF},
+			{ID: 0x7e8, Data: []byte{0x04, 0x41, 0x0c, 0x0c, 0x80}, Kind: canbus.SFF},
+			{ID: 0x120, Data: []byte{0, 0, 0x10, 0, 1}, Kind: canbus.SFF},
+		}}, nil
+	}
+
+	var chunks []models.CanDumpFileChunk
+	collect := func(data json.RawMessage) error {
+		chunk := models.CanDumpFileChunk{}
+		require.NoError(t, json.Unmarshal(data, &chunk))
+		chunks = append(chunks, chunk)
+		return nil
+	}
+	// connection drops after the first chunk
+	ds.EXPECT().SendCanDumpData(gomock.Any()).DoAndReturn(collect)
+	ds.EXPECT().SendCanDumpData(gomock.Any()).Return(errors.New("not connected"))
+	c.run(job)
+
+	st := persisted.Jobs["job1"]
+	assert.Equal(t, models.CANCaptureUploading, st.Status)
+	assert.Equal(t, 1, st.NextChunk)
+	assert.Equal(t, 3, st.Frames)
+	require.FileExists(t, st.File)
+
+	// resumes from chunk 1 without recording again
+	ds.EXPECT().SendCanDumpData(gomock.Any()).AnyTimes().DoAndReturn(collect)
+	c.run(job)
+	st = persisted.Jobs["job1"]
+	assert.Equal(t, models.CANCaptureDone, st.Status)
+	assert.NoFileExists(t, st.File)
+
+	var gz []byte
+	for i, chunk := range chunks {
+		assert.Equal(t, i, chunk.Chunk)
+		assert.Equal(t, "job1.0.log.gz", chunk.FileName)
+		gz = append(gz, chunk.Data...)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(gz))
+	require.NoError(t, err)
+	raw, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	frames, err := canbus.ReadCandumpLog(bytes.NewReader(raw))
+	require.NoError(t, err)
+	require.Len(t, frames, 3)
+	assert.Equal(t, uint32(0x7e8), frames[1].Frame.ID)
+	assert.Equal(t, "vcan0", frames[1].Interface)
+}
+
+func TestSignalsQueue_LatestFloat(t *testing.T) {
+	sq := &SignalsQueue{lastTimeChecked: make(map[string]time.Time), failureCount: make(map[string]int), signals: make(map[string][]models.SignalData)}
+	sq.Enqueue(models.SignalData{Name: "speed", Value: 42.0, Timestamp: time.Now().UnixMilli()})
+	sq.Enqueue(models.SignalData{Name: "rpm", Value: 800.0, Timestamp: time.Now().Add(-2 * time.Minute).UnixMilli()})
+	sq.Dequeue()
+
+	speed, ok := sq.LatestFloat("speed", time.Minute)
+	assert.True(t, ok)
+	assert.Equal(t, 42.0, speed)
+	_, ok = sq.LatestFloat("rpm", time.Minute)
+	assert.False(t, ok, "too old")
+	_, ok = sq.LatestFloat("nope", time.Minute)
+	assert.False(t, ok)
+}
+
+func TestCANCaptureRunner_Wait(t *testing.T) {
+	lss := mock_loggers.NewMockSettingsStore(gomock.NewController(t))
+	lss.EXPECT().ReadCANCaptureState().Return(nil, errors.New("no file"))
+	c := NewCANCaptureRunner(zerolog.Nop(), nil, lss, nil, "vcan0")
+	assert.True(t, c.Wait(time.Millisecond), "idle")
+
+	c.running.Add(1)
+	assert.False(t, c.Wait(10*time.Millisecond), "capture in progress")
+	c.running.Done()
+	assert.True(t, c.Wait(time.Second))
+}
+
+func TestCANCaptureRunner_capture_MaxBytes(t *testing.T) {
+	lss := mock_loggers.NewMockSettingsStore(gomock.NewController(t))
+	lss.EXPECT().ReadCANCaptureState().Return(nil, errors.New("no file"))
+	c := NewCANCaptureRunner(zerolog.Nop(), nil, lss, nil, "vcan0")
+	c.dir = t.TempDir()
+	frames := make([]canbus.Frame, 1000)
+	for i := range frames {
+		frames[i] = canbus.Frame{ID: 0x120, Data: []byte{0, 0, 0x10, 0, byte(i)}, Kind: canbus.SFF}
+	}
+	c.openSocket = func(_ []unix.CanFilter) (frameReceiver, error) {
+		return &fakeReceiver{frames: frames}, nil
+	}
+
+	// the log is buffered in 4KB blocks, so it stops at the first flush
+	_, recorded, err := c.capture(models.CANCaptureJob{ID: "big", DurationSecs: 5, MaxBytes: 1024})
+	require.NoError(t, err)
+	assert.Greater(t, recorded, 0)
+	assert.Less(t, recorded, len(frames))
+}
@@ -0,0 +1,165 @@
+package canbus
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// blf layout per the Vector binlog spec, same as what python-can writes so cantools, SavvyCAN and CANalyzer can open it.
+// A fixed 144 byte file header, followed by LOBJ containers holding zlib compressed CAN_MESSAGE objects.
+const (
+	blfFileHeaderSize   = 144
+	blfObjHeaderBase    = 16
+	blfObjHeaderV1      = 16
+	blfContainerHeader  = 16
+	blfCANMessageSize   = 16
+	blfObjTypeCANMsg    = 1
+	blfObjTypeContainer = 10
+	blfCompressionZlib  = 2
+	blfTimeOneNanos     = 2
+	blfCANMsgRTR        = 0x80
+	blfExtendedID       = 0x80000000
+	// max uncompressed bytes per container
+	blfContainerMax = 128 * 1024
+)
+
+type blfWriter struct {
+	w                io.WriteSeeker
+	buf              bytes.Buffer
+	start            time.Time
+	last             time.Time
+	fileSize         uint64
+	uncompressedSize uint64
+	count            uint32
+}
+
+func newBLFWriter(w io.WriteSeeker) (*blfWriter, error) {
+	b := &blfWriter{w: w, fileSize: blfFileHeaderSize, uncompressedSize: blfFileHeaderSize}
+	// placeholder, rewritten on Close once sizes and the stop time are known
+	if err := b.writeFileHeader(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *blfWriter) Write(lf LogFrame) error {
+	if b.start.IsZero() {
+		b.start = lf.Timestamp
+	}
+	b.last = lf.Timestamp
+
+	id := lf.Frame.ID
+	if lf.Frame.Kind == EFF || lf.Frame.Kind == ERTR || id > 0x7ff {
+		id |= blfExtendedID
+	}
+	var flags uint8
+	if lf.Frame.Kind == RTR || lf.Frame.Kind == ERTR {
+		flags |= blfCANMsgRTR
+	}
+	var data [8]byte
+	copy(data[:], lf.Frame.Data)
+
+	le := binary.LittleEndian
+	obj := make([]byte, blfObjHeaderBase+blfObjHeaderV1+blfCANMessageSize)
+	copy(obj[0:4], "LOBJ")
+	le.PutUint16(obj[4:], blfObjHeaderBase+blfObjHeaderV1)
+	le.PutUint16(obj[6:], 1) // header version
+	le.PutUint32(obj[8:], uint32(len(obj)))
+	le.PutUint32(obj[12:], blfObjTypeCANMsg)
+	le.PutUint32(obj[16:], blfTimeOneNanos)
+	le.PutUint16(obj[20:], 0) // client index
+	le.PutUint16(obj[22:], 0) // object version
+	le.PutUint64(obj[24:], uint64(lf.Timestamp.Sub(b.start).Nanoseconds()))
+	le.PutUint16(obj[32:], 1) // channel
+	obj[34] = flags
+	obj[35] = uint8(len(lf.Frame.Data))
+	le.PutUint32(obj[36:], id)
+	copy(obj[40:], data[:])
+
+	b.buf.Write(obj)
+	b.count++
+	if b.buf.Len() >= blfContainerMax {
+		return b.flush()
+	}
+	return nil
+}
+
+// flush compresses the buffered objects into a container
+func (b *blfWriter) flush() error {
+	if b.buf.Len() == 0 {
+		return nil
+	}
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(b.buf.Bytes()); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	le := binary.LittleEndian
+	hdr := make([]byte, blfObjHeaderBase+blfContainerHeader)
+	copy(hdr[0:4], "LOBJ")
+	le.PutUint16(hdr[4:], blfObjHeaderBase)
+	le.PutUint16(hdr[6:], 1)
+	le.PutUint32(hdr[8:], uint32(len(hdr)+compressed.Len()))
+	le.PutUint32(hdr[12:], blfObjTypeContainer)
+	le.PutUint16(hdr[16:], blfCompressionZlib)
+	le.PutUint32(hdr[24:], uint32(b.buf.Len()))
+
+	// objects are 4 byte aligned
+	padding := make([]byte, compressed.Len()%4)
+	for _, p := range [][]byte{hdr, compressed.Bytes(), padding} {
+		if _, err := b.w.Write(p); err != nil {
+			return err
+		}
+	}
+	b.fileSize += uint64(len(hdr) + compressed.Len() + len(padding))
+	b.uncompressedSize += uint64(len(hdr) + b.buf.Len())
+	b.buf.Reset()
+	return nil
+}
+
+func (b *blfWriter) Close() error {
+	if err := b.flush(); err != nil {
+		return err
+	}
+	if _, err := b.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := b.writeFileHeader(); err != nil {
+		return err
+	}
+	_, err := b.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (b *blfWriter) writeFileHeader() error {
+	le := binary.LittleEndian
+	hdr := make([]byte, blfFileHeaderSize)
+	copy(hdr[0:4], "LOGG")
+	le.PutUint32(hdr[4:], blfFileHeaderSize)
+	// application id and versions (8 bytes) left empty
+	le.PutUint64(hdr[16:], b.fileSize)
+	le.PutUint64(hdr[24:], b.uncompressedSize)
+	le.PutUint32(hdr[32:], b.count)
+	putSystemTime(hdr[40:56], b.start)
+	putSystemTime(hdr[56:72], b.last)
+	_, err := b.w.Write(hdr)
+	return err
+}
+
+// putSystemTime writes a windows SYSTEMTIME struct, which is what blf uses for the measurement start and stop
+func putSystemTime(dst []byte, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	le := binary.LittleEndian
+	for i, v := range []int{t.Year(), int(t.Month()), int(t.Weekday()), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond() / 1e6} {
+		le.PutUint16(dst[i*2:], uint16(v))
+	}
+}
@@ -0,0 +1,91 @@
+package canbus
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultInterface is the can interface on the autopi
+const DefaultInterface = "can0"
+
+// LogFrame is a frame read from or written to a candump -l log file, eg. `(1436509052.249713) vcan0 044#2A366C2BBA`
+type LogFrame struct {
+	Timestamp time.Time
+	Interface string
+	Frame     Frame
+}
+
+// ParseCandumpLine parses a single line in the linux candump log format.
+// Supports standard and extended ids, and remote transmission requests (`123#R`).
+func ParseCandumpLine(line string) (LogFrame, error) {
+	lf := LogFrame{}
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return lf, fmt.Errorf("invalid candump line, expected 3 fields: %s", line)
+	}
+	ts := strings.Trim(fields[0], "()")
+	secs, frac, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return lf, fmt.Errorf("invalid candump timestamp: %s", fields[0])
+	}
+	var nanos int64
+	if frac != "" {
+		frac = (frac + "000000000")[:9]
+		nanos, err = strconv.ParseInt(frac, 10, 64)
+		if err != nil {
+			return lf, fmt.Errorf("invalid candump timestamp: %s", fields[0])
+		}
+	}
+	lf.Timestamp = time.Unix(s, nanos).UTC()
+	lf.Interface = fields[1]
+
+	idStr, dataStr, ok := strings.Cut(fields[2], "#")
+	if !ok {
+		return lf, fmt.Errorf("invalid candump frame: %s", fields[2])
+	}
+	if strings.HasPrefix(dataStr, "#") {
+		return lf, fmt.Errorf("can fd frames are not supported: %s", fields[2])
+	}
+	id, err := strconv.ParseUint(idStr, 16, 32)
+	if err != nil {
+		return lf, fmt.Errorf("invalid candump frame id: %s", idStr)
+	}
+	lf.Frame.ID = uint32(id)
+	lf.Frame.Kind = SFF
+	if len(idStr) > 3 {
+		lf.Frame.Kind = EFF
+	}
+	if strings.HasPrefix(strings.ToUpper(dataStr), "R") {
+		lf.Frame.Kind = RTR
+		if len(idStr) > 3 {
+			lf.Frame.Kind = ERTR
+		}
+		return lf, nil
+	}
+	data, err := hex.DecodeString(dataStr)
+	if err != nil {
+		return lf, fmt.Errorf("invalid candump frame data: %s", dataStr)
+	}
+	if len(data) > 8 {
+		return lf, errDataTooBig
+	}
+	lf.Frame.Data = data
+	return lf, nil
+}
+
+// FormatCandumpLine writes the frame in the candump -l log format, the inverse of ParseCandumpLine
+func FormatCandumpLine(lf LogFrame) string {
+	id := fmt.Sprintf("%03X", lf.Frame.ID)
+	if lf.Frame.Kind == EFF || lf.Frame.Kind == ERTR || lf.Frame.ID > 0x7ff {
+		id = fmt.Sprintf("%08X", lf.Frame.ID)
+	}
+	data := strings.ToUpper(hex.EncodeToString(lf.Frame.Data))
+	if lf.Frame.Kind == RTR || lf.Frame.Kind == ERTR {
+		data = "R"
+	}
+	return fmt.Sprintf("(%d.%06d) %s %s#%s", lf.Timestamp.Unix(), lf.Timestamp.Nanosecond()/1000, lf.Interface, id, data)
+}
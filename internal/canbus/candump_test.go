@@ -0,0 +1,89 @@
+package canbus
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCandumpLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    LogFrame
+		wantErr bool
+	}{
+		{
+			name: "standard frame",
+			line: "(1436509052.249713) vcan0 044#2A366C2BBA",
+			want: LogFrame{Timestamp: time.Unix(1436509052, 249713000).UTC(), Interface: "vcan0",
+				Frame: Frame{ID: 0x44, Data: []byte{0x2a, 0x36, 0x6c, 0x2b, 0xba}, Kind: SFF}},
+		},
+		{
+			name: "extended frame",
+			line: "(1436509052.5) can0 18DAF110#0441000000",
+			want: LogFrame{Timestamp: time.Unix(1436509052, 500000000).UTC(), Interface: "can0",
+				Frame: Frame{ID: 0x18daf110, Data: []byte{0x04, 0x41, 0x00, 0x00, 0x00}, Kind: EFF}},
+		},
+		{
+			name: "remote transmission request",
+			line: "(1436509052.000001) vcan0 123#R",
+			want: LogFrame{Timestamp: time.Unix(1436509052, 1000).UTC(), Interface: "vcan0",
+				Frame: Frame{ID: 0x123, Kind: RTR}},
+		},
+		{
+			name: "extended remote transmission request",
+			line: "(1436509052.000001) vcan0 18DB33F1#R",
+			want: LogFrame{Timestamp: time.Unix(1436509052, 1000).UTC(), Interface: "vcan0",
+				Frame: Frame{ID: 0x18db33f1, Kind: ERTR}},
+		},
+		{name: "can fd not supported", line: "(1436509052.249713) vcan0 044##12A36", wantErr: true},
+		{name: "too much data", line: "(1436509052.249713) vcan0 044#001122334455667788", wantErr: true},
+		{name: "missing fields", line: "vcan0 044#2A", wantErr: true},
+		{name: "bad id", line: "(1436509052.249713) vcan0 XYZ#2A", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCandumpLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFormatCandumpLine_RoundTrip(t *testing.T) {
+	lines := []string{
+		"(1436509052.249713) vcan0 044#2A366C2BBA",
+		"(1436509052.500000) can0 18DAF110#0441000000",
+		"(1436509052.000001) vcan0 123#R",
+		"(1436509052.000001) vcan0 00000123#R",
+	}
+	for _, line := range lines {
+		lf, err := ParseCandumpLine(line)
+		require.NoError(t, err)
+		assert.Equal(t, line, FormatCandumpLine(lf))
+	}
+}
+
+func TestReadCandumpLog(t *testing.T) {
+	log := `# recorded on a 2019 chevy
+(1436509052.249713) vcan0 120#0000100000
+
+(1436509052.349713) vcan0 7E8#04410C0C80
+`
+	frames, err := ReadCandumpLog(strings.NewReader(log))
+	require.NoError(t, err)
+	require.Len(t, frames, 2)
+	assert.Equal(t, uint32(0x120), frames[0].Frame.ID)
+	assert.Equal(t, 100*time.Millisecond, frames[1].Timestamp.Sub(frames[0].Timestamp))
+
+	_, err = ReadCandumpLog(strings.NewReader("(1436509052.249713) vcan0 120#zz"))
+	assert.ErrorContains(t, err, "line 1")
+}
@@ -0,0 +1,49 @@
+package canbus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ParseFilter parses a filter in the candump syntax, ids and masks in hex:
+//
+//	<id>         exact match, eg. 7E8
+//	<id>:<mask>  match when received_id & mask == id & mask, eg. 7E0:7F0 for all 7E? ids
+//	<id>~<mask>  inverted, match when received_id & mask != id & mask
+//
+// Ids with more than 3 hex characters are extended (29bit) ids, and only match extended frames. Otherwise only standard frames match.
+func ParseFilter(s string) (unix.CanFilter, error) {
+	f := unix.CanFilter{}
+	s = strings.TrimSpace(s)
+	idStr, maskStr, inverted := s, "", false
+	if i := strings.IndexAny(s, ":~"); i >= 0 {
+		idStr, maskStr, inverted = s[:i], s[i+1:], s[i] == '~'
+	}
+	id, err := strconv.ParseUint(idStr, 16, 32)
+	if err != nil || idStr == "" {
+		return f, fmt.Errorf("invalid can filter id: %s", s)
+	}
+	extended := len(idStr) > 3 || id > unix.CAN_SFF_MASK
+	mask := uint64(unix.CAN_SFF_MASK)
+	if extended {
+		mask = unix.CAN_EFF_MASK
+	}
+	if maskStr != "" {
+		mask, err = strconv.ParseUint(maskStr, 16, 32)
+		if err != nil {
+			return f, fmt.Errorf("invalid can filter mask: %s", s)
+		}
+	}
+	f.Id = uint32(id)
+	f.Mask = uint32(mask) | unix.CAN_EFF_FLAG
+	if extended {
+		f.Id |= unix.CAN_EFF_FLAG
+	}
+	if inverted {
+		f.Id |= unix.CAN_INV_FILTER
+	}
+	return f, nil
+}
@@ -18,10 +18,11 @@ type Frame struct {
 type Kind uint8
 
 const (
-	SFF Kind = iota // Standard frame format
-	EFF             // Extended frame format
-	RTR             // Remote transmission request
-	ERR             // Error message frame
+	SFF  Kind = iota // Standard frame format
+	EFF              // Extended frame format
+	RTR              // Remote transmission request
+	ERR              // Error message frame
+	ERTR             // Remote transmission request with an extended id
 )
 
 const frameSize = unsafe.Sizeof(
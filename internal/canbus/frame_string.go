@@ -12,15 +12,16 @@ func _() {
 	_ = x[EFF-1]
 	_ = x[RTR-2]
 	_ = x[ERR-3]
+	_ = x[ERTR-4]
 }
 
-const _Kind_name = "SFFEFFRTRERR"
+const _Kind_name = "SFFEFFRTRERRERTR"
 
-var _Kind_index = [...]uint8{0, 3, 6, 9, 12}
+var _Kind_index = [...]uint8{0, 3, 6, 9, 12, 16}
 
 func (i Kind) String() string {
 	if i >= Kind(len(_Kind_index)-1) {
 		return "Kind(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
 	return _Kind_name[_Kind_index[i]:_Kind_index[i+1]]
-}
\ No newline at end of file
+}
@@ -0,0 +1,118 @@
+package canbus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// LogFormat is a can log file format readable by common tools like SavvyCAN, cantools, python-can and CANalyzer
+type LogFormat string
+
+const (
+	// FormatCandump is the linux can-utils `candump -l` format
+	FormatCandump LogFormat = "candump"
+	// FormatASC is the Vector ascii log format
+	FormatASC LogFormat = "asc"
+	// FormatBLF is the Vector binary logging format
+	FormatBLF LogFormat = "blf"
+)
+
+// ParseLogFormat validates the format name, eg. from a command line flag
+func ParseLogFormat(s string) (LogFormat, error) {
+	switch f := LogFormat(strings.ToLower(s)); f {
+	case FormatCandump, FormatASC, FormatBLF:
+		return f, nil
+	}
+	return "", fmt.Errorf("unsupported can log format: %s", s)
+}
+
+// Extension is the file extension tools expect for the format
+func (f LogFormat) Extension() string {
+	if f == FormatCandump {
+		return "log"
+	}
+	return string(f)
+}
+
+// LogWriter writes can frames to a log file. Close flushes any buffered data but does not close the underlying writer.
+type LogWriter interface {
+	Write(lf LogFrame) error
+	Close() error
+}
+
+// NewLogWriter creates a writer for the format. BLF needs an io.WriteSeeker, eg. an *os.File, to finalize the file header.
+func NewLogWriter(format LogFormat, w io.Writer) (LogWriter, error) {
+	switch format {
+	case FormatCandump:
+		return &candumpWriter{w: bufio.NewWriter(w)}, nil
+	case FormatASC:
+		return &ascWriter{w: bufio.NewWriter(w)}, nil
+	case FormatBLF:
+		ws, ok := w.(io.WriteSeeker)
+		if !ok {
+			return nil, fmt.Errorf("blf format requires a seekable file")
+		}
+		return newBLFWriter(ws)
+	}
+	return nil, fmt.Errorf("unsupported can log format: %s", format)
+}
+
+type candumpWriter struct {
+	w *bufio.Writer
+}
+
+func (c *candumpWriter) Write(lf LogFrame) error {
+	_, err := c.w.WriteString(FormatCandumpLine(lf) + "\n")
+	return err
+}
+
+func (c *candumpWriter) Close() error {
+	return c.w.Flush()
+}
+
+// ascDateLayout is how CANalyzer writes the date header, eg. `Thu Oct 18 10:00:00.000 am 2026`
+const ascDateLayout = "Mon Jan 02 03:04:05.000 pm 2006"
+
+// ascWriter writes the Vector ascii format, timestamps are seconds relative to the date in the header
+type ascWriter struct {
+	w     *bufio.Writer
+	start time.Time
+}
+
+func (a *ascWriter) Write(lf LogFrame) error {
+	if a.start.IsZero() {
+		a.start = lf.Timestamp
+		date := a.start.Format(ascDateLayout)
+		header := fmt.Sprintf("date %s\nbase hex  timestamps absolute\nno internal events logged\n"+
+			"// version 9.0.0\nBegin Triggerblock %s\n   0.000000 Start of measurement\n", date, date)
+		if _, err := a.w.WriteString(header); err != nil {
+			return err
+		}
+	}
+	id := fmt.Sprintf("%X", lf.Frame.ID)
+	if lf.Frame.Kind == EFF || lf.Frame.Kind == ERTR || lf.Frame.ID > 0x7ff {
+		id += "x"
+	}
+	data := "d " + fmt.Sprintf("%X", len(lf.Frame.Data))
+	for _, b := range lf.Frame.Data {
+		data += fmt.Sprintf(" %02X", b)
+	}
+	if lf.Frame.Kind == RTR || lf.Frame.Kind == ERTR {
+		data = "r"
+	}
+	// channels are 1 based, we only ever log a single interface
+	_, err := fmt.Fprintf(a.w, "%11.6f 1  %-15s Rx   %s\n", lf.Timestamp.Sub(a.start).Seconds(), id, data)
+	return err
+}
+
+func (a *ascWriter) Close() error {
+	if !a.start.IsZero() {
+		if _, err := a.w.WriteString("End TriggerBlock\n"); err != nil {
+			return err
+		}
+	}
+	return a.w.Flush()
+}
@@ -0,0 +1,154 @@
+package canbus
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+var testLogFrames = []LogFrame{
+	{Timestamp: time.Date(2024, 2, 29, 17, 17, 30, 0, time.UTC), Interface: "can0",
+		Frame: Frame{ID: 0x120, Data: []byte{0x00, 0x00, 0x10, 0x00, 0x00}, Kind: SFF}},
+	{Timestamp: time.Date(2024, 2, 29, 17, 17, 30, 250000000, time.UTC), Interface: "can0",
+		Frame: Frame{ID: 0x18daf110, Data: []byte{0x04, 0x41, 0x0c, 0x0c, 0x80}, Kind: EFF}},
+}
+
+func writeAll(t *testing.T, format LogFormat, w io.Writer) {
+	lw, err := NewLogWriter(format, w)
+	require.NoError(t, err)
+	for _, lf := range testLogFrames {
+		require.NoError(t, lw.Write(lf))
+	}
+	require.NoError(t, lw.Close())
+}
+
+func TestLogWriter_Candump(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writeAll(t, FormatCandump, buf)
+
+	frames, err := ReadCandumpLog(buf)
+	require.NoError(t, err)
+	assert.Equal(t, testLogFrames, frames)
+}
+
+func TestLogWriter_ASC(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writeAll(t, FormatASC, buf)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, "date Thu Feb 29 05:17:30.000 pm 2024", lines[0])
+	assert.Equal(t, "base hex  timestamps absolute", lines[1])
+	assert.Equal(t, "   0.000000 1  120             Rx   d 5 00 00 10 00 00", lines[6])
+	assert.Equal(t, "   0.250000 1  18DAF110x       Rx   d 5 04 41 0C 0C 80", lines[7])
+	assert.Equal(t, "End TriggerBlock", lines[8])
+}
+
+func TestLogWriter_BLF(t *testing.T) {
+	_, err := NewLogWriter(FormatBLF, &bytes.Buffer{})
+	assert.Error(t, err, "blf needs a seekable writer")
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "dump.blf"))
+	require.NoError(t, err)
+	defer f.Close() //nolint
+	writeAll(t, FormatBLF, f)
+
+	raw, err := os.ReadFile(f.Name())
+	require.NoError(t, err)
+	le := binary.LittleEndian
+	require.Equal(t, "LOGG", string(raw[0:4]))
+	assert.Equal(t, uint64(len(raw)), le.Uint64(raw[16:]), "file size in header")
+	assert.Equal(t, uint32(2), le.Uint32(raw[32:]), "object count")
+	assert.Equal(t, uint16(2024), le.Uint16(raw[40:]), "start year")
+
+	// a single zlib container with both can messages
+	container := raw[blfFileHeaderSize:]
+	require.Equal(t, "LOBJ", string(container[0:4]))
+	assert.Equal(t, uint32(blfObjTypeContainer), le.Uint32(container[12:]))
+	objSize := le.Uint32(container[8:])
+	zr, err := zlib.NewReader(bytes.NewReader(container[32:objSize]))
+	require.NoError(t, err)
+	objects, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	require.Len(t, objects, 2*48)
+
+	second := objects[48:]
+	assert.Equal(t, "LOBJ", string(second[0:4]))
+	assert.Equal(t, uint32(blfObjTypeCANMsg), le.Uint32(second[12:]))
+	assert.Equal(t, uint64(250*time.Millisecond), le.Uint64(second[24:]), "relative timestamp in ns")
+	assert.Equal(t, uint8(5), second[35], "dlc")
+	assert.Equal(t, uint32(0x18daf110|blfExtendedID), le.Uint32(second[36:]))
+	assert.Equal(t, []byte{0x04, 0x41, 0x0c, 0x0c, 0x80, 0, 0, 0}, second[40:48])
+}
+
+func TestRotatingLogWriter(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "dump")
+	// bufio flushes every 4KB, so rotate on that boundary
+	w, err := NewRotatingLogWriter(base, FormatCandump, 4096)
+	require.NoError(t, err)
+	lf := testLogFrames[0]
+	for i := 0; i < 300; i++ {
+		lf.Timestamp = lf.Timestamp.Add(time.Millisecond)
+		require.NoError(t, w.Write(lf))
+	}
+	require.NoError(t, w.Close())
+
+	files := w.Files()
+	require.Greater(t, len(files), 1)
+	var size int64
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		require.NoError(t, err)
+		size += fi.Size()
+	}
+	assert.Equal(t, size, w.Size())
+	assert.Equal(t, base+".0.log", files[0])
+	total := 0
+	for _, file := range files {
+		f, err := os.Open(file)
+		require.NoError(t, err)
+		frames, err := ReadCandumpLog(f)
+		_ = f.Close()
+		require.NoError(t, err)
+		total += len(frames)
+	}
+	assert.Equal(t, 300, total)
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter   string
+		wantID   uint32
+		wantMask uint32
+		wantErr  bool
+	}{
+		{filter: "7E8", wantID: 0x7e8, wantMask: unix.CAN_SFF_MASK | unix.CAN_EFF_FLAG},
+		{filter: "7E0:7F0", wantID: 0x7e0, wantMask: 0x7f0 | unix.CAN_EFF_FLAG},
+		{filter: "18DAF110", wantID: 0x18daf110 | unix.CAN_EFF_FLAG, wantMask: unix.CAN_EFF_MASK | unix.CAN_EFF_FLAG},
+		{filter: "7DF~7FF", wantID: 0x7df | unix.CAN_INV_FILTER, wantMask: 0x7ff | unix.CAN_EFF_FLAG},
+		{filter: "xyz", wantErr: true},
+		{filter: "7E0:zz", wantErr: true},
+		{filter: ":7FF", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			got, err := ParseFilter(tt.filter)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantID, got.Id)
+			assert.Equal(t, tt.wantMask, got.Mask)
+		})
+	}
+}
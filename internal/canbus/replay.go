@@ -0,0 +1,60 @@
+package canbus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ReadCandumpLog reads all frames from a candump -l formatted log. Blank lines and lines starting with # are ignored.
+func ReadCandumpLog(r io.Reader) ([]LogFrame, error) {
+	var frames []LogFrame
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		lf, err := ParseCandumpLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		frames = append(frames, lf)
+	}
+	return frames, scanner.Err()
+}
+
+// Replay sends the frames on the socket keeping the original inter-frame timing, divided by speed.
+// A speed of 0 sends as fast as possible. Stops early if stop is closed.
+func Replay(sck *Socket, frames []LogFrame, speed float64, stop <-chan struct{}) error {
+	if len(frames) == 0 {
+		return nil
+	}
+	first := frames[0].Timestamp
+	start := time.Now()
+	for i, lf := range frames {
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(lf.Timestamp.Sub(first)) / speed))
+			if wait := time.Until(due); wait > 0 {
+				select {
+				case <-stop:
+					return nil
+				case <-time.After(wait):
+				}
+			}
+		}
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		if _, err := sck.Send(lf.Frame); err != nil {
+			return fmt.Errorf("failed to send frame %d (%s): %w", i, FormatCandumpLine(lf), err)
+		}
+	}
+	return nil
+}
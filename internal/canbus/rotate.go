@@ -0,0 +1,102 @@
+package canbus
+
+import (
+	"fmt"
+	"os"
+)
+
+// RotatingLogWriter writes can frames to numbered files, eg. dump.0.log, dump.1.log, starting a new file once maxBytes is reached.
+// BLF files are compressed in large blocks, so they rotate on block boundaries and may overshoot maxBytes.
+type RotatingLogWriter struct {
+	basePath string
+	format   LogFormat
+	maxBytes int64
+	files    []string
+	file     *os.File
+	counter  *countingFile
+	writer   LogWriter
+	// written to the files already rotated
+	written int64
+}
+
+// NewRotatingLogWriter creates the first file. A maxBytes of 0 disables rotation.
+func NewRotatingLogWriter(basePath string, format LogFormat, maxBytes int64) (*RotatingLogWriter, error) {
+	r := &RotatingLogWriter{basePath: basePath, format: format, maxBytes: maxBytes}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingLogWriter) Write(lf LogFrame) error {
+	if err := r.writer.Write(lf); err != nil {
+		return err
+	}
+	if r.maxBytes > 0 && r.counter.n >= r.maxBytes {
+		if err := r.closeCurrent(); err != nil {
+			return err
+		}
+		return r.open()
+	}
+	return nil
+}
+
+// Close flushes and closes the current file
+func (r *RotatingLogWriter) Close() error {
+	return r.closeCurrent()
+}
+
+// Size returns the bytes flushed to all files so far, buffered frames are not counted until flushed
+func (r *RotatingLogWriter) Size() int64 {
+	return r.written + r.counter.n
+}
+
+// Files returns the paths of all files written so far, in order
+func (r *RotatingLogWriter) Files() []string {
+	return r.files
+}
+
+func (r *RotatingLogWriter) open() error {
+	path := fmt.Sprintf("%s.%d.%s", r.basePath, len(r.files), r.format.Extension())
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create can log file: %w", err)
+	}
+	r.counter = &countingFile{File: f}
+	w, err := NewLogWriter(r.format, r.counter)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r.file = f
+	r.writer = w
+	r.files = append(r.files, path)
+	return nil
+}
+
+func (r *RotatingLogWriter) closeCurrent() error {
+	if r.file == nil {
+		return nil
+	}
+	errW := r.writer.Close()
+	errF := r.file.Close()
+	r.file = nil
+	r.written += r.counter.n
+	r.counter = &countingFile{}
+	if errW != nil {
+		return errW
+	}
+	return errF
+}
+
+// countingFile tracks bytes written, buffered writers only report once flushed
+type countingFile struct {
+	*os.File
+	n int64
+}
+
+func (c *countingFile) Write(p []byte) (int, error) {
+	n, err := c.File.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"time"
 
 	unix "golang.org/x/sys/unix"
 )
@@ -55,6 +56,16 @@ func (sck *Socket) SetFilters(filters []unix.CanFilter) error {
 	return nil
 }
 
+// SetRecvTimeout sets the SO_RCVTIMEO option so Recv returns unix.EAGAIN when no frame arrives within d.
+// Useful to periodically check for shutdown, since closing the socket does not unblock a pending Recv.
+func (sck *Socket) SetRecvTimeout(d time.Duration) error {
+	tv := unix.NsecToTimeval(d.Nanoseconds())
+	if err := unix.SetsockoptTimeval(sck.dev.fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		return fmt.Errorf("could not set recv timeout: %w", err)
+	}
+	return nil
+}
+
 // Close closes the CAN bus socket.
 func (sck *Socket) Close() error {
 	return unix.Close(sck.dev.fd)
@@ -92,6 +103,9 @@ func (sck *Socket) Send(msg Frame) (int, error) {
 	case RTR:
 		msg.ID &= unix.CAN_EFF_MASK
 		msg.ID |= unix.CAN_RTR_FLAG
+	case ERTR:
+		msg.ID &= unix.CAN_EFF_MASK
+		msg.ID |= unix.CAN_EFF_FLAG | unix.CAN_RTR_FLAG
 	case ERR:
 		msg.ID &= unix.CAN_ERR_MASK
 		msg.ID |= unix.CAN_ERR_FLAG
@@ -121,6 +135,9 @@ func (sck *Socket) Recv() (msg Frame, err error) {
 	switch {
 	case msg.ID&unix.CAN_EFF_FLAG != 0:
 		msg.Kind = EFF
+		if msg.ID&unix.CAN_RTR_FLAG != 0 {
+			msg.Kind = ERTR
+		}
 		msg.ID &= unix.CAN_EFF_MASK
 	case msg.ID&unix.CAN_ERR_FLAG != 0:
 		msg.Kind = ERR
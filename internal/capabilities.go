@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/DIMO-Network/edge-network/commands"
+	"github.com/DIMO-Network/edge-network/internal/loggers"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/network"
+	"github.com/DIMO-Network/edge-network/internal/util"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// functional request headers and the autopi protocol for each bus type, 11 bit is tried first
+var capabilityBuses = []struct {
+	header   uint32
+	protocol string
+	extended bool
+}{
+	{header: 0x7df, protocol: "6"},
+	{header: 0x18db33f1, protocol: "7", extended: true},
+}
+
+// CapabilityScanner learns which mode 01 and 09 pids each ecu supports from the supported pid bitmaps, and which of
+// the configured uds dids each answers. The result is sent once and cached until the device is moved to another vehicle.
+type CapabilityScanner struct {
+	logger     zerolog.Logger
+	lss        loggers.SettingsStore
+	dataSender network.DataSender
+	dids       []uint32
+	query      func(request models.PIDRequest) ([]string, error)
+	mu         sync.Mutex
+	cached     *models.VehicleCapabilities
+}
+
+func NewCapabilityScanner(logger zerolog.Logger, unitID uuid.UUID, lss loggers.SettingsStore, dataSender network.DataSender,
+	settings models.CapabilityScanSettings) *CapabilityScanner {
+	return newCapabilityScanner(logger, lss, dataSender, settings, func(request models.PIDRequest) ([]string, error) {
+		resp, _, err := commands.RequestPIDRaw(&logger, unitID, request)
+		if err != nil {
+			return nil, err
+		}
+		if !resp.IsHex {
+			return nil, fmt.Errorf("unexpected response: %v", resp.Value)
+		}
+		return resp.ValueHex, nil
+	})
+}
+
+func newCapabilityScanner(logger zerolog.Logger, lss loggers.SettingsStore, dataSender network.DataSender,
+	settings models.CapabilityScanSettings, query func(request models.PIDRequest) ([]string, error)) *CapabilityScanner {
+	cs := &CapabilityScanner{logger: logger, lss: lss, dataSender: dataSender, query: query}
+	for _, did := range settings.DIDs {
+		d, err := util.HexToDecimal(did)
+		if err != nil {
+			logger.Err(err).Msgf("invalid did in capability scan settings: %s", did)
+			continue
+		}
+		cs.dids = append(cs.dids, d)
+	}
+	if cached, err := lss.ReadCapabilities(); err == nil && cached != nil {
+		cs.cached = cached
+	}
+	return cs
+}
+
+// Cached the capabilities from a previous scan of this vehicle, nil if it wasn't scanned yet
+func (cs *CapabilityScanner) Cached() *models.VehicleCapabilities {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.cached
+}
+
+// Reset forgets the capabilities of the previous vehicle, after the device was moved to another one
+func (cs *CapabilityScanner) Reset() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.cached = nil
+}
+
+// Scan queries the bitmaps on the first bus any ecu answers on, probes the dids on each ecu found, then sends and
+// caches the result. Only call while it is ok to query obd.
+func (cs *CapabilityScanner) Scan() (*models.VehicleCapabilities, error) {
+	for _, bus := range capabilityBuses {
+		ecus := map[string]*models.ECUCapabilities{}
+		cs.scanBitmaps(0x01, bus.header, bus.protocol, bus.extended, ecus)
+		if len(ecus) == 0 {
+			continue
+		}
+		cs.scanBitmaps(0x09, bus.header, bus.protocol, bus.extended, ecus)
+		capabilities := &models.VehicleCapabilities{}
+		for _, header := range slices.Sorted(maps.Keys(ecus)) {
+			ecu := ecus[header]
+			cs.probeDIDs(ecu, bus.protocol, bus.extended)
+			capabilities.ECUs = append(capabilities.ECUs, *ecu)
+		}
+		cs.logger.Info().Msgf("capability scan found %d ecus", len(capabilities.ECUs))
+		if err := cs.dataSender.SendCapabilities(*capabilities); err != nil {
+			return nil, errors.Wrap(err, "failed to send capabilities")
+		}
+		if err := cs.lss.WriteCapabilities(*capabilities); err != nil {
+			cs.logger.Err(err).Msg("failed to cache capabilities")
+		}
+		cs.mu.Lock()
+		cs.cached = capabilities
+		cs.mu.Unlock()
+		return capabilities, nil
+	}
+	return nil, fmt.Errorf("no ecu answered the supported pids request")
+}
+
+// scanBitmaps follows the supported pid bitmaps of the mode, 00, 20, 40... while any ecu reports the next one supported
+func (cs *CapabilityScanner) scanBitmaps(mode uint32, header uint32, protocol string, extended bool, ecus map[string]*models.ECUCapabilities) {
+	for pid := uint32(0); pid <= 0xe0; pid += 0x20 {
+		frames, err := cs.query(models.PIDRequest{Name: "capabilities", Header: header, Mode: mode, Pid: pid, Protocol: protocol})
+		if err != nil {
+			return
+		}
+		next := false
+		for _, frame := range frames {
+			ecuHeader, data, err := parseResponseFrame(frame, extended)
+			// positive response: service + 0x40, the pid, 4 bytes of bitmap
+			if err != nil || len(data) < 6 || uint32(data[0]) != mode+0x40 || uint32(data[1]) != pid {
+				continue
+			}
+			ecu, ok := ecus[ecuHeader]
+			if !ok {
+				ecu = &models.ECUCapabilities{Header: ecuHeader}
+				ecus[ecuHeader] = ecu
+			}
+			for i := uint32(0); i < 32; i++ {
+				if data[2+i/8]&(0x80>>(i%8)) == 0 {
+					continue
+				}
+				supported := util.UintToHexStr(pid + i + 1)
+				if mode == 0x01 {
+					ecu.PIDs = appendUnique(ecu.PIDs, supported)
+				} else {
+					ecu.VehicleInfoPIDs = appendUnique(ecu.VehicleInfoPIDs, supported)
+				}
+				next = next || i == 31
+			}
+		}
+		if !next || mode != 0x01 {
+			return
+		}
+	}
+}
+
+// probeDIDs reads each did from the ecu with its physical request header
+func (cs *CapabilityScanner) probeDIDs(ecu *models.ECUCapabilities, protocol string, extended bool) {
+	responseHeader, err := util.HexToDecimal(ecu.Header)
+	if err != nil {
+		return
+	}
+	requestHeader := responseHeader - 8
+	if extended {
+		requestHeader = util.ForceFirstTwoBytesAndSwapLast(responseHeader)
+	}
+	for _, did := range cs.dids {
+		frames, err := cs.query(models.PIDRequest{Name: "capabilities", Header: requestHeader, Mode: 0x22, Pid: did, Protocol: protocol})
+		if err != nil {
+			continue
+		}
+		for _, frame := range frames {
+			header, data, err := parseResponseFrame(frame, extended)
+			if err == nil && header == ecu.Header && len(data) >= 3 && data[0] == 0x62 && uint32(data[1])<<8|uint32(data[2]) == did {
+				ecu.DIDs = appendUnique(ecu.DIDs, util.UintToHexStr(did))
+			}
+		}
+	}
+}
+
+// PruneUnsupported drops the mode 01 and 09 requests no ecu that could answer them supports. Requests the scan doesn't
+// cover are kept, eg. uds dids, which ecus often don't answer to functional requests.
+func PruneUnsupported(requests []models.PIDRequest, capabilities models.VehicleCapabilities) []models.PIDRequest {
+	return slices.DeleteFunc(slices.Clone(requests), func(request models.PIDRequest) bool {
+		if request.Mode != 0x01 && request.Mode != 0x09 {
+			return false
+		}
+		functional := request.IsBroadcast()
+		responseHeader := fmt.Sprintf("%X", request.ResponseHeader())
+		pid := util.UintToHexStr(request.Pid)
+		scanned := false
+		for _, ecu := range capabilities.ECUs {
+			if !functional && ecu.Header != responseHeader {
+				continue
+			}
+			supported := ecu.PIDs
+			if request.Mode == 0x09 {
+				supported = ecu.VehicleInfoPIDs
+			}
+			if slices.Contains(supported, pid) {
+				return false
+			}
+			scanned = scanned || len(supported) > 0
+		}
+		return scanned
+	})
+}
+
+// parseResponseFrame splits a response frame into the ecu header and the payload of a single or first frame, after the
+// pci bytes. Consecutive frames are an error.
+func parseResponseFrame(frame string, extended bool) (string, []byte, error) {
+	headerLen := 3
+	if extended {
+		headerLen = 8
+	}
+	if len(frame) <= headerLen {
+		return "", nil, fmt.Errorf("frame too short: %s", frame)
+	}
+	data, err := hex.DecodeString(frame[headerLen:])
+	if err != nil || len(data) < 2 {
+		return "", nil, fmt.Errorf("invalid frame: %s", frame)
+	}
+	header := strings.ToUpper(frame[:headerLen])
+	switch data[0] >> 4 {
+	case 0:
+		length := int(data[0] & 0x0f)
+		if length > len(data)-1 {
+			length = len(data) - 1
+		}
+		return header, data[1 : 1+length], nil
+	case 1:
+		if len(data) < 3 {
+			return "", nil, fmt.Errorf("invalid first frame: %s", frame)
+		}
+		return header, data[2:], nil
+	}
+	return "", nil, fmt.Errorf("not a single or first frame: %s", frame)
+}
+
+func appendUnique(values []string, value string) []string {
+	if slices.Contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+
+	mock_loggers "github.com/DIMO-Network/edge-network/internal/loggers/mocks"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	mock_network "github.com/DIMO-Network/edge-network/internal/network/mocks"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestCapabilityScanner_Scan(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	lss := mock_loggers.NewMockSettingsStore(ctrl)
+	ds := mock_network.NewMockDataSender(ctrl)
+	lss.EXPECT().ReadCapabilities().Return(nil, fmt.Errorf("not found"))
+
+	// engine ecu supports the next bitmap, transmission 01 and 05, f190 only from the engine
+	responses := map[string][]string{
+		"7DF_01_00":   {"7e80641000180001f", "7e906410088000000"},
+		"7DF_01_20":   {"7e80641200000a000"},
+		"7DF_09_00":   {"7e80649005400000000", "7e9037f0912"},
+		"7E0_22_F190": {"7e8101462f190314654", "7e8214657314554354446"},
+		"7E1_22_F190": {"7e9037f2231"},
+	}
+	var queried []string
+	query := func(request models.PIDRequest) ([]string, error) {
+		key := fmt.Sprintf("%X_%02X_%02X", request.Header, request.Mode, request.Pid)
+		queried = append(queried, key)
+		if frames, ok := responses[key]; ok {
+			return frames, nil
+		}
+		return nil, fmt.Errorf("no response received")
+	}
+	cs := newCapabilityScanner(zerolog.Nop(), lss, ds, models.CapabilityScanSettings{Enabled: true, DIDs: []string{"F190"}}, query)
+	assert.Nil(t, cs.Cached())
+
+	expected := models.VehicleCapabilities{ECUs: []models.ECUCapabilities{
+		{Header: "7E8", PIDs: []string{"08", "09", "1C", "1D", "1E", "1F", "20", "31", "33"}, VehicleInfoPIDs: []string{"02", "04", "06"}, DIDs: []string{"F190"}},
+		{Header: "7E9", PIDs: []string{"01", "05"}},
+	}}
+	ds.EXPECT().SendCapabilities(expected).Return(nil)
+	lss.EXPECT().WriteCapabilities(expected).Return(nil)
+	capabilities, err := cs.Scan()
+	require.NoError(t, err)
+	assert.Equal(t, expected, *capabilities)
+	assert.Equal(t, &expected, cs.Cached())
+	// stops at the bitmap no ecu reports as supported, 29 bit isn't tried once an ecu answered
+	assert.Equal(t, []string{"7DF_01_00", "7DF_01_20", "7DF_09_00", "7E0_22_F190", "7E1_22_F190"}, queried)
+}
+
+func TestCapabilityScanner_noResponse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	lss := mock_loggers.NewMockSettingsStore(ctrl)
+	lss.EXPECT().ReadCapabilities().Return(nil, fmt.Errorf("not found"))
+	var queried []uint32
+	cs := newCapabilityScanner(zerolog.Nop(), lss, nil, models.CapabilityScanSettings{Enabled: true}, func(request models.PIDRequest) ([]string, error) {
+		queried = append(queried, request.Header)
+		return nil, fmt.Errorf("no response received")
+	})
+	_, err := cs.Scan()
+	assert.Error(t, err)
+	assert.Equal(t, []uint32{0x7df, 0x18db33f1}, queried)
+}
+
+func TestPruneUnsupported(t *testing.T) {
+	capabilities := models.VehicleCapabilities{ECUs: []models.ECUCapabilities{
+		{Header: "7E8", PIDs: []string{"0C", "0D"}, VehicleInfoPIDs: []string{"02"}},
+		{Header: "7E9", PIDs: []string{"A6"}},
+	}}
+	requests := []models.PIDRequest{
+		{Name: "rpm", Header: 0x7df, Mode: 0x01, Pid: 0x0c},
+		{Name: "fuelLevel", Header: 0x7df, Mode: 0x01, Pid: 0x2f},
+		{Name: "odometer", Header: 0x7df, Mode: 0x01, Pid: 0xa6},
+		// physical, only the addressed ecu counts
+		{Name: "odometerEngine", Header: 0x7e0, Mode: 0x01, Pid: 0xa6},
+		{Name: "speedTransmission", Header: 0x7e1, Mode: 0x01, Pid: 0x0d},
+		// the ecu wasn't found by the scan
+		{Name: "hybrid", Header: 0x7e2, Mode: 0x01, Pid: 0x5b},
+		{Name: "vin", Header: 0x7df, Mode: 0x09, Pid: 0x02},
+		{Name: "soc", Header: 0x7e4, Mode: 0x22, Pid: 0x8334},
+	}
+	var names []string
+	for _, r := range PruneUnsupported(requests, capabilities) {
+		names = append(names, r.Name)
+	}
+	assert.Equal(t, []string{"rpm", "odometer", "hybrid", "vin", "soc"}, names)
+	assert.Len(t, requests, 8, "the template is not modified")
+
+	// nothing scanned, nothing pruned
+	assert.Len(t, PruneUnsupported(requests, models.VehicleCapabilities{}), 8)
+}
+
+func Test_parseResponseFrame(t *testing.T) {
+	header, data, err := parseResponseFrame("18daf110064100000000ff00", true)
+	require.NoError(t, err)
+	assert.Equal(t, "18DAF110", header)
+	assert.Equal(t, []byte{0x41, 0x00, 0x00, 0x00, 0x00, 0xff}, data, "padding after the length is dropped")
+	_, _, err = parseResponseFrame("7e82142", false)
+	assert.Error(t, err, "consecutive frame")
+}
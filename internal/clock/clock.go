@@ -0,0 +1,236 @@
+package clock
+
+import (
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quality how far the device clock can be trusted, sent with every payload
+type Quality string
+
+const (
+	// Unsynced the pi has no rtc, after a cold boot without network the clock can be off by days
+	Unsynced Quality = "unsynced"
+	// NTP the system clock is synchronized
+	NTP Quality = "ntp"
+	// GNSS the system clock is not synchronized, time is corrected with the offset to the gnss time
+	GNSS Quality = "gnss"
+)
+
+const (
+	// stepThreshold a difference between wall and monotonic elapsed time larger than this is a step of the system clock
+	stepThreshold = 2 * time.Second
+	// gnssTolerance system time within this of the gnss time is right, the fix time has 1s resolution and some latency
+	gnssTolerance = 2 * time.Second
+)
+
+// Adjustment to apply to timestamps taken before the clock was corrected
+type Adjustment struct {
+	// Before timestamps in unix millis at or before this were taken with the old time
+	Before int64
+	// NewFrom and NewTo timestamps in between were already taken with the new time, eg. after a step back
+	NewFrom int64
+	NewTo   int64
+	// Delta millis to add
+	Delta int64
+}
+
+// Apply returns the corrected timestamp in unix millis
+func (a Adjustment) Apply(ts int64) int64 {
+	if ts > a.Before || (ts > a.NewFrom && ts <= a.NewTo) {
+		return ts
+	}
+	return ts + a.Delta
+}
+
+// Clock tracks whether the system clock is valid from ntp status and gnss time, detects steps of the system clock with the
+// monotonic clock, and lets buffers rewrite timestamps taken before the time was known. Safe for concurrent use.
+type Clock struct {
+	wall func() time.Time
+	// mono elapsed monotonic time
+	mono      func() time.Duration
+	quality   Quality
+	offset    time.Duration
+	checked   bool
+	lastWall  time.Time
+	lastMono  time.Duration
+	listeners []listener
+	nextID    int
+	mu        sync.Mutex
+}
+
+// New clock from the system clock
+func New() *Clock {
+	start := time.Now()
+	return newClock(func() time.Time { return time.Now().Round(0) }, func() time.Duration { return time.Since(start) })
+}
+
+func newClock(wall func() time.Time, mono func() time.Duration) *Clock {
+	return &Clock{wall: wall, mono: mono, quality: Unsynced}
+}
+
+// Now the best known time: the system time, plus the gnss offset while ntp is not synchronized
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.wall().Add(c.offset)
+}
+
+// Correct a time read from the system clock, eg. the autopi _stamp
+func (c *Clock) Correct(t time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return t.Add(c.offset)
+}
+
+func (c *Clock) Quality() Quality {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.quality
+}
+
+type listener struct {
+	id int
+	f  func(Adjustment)
+}
+
+// OnAdjust registers f to be called when timestamps taken so far need correcting, the returned func unregisters it
+func (c *Clock) OnAdjust(f func(Adjustment)) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	id := c.nextID
+	c.listeners = append(c.listeners, listener{id: id, f: f})
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.listeners = slices.DeleteFunc(slices.Clone(c.listeners), func(l listener) bool { return l.id == id })
+	}
+}
+
+// Check looks for steps of the system clock since the last check. A step while ntp is synchronized is the clock being set,
+// timestamps taken before are rewritten. Any other step is compensated so Now stays continuous.
+func (c *Clock) Check(ntpSynced bool) {
+	c.mu.Lock()
+	wall, mono := c.wall(), c.mono()
+	var adj *Adjustment
+	if c.checked {
+		expected := c.lastWall.Add(mono - c.lastMono)
+		jump := wall.Sub(expected)
+		switch {
+		case jump.Abs() > stepThreshold && ntpSynced:
+			adj = &Adjustment{
+				Before:  expected.Add(c.offset).UnixMilli(),
+				NewFrom: c.lastWall.Add(jump).UnixMilli(),
+				NewTo:   wall.UnixMilli(),
+				Delta:   (jump - c.offset).Milliseconds(),
+			}
+			c.offset = 0
+		case jump.Abs() > stepThreshold:
+			c.offset -= jump
+		}
+	}
+	if ntpSynced {
+		// trust ntp over gnss, the clock was right or has just been set
+		c.quality, c.offset = NTP, 0
+	}
+	c.checked, c.lastWall, c.lastMono = true, wall, mono
+	listeners := c.listeners
+	c.mu.Unlock()
+
+	if adj != nil && adj.Delta != 0 {
+		for _, l := range listeners {
+			l.f(*adj)
+		}
+	}
+}
+
+// ObserveGNSS compares the gnss time of a fix with the system time it was read at. Until ntp is synchronized the offset
+// corrects Now, and the first time it is known timestamps taken so far are rewritten.
+func (c *Clock) ObserveGNSS(fix, at time.Time) {
+	c.mu.Lock()
+	if c.quality == NTP {
+		c.mu.Unlock()
+		return
+	}
+	offset := fix.Sub(at)
+	if offset.Abs() <= gnssTolerance {
+		offset = 0
+	}
+	var adj *Adjustment
+	if c.quality == Unsynced && offset != c.offset {
+		before := at.Add(c.offset).UnixMilli()
+		adj = &Adjustment{Before: before, NewFrom: before, NewTo: before, Delta: (offset - c.offset).Milliseconds()}
+	}
+	if c.quality == Unsynced || (offset-c.offset).Abs() > gnssTolerance {
+		c.offset = offset
+	}
+	c.quality = GNSS
+	listeners := c.listeners
+	c.mu.Unlock()
+
+	if adj != nil {
+		for _, l := range listeners {
+			l.f(*adj)
+		}
+	}
+}
+
+// Watch checks the clock every interval until stop is closed
+func (c *Clock) Watch(interval time.Duration, ntpSynced func() bool, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	c.Check(ntpSynced())
+	for {
+		select {
+		case <-ticker.C:
+			c.Check(ntpSynced())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// NTPSynchronized asks systemd whether the system clock is synchronized, false if it can't tell
+func NTPSynchronized() bool {
+	out, err := exec.Command("timedatectl", "show", "-p", "NTPSynchronized", "--value").Output()
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(out)) == "yes"
+}
+
+var std = New()
+
+// Now the best known time of the device clock
+func Now() time.Time {
+	return std.Now()
+}
+
+// Correct a time read from the system clock, eg. the autopi _stamp
+func Correct(t time.Time) time.Time {
+	return std.Correct(t)
+}
+
+// CurrentQuality of the device clock
+func CurrentQuality() Quality {
+	return std.Quality()
+}
+
+// OnAdjust registers f to be called when timestamps taken so far need correcting, the returned func unregisters it
+func OnAdjust(f func(Adjustment)) func() {
+	return std.OnAdjust(f)
+}
+
+// ObserveGNSS feeds the gnss time of a fix and the system time it was read at
+func ObserveGNSS(fix, at time.Time) {
+	std.ObserveGNSS(fix, at)
+}
+
+// Watch checks the device clock against ntp every interval until stop is closed
+func Watch(interval time.Duration, stop <-chan struct{}) {
+	std.Watch(interval, NTPSynchronized, stop)
+}
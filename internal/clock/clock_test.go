@@ -0,0 +1,135 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock a system clock that can be stepped, mono only moves forward
+type fakeClock struct {
+	wall time.Time
+	mono time.Duration
+}
+
+func (f *fakeClock) advance(d time.Duration) {
+	f.wall = f.wall.Add(d)
+	f.mono += d
+}
+
+func newFake(wall time.Time) (*fakeClock, *Clock) {
+	f := &fakeClock{wall: wall}
+	return f, newClock(func() time.Time { return f.wall }, func() time.Duration { return f.mono })
+}
+
+func TestClock_ntpStep(t *testing.T) {
+	// booted thinking it is 2000-01-01
+	f, c := newFake(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	var adjustments []Adjustment
+	c.OnAdjust(func(a Adjustment) { adjustments = append(adjustments, a) })
+
+	c.Check(false)
+	assert.Equal(t, Unsynced, c.Quality())
+	early := c.Now().UnixMilli()
+	f.advance(10 * time.Second)
+	c.Check(false)
+	assert.Empty(t, adjustments)
+
+	// ntp sets the clock 2s after the last check
+	f.advance(2 * time.Second)
+	late := c.Now().UnixMilli()
+	real := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	f.wall = real
+	f.advance(3 * time.Second)
+	afterStep := c.Now().UnixMilli()
+	c.Check(true)
+
+	assert.Equal(t, NTP, c.Quality())
+	require.Len(t, adjustments, 1)
+	adj := adjustments[0]
+	assert.Equal(t, real.Add(-12*time.Second).UnixMilli(), adj.Apply(early))
+	assert.Equal(t, real.UnixMilli(), adj.Apply(late))
+	assert.Equal(t, afterStep, adj.Apply(afterStep), "already taken with the new time")
+	assert.Equal(t, real.Add(3*time.Second), c.Now())
+}
+
+func TestClock_ntpStepBack(t *testing.T) {
+	// booted thinking it is a day later than it is
+	f, c := newFake(time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC))
+	var adjustments []Adjustment
+	c.OnAdjust(func(a Adjustment) { adjustments = append(adjustments, a) })
+	c.Check(false)
+	early := c.Now().UnixMilli()
+
+	f.advance(5 * time.Second)
+	f.wall = time.Date(2024, 5, 1, 12, 0, 5, 0, time.UTC)
+	f.advance(time.Second)
+	afterStep := c.Now().UnixMilli()
+	c.Check(true)
+
+	require.Len(t, adjustments, 1)
+	assert.Equal(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).UnixMilli(), adjustments[0].Apply(early))
+	assert.Equal(t, afterStep, adjustments[0].Apply(afterStep))
+}
+
+func TestClock_gnss(t *testing.T) {
+	f, c := newFake(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	var adjustments []Adjustment
+	c.OnAdjust(func(a Adjustment) { adjustments = append(adjustments, a) })
+	c.Check(false)
+	early := c.Now().UnixMilli()
+
+	f.advance(time.Minute)
+	real := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c.ObserveGNSS(real, f.wall)
+	assert.Equal(t, GNSS, c.Quality())
+	assert.Equal(t, real, c.Now())
+	assert.Equal(t, real, c.Correct(f.wall))
+	require.Len(t, adjustments, 1)
+	assert.Equal(t, real.Add(-time.Minute).UnixMilli(), adjustments[0].Apply(early))
+
+	// small differences are the fix latency, not a reason to rewrite anything
+	f.advance(time.Second)
+	c.ObserveGNSS(real, f.wall)
+	assert.Len(t, adjustments, 1)
+	assert.Equal(t, real.Add(time.Second), c.Now())
+
+	// a manual step of the system clock without ntp keeps Now continuous
+	c.Check(false)
+	f.advance(time.Second)
+	f.wall = f.wall.Add(time.Hour)
+	c.Check(false)
+	assert.Equal(t, real.Add(2*time.Second), c.Now())
+	assert.Len(t, adjustments, 1)
+
+	// ntp synced without a step, the system clock is trusted from now on
+	c.Check(true)
+	assert.Equal(t, NTP, c.Quality())
+	c.ObserveGNSS(real, f.wall)
+	assert.Equal(t, NTP, c.Quality())
+}
+
+func TestClock_gnssAgrees(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, c := newFake(now)
+	called := false
+	c.OnAdjust(func(Adjustment) { called = true })
+	c.ObserveGNSS(now.Add(-time.Second), now)
+	assert.Equal(t, GNSS, c.Quality())
+	assert.Equal(t, now, c.Now())
+	assert.False(t, called)
+}
+
+func TestClock_OnAdjustUnregister(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, c := newFake(now)
+	var kept, removed int
+	c.OnAdjust(func(Adjustment) { kept++ })
+	unregister := c.OnAdjust(func(Adjustment) { removed++ })
+	unregister()
+	c.ObserveGNSS(now.Add(time.Hour), now)
+	assert.Equal(t, 1, kept)
+	assert.Equal(t, 0, removed)
+}
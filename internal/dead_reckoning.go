@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/util"
+)
+
+const (
+	defaultDeadReckoningMaxSecs = 300.0
+	defaultWheelbaseMeters      = 2.8
+	defaultSteeringRatio        = 15.0
+	// deadReckoningMaxGap between speed samples that are still integrated, and how long a turn rate sample is valid
+	deadReckoningMaxGap = 30 * time.Second
+	// deadReckoningCourseSpeed gps speed in km/h above which the course over ground is trusted
+	deadReckoningCourseSpeed = 5.0
+	// deadReckoningDrift error as a fraction of the distance travelled, holding the last course or following the turn rate
+	deadReckoningDrift         = 0.1
+	deadReckoningDriftTurnRate = 0.03
+	// hdopMeters rough error in meters per unit of hdop for the fix we start from
+	hdopMeters = 5.0
+)
+
+// DeadReckoning propagates the last gps fix with the vehicle speed, the yaw rate or steering angle when the vehicle has them,
+// and otherwise the last gps course. A new fix replaces the estimate. Safe for concurrent use.
+type DeadReckoning struct {
+	settings     models.DeadReckoningSettings
+	speedSignals map[string]bool
+	hasFix       bool
+	fixAt        time.Time
+	// current estimate
+	lat, lon, altitude float64
+	course             float64
+	hasCourse          bool
+	accuracy           float64
+	moved              bool
+	// lost is set when the vehicle moved without a known course, there is nothing to estimate until the next fix
+	lost bool
+	// last speed sample, integrated until the next one
+	speed   float64
+	speedAt time.Time
+	// last yaw rate or steering angle sample
+	yawRate         float64
+	yawRateAt       time.Time
+	steeringAngle   float64
+	steeringAngleAt time.Time
+	mu              sync.Mutex
+}
+
+func NewDeadReckoning(settings models.DeadReckoningSettings) *DeadReckoning {
+	if settings.MaxSecs <= 0 {
+		settings.MaxSecs = defaultDeadReckoningMaxSecs
+	}
+	if len(settings.SpeedSignals) == 0 {
+		settings.SpeedSignals = []string{"speed"}
+	}
+	if settings.WheelbaseMeters <= 0 {
+		settings.WheelbaseMeters = defaultWheelbaseMeters
+	}
+	if settings.SteeringRatio <= 0 {
+		settings.SteeringRatio = defaultSteeringRatio
+	}
+	speedSignals := map[string]bool{}
+	for _, s := range settings.SpeedSignals {
+		speedSignals[s] = true
+	}
+	return &DeadReckoning{settings: settings, speedSignals: speedSignals}
+}
+
+// Fix resets the estimate to a gps fix. If there was an estimate, returns how far off it was in meters and true.
+func (d *DeadReckoning) Fix(ts time.Time, loc models.Location) (float64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	drift, reconciled := 0.0, false
+	if d.hasFix && d.moved && !d.lost {
+		drift, reconciled = util.HaversineKm(d.lat, d.lon, loc.Latitude, loc.Longitude)*1000, true
+	}
+	d.hasFix, d.fixAt, d.moved, d.lost = true, ts, false, false
+	d.lat, d.lon, d.altitude = loc.Latitude, loc.Longitude, loc.Altitude
+	d.accuracy = hdopMeters
+	if loc.Hdop > 0 {
+		d.accuracy = loc.Hdop * hdopMeters
+	}
+	if loc.Fix != "" && loc.SogKm >= deadReckoningCourseSpeed {
+		d.course, d.hasCourse = loc.Cog, true
+	}
+	// integrate from the fix on
+	if d.speedAt.Before(ts) {
+		d.speedAt = ts
+	}
+	return drift, reconciled
+}
+
+// ObserveSignal feeds speed, yaw rate and steering angle signals, other signals are ignored
+func (d *DeadReckoning) ObserveSignal(name string, ts time.Time, value float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case d.speedSignals[name]:
+		d.advance(ts)
+		d.speed, d.speedAt = value, ts
+	case name == d.settings.YawRateSignal:
+		d.advance(ts)
+		d.yawRate, d.yawRateAt = value, ts
+	case name == d.settings.SteeringAngleSignal:
+		d.advance(ts)
+		d.steeringAngle, d.steeringAngleAt = value, ts
+	}
+}
+
+// Estimate returns the estimated location at ts, nil if there is none: no fix yet, the last fix is older than MaxSecs, or
+// the vehicle moved without a known course
+func (d *DeadReckoning) Estimate(ts time.Time) *models.Location {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.hasFix || ts.Sub(d.fixAt).Seconds() > d.settings.MaxSecs {
+		return nil
+	}
+	d.advance(ts)
+	if d.lost {
+		return nil
+	}
+	return &models.Location{
+		Latitude:       d.lat,
+		Longitude:      d.lon,
+		Altitude:       d.altitude,
+		Cog:            d.course,
+		SogKm:          d.speed,
+		Estimated:      true,
+		AccuracyMeters: math.Round(d.accuracy),
+	}
+}
+
+// advance integrates the last speed sample until ts. Must hold the lock.
+func (d *DeadReckoning) advance(ts time.Time) {
+	elapsed := ts.Sub(d.speedAt)
+	if !d.hasFix || elapsed <= 0 {
+		return
+	}
+	d.speedAt = ts
+	if elapsed > deadReckoningMaxGap || d.speed <= 0 {
+		return
+	}
+	meters := d.speed / 3.6 * elapsed.Seconds()
+	if !d.hasCourse {
+		d.lost = true
+		return
+	}
+	turnRate, hasTurnRate := d.turnRate(ts)
+	// course is clockwise, turn rate positive to the left. Move along the mean course over the interval.
+	turn := turnRate * elapsed.Seconds()
+	d.lat, d.lon = util.Destination(d.lat, d.lon, d.course-turn/2, meters)
+	d.course = math.Mod(d.course-turn+360, 360)
+	drift := deadReckoningDrift
+	if hasTurnRate {
+		drift = deadReckoningDriftTurnRate
+	}
+	d.accuracy += meters * drift
+	d.moved = true
+}
+
+// turnRate in deg/s from the yaw rate, or the steering angle with a bicycle model. Must hold the lock.
+func (d *DeadReckoning) turnRate(ts time.Time) (float64, bool) {
+	if d.settings.YawRateSignal != "" && ts.Sub(d.yawRateAt) <= deadReckoningMaxGap {
+		return d.yawRate, true
+	}
+	if d.settings.SteeringAngleSignal != "" && ts.Sub(d.steeringAngleAt) <= deadReckoningMaxGap {
+		wheelAngle := d.steeringAngle / d.settings.SteeringRatio * math.Pi / 180
+		radPerSec := d.speed / 3.6 / d.settings.WheelbaseMeters * math.Tan(wheelAngle)
+		return radPerSec * 180 / math.Pi, true
+	}
+	return 0, false
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadReckoning_holdsCourse(t *testing.T) {
+	d := NewDeadReckoning(models.DeadReckoningSettings{Enabled: true})
+	start := time.Now()
+	assert.Nil(t, d.Estimate(start), "no fix yet")
+
+	fix := models.Location{Latitude: 40, Longitude: -3, Altitude: 600, Hdop: 1, Fix: "3D", Cog: 90, SogKm: 72}
+	_, reconciled := d.Fix(start, fix)
+	assert.False(t, reconciled)
+
+	// 72 km/h is 20 m/s, 10s east into a tunnel
+	for i := 0; i <= 10; i++ {
+		d.ObserveSignal("speed", start.Add(time.Duration(i)*time.Second), 72)
+	}
+	est := d.Estimate(start.Add(10 * time.Second))
+	require.NotNil(t, est)
+	assert.True(t, est.Estimated)
+	assert.InDelta(t, 200, util.HaversineKm(40, -3, est.Latitude, est.Longitude)*1000, 1)
+	assert.InDelta(t, 40, est.Latitude, 0.00001)
+	assert.Greater(t, est.Longitude, -3.0)
+	assert.Equal(t, 600.0, est.Altitude)
+	// 5m from the fix plus 10% of 200m
+	assert.Equal(t, 25.0, est.AccuracyMeters)
+
+	// gps is back 10m further
+	lat, lon := util.Destination(est.Latitude, est.Longitude, 90, 10)
+	drift, reconciled := d.Fix(start.Add(10*time.Second), models.Location{Latitude: lat, Longitude: lon, Fix: "3D", Cog: 90, SogKm: 72})
+	assert.True(t, reconciled)
+	assert.InDelta(t, 10, drift, 0.5)
+
+	// too long since the last fix
+	assert.Nil(t, d.Estimate(start.Add(10*time.Minute)))
+}
+
+func TestDeadReckoning_yawRate(t *testing.T) {
+	d := NewDeadReckoning(models.DeadReckoningSettings{Enabled: true, YawRateSignal: "yawRate"})
+	start := time.Now()
+	d.Fix(start, models.Location{Latitude: 40, Longitude: -3, Fix: "3D", Cog: 0, SogKm: 36})
+
+	// turning left at 9 deg/s for 10s ends up heading west
+	for i := 0; i <= 10; i++ {
+		ts := start.Add(time.Duration(i) * time.Second)
+		d.ObserveSignal("yawRate", ts, 9)
+		d.ObserveSignal("speed", ts, 36)
+	}
+	est := d.Estimate(start.Add(10 * time.Second))
+	require.NotNil(t, est)
+	assert.InDelta(t, 270, est.Cog, 0.001)
+	assert.Greater(t, est.Latitude, 40.0)
+	assert.Less(t, est.Longitude, -3.0)
+	// 5m plus 3% of 100m
+	assert.Equal(t, 8.0, est.AccuracyMeters)
+}
+
+func TestDeadReckoning_noCourse(t *testing.T) {
+	d := NewDeadReckoning(models.DeadReckoningSettings{Enabled: true})
+	start := time.Now()
+	// fix while stationary, course is not known
+	d.Fix(start, models.Location{Latitude: 40, Longitude: -3, Fix: "3D", Cog: 123, SogKm: 0})
+
+	d.ObserveSignal("speed", start.Add(time.Second), 0)
+	est := d.Estimate(start.Add(2 * time.Second))
+	require.NotNil(t, est, "not moving, still where the fix was")
+	assert.Equal(t, 40.0, est.Latitude)
+
+	d.ObserveSignal("speed", start.Add(3*time.Second), 20)
+	d.ObserveSignal("speed", start.Add(4*time.Second), 20)
+	assert.Nil(t, d.Estimate(start.Add(5*time.Second)), "moved without a course")
+}
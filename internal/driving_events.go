@@ -0,0 +1,257 @@
+package internal
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+)
+
+const (
+	standardGravity = 9.80665
+	// drivingMaxSampleGap speed samples further apart than this don't say anything about harsh events
+	drivingMaxSampleGap = 3 * time.Second
+	drivingMinSampleGap = 50 * time.Millisecond
+	// drivingCooldown the same event type is not repeated within this, it is usually seen by more than one source
+	drivingCooldown = 5 * time.Second
+	// drivingMinTurnSpeed below this gps course is too noisy to derive lateral acceleration from
+	drivingMinTurnSpeed = 15.0
+	// gravityAlpha low pass filter weight to estimate the gravity vector from the accelerometer
+	gravityAlpha = 0.02
+	// trendG longitudinal acceleration from speed above which we classify an accelerometer spike as brake or accel
+	trendG       = 0.1
+	trendMaxAge  = 3 * time.Second
+	gpsSourceKey = "gps"
+	accSourceKey = "accelerometer"
+)
+
+type speedSample struct {
+	ts    time.Time
+	speed float64
+}
+
+// DrivingEventDetector derives harsh brake, accel and turn events from speed deltas, gps course and the accelerometer if the
+// device has one, plus over-speed events. Safe for concurrent use, each source is fed from its own goroutine.
+type DrivingEventDetector struct {
+	settings models.DrivingEventSettings
+	// last sample per speed source
+	speeds   map[string]speedSample
+	lastCog  float64
+	lastGPS  time.Time
+	lat, lon float64
+	// latest longitudinal acceleration in g from speed, to classify accelerometer spikes
+	trend     float64
+	trendAt   time.Time
+	gravity   [3]float64
+	gravityOK bool
+	// overSpeedSince zero when not above the limit
+	overSpeedSince time.Time
+	overSpeedMax   float64
+	overSpeedSent  bool
+	lastEvent      map[models.DrivingEventType]time.Time
+	mu             sync.Mutex
+}
+
+func NewDrivingEventDetector(settings models.DrivingEventSettings) *DrivingEventDetector {
+	if settings.HarshBrakeG <= 0 {
+		settings.HarshBrakeG = 0.4
+	}
+	if settings.HarshAccelG <= 0 {
+		settings.HarshAccelG = 0.35
+	}
+	if settings.HarshTurnG <= 0 {
+		settings.HarshTurnG = 0.45
+	}
+	if settings.OverSpeedMinSecs <= 0 {
+		settings.OverSpeedMinSecs = 10
+	}
+	if len(settings.SpeedSignals) == 0 {
+		settings.SpeedSignals = []string{"speed"}
+	}
+	return &DrivingEventDetector{
+		settings:  settings,
+		speeds:    make(map[string]speedSample),
+		lastEvent: make(map[models.DrivingEventType]time.Time),
+	}
+}
+
+// IsSpeedSignal true if the signal is configured as a source of speed
+func (d *DrivingEventDetector) IsSpeedSignal(name string) bool {
+	for _, s := range d.settings.SpeedSignals {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ObserveSpeed feeds a speed sample in km/h from a pid or dbc signal
+func (d *DrivingEventDetector) ObserveSpeed(source string, ts time.Time, speed float64) []models.DrivingEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.observeSpeed(source, ts, speed)
+}
+
+// ObserveGPS feeds a gps fix with course over ground in degrees and speed over ground in km/h
+func (d *DrivingEventDetector) ObserveGPS(ts time.Time, lat, lon, cog, sogKm float64) []models.DrivingEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lat, d.lon = lat, lon
+	events := d.observeSpeed(gpsSourceKey, ts, sogKm)
+
+	elapsed := ts.Sub(d.lastGPS)
+	prevCog := d.lastCog
+	d.lastGPS, d.lastCog = ts, cog
+	if elapsed < drivingMinSampleGap || elapsed > drivingMaxSampleGap || sogKm < drivingMinTurnSpeed {
+		return events
+	}
+	// lateral acceleration = v * yaw rate
+	delta := math.Mod(cog-prevCog+540, 360) - 180
+	yawRate := delta * math.Pi / 180 / elapsed.Seconds()
+	lateral := math.Abs(sogKm/3.6*yawRate) / standardGravity
+	if lateral >= d.settings.HarshTurnG {
+		events = d.emit(events, newDrivingEvent(models.HarshTurn, gpsSourceKey, ts, lateral, d.settings.HarshTurnG, sogKm))
+	}
+	return events
+}
+
+// ObserveAccelerometer feeds a raw accelerometer sample in g. The device can be mounted any way, so gravity is estimated with
+// a low pass filter and removed, and the horizontal magnitude is classified as brake or accel by the speed trend, turn otherwise.
+func (d *DrivingEventDetector) ObserveAccelerometer(ts time.Time, x, y, z float64) []models.DrivingEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sample := [3]float64{x, y, z}
+	if !d.gravityOK {
+		d.gravity = sample
+		d.gravityOK = true
+		return nil
+	}
+	for i := range sample {
+		d.gravity[i] += gravityAlpha * (sample[i] - d.gravity[i])
+	}
+	g := math.Sqrt(d.gravity[0]*d.gravity[0] + d.gravity[1]*d.gravity[1] + d.gravity[2]*d.gravity[2])
+	if g == 0 {
+		return nil
+	}
+	var dyn [3]float64
+	var along float64
+	for i := range sample {
+		dyn[i] = sample[i] - d.gravity[i]
+		along += dyn[i] * d.gravity[i] / g
+	}
+	// remove the vertical component, eg. bumps
+	var horizontal float64
+	for i := range dyn {
+		h := dyn[i] - along*d.gravity[i]/g
+		horizontal += h * h
+	}
+	horizontal = math.Sqrt(horizontal)
+
+	speed := 0.0
+	if s, ok := d.speeds[d.settings.SpeedSignals[0]]; ok {
+		speed = s.speed
+	}
+	recentTrend := ts.Sub(d.trendAt) <= trendMaxAge
+	switch {
+	case recentTrend && d.trend <= -trendG:
+		if horizontal >= d.settings.HarshBrakeG {
+			return d.emit(nil, newDrivingEvent(models.HarshBrake, accSourceKey, ts, horizontal, d.settings.HarshBrakeG, speed))
+		}
+	case recentTrend && d.trend >= trendG:
+		if horizontal >= d.settings.HarshAccelG {
+			return d.emit(nil, newDrivingEvent(models.HarshAccel, accSourceKey, ts, horizontal, d.settings.HarshAccelG, speed))
+		}
+	default:
+		if horizontal >= d.settings.HarshTurnG {
+			return d.emit(nil, newDrivingEvent(models.HarshTurn, accSourceKey, ts, horizontal, d.settings.HarshTurnG, speed))
+		}
+	}
+	return nil
+}
+
+// observeSpeed must hold the lock
+func (d *DrivingEventDetector) observeSpeed(source string, ts time.Time, speed float64) []models.DrivingEvent {
+	var events []models.DrivingEvent
+	prev, ok := d.speeds[source]
+	d.speeds[source] = speedSample{ts: ts, speed: speed}
+	if ok {
+		elapsed := ts.Sub(prev.ts)
+		if elapsed >= drivingMinSampleGap && elapsed <= drivingMaxSampleGap {
+			accel := (speed - prev.speed) / 3.6 / elapsed.Seconds() / standardGravity
+			d.trend, d.trendAt = accel, ts
+			if -accel >= d.settings.HarshBrakeG {
+				events = d.emit(events, newDrivingEvent(models.HarshBrake, source, ts, -accel, d.settings.HarshBrakeG, speed))
+			} else if accel >= d.settings.HarshAccelG {
+				events = d.emit(events, newDrivingEvent(models.HarshAccel, source, ts, accel, d.settings.HarshAccelG, speed))
+			}
+		}
+	}
+	if source == gpsSourceKey && d.hasVehicleSpeed(ts) {
+		return events // vehicle speed is more accurate, mixing both makes over-speed flap around the limit
+	}
+	return d.overSpeed(events, source, ts, speed)
+}
+
+// hasVehicleSpeed true if we got a recent speed signal from the vehicle. Must hold the lock.
+func (d *DrivingEventDetector) hasVehicleSpeed(ts time.Time) bool {
+	for source, s := range d.speeds {
+		if source != gpsSourceKey && ts.Sub(s.ts) <= 10*time.Second {
+			return true
+		}
+	}
+	return false
+}
+
+// overSpeed one event per period above the limit, once it lasted OverSpeedMinSecs. Must hold the lock.
+func (d *DrivingEventDetector) overSpeed(events []models.DrivingEvent, source string, ts time.Time, speed float64) []models.DrivingEvent {
+	limit := d.settings.OverSpeedKph
+	if limit <= 0 {
+		return events
+	}
+	if speed <= limit {
+		d.overSpeedSince = time.Time{}
+		d.overSpeedSent = false
+		return events
+	}
+	if d.overSpeedSince.IsZero() {
+		d.overSpeedSince = ts
+		d.overSpeedMax = 0
+	}
+	d.overSpeedMax = math.Max(d.overSpeedMax, speed)
+	duration := ts.Sub(d.overSpeedSince)
+	if d.overSpeedSent || duration.Seconds() < d.settings.OverSpeedMinSecs {
+		return events
+	}
+	d.overSpeedSent = true
+	ev := newDrivingEvent(models.OverSpeed, source, ts, d.overSpeedMax, limit, speed)
+	ev.DurationSecs = duration.Seconds()
+	return append(events, d.locate(ev))
+}
+
+// emit appends the event unless the same type was just sent. Must hold the lock.
+func (d *DrivingEventDetector) emit(events []models.DrivingEvent, ev models.DrivingEvent) []models.DrivingEvent {
+	ts := time.UnixMilli(ev.Timestamp)
+	if last, ok := d.lastEvent[ev.Type]; ok && ts.Sub(last) < drivingCooldown {
+		return events
+	}
+	d.lastEvent[ev.Type] = ts
+	return append(events, d.locate(ev))
+}
+
+func (d *DrivingEventDetector) locate(ev models.DrivingEvent) models.DrivingEvent {
+	ev.Latitude, ev.Longitude = d.lat, d.lon
+	return ev
+}
+
+// HarshEvent builds an event, values are rounded to what is meaningful
+func newDrivingEvent(t models.DrivingEventType, source string, ts time.Time, value, threshold, speed float64) models.DrivingEvent {
+	return models.DrivingEvent{
+		CommonData: models.CommonData{Timestamp: ts.UTC().UnixMilli()},
+		Type:       t,
+		Source:     source,
+		Value:      math.Round(value*1000) / 1000,
+		Threshold:  threshold,
+		Speed:      math.Round(speed*10) / 10,
+	}
+}
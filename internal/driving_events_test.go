@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrivingEventDetector_HarshBrakeAndAccel(t *testing.T) {
+	d := NewDrivingEventDetector(models.DrivingEventSettings{Enabled: true})
+	start := time.Now()
+
+	assert.Empty(t, d.ObserveSpeed("speed", start, 80))
+	// 80 -> 60 km/h in 1s is ~0.57g
+	events := d.ObserveSpeed("speed", start.Add(time.Second), 60)
+	require.Len(t, events, 1)
+	assert.Equal(t, models.HarshBrake, events[0].Type)
+	assert.Equal(t, "speed", events[0].Source)
+	assert.InDelta(t, 0.567, events[0].Value, 0.001)
+	assert.Equal(t, 0.4, events[0].Threshold)
+	assert.Equal(t, 60.0, events[0].Speed)
+
+	// same brake seen from the gps is not repeated
+	assert.Empty(t, d.ObserveGPS(start.Add(500*time.Millisecond), 40, -3, 90, 80))
+	assert.Empty(t, d.ObserveGPS(start.Add(1500*time.Millisecond), 40, -3, 90, 58))
+
+	// 65 -> 80 km/h in 1s
+	assert.Empty(t, d.ObserveSpeed("speed", start.Add(2*time.Second), 65))
+	events = d.ObserveSpeed("speed", start.Add(3*time.Second), 80)
+	require.Len(t, events, 1)
+	assert.Equal(t, models.HarshAccel, events[0].Type)
+	assert.Equal(t, 40.0, events[0].Latitude)
+
+	// samples too far apart are ignored
+	assert.Empty(t, d.ObserveSpeed("speed", start.Add(10*time.Second), 10))
+}
+
+func TestDrivingEventDetector_HarshTurnFromGPS(t *testing.T) {
+	d := NewDrivingEventDetector(models.DrivingEventSettings{Enabled: true})
+	start := time.Now()
+
+	assert.Empty(t, d.ObserveGPS(start, 40, -3, 350, 50))
+	// 30 degrees in 1s at 50km/h across north is ~0.74g
+	events := d.ObserveGPS(start.Add(time.Second), 40, -3, 20, 50)
+	require.Len(t, events, 1)
+	assert.Equal(t, models.HarshTurn, events[0].Type)
+	assert.Equal(t, "gps", events[0].Source)
+	assert.InDelta(t, 0.742, events[0].Value, 0.001)
+
+	// slow speed course changes are noise
+	d = NewDrivingEventDetector(models.DrivingEventSettings{Enabled: true})
+	assert.Empty(t, d.ObserveGPS(start, 40, -3, 0, 5))
+	assert.Empty(t, d.ObserveGPS(start.Add(time.Second), 40, -3, 90, 5))
+}
+
+func TestDrivingEventDetector_OverSpeed(t *testing.T) {
+	d := NewDrivingEventDetector(models.DrivingEventSettings{Enabled: true, OverSpeedKph: 120, OverSpeedMinSecs: 5})
+	start := time.Now()
+
+	var events []models.DrivingEvent
+	for i := 0; i <= 8; i++ {
+		events = append(events, d.ObserveSpeed("speed", start.Add(time.Duration(i)*time.Second), 125+float64(i%3))...)
+	}
+	require.Len(t, events, 1)
+	assert.Equal(t, models.OverSpeed, events[0].Type)
+	assert.Equal(t, 127.0, events[0].Value)
+	assert.Equal(t, 120.0, events[0].Threshold)
+	assert.Equal(t, 5.0, events[0].DurationSecs)
+
+	// dropping below the limit re-arms it
+	assert.Empty(t, d.ObserveSpeed("speed", start.Add(9*time.Second), 119))
+	for i := 10; i <= 15; i++ {
+		events = append(events, d.ObserveSpeed("speed", start.Add(time.Duration(i)*time.Second), 121)...)
+	}
+	assert.Len(t, events, 2)
+}
+
+func TestDrivingEventDetector_Accelerometer(t *testing.T) {
+	d := NewDrivingEventDetector(models.DrivingEventSettings{Enabled: true})
+	start := time.Now()
+
+	// device mounted sideways, gravity on x
+	for i := 0; i < 50; i++ {
+		assert.Empty(t, d.ObserveAccelerometer(start.Add(time.Duration(i)*100*time.Millisecond), 1, 0, 0))
+	}
+	// a bump, only vertical, is not an event
+	assert.Empty(t, d.ObserveAccelerometer(start.Add(5*time.Second), 1.8, 0, 0))
+
+	// lateral spike with steady speed is a turn
+	events := d.ObserveAccelerometer(start.Add(5100*time.Millisecond), 1, 0.6, 0)
+	require.Len(t, events, 1)
+	assert.Equal(t, models.HarshTurn, events[0].Type)
+	assert.Equal(t, "accelerometer", events[0].Source)
+
+	// spike while slowing down is a brake
+	d.ObserveSpeed("speed", start.Add(6*time.Second), 50)
+	d.ObserveSpeed("speed", start.Add(7*time.Second), 45)
+	events = d.ObserveAccelerometer(start.Add(7100*time.Millisecond), 1, 0, 0.5)
+	require.Len(t, events, 1)
+	assert.Equal(t, models.HarshBrake, events[0].Type)
+}
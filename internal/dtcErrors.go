@@ -2,9 +2,9 @@ package internal
 
 import (
 	"fmt"
-	"time"
 
 	"github.com/DIMO-Network/edge-network/commands"
+	"github.com/DIMO-Network/edge-network/internal/clock"
 	"github.com/DIMO-Network/edge-network/internal/models"
 	"github.com/DIMO-Network/edge-network/internal/network"
 	"github.com/google/uuid"
@@ -48,7 +48,7 @@ func (ls *dtcErrorsRunner) DtcErrors() error {
 	}
 	if len(codes) > 0 {
 		// send the dtc in the signals using status topic. Seems pointless to send any other common data
-		ts := time.Now().UTC().UnixMilli()
+		ts := clock.Now().UTC().UnixMilli()
 		s := models.DtcErrorsData{Vehicle: models.Vehicle{Signals: []models.SignalData{
 			{
 				Timestamp: ts,
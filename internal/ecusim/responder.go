@@ -0,0 +1,118 @@
+package ecusim
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/autopisim"
+	"github.com/DIMO-Network/edge-network/internal/canbus"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+)
+
+// Responder is a scriptable ECU that answers OBD2 and UDS requests on a (v)can interface from the pid table of a
+// simulator vehicle model. Meant for testing the native logger without a car, eg. on vcan0.
+type Responder struct {
+	logger  zerolog.Logger
+	iface   string
+	vehicle *autopisim.Vehicle
+	start   time.Time
+	sck     *canbus.Socket
+	closed  atomic.Bool
+}
+
+func NewResponder(logger zerolog.Logger, iface string, vehicle *autopisim.Vehicle) *Responder {
+	return &Responder{logger: logger, iface: iface, vehicle: vehicle}
+}
+
+// Run binds to the interface and answers requests until Close is called
+func (r *Responder) Run() error {
+	sck, err := canbus.New()
+	if err != nil {
+		return fmt.Errorf("cannot create canbus socket: %w", err)
+	}
+	if err := sck.Bind(r.iface); err != nil {
+		_ = sck.Close()
+		return fmt.Errorf("cannot bind %s: %w", r.iface, err)
+	}
+	// closing the socket does not unblock Recv, so wake up periodically to check if we were closed
+	if err := sck.SetRecvTimeout(500 * time.Millisecond); err != nil {
+		_ = sck.Close()
+		return err
+	}
+	r.sck = sck
+	r.start = time.Now()
+	defer sck.Close() //nolint
+
+	for !r.closed.Load() {
+		frame, err := sck.Recv()
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) {
+				continue
+			}
+			r.logger.Debug().Err(err).Msg("ecu sim failed to read frame")
+			continue
+		}
+		request, ok := parseRequest(frame)
+		if !ok {
+			continue
+		}
+		frames, err := r.vehicle.ResponseFrames(request, time.Since(r.start).Seconds())
+		if err != nil {
+			r.logger.Debug().Msgf("ecu sim no response for header %X mode %X pid %X", request.Header, request.Mode, request.Pid)
+			continue
+		}
+		if err := r.send(request.ResponseHeader(), frames); err != nil {
+			r.logger.Err(err).Msg("ecu sim failed to send response")
+		}
+	}
+	return nil
+}
+
+// Close stops Run, which closes the socket on its way out
+func (r *Responder) Close() error {
+	r.closed.Store(true)
+	return nil
+}
+
+// send writes the hex frames, which are prefixed with the response header, onto the bus
+func (r *Responder) send(header uint32, frames []string) error {
+	hdrLen := len(fmt.Sprintf("%X", header))
+	kind := canbus.SFF
+	if header > 0xfff {
+		kind = canbus.EFF
+	}
+	for _, f := range frames {
+		data, err := hex.DecodeString(f[hdrLen:])
+		if err != nil {
+			return fmt.Errorf("invalid response frame %s: %w", f, err)
+		}
+		if _, err := r.sck.Send(canbus.Frame{ID: header, Data: data, Kind: kind}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseRequest recognizes obd2 / uds single frame requests sent to the functional or physical ecu addresses
+func parseRequest(frame canbus.Frame) (models.PIDRequest, bool) {
+	isRequestID := frame.ID == 0x7df || (frame.ID >= 0x7e0 && frame.ID <= 0x7e7) ||
+		frame.ID == 0x18db33f1 || (frame.ID&0xffff00ff) == 0x18da00f1
+	if !isRequestID || len(frame.Data) < 3 {
+		return models.PIDRequest{}, false
+	}
+	length := int(frame.Data[0])
+	// only single frames, anything else (eg. flow control 0x30) is ignored
+	if length < 2 || length > 7 || len(frame.Data) < length+1 {
+		return models.PIDRequest{}, false
+	}
+	request := models.PIDRequest{Header: frame.ID, Mode: uint32(frame.Data[1]), Pid: uint32(frame.Data[2])}
+	if length == 3 {
+		request.Pid = uint32(frame.Data[2])<<8 | uint32(frame.Data[3])
+	}
+	return request, true
+}
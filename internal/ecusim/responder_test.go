@@ -0,0 +1,47 @@
+package ecusim
+
+import (
+	"testing"
+
+	"github.com/DIMO-Network/edge-network/internal/canbus"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseRequest(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame canbus.Frame
+		want  models.PIDRequest
+		ok    bool
+	}{
+		{
+			name:  "obd2 functional",
+			frame: canbus.Frame{ID: 0x7df, Data: []byte{0x02, 0x01, 0x0c, 0, 0, 0, 0, 0}},
+			want:  models.PIDRequest{Header: 0x7df, Mode: 0x01, Pid: 0x0c},
+			ok:    true,
+		},
+		{
+			name:  "uds did physical",
+			frame: canbus.Frame{ID: 0x7e0, Data: []byte{0x03, 0x22, 0xf1, 0x90, 0, 0, 0, 0}},
+			want:  models.PIDRequest{Header: 0x7e0, Mode: 0x22, Pid: 0xf190},
+			ok:    true,
+		},
+		{
+			name:  "extended physical",
+			frame: canbus.Frame{ID: 0x18da10f1, Data: []byte{0x02, 0x09, 0x02}},
+			want:  models.PIDRequest{Header: 0x18da10f1, Mode: 0x09, Pid: 0x02},
+			ok:    true,
+		},
+		{name: "flow control ignored", frame: canbus.Frame{ID: 0x7e0, Data: []byte{0x30, 0, 0, 0, 0, 0, 0, 0}}},
+		{name: "response ignored", frame: canbus.Frame{ID: 0x7e8, Data: []byte{0x04, 0x41, 0x0c, 0x0c, 0x80}}},
+		{name: "too short", frame: canbus.Frame{ID: 0x7df, Data: []byte{0x02, 0x01}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRequest(tt.frame)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package internal
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/segmentio/ksuid"
+)
+
+// EV signal names, templates that define pids with these names take precedence over the catalog
+const (
+	EVSignalSOC            = "soc"
+	EVSignalSOH            = "soh"
+	EVSignalPackVoltage    = "hvBatteryVoltage"
+	EVSignalPackCurrent    = "hvBatteryCurrent"
+	EVSignalCellVoltageMin = "hvCellVoltageMin"
+	EVSignalCellVoltageMax = "hvCellVoltageMax"
+	EVSignalChargingStatus = "chargingStatus"
+	EVSignalChargerType    = "chargerType"
+)
+
+// EVSignalNames all the signals of the ev pack, queried while the vehicle is off too
+var EVSignalNames = []string{EVSignalSOC, EVSignalSOH, EVSignalPackVoltage, EVSignalPackCurrent, EVSignalCellVoltageMin,
+	EVSignalCellVoltageMax, EVSignalChargingStatus, EVSignalChargerType}
+
+// evCatalogEntry a pid of the ev catalog, Makes empty is a standard obd pid queried on any vehicle
+type evCatalogEntry struct {
+	Makes   []string
+	Request models.PIDRequest
+}
+
+// evCatalog standard and community documented oem pids. Cell voltages, soh, charging status and charger type are not
+// standardized, templates have to provide them under the names above.
+var evCatalog = []evCatalogEntry{
+	// SAE J1979 hybrid/ev battery pack remaining life
+	{Request: models.PIDRequest{Name: EVSignalSOC, Header: 0x7df, Mode: 0x01, Pid: 0x5b, IntervalSeconds: 60,
+		Formula: `dbc:31|8@0+ (0.392156862745098,0) [0|100] "%"`}},
+	{Makes: []string{"Chevrolet"}, Request: models.PIDRequest{Name: EVSignalSOC, Header: 0x7e4, Mode: 0x22, Pid: 0x8334, IntervalSeconds: 60,
+		Formula: `dbc:39|8@0+ (0.392156862745098,0) [0|100] "%"`}},
+	{Makes: []string{"Chevrolet"}, Request: models.PIDRequest{Name: EVSignalPackVoltage, Header: 0x7e4, Mode: 0x22, Pid: 0x2885, IntervalSeconds: 30,
+		Formula: `dbc:39|16@0+ (0.01,0) [0|1000] "V"`}},
+	{Makes: []string{"Chevrolet"}, Request: models.PIDRequest{Name: EVSignalPackCurrent, Header: 0x7e4, Mode: 0x22, Pid: 0x2414, IntervalSeconds: 30,
+		Formula: `dbc:39|16@0- (-0.05,0) [-1000|1000] "A"`}},
+	{Makes: []string{"Ford"}, Request: models.PIDRequest{Name: EVSignalSOC, Header: 0x7e4, Mode: 0x22, Pid: 0x4801, IntervalSeconds: 60,
+		Formula: `dbc:39|16@0+ (0.002,0) [0|100] "%"`}},
+	{Makes: []string{"Ford"}, Request: models.PIDRequest{Name: EVSignalPackVoltage, Header: 0x7e4, Mode: 0x22, Pid: 0x480d, IntervalSeconds: 30,
+		Formula: `dbc:39|16@0+ (0.01,0) [0|1000] "V"`}},
+	{Makes: []string{"Volkswagen", "Audi", "Skoda", "Cupra"}, Request: models.PIDRequest{Name: EVSignalSOC, Header: 0x17fc007b, Mode: 0x22, Pid: 0x028c,
+		IntervalSeconds: 60, Formula: `dbc:39|8@0+ (0.4,0) [0|100] "%"`}},
+}
+
+// EVRequests the catalog pids for the make, the oem specific one when there is one for a signal, otherwise the standard one.
+// Signals in existing are left out.
+func EVRequests(vehicleMake string, existing []models.PIDRequest) []models.PIDRequest {
+	have := map[string]bool{}
+	for _, r := range existing {
+		have[r.Name] = true
+	}
+	oem := map[string]bool{}
+	var requests []models.PIDRequest
+	for _, e := range evCatalog {
+		if !containsFold(e.Makes, vehicleMake) || have[e.Request.Name] {
+			continue
+		}
+		oem[e.Request.Name] = true
+		requests = append(requests, e.Request)
+	}
+	for _, e := range evCatalog {
+		if len(e.Makes) > 0 || have[e.Request.Name] || oem[e.Request.Name] {
+			continue
+		}
+		requests = append(requests, e.Request)
+	}
+	return requests
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// chargeEndAfter charging has to be off this long before a session ends, so short interruptions don't split sessions
+	chargeEndAfter = 2 * time.Minute
+	// chargeMinCurrent amps into the pack that count as charging
+	chargeMinCurrent = 1.0
+	// chargeSOCRise soc points gained while not moving that count as charging, when there is nothing else to go by
+	chargeSOCRise = 1.0
+	// chargeSOCStall how long the soc may stay flat and still be charging, slow ac charging takes minutes per percent
+	chargeSOCStall = 15 * time.Minute
+	// chargeMaxGap between observations that are still integrated into energy
+	chargeMaxGap = 5 * time.Minute
+)
+
+// ChargingObservation is the ev state at a point in time, nil values are not known
+type ChargingObservation struct {
+	Time           time.Time
+	SOC            *float64
+	PackVoltage    *float64
+	PackCurrent    *float64
+	ChargingStatus *float64
+	Speed          *float64
+	ChargerType    string
+	Location       *models.Location
+}
+
+// ChargingSessionDetector infers charging from the charging status signal, current into the pack, or the soc rising while
+// parked, and builds session summaries. Safe for concurrent use.
+type ChargingSessionDetector struct {
+	settings models.EVSettings
+	current  *chargingSession
+	// soc baseline while not charging, to detect a rise without status or current
+	restSOC *float64
+	mu      sync.Mutex
+}
+
+type chargingSession struct {
+	id          string
+	start       time.Time
+	lastOn      time.Time
+	lastObs     time.Time
+	startSOC    *float64
+	endSOC      *float64
+	lastRise    time.Time
+	energyKwh   float64
+	hasPower    bool
+	maxPowerKw  float64
+	chargerType string
+	location    *models.Location
+}
+
+func NewChargingSessionDetector(settings models.EVSettings) *ChargingSessionDetector {
+	if settings.OffQueryIntervalSecs <= 0 {
+		settings.OffQueryIntervalSecs = 60
+	}
+	return &ChargingSessionDetector{settings: settings}
+}
+
+// Observe feeds the current ev state. Returns the charge start or end event if this observation starts or ends a session.
+func (cd *ChargingSessionDetector) Observe(obs ChargingObservation) *models.ChargingEvent {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	charging := cd.charging(obs)
+	session := cd.current
+	if session == nil {
+		if !charging {
+			return nil
+		}
+		session = &chargingSession{id: ksuid.New().String(), start: obs.Time, lastOn: obs.Time, lastObs: obs.Time,
+			startSOC: cd.restSOC, location: obs.Location}
+		if session.startSOC == nil {
+			session.startSOC = obs.SOC
+		}
+		cd.current = session
+		cd.restSOC = nil
+		session.observe(obs, true)
+		return &models.ChargingEvent{
+			CommonData:  models.CommonData{Timestamp: obs.Time.UTC().UnixMilli()},
+			SessionID:   session.id,
+			Type:        models.ChargeStart,
+			StartTime:   session.start.UTC().UnixMilli(),
+			StartSOC:    session.startSOC,
+			ChargerType: session.chargerType,
+			Location:    session.location,
+		}
+	}
+
+	session.observe(obs, charging)
+	if charging || obs.Time.Sub(session.lastOn) < chargeEndAfter {
+		return nil
+	}
+	cd.current = nil
+	return session.summary(obs.Time, cd.settings.BatteryCapacityKwh)
+}
+
+// charging in order of preference: charging status, current into the pack, soc rising while not moving. Must hold the lock.
+func (cd *ChargingSessionDetector) charging(obs ChargingObservation) bool {
+	if obs.ChargingStatus != nil {
+		return *obs.ChargingStatus > 0
+	}
+	moving := obs.Speed != nil && *obs.Speed > 0
+	if obs.PackCurrent != nil {
+		current := *obs.PackCurrent
+		if !cd.settings.ChargeCurrentPositive {
+			current = -current
+		}
+		return !moving && current >= chargeMinCurrent
+	}
+	if obs.SOC == nil {
+		return false
+	}
+	if moving || (cd.restSOC != nil && *obs.SOC < *cd.restSOC) {
+		soc := *obs.SOC
+		cd.restSOC = &soc
+		return false
+	}
+	if cd.current != nil {
+		// keep charging while the soc keeps rising
+		end := cd.current.endSOC
+		return end == nil || *obs.SOC > *end || (*obs.SOC == *end && obs.Time.Sub(cd.current.lastRise) < chargeSOCStall)
+	}
+	if cd.restSOC == nil {
+		soc := *obs.SOC
+		cd.restSOC = &soc
+		return false
+	}
+	return *obs.SOC-*cd.restSOC >= chargeSOCRise
+}
+
+func (s *chargingSession) observe(obs ChargingObservation, charging bool) {
+	elapsed := obs.Time.Sub(s.lastObs)
+	if elapsed > chargeMaxGap {
+		elapsed = 0
+	}
+	s.lastObs = obs.Time
+	if obs.ChargerType != "" {
+		s.chargerType = obs.ChargerType
+	}
+	if s.location == nil {
+		s.location = obs.Location
+	}
+	if !charging {
+		return
+	}
+	s.lastOn = obs.Time
+	if obs.SOC != nil {
+		soc := *obs.SOC
+		if s.endSOC == nil || soc > *s.endSOC {
+			s.lastRise = obs.Time
+		}
+		s.endSOC = &soc
+		if s.startSOC == nil {
+			s.startSOC = &soc
+		}
+	}
+	if obs.PackVoltage != nil && obs.PackCurrent != nil {
+		kw := math.Abs(*obs.PackVoltage**obs.PackCurrent) / 1000
+		s.maxPowerKw = math.Max(s.maxPowerKw, kw)
+		s.energyKwh += kw * elapsed.Hours()
+		s.hasPower = true
+	}
+}
+
+func (s *chargingSession) summary(now time.Time, capacityKwh float64) *models.ChargingEvent {
+	event := &models.ChargingEvent{
+		CommonData:   models.CommonData{Timestamp: now.UTC().UnixMilli()},
+		SessionID:    s.id,
+		Type:         models.ChargeEnd,
+		StartTime:    s.start.UTC().UnixMilli(),
+		EndTime:      s.lastOn.UTC().UnixMilli(),
+		DurationSecs: s.lastOn.Sub(s.start).Seconds(),
+		StartSOC:     s.startSOC,
+		EndSOC:       s.endSOC,
+		MaxPowerKw:   math.Round(s.maxPowerKw*10) / 10,
+		ChargerType:  s.chargerType,
+		Location:     s.location,
+	}
+	// prefer measured energy, the soc has 1% resolution at best
+	switch {
+	case s.hasPower:
+		energy := math.Round(s.energyKwh*100) / 100
+		event.EnergyAddedKwh = &energy
+	case capacityKwh > 0 && s.startSOC != nil && s.endSOC != nil:
+		energy := math.Round((*s.endSOC-*s.startSOC)/100*capacityKwh*100) / 100
+		event.EnergyAddedKwh = &energy
+	}
+	return event
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEVRequests(t *testing.T) {
+	standard := EVRequests("Toyota", nil)
+	require.Len(t, standard, 1)
+	assert.Equal(t, uint32(0x5b), standard[0].Pid)
+
+	// oem soc replaces the standard one
+	chevy := EVRequests("chevrolet", nil)
+	require.Len(t, chevy, 3)
+	for _, r := range chevy {
+		assert.Equal(t, uint32(0x7e4), r.Header)
+	}
+
+	// the template wins
+	ford := EVRequests("Ford", []models.PIDRequest{{Name: EVSignalSOC, Header: 0x7e0, Mode: 0x22, Pid: 0x1234}})
+	require.Len(t, ford, 1)
+	assert.Equal(t, EVSignalPackVoltage, ford[0].Name)
+}
+
+func TestChargingSessionDetector_current(t *testing.T) {
+	cd := NewChargingSessionDetector(models.EVSettings{Enabled: true})
+	start := time.Now()
+	soc, voltage, zero := 40.0, 400.0, 0.0
+	idle := 0.5
+	assert.Nil(t, cd.Observe(ChargingObservation{Time: start, SOC: &soc, PackVoltage: &voltage, PackCurrent: &idle, Speed: &zero}))
+
+	// 25A into the pack at 400V is 10kW, for an hour
+	current := -25.0
+	event := cd.Observe(ChargingObservation{Time: start.Add(time.Minute), SOC: &soc, PackVoltage: &voltage, PackCurrent: &current,
+		Speed: &zero, Location: &models.Location{Latitude: 1, Longitude: 2}})
+	require.NotNil(t, event)
+	assert.Equal(t, models.ChargeStart, event.Type)
+	assert.Equal(t, 40.0, *event.StartSOC)
+	assert.Equal(t, 1.0, event.Location.Latitude)
+	id := event.SessionID
+
+	for i := 1; i <= 60; i++ {
+		s := 40.0 + float64(i)/6
+		assert.Nil(t, cd.Observe(ChargingObservation{Time: start.Add(time.Duration(i+1) * time.Minute), SOC: &s, PackVoltage: &voltage,
+			PackCurrent: &current, Speed: &zero}))
+	}
+	// a short interruption doesn't end the session
+	assert.Nil(t, cd.Observe(ChargingObservation{Time: start.Add(62 * time.Minute), PackVoltage: &voltage, PackCurrent: &idle, Speed: &zero}))
+	event = cd.Observe(ChargingObservation{Time: start.Add(64 * time.Minute), PackVoltage: &voltage, PackCurrent: &idle, Speed: &zero})
+	require.NotNil(t, event)
+	assert.Equal(t, models.ChargeEnd, event.Type)
+	assert.Equal(t, id, event.SessionID)
+	assert.Equal(t, 3600.0, event.DurationSecs)
+	assert.Equal(t, 10.0, *event.EnergyAddedKwh)
+	assert.Equal(t, 10.0, event.MaxPowerKw)
+	assert.Equal(t, 50.0, *event.EndSOC)
+}
+
+func TestChargingSessionDetector_soc(t *testing.T) {
+	cd := NewChargingSessionDetector(models.EVSettings{Enabled: true, BatteryCapacityKwh: 60})
+	start := time.Now()
+	at := func(minutes int, soc float64) *models.ChargingEvent {
+		return cd.Observe(ChargingObservation{Time: start.Add(time.Duration(minutes) * time.Minute), SOC: &soc})
+	}
+	assert.Nil(t, at(0, 20))
+	assert.Nil(t, at(5, 20.5))
+	event := at(10, 21)
+	require.NotNil(t, event)
+	assert.Equal(t, 20.0, *event.StartSOC)
+
+	// slow charging, the soc stays flat for a few minutes at a time
+	assert.Nil(t, at(20, 21))
+	assert.Nil(t, at(25, 25))
+	assert.Nil(t, at(35, 25))
+	assert.Nil(t, at(45, 30))
+	event = at(62, 30)
+	require.NotNil(t, event)
+	assert.Equal(t, models.ChargeEnd, event.Type)
+	// 10% of 60kWh
+	assert.Equal(t, 6.0, *event.EnergyAddedKwh)
+	assert.Equal(t, start.Add(45*time.Minute).UTC().UnixMilli(), event.EndTime)
+}
+
+func TestChargingSessionDetector_status(t *testing.T) {
+	cd := NewChargingSessionDetector(models.EVSettings{Enabled: true})
+	start := time.Now()
+	on, off := 1.0, 0.0
+	event := cd.Observe(ChargingObservation{Time: start, ChargingStatus: &on, ChargerType: "dc"})
+	require.NotNil(t, event)
+	assert.Equal(t, "dc", event.ChargerType)
+	assert.Nil(t, event.StartSOC)
+
+	assert.Nil(t, cd.Observe(ChargingObservation{Time: start.Add(time.Minute), ChargingStatus: &off}))
+	event = cd.Observe(ChargingObservation{Time: start.Add(3 * time.Minute), ChargingStatus: &off})
+	require.NotNil(t, event)
+	assert.Nil(t, event.EnergyAddedKwh)
+	assert.Equal(t, "dc", event.ChargerType)
+}
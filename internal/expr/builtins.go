@@ -0,0 +1,199 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type builtin func(args []any) (any, error)
+
+// builtins the functions formulas can call
+var builtins = map[string]builtin{
+	"bytes_to_int": bytesToInt,
+	"signed":       signed,
+	"ascii":        ascii,
+	"lookup":       lookup,
+	"len":          length,
+	"abs":          numeric(math.Abs),
+	"int":          numeric(math.Trunc),
+	"float":        numeric(func(f float64) float64 { return f }),
+	"round":        round,
+	"min":          extreme(math.Min),
+	"max":          extreme(math.Max),
+}
+
+func arity(args []any, least, most int) error {
+	if len(args) < least || len(args) > most {
+		if least == most {
+			return fmt.Errorf("takes %d arguments, got %d", least, len(args))
+		}
+		return fmt.Errorf("takes %d to %d arguments, got %d", least, most, len(args))
+	}
+	return nil
+}
+
+func byteArg(v any) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case float64:
+		i, err := integer(b)
+		if err != nil || i < 0 || i > 0xff {
+			return nil, fmt.Errorf("expected bytes, got %v", b)
+		}
+		return []byte{byte(i)}, nil
+	}
+	return nil, fmt.Errorf("expected bytes, got %s", typeName(v))
+}
+
+// bytesToInt big endian unsigned integer, bytes_to_int(bytes[0:2])
+func bytesToInt(args []any) (any, error) {
+	if err := arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	b, err := byteArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 6 {
+		return nil, fmt.Errorf("more than 6 bytes")
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return float64(n), nil
+}
+
+// signed two's complement of the value with the bit width, signed(bytes_to_int(bytes[0:2]), 16)
+func signed(args []any) (any, error) {
+	if err := arity(args, 2, 2); err != nil {
+		return nil, err
+	}
+	v, err := integer(args[0])
+	if err != nil {
+		return nil, err
+	}
+	bits, err := integer(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if bits < 1 || bits > 52 {
+		return nil, fmt.Errorf("invalid bit width %d", bits)
+	}
+	v &= 1<<bits - 1
+	if v&(1<<(bits-1)) != 0 {
+		v -= 1 << bits
+	}
+	return float64(v), nil
+}
+
+// ascii decodes the printable characters of the bytes, eg. a vin, padding and control characters are dropped
+func ascii(args []any) (any, error) {
+	if err := arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	b, err := byteArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	for _, c := range b {
+		if c >= 0x20 && c < 0x7f {
+			sb.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// lookup the key in the table, lookup({0: "off", 1: "on"}, bytes[0], "unknown"), errors without a default if missing
+func lookup(args []any) (any, error) {
+	if err := arity(args, 2, 3); err != nil {
+		return nil, err
+	}
+	table, ok := args[0].(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a table, got %s", typeName(args[0]))
+	}
+	key, err := tableKey(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := table[key]; ok {
+		return v, nil
+	}
+	if len(args) == 3 {
+		return args[2], nil
+	}
+	return nil, fmt.Errorf("key %v not in table", key)
+}
+
+func length(args []any) (any, error) {
+	if err := arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case []byte:
+		return float64(len(v)), nil
+	case string:
+		return float64(len(v)), nil
+	case []message:
+		return float64(len(v)), nil
+	case map[any]any:
+		return float64(len(v)), nil
+	}
+	return nil, fmt.Errorf("%s has no length", typeName(args[0]))
+}
+
+func numeric(fn func(float64) float64) builtin {
+	return func(args []any) (any, error) {
+		if err := arity(args, 1, 1); err != nil {
+			return nil, err
+		}
+		f, err := number(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return fn(f), nil
+	}
+}
+
+// round to the digits, half to even like python
+func round(args []any) (any, error) {
+	if err := arity(args, 1, 2); err != nil {
+		return nil, err
+	}
+	f, err := number(args[0])
+	if err != nil {
+		return nil, err
+	}
+	digits := int64(0)
+	if len(args) == 2 {
+		if digits, err = integer(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	scale := math.Pow(10, float64(digits))
+	return math.RoundToEven(f*scale) / scale, nil
+}
+
+func extreme(fn func(a, b float64) float64) builtin {
+	return func(args []any) (any, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("takes at least 1 argument")
+		}
+		result, err := number(args[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, arg := range args[1:] {
+			f, err := number(arg)
+			if err != nil {
+				return nil, err
+			}
+			result = fn(result, f)
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,351 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+)
+
+type node interface {
+	eval(env *Env) (any, error)
+}
+
+type constNode struct {
+	value any
+}
+
+func (n *constNode) eval(*Env) (any, error) {
+	return n.value, nil
+}
+
+// identNode the response variables, builtins are only valid as call targets
+type identNode struct {
+	name string
+}
+
+func (n *identNode) eval(env *Env) (any, error) {
+	switch n.name {
+	case "data":
+		return env.Data, nil
+	case "bytes":
+		return env.Bytes, nil
+	case "messages":
+		return []message{{data: env.Data}}, nil
+	}
+	return nil, fmt.Errorf("%s must be called", n.name)
+}
+
+type attrNode struct {
+	target node
+	name   string
+}
+
+func (n *attrNode) eval(env *Env) (any, error) {
+	v, err := n.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := v.(message); ok && n.name == "data" {
+		return m.data, nil
+	}
+	return nil, fmt.Errorf("%s has no attribute %s", typeName(v), n.name)
+}
+
+type indexNode struct {
+	target node
+	index  node
+}
+
+func (n *indexNode) eval(env *Env) (any, error) {
+	v, err := n.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	i, err := n.index.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if table, ok := v.(map[any]any); ok {
+		key, err := tableKey(i)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := table[key]
+		if !ok {
+			return nil, fmt.Errorf("key %v not in table", key)
+		}
+		return value, nil
+	}
+	idx, err := integer(i)
+	if err != nil {
+		return nil, err
+	}
+	switch t := v.(type) {
+	case []byte:
+		if idx, err = position(idx, len(t)); err != nil {
+			return nil, err
+		}
+		return float64(t[idx]), nil
+	case []message:
+		if idx, err = position(idx, len(t)); err != nil {
+			return nil, err
+		}
+		return t[idx], nil
+	case string:
+		if idx, err = position(idx, len(t)); err != nil {
+			return nil, err
+		}
+		return t[idx : idx+1], nil
+	}
+	return nil, fmt.Errorf("%s cannot be indexed", typeName(v))
+}
+
+// position resolves a negative index from the end, python style
+func position(idx int64, length int) (int64, error) {
+	if idx < 0 {
+		idx += int64(length)
+	}
+	if idx < 0 || idx >= int64(length) {
+		return 0, fmt.Errorf("index out of range: %d of %d", idx, length)
+	}
+	return idx, nil
+}
+
+type sliceNode struct {
+	target     node
+	start, end node
+}
+
+func (n *sliceNode) eval(env *Env) (any, error) {
+	v, err := n.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	var length int
+	switch t := v.(type) {
+	case []byte:
+		length = len(t)
+	case string:
+		length = len(t)
+	default:
+		return nil, fmt.Errorf("%s cannot be sliced", typeName(v))
+	}
+	start, err := n.bound(env, n.start, 0, length)
+	if err != nil {
+		return nil, err
+	}
+	end, err := n.bound(env, n.end, length, length)
+	if err != nil {
+		return nil, err
+	}
+	end = max(start, end)
+	if s, ok := v.(string); ok {
+		return s[start:end], nil
+	}
+	return v.([]byte)[start:end], nil
+}
+
+// bound clamps the slice bound to the length, python style
+func (n *sliceNode) bound(env *Env, bound node, def, length int) (int, error) {
+	if bound == nil {
+		return def, nil
+	}
+	v, err := bound.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	i, err := integer(v)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 {
+		i += int64(length)
+	}
+	return int(min(max(i, 0), int64(length))), nil
+}
+
+type callNode struct {
+	name string
+	fn   builtin
+	args []node
+}
+
+func (n *callNode) eval(env *Env) (any, error) {
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := n.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return v, nil
+}
+
+type condNode struct {
+	cond, then, otherwise node
+}
+
+func (n *condNode) eval(env *Env) (any, error) {
+	c, err := n.cond.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(c) {
+		return n.then.eval(env)
+	}
+	return n.otherwise.eval(env)
+}
+
+// logicNode and, or short circuit and return the deciding operand like python
+type logicNode struct {
+	and         bool
+	left, right node
+}
+
+func (n *logicNode) eval(env *Env) (any, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(left) != n.and {
+		return left, nil
+	}
+	return n.right.eval(env)
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) eval(env *Env) (any, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return compare(n.op, left, right)
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(env *Env) (any, error) {
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "not":
+		return !truthy(v), nil
+	case "~":
+		i, err := integer(v)
+		if err != nil {
+			return nil, err
+		}
+		return float64(^i), nil
+	}
+	f, err := number(v)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "-" {
+		return -f, nil
+	}
+	return f, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(env *Env) (any, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "+" {
+		if a, ok := left.(string); ok {
+			b, ok := right.(string)
+			if !ok {
+				return nil, fmt.Errorf("cannot add string and %s", typeName(right))
+			}
+			return a + b, nil
+		}
+	}
+	switch n.op {
+	case "|", "^", "&", "<<", ">>":
+		return bitwise(n.op, left, right)
+	}
+	a, err := number(left)
+	if err != nil {
+		return nil, err
+	}
+	b, err := number(right)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "**":
+		return math.Pow(a, b), nil
+	}
+	if b == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	switch n.op {
+	case "/":
+		return a / b, nil
+	case "//":
+		return math.Floor(a / b), nil
+	case "%":
+		// python modulo takes the sign of the divisor
+		return a - b*math.Floor(a/b), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+func bitwise(op string, left, right any) (any, error) {
+	a, err := integer(left)
+	if err != nil {
+		return nil, err
+	}
+	b, err := integer(right)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "|":
+		return float64(a | b), nil
+	case "^":
+		return float64(a ^ b), nil
+	case "&":
+		return float64(a & b), nil
+	}
+	if b < 0 || b > 63 {
+		return nil, fmt.Errorf("invalid shift count %d", b)
+	}
+	if op == "<<" {
+		return float64(a << b), nil
+	}
+	return float64(a >> b), nil
+}
@@ -0,0 +1,206 @@
+// Package expr evaluates pid formulas on the response bytes, a small deterministic subset of python: arithmetic, bit
+// operations, comparisons, conditionals, indexing and slicing of the bytes, ascii decoding and lookup tables. There are
+// no loops, assignments or access to anything but the response, so a formula always terminates. The AutoPi python
+// formula patterns, eg. bytes_to_int(messages[0].data[-2:]) * 0.25, are valid expressions.
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// maxSourceLen longer formulas are rejected
+	maxSourceLen = 1024
+	// maxDepth of nested expressions
+	maxDepth = 32
+)
+
+// Env the response a formula is evaluated on
+type Env struct {
+	// Data the message payload after the pci bytes, starting with the service id, like messages[0].data in AutoPi formulas
+	Data []byte
+	// Bytes the payload after the service id and the pid or did echo, A in the usual obd formulas is bytes[0]
+	Bytes []byte
+}
+
+// Program a compiled formula, safe for concurrent use
+type Program struct {
+	root node
+}
+
+// Compile parses the formula
+func Compile(source string) (*Program, error) {
+	if len(source) > maxSourceLen {
+		return nil, fmt.Errorf("formula longer than %d characters", maxSourceLen)
+	}
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.conditional()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return &Program{root: root}, nil
+}
+
+// Eval the formula on the response, the result is a float64 or a string
+func (p *Program) Eval(env Env) (any, error) {
+	v, err := p.root.eval(&env)
+	if err != nil {
+		return nil, err
+	}
+	switch r := v.(type) {
+	case float64:
+		if math.IsNaN(r) || math.IsInf(r, 0) {
+			return nil, fmt.Errorf("result is not a number: %v", r)
+		}
+		return r, nil
+	case string:
+		return r, nil
+	case bool:
+		if r {
+			return 1.0, nil
+		}
+		return 0.0, nil
+	}
+	return nil, fmt.Errorf("result must be a number or a string, got %s", typeName(v))
+}
+
+// message like the AutoPi messages, only data is available
+type message struct {
+	data []byte
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case []byte:
+		return "bytes"
+	case []message:
+		return "messages"
+	case message:
+		return "message"
+	case map[any]any:
+		return "table"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func number(v any) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case bool:
+		if n {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("expected a number, got %s", typeName(v))
+}
+
+// integer for bit operations, the number must not have a fraction
+func integer(v any) (int64, error) {
+	n, err := number(v)
+	if err != nil {
+		return 0, err
+	}
+	if n != math.Trunc(n) || math.Abs(n) > 1<<53 {
+		return 0, fmt.Errorf("expected an integer, got %v", n)
+	}
+	return int64(n), nil
+}
+
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case float64:
+		return t != 0
+	case bool:
+		return t
+	case string:
+		return t != ""
+	case []byte:
+		return len(t) > 0
+	case []message:
+		return len(t) > 0
+	case map[any]any:
+		return len(t) > 0
+	}
+	return true
+}
+
+// tableKey numbers and strings can be table keys
+func tableKey(v any) (any, error) {
+	switch k := v.(type) {
+	case float64, string:
+		return k, nil
+	case bool:
+		return number(k)
+	}
+	return nil, fmt.Errorf("invalid table key: %s", typeName(v))
+}
+
+func equal(a, b any) bool {
+	if sa, ok := a.(string); ok {
+		sb, ok := b.(string)
+		return ok && sa == sb
+	}
+	na, errA := number(a)
+	nb, errB := number(b)
+	return errA == nil && errB == nil && na == nb
+}
+
+func compare(op string, a, b any) (bool, error) {
+	switch op {
+	case "==":
+		return equal(a, b), nil
+	case "!=":
+		return !equal(a, b), nil
+	}
+	var c int
+	if sa, ok := a.(string); ok {
+		sb, ok := b.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare string and %s", typeName(b))
+		}
+		c = strings.Compare(sa, sb)
+	} else {
+		na, err := number(a)
+		if err != nil {
+			return false, err
+		}
+		nb, err := number(b)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case na < nb:
+			c = -1
+		case na > nb:
+			c = 1
+		}
+	}
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return false, fmt.Errorf("unknown comparison %s", op)
+}
@@ -0,0 +1,99 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEval(t *testing.T) {
+	// 41 05 7b, coolant temp, and a negative 16 bit value
+	env := Env{Data: []byte{0x41, 0x05, 0x7b, 0xff, 0x38}, Bytes: []byte{0x7b, 0xff, 0x38}}
+	tests := []struct {
+		formula string
+		want    any
+	}{
+		{formula: "bytes[0] - 40", want: 83.0},
+		{formula: "bytes_to_int(messages[0].data[-1:]) * 0.25", want: 14.0},
+		{formula: "(bytes_to_int(messages[0].data[-1:]) - 50) * 1.8 + 32", want: 42.8},
+		{formula: "bytes_to_int(data[2:3])", want: 123.0},
+		{formula: "signed(bytes_to_int(bytes[1:]), 16) / 10", want: -20.0},
+		{formula: "(bytes[0] << 8 | bytes[1]) & 0x0fff", want: 3071.0},
+		{formula: "bytes[0] >> 4 ^ 1", want: 6.0},
+		{formula: "~bytes[0] & 0xff", want: 132.0},
+		{formula: "1 if bytes[0] & 0x80 else 0", want: 0.0},
+		{formula: "'on' if bytes[0] > 100 and not bytes[1] == 0 else 'off'", want: "on"},
+		{formula: "lookup({0x7b: 'D', 0x7c: 'R'}, bytes[0])", want: "D"},
+		{formula: "lookup({1: 'D'}, bytes[0], 'unknown')", want: "unknown"},
+		{formula: "{123: -1.5}[bytes[0]]", want: -1.5},
+		{formula: "bytes[0] > 100", want: 1.0},
+		{formula: "7 // 2 + 7 % -2 + 2 ** 3", want: 10.0},
+		{formula: "-2 ** 2", want: -4.0},
+		{formula: "round(min(bytes[0], 200) / 3, 1) + max(1, 2, 3) + abs(-1) + int(2.7) + len(bytes)", want: 50.0},
+		{formula: "data[10:]", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.formula, func(t *testing.T) {
+			p, err := Compile(tt.formula)
+			require.NoError(t, err)
+			got, err := p.Eval(env)
+			if tt.want == nil {
+				assert.Error(t, err, "bytes are not a result")
+				return
+			}
+			require.NoError(t, err)
+			if f, ok := tt.want.(float64); ok {
+				assert.InDelta(t, f, got, 0.0001)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEval_ascii(t *testing.T) {
+	p, err := Compile("ascii(messages[0].data[3:])")
+	require.NoError(t, err)
+	got, err := p.Eval(Env{Data: append([]byte{0x49, 0x02, 0x01}, "1FMYU0\x00\x00"...)})
+	require.NoError(t, err)
+	assert.Equal(t, "1FMYU0", got)
+}
+
+func TestEval_errors(t *testing.T) {
+	env := Env{Data: []byte{0x41, 0x05}, Bytes: []byte{}}
+	for _, formula := range []string{
+		"bytes[0]",
+		"1 / (data[0] - 0x41)",
+		"lookup({1: 'a'}, 2)",
+		"data[0] << -1",
+		"ascii(1.5)",
+		"'a' + 1",
+	} {
+		p, err := Compile(formula)
+		require.NoError(t, err, formula)
+		_, err = p.Eval(env)
+		assert.Error(t, err, formula)
+	}
+}
+
+func TestCompile_errors(t *testing.T) {
+	for _, formula := range []string{
+		"",
+		"import os",
+		"open('/etc/passwd')",
+		"bytes[0].__class__",
+		"[x for x in bytes]",
+		"bytes[0] +",
+		"(1",
+		"{bytes[0]: 1}",
+		"1 if bytes[0]",
+		"'unterminated",
+		strings.Repeat("(", 40) + "1" + strings.Repeat(")", 40),
+		strings.Repeat("1+", 600) + "1",
+	} {
+		_, err := Compile(formula)
+		assert.Error(t, err, formula)
+	}
+}
@@ -0,0 +1,107 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+// operators, longest first so << is not read as <
+var operators = []string{"**", "//", "<<", ">>", "==", "!=", "<=", ">=",
+	"+", "-", "*", "/", "%", "&", "|", "^", "~", "<", ">", "(", ")", "[", "]", "{", "}", ",", ":", "."}
+
+func lex(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isDigit(c) || (c == '.' && i+1 < len(source) && isDigit(source[i+1])):
+			start := i
+			if c == '0' && i+1 < len(source) && (source[i+1] == 'x' || source[i+1] == 'X' || source[i+1] == 'b' || source[i+1] == 'B') {
+				i += 2
+				for i < len(source) && isIdentChar(source[i]) {
+					i++
+				}
+				n, err := strconv.ParseInt(source[start:i], 0, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid number %q at %d", source[start:i], start)
+				}
+				tokens = append(tokens, token{kind: tokNumber, text: source[start:i], num: float64(n), pos: start})
+				continue
+			}
+			for i < len(source) && (isDigit(source[i]) || source[i] == '.') {
+				i++
+			}
+			if i < len(source) && (source[i] == 'e' || source[i] == 'E') {
+				i++
+				if i < len(source) && (source[i] == '+' || source[i] == '-') {
+					i++
+				}
+				for i < len(source) && isDigit(source[i]) {
+					i++
+				}
+			}
+			n, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", source[start:i], start)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: source[start:i], num: n, pos: start})
+		case isIdentChar(c):
+			start := i
+			for i < len(source) && (isIdentChar(source[i]) || isDigit(source[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: source[start:i], pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			end := strings.IndexByte(source[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			text := source[i+1 : i+1+end]
+			i += end + 2
+			tokens = append(tokens, token{kind: tokString, text: text, pos: start})
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(source)}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || isDigit(c)
+}
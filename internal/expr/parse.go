@@ -0,0 +1,365 @@
+package expr
+
+import (
+	"fmt"
+	"slices"
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the operator or keyword if it's next
+func (p *parser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokOp || t.kind == tokIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		t := p.peek()
+		return fmt.Errorf("expected %q at %d, got %q", text, t.pos, t.text)
+	}
+	return nil
+}
+
+// conditional: or_expr ["if" or_expr "else" conditional]
+func (p *parser) conditional() (node, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return nil, fmt.Errorf("formula nested deeper than %d", maxDepth)
+	}
+	then, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("if") {
+		return then, nil
+	}
+	cond, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("else"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.conditional()
+	if err != nil {
+		return nil, err
+	}
+	return &condNode{cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) not() (node, error) {
+	if p.accept("not") {
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: "not", operand: operand}, nil
+	}
+	return p.comparison()
+}
+
+var comparisons = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || !slices.Contains(comparisons, t.text) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.binary(0)
+		if err != nil {
+			return nil, err
+		}
+		left = &compareNode{op: t.text, left: left, right: right}
+	}
+}
+
+// binaryLevels the left associative binary operators from the lowest precedence
+var binaryLevels = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "//", "%"},
+}
+
+func (p *parser) binary(level int) (node, error) {
+	if level == len(binaryLevels) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || !slices.Contains(binaryLevels[level], t.text) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	t := p.peek()
+	if t.kind == tokOp && (t.text == "-" || t.text == "+" || t.text == "~") {
+		p.next()
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.depth > maxDepth {
+			return nil, fmt.Errorf("formula nested deeper than %d", maxDepth)
+		}
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: t.text, operand: operand}, nil
+	}
+	return p.power()
+}
+
+// power binds tighter than unary minus on its left, -2**2 is -4, and is right associative
+func (p *parser) power() (node, error) {
+	base, err := p.postfix()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("**") {
+		return base, nil
+	}
+	exponent, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryNode{op: "**", left: base, right: exponent}, nil
+}
+
+func (p *parser) postfix() (node, error) {
+	n, err := p.atom()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("["):
+			n, err = p.subscript(n)
+		case p.accept("("):
+			n, err = p.call(n)
+		case p.accept("."):
+			t := p.next()
+			// messages only have data
+			if t.kind != tokIdent || t.text != "data" {
+				return nil, fmt.Errorf("unknown attribute %q at %d", t.text, t.pos)
+			}
+			n = &attrNode{target: n, name: t.text}
+		default:
+			return n, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) subscript(target node) (node, error) {
+	var start, end node
+	var err error
+	if t := p.peek(); !(t.kind == tokOp && t.text == ":") {
+		if start, err = p.conditional(); err != nil {
+			return nil, err
+		}
+	}
+	if !p.accept(":") {
+		if start == nil {
+			return nil, fmt.Errorf("empty index at %d", p.peek().pos)
+		}
+		return &indexNode{target: target, index: start}, p.expect("]")
+	}
+	if t := p.peek(); !(t.kind == tokOp && t.text == "]") {
+		if end, err = p.conditional(); err != nil {
+			return nil, err
+		}
+	}
+	return &sliceNode{target: target, start: start, end: end}, p.expect("]")
+}
+
+func (p *parser) call(target node) (node, error) {
+	name, ok := target.(*identNode)
+	if !ok {
+		return nil, fmt.Errorf("only builtin functions can be called")
+	}
+	fn, ok := builtins[name.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name.name)
+	}
+	c := &callNode{name: name.name, fn: fn}
+	if p.accept(")") {
+		return c, nil
+	}
+	for {
+		arg, err := p.conditional()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+		if p.accept(")") {
+			return c, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) atom() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &constNode{value: t.num}, nil
+	case tokString:
+		return &constNode{value: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "True":
+			return &constNode{value: true}, nil
+		case "False":
+			return &constNode{value: false}, nil
+		case "data", "bytes", "messages":
+			return &identNode{name: t.text}, nil
+		}
+		if _, ok := builtins[t.text]; ok {
+			return &identNode{name: t.text}, nil
+		}
+		return nil, fmt.Errorf("unknown name %s at %d", t.text, t.pos)
+	case tokOp:
+		switch t.text {
+		case "(":
+			n, err := p.conditional()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "{":
+			return p.table()
+		}
+	}
+	if t.kind == tokEOF {
+		return nil, fmt.Errorf("unexpected end of formula")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+// table a lookup table literal, {1: "P", 2: "R"}, the keys must be constants
+func (p *parser) table() (node, error) {
+	table := map[any]any{}
+	if p.accept("}") {
+		return &constNode{value: table}, nil
+	}
+	for {
+		key, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		k, err := constValue(key)
+		if err != nil {
+			return nil, err
+		}
+		if k, err = tableKey(k); err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		v, err := constValue(value)
+		if err != nil {
+			return nil, err
+		}
+		table[k] = v
+		if p.accept("}") {
+			return &constNode{value: table}, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// constValue evaluates a constant expression, eg. a negative number
+func constValue(n node) (any, error) {
+	switch c := n.(type) {
+	case *constNode:
+		return c.value, nil
+	case *unaryNode:
+		if _, ok := c.operand.(*constNode); ok && c.op != "not" {
+			return c.eval(&Env{})
+		}
+	}
+	return nil, fmt.Errorf("table keys and values must be constants")
+}
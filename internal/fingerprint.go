@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/DIMO-Network/edge-network/internal/clock"
 	"github.com/DIMO-Network/edge-network/internal/hooks"
 	"github.com/DIMO-Network/edge-network/internal/models"
 
@@ -37,10 +38,18 @@ type fingerprintRunner struct {
 	allTimeFailureCount int
 	// pastVINQueryName is loaded from disk from last boot - used to speedup VIN request if we already know the method that worked last
 	pastVINQueryName *string
+	// pastVIN is loaded from disk from last boot - a different VIN means the device was moved to another vehicle
+	pastVIN string
+	// odometer is optional, read along with the vin
+	odometer *OdometerReader
+	// pairing is optional, handles a vin change
+	pairing *VehiclePairing
 }
 
-func NewFingerprintRunner(unitID uuid.UUID, vinLog loggers.VINLogger, dataSender network.DataSender, templateStore loggers.SettingsStore, logger zerolog.Logger) FingerprintRunner {
-	fpr := &fingerprintRunner{unitID: unitID, vinLog: vinLog, dataSender: dataSender, templateStore: templateStore, logger: logger}
+func NewFingerprintRunner(unitID uuid.UUID, vinLog loggers.VINLogger, dataSender network.DataSender, templateStore loggers.SettingsStore,
+	logger zerolog.Logger, odometer *OdometerReader, pairing *VehiclePairing) FingerprintRunner {
+	fpr := &fingerprintRunner{unitID: unitID, vinLog: vinLog, dataSender: dataSender, templateStore: templateStore, logger: logger,
+		odometer: odometer, pairing: pairing}
 	fpr.failureCount = 0
 	fpr.allTimeFailureCount = 0
 
@@ -54,6 +63,7 @@ func NewFingerprintRunner(unitID uuid.UUID, vinLog loggers.VINLogger, dataSender
 			fpr.pastVINQueryName = &pastVINInfo.VINQueryName
 			fpr.logger.Debug().Msgf("found previous VIN query name: %s", pastVINInfo.VINQueryName)
 		}
+		fpr.pastVIN = pastVINInfo.VIN
 	}
 	return fpr
 }
@@ -87,13 +97,18 @@ func (ls *fingerprintRunner) FingerprintSimple(powerStatus api.PowerStatusRespon
 	}
 	// assumption here is that the vin query name, if set, will work on this car. If the device has been moved to a different car without pairing again, this won't work
 	vinResp, err := vinLogger.ScanFunc(ls.unitID, ls.pastVINQueryName)
+	if err != nil && ls.pastVINQueryName != nil && ls.pairing != nil {
+		// the query that worked on the previous vehicle may not work on another one
+		vinResp, err = vinLogger.ScanFunc(ls.unitID, nil)
+	}
 	if err != nil {
 		ls.failureCount++
 		// just return the error here and let the caller save to disk + log to edge etc
 		return errors.Wrap(err, fmt.Sprintf("failed to scan for vin. fail count since boot: %d", ls.failureCount))
 	}
+	vehicleChanged := ls.pairing != nil && ls.pastVIN != "" && vinResp.VIN != ls.pastVIN
 	// save vin query name in settings & report to edge logs if not set - normally this should only happen once with a given car.
-	if ls.pastVINQueryName == nil {
+	if ls.pastVINQueryName == nil || vehicleChanged {
 		config := &models.VINLoggerSettings{VINQueryName: vinResp.QueryName, VIN: vinResp.VIN}
 		err := ls.templateStore.WriteVINConfig(*config)
 		if err != nil {
@@ -102,6 +117,11 @@ func (ls *fingerprintRunner) FingerprintSimple(powerStatus api.PowerStatusRespon
 		}
 		// log to cloud only once during paired lifetime with this vehicle.
 		ls.logger.Info().Ctx(context.WithValue(context.Background(), hooks.LogToMqtt, "true")).Msgf("succesfully obtained VIN via fingerprint")
+		ls.pastVINQueryName = &vinResp.QueryName
+	}
+	if vehicleChanged {
+		ls.pairing.VehicleChanged(ls.pastVIN, vinResp.VIN)
+		ls.pastVIN = vinResp.VIN
 	}
 
 	data := models.FingerprintData{
@@ -114,9 +134,17 @@ func (ls *fingerprintRunner) FingerprintSimple(powerStatus api.PowerStatusRespon
 	if err == nil {
 		data.SoftwareVersion = version
 	}
+	// the odometer strategy and readings are from the previous vehicle until the restart with the new templates
+	if ls.odometer != nil && !vehicleChanged {
+		ls.odometer.Refresh(clock.Now())
+		if odometer, err := ls.odometer.Current(); err == nil {
+			data.Odometer = odometer.Km
+			data.OdometerSource = odometer.Source
+		}
+	}
 
 	err = ls.dataSender.SendFingerprintData(data)
-	if err != nil {
+	if err != nil && !errors.Is(err, network.ErrVehicleDataPaused) {
 		ls.logger.Err(err).Send()
 	}
 
@@ -41,7 +41,7 @@ func Test_fungerprintRunner_VINLoggers(t *testing.T) {
 		Logger()
 	ts.EXPECT().ReadVINConfig().Times(1).Return(&models.VINLoggerSettings{VINQueryName: vinQueryName}, nil)
 
-	ls := NewFingerprintRunner(unitID, vl, ds, ts, logger)
+	ls := NewFingerprintRunner(unitID, vl, ds, ts, logger, nil, nil)
 
 	// mock powerstatus resp
 	psPath := fmt.Sprintf("/dongle/%s/execute_raw/", unitID)
@@ -81,7 +81,7 @@ func Test_fingerprintRunner_VINLoggers_nilSettings(t *testing.T) {
 		Logger()
 
 	ts.EXPECT().ReadVINConfig().Times(1).Return(nil, fmt.Errorf("error reading file: open /tmp/logger-settings.json: no such file or directory"))
-	ls := NewFingerprintRunner(unitID, vl, ds, ts, logger)
+	ls := NewFingerprintRunner(unitID, vl, ds, ts, logger, nil, nil)
 
 	// mock powerstatus resp
 	psPath := fmt.Sprintf("/dongle/%s/execute_raw/", unitID)
@@ -123,7 +123,7 @@ func Test_fingerprintRunner_VINLoggers_noVINResponse(t *testing.T) {
 		Logger()
 
 	ts.EXPECT().ReadVINConfig().Times(1).Return(nil, fmt.Errorf("error reading file: open /tmp/logger-settings.json: no such file or directory"))
-	ls := NewFingerprintRunner(unitID, vl, ds, ts, logger)
+	ls := NewFingerprintRunner(unitID, vl, ds, ts, logger, nil, nil)
 
 	// mock powerstatus resp
 	psPath := fmt.Sprintf("/dongle/%s/execute_raw/", unitID)
@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/loggers"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/util"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultGeofenceMaxHdop = 3.0
+	defaultGeofenceMinNsat = 4
+	defaultGeofenceMargin  = 15.0
+	// geofenceRecoverHdop fraction of MaxHdop the hdop has to get back under before fixes are trusted again
+	geofenceRecoverHdop = 0.75
+)
+
+// GeofenceEvaluator evaluates circle and polygon fences against each gps fix and reports entries and exits. To avoid flapping
+// a fix has to be MarginMeters past the boundary, and poor fixes are ignored until the quality recovers. Fence state is
+// persisted so a reboot inside a fence does not report a new entry. Safe for concurrent use.
+type GeofenceEvaluator struct {
+	logger    zerolog.Logger
+	lss       loggers.SettingsStore
+	settings  models.GeofenceSettings
+	state     models.GeofenceState
+	qualityOK bool
+	mu        sync.Mutex
+}
+
+func NewGeofenceEvaluator(logger zerolog.Logger, lss loggers.SettingsStore, settings models.GeofenceSettings) *GeofenceEvaluator {
+	if settings.MaxHdop <= 0 {
+		settings.MaxHdop = defaultGeofenceMaxHdop
+	}
+	if settings.MinNsat <= 0 {
+		settings.MinNsat = defaultGeofenceMinNsat
+	}
+	if settings.MarginMeters <= 0 {
+		settings.MarginMeters = defaultGeofenceMargin
+	}
+	state, err := lss.ReadGeofenceState()
+	if err != nil || state == nil {
+		state = &models.GeofenceState{}
+	}
+	if state.Fences == nil {
+		state.Fences = map[string]models.GeofenceFenceState{}
+	}
+	ge := &GeofenceEvaluator{logger: logger, lss: lss, settings: settings, state: *state, qualityOK: true}
+	ge.SetFences(settings.Fences)
+	return ge
+}
+
+// SetFences replaces the fences, eg. when new ones are delivered. State of fences that are kept is preserved.
+func (ge *GeofenceEvaluator) SetFences(fences []models.Geofence) {
+	ge.mu.Lock()
+	defer ge.mu.Unlock()
+	valid := make([]models.Geofence, 0, len(fences))
+	ids := map[string]bool{}
+	for _, f := range fences {
+		if !validFence(f) {
+			ge.logger.Warn().Msgf("ignoring invalid geofence %s: %+v", f.ID, f)
+			continue
+		}
+		valid = append(valid, f)
+		ids[f.ID] = true
+	}
+	ge.settings.Fences = valid
+	changed := false
+	for id := range ge.state.Fences {
+		if !ids[id] {
+			delete(ge.state.Fences, id)
+			changed = true
+		}
+	}
+	if changed {
+		ge.persist()
+	}
+}
+
+func validFence(f models.Geofence) bool {
+	if f.ID == "" {
+		return false
+	}
+	switch f.Shape {
+	case models.GeofenceCircle:
+		return f.RadiusMeters > 0
+	case models.GeofencePolygon:
+		return len(f.Points) >= 3
+	}
+	return false
+}
+
+// Evaluate checks the fix against every fence and returns the entries and exits it caused
+func (ge *GeofenceEvaluator) Evaluate(ts time.Time, loc models.Location) []models.GeofenceEvent {
+	if loc.Latitude == 0 && loc.Longitude == 0 {
+		return nil
+	}
+	ge.mu.Lock()
+	defer ge.mu.Unlock()
+	if !ge.checkQuality(loc) {
+		return nil
+	}
+
+	var events []models.GeofenceEvent
+	changed := false
+	margin := ge.settings.MarginMeters
+	for _, f := range ge.settings.Fences {
+		d := signedDistance(f, loc)
+		st := ge.state.Fences[f.ID]
+		prev := st
+		if !st.Inside {
+			switch {
+			case d <= -margin:
+				if st.EnteredAt.IsZero() {
+					st.EnteredAt = ts
+				}
+				dwell := ts.Sub(st.EnteredAt).Seconds()
+				if dwell >= f.MinDwellSecs {
+					st.Inside = true
+					events = append(events, geofenceEvent(f, models.GeofenceEntry, ts, loc, dwell))
+				}
+			case d > 0:
+				st.EnteredAt = time.Time{} // left before the entry was confirmed
+			}
+		} else if d >= margin {
+			events = append(events, geofenceEvent(f, models.GeofenceExit, ts, loc, ts.Sub(st.EnteredAt).Seconds()))
+			st = models.GeofenceFenceState{ExitedAt: ts}
+		}
+		if st != prev {
+			ge.state.Fences[f.ID] = st
+			changed = true
+		}
+	}
+	if changed {
+		ge.persist()
+	}
+	return events
+}
+
+// Behavior the location overrides of the fences we are inside of: the fastest location frequency, 0 if none, and whether
+// location should be suppressed
+func (ge *GeofenceEvaluator) Behavior() (locationFrequencySecs float64, suppressLocation bool) {
+	ge.mu.Lock()
+	defer ge.mu.Unlock()
+	for _, f := range ge.settings.Fences {
+		if !ge.state.Fences[f.ID].Inside {
+			continue
+		}
+		suppressLocation = suppressLocation || f.SuppressLocation
+		if f.LocationFrequencySecs > 0 && (locationFrequencySecs == 0 || f.LocationFrequencySecs < locationFrequencySecs) {
+			locationFrequencySecs = f.LocationFrequencySecs
+		}
+	}
+	return locationFrequencySecs, suppressLocation
+}
+
+// HasLocationFrequency true if any fence overrides the location frequency
+func (ge *GeofenceEvaluator) HasLocationFrequency() bool {
+	ge.mu.Lock()
+	defer ge.mu.Unlock()
+	for _, f := range ge.settings.Fences {
+		if f.LocationFrequencySecs > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkQuality hysteresis on fix quality: once a fix is poor, fixes are ignored until hdop is comfortably below the limit
+// again, so a fix bouncing around the limit does not let through the noisy ones. Nsat 0 means the modem did not report it.
+// Must hold the lock.
+func (ge *GeofenceEvaluator) checkQuality(loc models.Location) bool {
+	nsatOK := func(atLeast int64) bool { return loc.Nsat == 0 || loc.Nsat >= atLeast }
+	if ge.qualityOK {
+		ge.qualityOK = loc.Hdop <= ge.settings.MaxHdop && nsatOK(ge.settings.MinNsat)
+	} else {
+		ge.qualityOK = loc.Hdop <= ge.settings.MaxHdop*geofenceRecoverHdop && nsatOK(ge.settings.MinNsat+1)
+	}
+	return ge.qualityOK
+}
+
+// Reset forgets which fences the previous vehicle was in, after the device was moved to another one
+func (ge *GeofenceEvaluator) Reset() {
+	ge.mu.Lock()
+	defer ge.mu.Unlock()
+	ge.state = models.GeofenceState{Fences: map[string]models.GeofenceFenceState{}}
+	ge.qualityOK = true
+}
+
+// persist must hold the lock
+func (ge *GeofenceEvaluator) persist() {
+	if err := ge.lss.WriteGeofenceState(ge.state); err != nil {
+		ge.logger.Err(err).Msg("failed to persist geofence state")
+	}
+}
+
+func geofenceEvent(f models.Geofence, t models.GeofenceEventType, ts time.Time, loc models.Location, dwell float64) models.GeofenceEvent {
+	ev := models.GeofenceEvent{
+		CommonData: models.CommonData{Timestamp: ts.UTC().UnixMilli()},
+		FenceID:    f.ID,
+		Name:       f.Name,
+		Type:       t,
+		DwellSecs:  math.Round(dwell),
+	}
+	// the fence itself is known to the backend, don't leak where in a privacy zone the vehicle is
+	if !f.SuppressLocation {
+		ev.Latitude, ev.Longitude = loc.Latitude, loc.Longitude
+	}
+	return ev
+}
+
+// signedDistance in meters from the fix to the fence boundary, negative inside
+func signedDistance(f models.Geofence, loc models.Location) float64 {
+	if f.Shape == models.GeofenceCircle {
+		return haversineKm(models.Location{Latitude: f.Latitude, Longitude: f.Longitude}, loc)*1000 - f.RadiusMeters
+	}
+	// project the polygon on a plane centered on the fix, fine at fence scale
+	cosLat := math.Cos(loc.Latitude * math.Pi / 180)
+	project := func(p models.GeoPoint) (float64, float64) {
+		x := (p.Longitude - loc.Longitude) * math.Pi / 180 * util.EarthRadiusKm * 1000 * cosLat
+		y := (p.Latitude - loc.Latitude) * math.Pi / 180 * util.EarthRadiusKm * 1000
+		return x, y
+	}
+	inside := false
+	edge := math.Inf(1)
+	n := len(f.Points)
+	for i := 0; i < n; i++ {
+		x1, y1 := project(f.Points[i])
+		x2, y2 := project(f.Points[(i+1)%n])
+		// ray casting along +x from the origin
+		if (y1 > 0) != (y2 > 0) && x1+(0-y1)*(x2-x1)/(y2-y1) > 0 {
+			inside = !inside
+		}
+		edge = math.Min(edge, distanceToSegment(x1, y1, x2, y2))
+	}
+	if inside {
+		return -edge
+	}
+	return edge
+}
+
+// distanceToSegment from the origin
+func distanceToSegment(x1, y1, x2, y2 float64) float64 {
+	dx, dy := x2-x1, y2-y1
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, -(x1*dx+y1*dy)/l))
+	}
+	return math.Hypot(x1+t*dx, y1+t*dy)
+}
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	mock_loggers "github.com/DIMO-Network/edge-network/internal/loggers/mocks"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// a ~1km square around the origin of the test
+var testPolygon = []models.GeoPoint{
+	{Latitude: 40.0, Longitude: -3.0},
+	{Latitude: 40.0, Longitude: -2.988},
+	{Latitude: 40.009, Longitude: -2.988},
+	{Latitude: 40.009, Longitude: -3.0},
+}
+
+func fix(lat, lon float64) models.Location {
+	return models.Location{Latitude: lat, Longitude: lon, Hdop: 1, Nsat: 8}
+}
+
+func newTestGeofenceEvaluator(t *testing.T, state *models.GeofenceState, fences ...models.Geofence) (*GeofenceEvaluator, *models.GeofenceState) {
+	ctrl := gomock.NewController(t)
+	lss := mock_loggers.NewMockSettingsStore(ctrl)
+	if state == nil {
+		lss.EXPECT().ReadGeofenceState().Return(nil, fmt.Errorf("not found"))
+	} else {
+		lss.EXPECT().ReadGeofenceState().Return(state, nil)
+	}
+	saved := &models.GeofenceState{}
+	lss.EXPECT().WriteGeofenceState(gomock.Any()).AnyTimes().DoAndReturn(func(s models.GeofenceState) error {
+		*saved = s
+		return nil
+	})
+	return NewGeofenceEvaluator(zerolog.Nop(), lss, models.GeofenceSettings{Fences: fences}), saved
+}
+
+func TestGeofenceEvaluator_PolygonEntryExit(t *testing.T) {
+	ge, saved := newTestGeofenceEvaluator(t, nil, models.Geofence{ID: "depot", Name: "Depot", Shape: models.GeofencePolygon, Points: testPolygon, MinDwellSecs: 30})
+	start := time.Now()
+
+	assert.Empty(t, ge.Evaluate(start, fix(39.99, -2.994)))
+	// inside, but entry is only reported after the dwell
+	assert.Empty(t, ge.Evaluate(start.Add(10*time.Second), fix(40.0045, -2.994)))
+	events := ge.Evaluate(start.Add(40*time.Second), fix(40.0046, -2.994))
+	require.Len(t, events, 1)
+	assert.Equal(t, models.GeofenceEntry, events[0].Type)
+	assert.Equal(t, "depot", events[0].FenceID)
+	assert.Equal(t, "Depot", events[0].Name)
+	assert.Equal(t, 30.0, events[0].DwellSecs)
+	assert.True(t, saved.Fences["depot"].Inside)
+
+	// just outside the boundary, within the margin, is not an exit
+	assert.Empty(t, ge.Evaluate(start.Add(50*time.Second), fix(40.00905, -2.994)))
+	events = ge.Evaluate(start.Add(100*time.Second), fix(40.0095, -2.994))
+	require.Len(t, events, 1)
+	assert.Equal(t, models.GeofenceExit, events[0].Type)
+	assert.Equal(t, 90.0, events[0].DwellSecs)
+	assert.False(t, saved.Fences["depot"].Inside)
+}
+
+func TestGeofenceEvaluator_CircleAndBehavior(t *testing.T) {
+	ge, _ := newTestGeofenceEvaluator(t, nil,
+		models.Geofence{ID: "home", Shape: models.GeofenceCircle, Latitude: 40, Longitude: -3, RadiusMeters: 200, SuppressLocation: true},
+		models.Geofence{ID: "site", Shape: models.GeofenceCircle, Latitude: 40, Longitude: -3, RadiusMeters: 1000, LocationFrequencySecs: 2},
+	)
+	assert.True(t, ge.HasLocationFrequency())
+	start := time.Now()
+
+	// ~500m away, inside site only
+	events := ge.Evaluate(start, fix(40.0045, -3))
+	require.Len(t, events, 1)
+	assert.Equal(t, "site", events[0].FenceID)
+	freq, suppress := ge.Behavior()
+	assert.Equal(t, 2.0, freq)
+	assert.False(t, suppress)
+
+	events = ge.Evaluate(start.Add(time.Minute), fix(40.0001, -3))
+	require.Len(t, events, 1)
+	assert.Equal(t, "home", events[0].FenceID)
+	// privacy zone events don't carry the location
+	assert.Zero(t, events[0].Latitude)
+	_, suppress = ge.Behavior()
+	assert.True(t, suppress)
+}
+
+func TestGeofenceEvaluator_QualityHysteresis(t *testing.T) {
+	ge, _ := newTestGeofenceEvaluator(t, nil, models.Geofence{ID: "depot", Shape: models.GeofencePolygon, Points: testPolygon})
+	start := time.Now()
+	inside := fix(40.0045, -2.994)
+
+	bad := inside
+	bad.Hdop = 4
+	assert.Empty(t, ge.Evaluate(start, bad))
+	// good enough to keep trusting fixes, but not to recover after a bad one
+	borderline := inside
+	borderline.Hdop = 2.8
+	assert.Empty(t, ge.Evaluate(start.Add(time.Second), borderline))
+	fewSats := inside
+	fewSats.Nsat = 3
+	assert.Empty(t, ge.Evaluate(start.Add(2*time.Second), fewSats))
+
+	assert.Len(t, ge.Evaluate(start.Add(3*time.Second), inside), 1)
+}
+
+func TestGeofenceEvaluator_StateSurvivesRestart(t *testing.T) {
+	entered := time.Now().Add(-time.Hour)
+	state := &models.GeofenceState{Fences: map[string]models.GeofenceFenceState{
+		"depot": {Inside: true, EnteredAt: entered},
+		"gone":  {Inside: true, EnteredAt: entered},
+	}}
+	ge, saved := newTestGeofenceEvaluator(t, state, models.Geofence{ID: "depot", Shape: models.GeofencePolygon, Points: testPolygon})
+	// removed fences are dropped
+	assert.NotContains(t, saved.Fences, "gone")
+
+	// still inside after reboot, no new entry
+	assert.Empty(t, ge.Evaluate(time.Now(), fix(40.0045, -2.994)))
+	events := ge.Evaluate(time.Now(), fix(39.99, -2.994))
+	require.Len(t, events, 1)
+	assert.Equal(t, models.GeofenceExit, events[0].Type)
+	assert.InDelta(t, 3600, events[0].DwellSecs, 2)
+}
+
+func TestSignedDistance(t *testing.T) {
+	square := models.Geofence{Shape: models.GeofencePolygon, Points: testPolygon}
+	// center is ~500m from every side
+	assert.InDelta(t, -500, signedDistance(square, fix(40.0045, -2.994)), 5)
+	assert.InDelta(t, 111, signedDistance(square, fix(39.999, -2.994)), 1)
+	// outside past a corner
+	assert.Greater(t, signedDistance(square, fix(40.01, -2.98)), 0.0)
+
+	circle := models.Geofence{Shape: models.GeofenceCircle, Latitude: 40, Longitude: -3, RadiusMeters: 100}
+	assert.InDelta(t, -100, signedDistance(circle, fix(40, -3)), 0.001)
+	assert.InDelta(t, 11.2, signedDistance(circle, fix(40.001, -3)), 0.1)
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/api"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/pkg/errors"
+)
+
+// gnssStaleAfter the modem keeps returning its last fix when it loses it, a fix time that hasn't moved for this long is stale
+const gnssStaleAfter = 5 * time.Second
+
+var (
+	ErrNoGPSFix    = errors.New("no gps fix")
+	ErrStaleGPSFix = errors.New("stale gps fix")
+)
+
+// gnssFilter validates modem gps responses so cold starts and lost fixes don't end up as 0,0 or repeated positions.
+// The zero value is ready to use, safe for concurrent use.
+type gnssFilter struct {
+	lastFixTime time.Time
+	// lastAdvanced system time at which the fix time last moved forward
+	lastAdvanced time.Time
+	mu           sync.Mutex
+}
+
+// location maps a modem response to a location, or returns ErrNoGPSFix / ErrStaleGPSFix. now is the system time of the query.
+func (g *gnssFilter) location(resp api.GPSLocationResponse, now time.Time) (*models.Location, error) {
+	// fix is not reported by all modem firmwares, when it is anything other than 2D or 3D there is no fix
+	if resp.Fix != "" && !strings.EqualFold(resp.Fix, "2D") && !strings.EqualFold(resp.Fix, "3D") {
+		return nil, ErrNoGPSFix
+	}
+	if resp.Lat == 0 && resp.Lon == 0 {
+		return nil, ErrNoGPSFix
+	}
+	location := &models.Location{
+		Hdop:        resp.Hdop,
+		Nsat:        resp.Nsat,
+		NsatGlonass: resp.NsatGlonass,
+		Latitude:    resp.Lat,
+		Longitude:   resp.Lon,
+		Altitude:    resp.Alt,
+		Fix:         resp.Fix,
+		Cog:         resp.Cog,
+		SogKm:       resp.SogKm,
+	}
+	fixTime, ok := resp.UTC()
+	if !ok {
+		return location, nil
+	}
+	location.FixTime = fixTime.UnixMilli()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if fixTime.After(g.lastFixTime) {
+		g.lastFixTime = fixTime
+		g.lastAdvanced = now
+		return location, nil
+	}
+	if now.Sub(g.lastAdvanced) >= gnssStaleAfter {
+		return nil, ErrStaleGPSFix
+	}
+	return location, nil
+}
+
+// locationTimestamp the gnss fix time in unix millis, which is authoritative for location signals, or fallback if unknown
+func locationTimestamp(location models.Location, fallback time.Time) int64 {
+	if location.FixTime > 0 {
+		return location.FixTime
+	}
+	return fallback.UTC().UnixMilli()
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/api"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_gnssFilter_location(t *testing.T) {
+	g := gnssFilter{}
+	now := time.Now()
+	resp := api.GPSLocationResponse{Lat: 53.485885, Lon: -113.507695, Alt: 665.2, Hdop: 0.8, Nsat: 7, NsatGlonass: 3,
+		Fix: "3D", Cog: 12.4, SogKm: 42, TimeUTC: "02:04:27", DateUTC: "2024-02-28"}
+
+	location, err := g.location(resp, now)
+	require.NoError(t, err)
+	assert.Equal(t, models.Location{Hdop: 0.8, Latitude: 53.485885, Longitude: -113.507695, Nsat: 7, NsatGlonass: 3,
+		Altitude: 665.2, Fix: "3D", Cog: 12.4, SogKm: 42,
+		FixTime: time.Date(2024, 2, 28, 2, 4, 27, 0, time.UTC).UnixMilli()}, *location)
+
+	// same fix again within a few seconds is fine, the receiver reports once a second
+	_, err = g.location(resp, now.Add(time.Second))
+	require.NoError(t, err)
+	// but not once it hasn't moved for a while
+	_, err = g.location(resp, now.Add(6*time.Second))
+	assert.ErrorIs(t, err, ErrStaleGPSFix)
+	resp.TimeUTC = "02:04:33.5"
+	_, err = g.location(resp, now.Add(7*time.Second))
+	require.NoError(t, err)
+
+	// cold start
+	_, err = g.location(api.GPSLocationResponse{Fix: "no fix"}, now)
+	assert.ErrorIs(t, err, ErrNoGPSFix)
+	_, err = g.location(api.GPSLocationResponse{Lat: 53.48, Lon: -113.5, Fix: "1"}, now)
+	assert.ErrorIs(t, err, ErrNoGPSFix)
+	_, err = g.location(api.GPSLocationResponse{}, now)
+	assert.ErrorIs(t, err, ErrNoGPSFix)
+
+	// modems that don't report fix nor time
+	location, err = g.location(api.GPSLocationResponse{Lat: 37.7749, Lon: -122.4194}, now)
+	require.NoError(t, err)
+	assert.Zero(t, location.FixTime)
+	assert.Equal(t, now.UTC().UnixMilli(), locationTimestamp(*location, now))
+}
+
+func Test_appendLocationSignals(t *testing.T) {
+	location := models.Location{Latitude: 1, Longitude: 2, Hdop: 0.9, Nsat: 8, Altitude: 3}
+	assert.Len(t, appendLocationSignals(nil, location, 10), 5)
+
+	location.Fix, location.SogKm, location.Cog = "2D", 55, 180
+	signals := appendLocationSignals(nil, location, 10)
+	require.Len(t, signals, 7)
+	assert.Equal(t, models.SignalData{Timestamp: 10, Name: "gpsSpeed", Value: 55.0, Unit: "km/h", Source: models.SignalSourceGPS}, signals[5])
+	assert.Equal(t, models.SignalData{Timestamp: 10, Name: "gpsHeading", Value: 180.0, Unit: "degrees", Source: models.SignalSourceGPS}, signals[6])
+
+	// dead reckoning is flagged with its accuracy
+	signals = appendLocationSignals(nil, models.Location{Latitude: 1, Longitude: 2, Estimated: true, AccuracyMeters: 25}, 10)
+	require.Len(t, signals, 4)
+	assert.Equal(t, models.SignalData{Timestamp: 10, Name: "locationEstimated", Value: true, Source: models.SignalSourceGPS}, signals[2])
+	assert.Equal(t, models.SignalData{Timestamp: 10, Name: "locationAccuracy", Value: 25.0, Unit: "m", Source: models.SignalSourceGPS}, signals[3])
+}
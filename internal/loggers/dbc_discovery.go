@@ -0,0 +1,362 @@
+package loggers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/canbus"
+	"github.com/DIMO-Network/edge-network/internal/clock"
+	"github.com/DIMO-Network/edge-network/internal/models"
+)
+
+const (
+	// only keep a sample every so often per id for correlation, bounds memory on busy buses
+	discoverySampleEvery = 200 * time.Millisecond
+	discoveryMaxSamples  = 1500
+	// a reference value older than this is not used to pair against a frame
+	discoveryMaxRefAge = 5 * time.Second
+	discoveryMinPairs  = 10
+	// detection thresholds, fraction of frames
+	discoveryCounterRate  = 0.9
+	discoveryChecksumRate = 0.95
+	discoveryMinFrames    = 10
+	// MinCorrelation is the pearson coefficient (absolute) above which a bit range is reported as tracking a signal
+	MinCorrelation = 0.9
+)
+
+// TrafficAnalyzer collects statistics of passive can traffic per arbitration id, to find candidate dbc signals for vehicles
+// we don't have a dbc for: frequency, dlc, byte entropy, rolling counters, checksums and bit ranges that track known pids.
+// Not safe for concurrent use.
+type TrafficAnalyzer struct {
+	ids        map[uint32]*idStats
+	references map[string][]refSample
+	total      int
+	start      time.Time
+	last       time.Time
+}
+
+type idStats struct {
+	id          uint32
+	extended    bool
+	count       int
+	first, last time.Time
+	minDLC      int
+	maxDLC      int
+	hist        [8][256]int
+	positions   [8]int
+	prev        []byte
+	transitions [8]int
+	counterHits [8]int
+	nibbleHits  [8][2]int
+	checkable   int
+	sum8Hits    [8]int
+	xor8Hits    [8]int
+	samples     []frameSample
+}
+
+type frameSample struct {
+	ts   time.Time
+	data []byte
+}
+
+type refSample struct {
+	ts    time.Time
+	value float64
+}
+
+func NewTrafficAnalyzer() *TrafficAnalyzer {
+	return &TrafficAnalyzer{ids: make(map[uint32]*idStats), references: make(map[string][]refSample)}
+}
+
+// AddFrame records a received frame. Remote and error frames are ignored.
+func (ta *TrafficAnalyzer) AddFrame(ts time.Time, frame canbus.Frame) {
+	if frame.Kind == canbus.RTR || frame.Kind == canbus.ERTR || frame.Kind == canbus.ERR {
+		return
+	}
+	if ta.start.IsZero() {
+		ta.start = ts
+	}
+	ta.last = ts
+	ta.total++
+
+	s, ok := ta.ids[frame.ID]
+	if !ok {
+		s = &idStats{id: frame.ID, extended: frame.Kind == canbus.EFF, first: ts, minDLC: len(frame.Data), maxDLC: len(frame.Data)}
+		ta.ids[frame.ID] = s
+	}
+	s.add(ts, frame.Data)
+}
+
+// AddReference records the value of a known signal, eg. polled speed or rpm, to correlate bit ranges against
+func (ta *TrafficAnalyzer) AddReference(name string, ts time.Time, value float64) {
+	refs := ta.references[name]
+	if len(refs) > 0 && !ts.After(refs[len(refs)-1].ts) {
+		return // keep sorted, we only need one value per timestamp
+	}
+	ta.references[name] = append(refs, refSample{ts: ts, value: value})
+}
+
+func (s *idStats) add(ts time.Time, data []byte) {
+	s.count++
+	s.last = ts
+	s.minDLC = min(s.minDLC, len(data))
+	s.maxDLC = max(s.maxDLC, len(data))
+	for i, b := range data {
+		s.hist[i][b]++
+		s.positions[i]++
+	}
+	if len(s.prev) == len(data) {
+		for i, b := range data {
+			p := s.prev[i]
+			s.transitions[i]++
+			if b == p+1 {
+				s.counterHits[i]++
+			}
+			if b&0x0f == (p+1)&0x0f {
+				s.nibbleHits[i][0]++
+			}
+			if b>>4 == ((p>>4)+1)&0x0f {
+				s.nibbleHits[i][1]++
+			}
+		}
+	}
+	if len(data) > 1 {
+		s.checkable++
+		var sum, xor byte
+		for _, b := range data {
+			sum += b
+			xor ^= b
+		}
+		for i, b := range data {
+			// checksum over every other byte
+			if sum-b == b {
+				s.sum8Hits[i]++
+			}
+			if xor^b == b {
+				s.xor8Hits[i]++
+			}
+		}
+	}
+	s.prev = append(s.prev[:0], data...)
+
+	if len(s.samples) < discoveryMaxSamples &&
+		(len(s.samples) == 0 || ts.Sub(s.samples[len(s.samples)-1].ts) >= discoverySampleEvery) {
+		s.samples = append(s.samples, frameSample{ts: ts, data: append([]byte(nil), data...)})
+	}
+}
+
+// Report summarizes everything seen so far, ids sorted ascending
+func (ta *TrafficAnalyzer) Report() models.DBCDiscoveryReport {
+	report := models.DBCDiscoveryReport{
+		Timestamp:   clock.Now().UTC().UnixMilli(),
+		WindowSecs:  ta.last.Sub(ta.start).Seconds(),
+		TotalFrames: ta.total,
+		References:  make(map[string]int),
+	}
+	for name, refs := range ta.references {
+		report.References[name] = len(refs)
+	}
+	ids := make([]uint32, 0, len(ta.ids))
+	for id := range ta.ids {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		report.IDs = append(report.IDs, ta.candidate(ta.ids[id]))
+	}
+	return report
+}
+
+func (ta *TrafficAnalyzer) candidate(s *idStats) models.DBCCandidateID {
+	c := models.DBCCandidateID{
+		ID:       fmt.Sprintf("%X", s.id),
+		Extended: s.extended,
+		Count:    s.count,
+		MinDLC:   s.minDLC,
+		MaxDLC:   s.maxDLC,
+	}
+	if span := s.last.Sub(s.first).Seconds(); span > 0 {
+		c.FrequencyHz = round(float64(s.count-1)/span, 2)
+	}
+	c.ByteEntropy = make([]float64, s.maxDLC)
+	for i := 0; i < s.maxDLC; i++ {
+		c.ByteEntropy[i] = round(entropy(s.hist[i][:], s.positions[i]), 3)
+	}
+	if s.count < discoveryMinFrames {
+		return c
+	}
+	for i := 0; i < s.maxDLC; i++ {
+		t := float64(s.transitions[i])
+		if t == 0 || c.ByteEntropy[i] == 0 {
+			continue
+		}
+		switch {
+		case float64(s.counterHits[i])/t >= discoveryCounterRate:
+			c.CounterBytes = append(c.CounterBytes, fmt.Sprintf("%d", i))
+		case float64(s.nibbleHits[i][0])/t >= discoveryCounterRate:
+			c.CounterBytes = append(c.CounterBytes, fmt.Sprintf("%d.lo", i))
+		case float64(s.nibbleHits[i][1])/t >= discoveryCounterRate:
+			c.CounterBytes = append(c.CounterBytes, fmt.Sprintf("%d.hi", i))
+		}
+	}
+	if s.checkable > 0 {
+		for i := 0; i < s.maxDLC; i++ {
+			if c.ByteEntropy[i] == 0 {
+				continue // a constant byte trivially matches when the rest sums to it
+			}
+			for _, alg := range []struct {
+				name string
+				hits int
+			}{{"sum8", s.sum8Hits[i]}, {"xor8", s.xor8Hits[i]}} {
+				rate := float64(alg.hits) / float64(s.checkable)
+				// xor over the whole frame matches on every byte, on ties prefer the last byte which is the usual place
+				if rate >= discoveryChecksumRate && (c.Checksum == nil || rate >= c.Checksum.MatchRate) {
+					c.Checksum = &models.DBCChecksumCandidate{Byte: i, Algorithm: alg.name, MatchRate: round(rate, 3)}
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(ta.references))
+	for name := range ta.references {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if corr, ok := ta.correlate(s, name, c.ByteEntropy); ok {
+			c.Correlations = append(c.Correlations, corr)
+		}
+	}
+	return c
+}
+
+// bitRange is a byte aligned 8 or 16 bit candidate signal
+type bitRange struct {
+	offset    int
+	length    int
+	bigEndian bool
+}
+
+func (r bitRange) value(data []byte) (float64, bool) {
+	if r.offset+r.length/8 > len(data) {
+		return 0, false
+	}
+	if r.length == 8 {
+		return float64(data[r.offset]), true
+	}
+	hi, lo := data[r.offset], data[r.offset+1]
+	if !r.bigEndian {
+		hi, lo = lo, hi
+	}
+	return float64(uint16(hi)<<8 | uint16(lo)), true
+}
+
+// startBit in dbc notation: lsb for little endian (Intel), msb for big endian (Motorola)
+func (r bitRange) startBit() int {
+	if r.bigEndian {
+		return r.offset*8 + 7
+	}
+	return r.offset * 8
+}
+
+// correlate finds the bit range of this id that best tracks the reference signal, if any is above MinCorrelation
+func (ta *TrafficAnalyzer) correlate(s *idStats, name string, byteEntropy []float64) (models.DBCSignalCorrelation, bool) {
+	refs := ta.references[name]
+	if len(refs) < 2 || len(s.samples) < discoveryMinPairs {
+		return models.DBCSignalCorrelation{}, false
+	}
+	// pair each sample with the latest reference value before it
+	refValues := make([]float64, len(s.samples))
+	paired := make([]bool, len(s.samples))
+	for i, sample := range s.samples {
+		j := sort.Search(len(refs), func(k int) bool { return refs[k].ts.After(sample.ts) }) - 1
+		if j >= 0 && sample.ts.Sub(refs[j].ts) <= discoveryMaxRefAge {
+			refValues[i] = refs[j].value
+			paired[i] = true
+		}
+	}
+
+	var ranges []bitRange
+	// skip constant bytes, but a 16 bit value whose high byte has not changed yet is still a candidate
+	for o := 0; o < s.minDLC; o++ {
+		if byteEntropy[o] > 0 {
+			ranges = append(ranges, bitRange{offset: o, length: 8})
+		}
+		if o+1 < s.minDLC && (byteEntropy[o] > 0 || byteEntropy[o+1] > 0) {
+			ranges = append(ranges, bitRange{offset: o, length: 16, bigEndian: true}, bitRange{offset: o, length: 16})
+		}
+	}
+
+	best := models.DBCSignalCorrelation{}
+	found := false
+	for _, r := range ranges {
+		var xs, ys []float64
+		for i, sample := range s.samples {
+			if !paired[i] {
+				continue
+			}
+			if x, ok := r.value(sample.data); ok {
+				xs = append(xs, x)
+				ys = append(ys, refValues[i])
+			}
+		}
+		if len(xs) < discoveryMinPairs {
+			continue
+		}
+		coef, scale, offset, ok := linearFit(xs, ys)
+		if !ok || math.Abs(coef) < MinCorrelation || math.Abs(coef) <= math.Abs(best.Coefficient) {
+			continue
+		}
+		found = true
+		best = models.DBCSignalCorrelation{Signal: name, StartBit: r.startBit(), Length: r.length, BigEndian: r.bigEndian,
+			Coefficient: round(coef, 4), Scale: round(scale, 6), Offset: round(offset, 4), Samples: len(xs)}
+	}
+	return best, found
+}
+
+// linearFit returns the pearson correlation coefficient and least squares ys = scale * xs + offset
+func linearFit(xs, ys []float64) (coef, scale, offset float64, ok bool) {
+	n := float64(len(xs))
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx /= n
+	my /= n
+	var cov, vx, vy float64
+	for i := range xs {
+		dx, dy := xs[i]-mx, ys[i]-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 || vy == 0 {
+		return 0, 0, 0, false
+	}
+	scale = cov / vx
+	return cov / math.Sqrt(vx*vy), scale, my - scale*mx, true
+}
+
+// entropy shannon entropy in bits of the histogram
+func entropy(hist []int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	e := 0.0
+	for _, c := range hist {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(total)
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+func round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
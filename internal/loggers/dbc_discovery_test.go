@@ -0,0 +1,85 @@
+package loggers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/canbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrafficAnalyzer_Report(t *testing.T) {
+	ta := NewTrafficAnalyzer()
+	start := time.Date(2024, 2, 29, 17, 17, 30, 0, time.UTC)
+
+	for i := 0; i < 500; i++ {
+		ts := start.Add(time.Duration(i) * 50 * time.Millisecond) // 20hz
+		// speed ramps 0 -> 100 km/h and back, encoded big endian in bytes 1-2 with 0.01 scale
+		speed := float64(i % 250)
+		if i >= 250 {
+			speed = float64(500 - i)
+		}
+		raw := uint16(speed * 100)
+		data := []byte{0x11, byte(raw >> 8), byte(raw), 0, 0, 0, byte(i % 16), 0}
+		var xor byte
+		for _, b := range data[:7] {
+			xor ^= b
+		}
+		data[7] = xor
+		ta.AddFrame(ts, canbus.Frame{ID: 0x3e9, Data: data, Kind: canbus.SFF})
+		// constant frame at 10hz
+		if i%2 == 0 {
+			ta.AddFrame(ts, canbus.Frame{ID: 0x120, Data: []byte{0, 0, 0x10, 0, 0}, Kind: canbus.SFF})
+		}
+		// polled speed comes in once a second
+		if i%20 == 0 {
+			ta.AddReference("speed", ts, speed)
+		}
+	}
+
+	report := ta.Report()
+	assert.Equal(t, 750, report.TotalFrames)
+	assert.Equal(t, 25, report.References["speed"])
+	require.Len(t, report.IDs, 2)
+
+	constant := report.IDs[0]
+	assert.Equal(t, "120", constant.ID)
+	assert.InDelta(t, 10, constant.FrequencyHz, 0.1)
+	assert.Equal(t, []float64{0, 0, 0, 0, 0}, constant.ByteEntropy)
+	assert.Empty(t, constant.CounterBytes)
+	assert.Nil(t, constant.Checksum)
+	assert.Empty(t, constant.Correlations)
+
+	c := report.IDs[1]
+	assert.Equal(t, "3E9", c.ID)
+	assert.InDelta(t, 20, c.FrequencyHz, 0.1)
+	assert.Equal(t, 8, c.MaxDLC)
+	assert.Equal(t, 0.0, c.ByteEntropy[0])
+	assert.Greater(t, c.ByteEntropy[2], 5.0)
+	assert.Equal(t, []string{"6"}, c.CounterBytes)
+	require.NotNil(t, c.Checksum)
+	assert.Equal(t, 7, c.Checksum.Byte)
+	assert.Equal(t, "xor8", c.Checksum.Algorithm)
+
+	require.Len(t, c.Correlations, 1)
+	corr := c.Correlations[0]
+	assert.Equal(t, "speed", corr.Signal)
+	assert.Equal(t, 15, corr.StartBit)
+	assert.Equal(t, 16, corr.Length)
+	assert.True(t, corr.BigEndian)
+	assert.InDelta(t, 1, corr.Coefficient, 0.01)
+	assert.InDelta(t, 0.01, corr.Scale, 0.001)
+	assert.InDelta(t, 0, corr.Offset, 1)
+}
+
+func Test_linearFit(t *testing.T) {
+	coef, scale, offset, ok := linearFit([]float64{0, 1, 2, 3}, []float64{-40, -39, -38, -37})
+	require.True(t, ok)
+	assert.InDelta(t, 1, coef, 0.0001)
+	assert.InDelta(t, 1, scale, 0.0001)
+	assert.InDelta(t, -40, offset, 0.0001)
+
+	_, _, _, ok = linearFit([]float64{1, 1, 1}, []float64{1, 2, 3})
+	assert.False(t, ok, "no variance")
+}
@@ -14,10 +14,10 @@ import (
 func ExtractAndDecodeWithDBCFormula(hexData, pid, formula string) (float64, string, error) {
 	formula = strings.TrimPrefix(formula, "dbc:")
 	// Parse formula
-	re := regexp.MustCompile(`(\d+)\|(\d+)@(\d+)\+ \(([^,]+),([^)]+)\) \[([^|]+)\|([^]]+)] "([^"]+)"`)
+	re := regexp.MustCompile(`(\d+)\|(\d+)@(\d+)([+-]) \(([^,]+),([^)]+)\) \[([^|]+)\|([^]]+)] "([^"]+)"`)
 	matches := re.FindStringSubmatch(formula)
 
-	if len(matches) != 9 {
+	if len(matches) != 10 {
 		return 0, "", fmt.Errorf("invalid formula format: %s", formula)
 	}
 
@@ -52,28 +52,32 @@ func ExtractAndDecodeWithDBCFormula(hexData, pid, formula string) (float64, stri
 	if err != nil {
 		return 0, "", err
 	}
+	raw := float64(value)
+	if matches[4] == "-" {
+		raw = twosComplement(value, numBytes*8)
+	}
 
 	// Parse the formula parameters
-	scaleFactor, err := strconv.ParseFloat(matches[4], 64)
+	scaleFactor, err := strconv.ParseFloat(matches[5], 64)
 	if err != nil {
 		return 0, "", err
 	}
-	offsetAdjustment, err := strconv.ParseFloat(matches[5], 64)
+	offsetAdjustment, err := strconv.ParseFloat(matches[6], 64)
 	if err != nil {
 		return 0, "", err
 	}
-	minValue, err := strconv.ParseFloat(matches[6], 64)
+	minValue, err := strconv.ParseFloat(matches[7], 64)
 	if err != nil {
 		return 0, "", err
 	}
-	maxValue, err := strconv.ParseFloat(matches[7], 64)
+	maxValue, err := strconv.ParseFloat(matches[8], 64)
 	if err != nil {
 		return 0, "", err
 	}
-	unit := matches[8]
+	unit := matches[9]
 
 	// Apply the formula
-	decodedValue := float64(value)*scaleFactor + offsetAdjustment
+	decodedValue := raw*scaleFactor + offsetAdjustment
 
 	// Validate the range
 	if decodedValue < minValue || decodedValue > maxValue {
@@ -88,10 +92,10 @@ func ExtractAndDecodeWithDBCFormula(hexData, pid, formula string) (float64, stri
 func ParsePIDBytesWithDBCFormula(frameData []byte, pid uint32, formula string) (float64, string, error) {
 	formula = strings.TrimPrefix(formula, "dbc:")
 	// Parse formula
-	re := regexp.MustCompile(`(\d+)\|(\d+)@(\d+)\+ \(([^,]+),([^)]+)\) \[([^|]+)\|([^]]+)] "([^"]+)"`)
+	re := regexp.MustCompile(`(\d+)\|(\d+)@(\d+)([+-]) \(([^,]+),([^)]+)\) \[([^|]+)\|([^]]+)] "([^"]+)"`)
 	matches := re.FindStringSubmatch(formula)
 
-	if len(matches) != 9 {
+	if len(matches) != 10 {
 		return 0, "", fmt.Errorf("invalid formula format: %s", formula)
 	}
 
@@ -133,28 +137,32 @@ func ParsePIDBytesWithDBCFormula(frameData []byte, pid uint32, formula string) (
 	if err != nil {
 		return 0, "", err
 	}
+	raw := float64(value)
+	if matches[4] == "-" {
+		raw = twosComplement(value, len(valueBytes)*8)
+	}
 
 	// Parse the formula parameters
-	scaleFactor, err := strconv.ParseFloat(matches[4], 64)
+	scaleFactor, err := strconv.ParseFloat(matches[5], 64)
 	if err != nil {
 		return 0, "", err
 	}
-	offsetAdjustment, err := strconv.ParseFloat(matches[5], 64)
+	offsetAdjustment, err := strconv.ParseFloat(matches[6], 64)
 	if err != nil {
 		return 0, "", err
 	}
-	minValue, err := strconv.ParseFloat(matches[6], 64)
+	minValue, err := strconv.ParseFloat(matches[7], 64)
 	if err != nil {
 		return 0, "", err
 	}
-	maxValue, err := strconv.ParseFloat(matches[7], 64)
+	maxValue, err := strconv.ParseFloat(matches[8], 64)
 	if err != nil {
 		return 0, "", err
 	}
-	unit := matches[8]
+	unit := matches[9]
 
 	// Apply the formula
-	decodedValue := float64(value)*scaleFactor + offsetAdjustment
+	decodedValue := raw*scaleFactor + offsetAdjustment
 
 	// Validate the range
 	if decodedValue < minValue || decodedValue > maxValue {
@@ -167,24 +175,74 @@ func ParsePIDBytesWithDBCFormula(frameData []byte, pid uint32, formula string) (
 // DecodePassiveFrame takes in passively captured frame via DBC file that is meant to be decoded with a DBC formula.
 // Used for DBC passive scanning decoding values.
 func DecodePassiveFrame(frameData []byte, dbcFormula string) (float64, string, error) {
-	// Parse formula
-	re := regexp.MustCompile(`(\d+)\|(\d+)@(\d+)\+ \(([^,]+),([^)]+)\) \[([^|]+)\|([^]]+)] "([^"]+)"`)
-	matches := re.FindStringSubmatch(dbcFormula)
-
-	if len(matches) != 9 {
-		return 0, "", fmt.Errorf("invalid formula format: %s", dbcFormula)
-	}
-
-	lengthBits, err := strconv.Atoi(matches[2]) // eg. get the 24 in `7|24 ...`
+	formula, err := parsePassiveFormula(dbcFormula)
 	if err != nil {
 		return 0, "", err
 	}
-	numBytes := lengthBits / 8
-
-	startPosBits, err := strconv.Atoi(matches[1]) // eg. get the 7 in `7|24 ...`
+	value, err := formula.rawValue(frameData)
 	if err != nil {
 		return 0, "", err
 	}
+	// Apply the formula
+	decodedValue := formula.signedValue(value)*formula.scale + formula.offset
+
+	// Validate the range
+	if decodedValue < formula.min || decodedValue > formula.max {
+		return 0, "", fmt.Errorf("decoded value out of range: %.2f (expected range %.2f to %.2f)", decodedValue, formula.min, formula.max)
+	}
+
+	return roundToTwoDecimals(decodedValue), formula.unit, nil
+}
+
+// passiveFormula the parts of a dbc file signal, eg. 7|32@0+ (0.015625,0) [0|67108863.984375] "km"
+type passiveFormula struct {
+	startBit   int
+	lengthBits int
+	signed     bool
+	scale      float64
+	offset     float64
+	min        float64
+	max        float64
+	unit       string
+}
+
+// unit can be empty, eg. state signals
+var passiveFormulaRegex = regexp.MustCompile(`(\d+)\|(\d+)@(\d+)([+-]) \(([^,]+),([^)]+)\) \[([^|]+)\|([^]]+)] "([^"]*)"`)
+
+func parsePassiveFormula(dbcFormula string) (passiveFormula, error) {
+	matches := passiveFormulaRegex.FindStringSubmatch(dbcFormula)
+	if len(matches) != 10 {
+		return passiveFormula{}, fmt.Errorf("invalid formula format: %s", dbcFormula)
+	}
+	var f passiveFormula
+	var err error
+	if f.startBit, err = strconv.Atoi(matches[1]); err != nil { // eg. get the 7 in `7|24 ...`
+		return f, err
+	}
+	if f.lengthBits, err = strconv.Atoi(matches[2]); err != nil { // eg. get the 24 in `7|24 ...`
+		return f, err
+	}
+	f.signed = matches[4] == "-"
+	if f.scale, err = strconv.ParseFloat(matches[5], 64); err != nil {
+		return f, err
+	}
+	if f.offset, err = strconv.ParseFloat(matches[6], 64); err != nil {
+		return f, err
+	}
+	if f.min, err = strconv.ParseFloat(matches[7], 64); err != nil {
+		return f, err
+	}
+	if f.max, err = strconv.ParseFloat(matches[8], 64); err != nil {
+		return f, err
+	}
+	f.unit = matches[9]
+	return f, nil
+}
+
+// rawValue the unscaled bytes of the signal in the frame as an unsigned integer
+func (f passiveFormula) rawValue(frameData []byte) (uint64, error) {
+	numBytes := f.lengthBits / 8
+	startPosBits := f.startBit
 	// this part I don't get, starting on pos bit 7 is like starting at the beginning of the data frame as the socket library gets it.
 	if startPosBits >= 7 {
 		startPosBits = startPosBits - 7
@@ -200,45 +258,32 @@ func DecodePassiveFrame(frameData []byte, dbcFormula string) (float64, string, e
 
 	if len(frameData) < dataEndPos {
 		// control for formula data length being longer than available bytes
-		return 0, "", fmt.Errorf("formula length longer than frame data length: %d vs. %d", dataEndPos, len(frameData))
+		return 0, fmt.Errorf("formula length longer than frame data length: %d vs. %d", dataEndPos, len(frameData))
 	}
 
 	valueBytes := frameData[startBytes:dataEndPos]
 	valueHex := hex.EncodeToString(valueBytes)
 	//fmt.Printf("value in hex: %s\n", valueHex) // for debugging
-	value, err := strconv.ParseUint(valueHex, 16, 64)
-	if err != nil {
-		return 0, "", err
-	}
-	// Parse the formula parameters
-	scaleFactor, err := strconv.ParseFloat(matches[4], 64)
-	if err != nil {
-		return 0, "", err
-	}
+	return strconv.ParseUint(valueHex, 16, 64)
+}
 
-	offsetAdjustment, err := strconv.ParseFloat(matches[5], 64)
-	if err != nil {
-		return 0, "", err
-	}
-	minValue, err := strconv.ParseFloat(matches[6], 64)
-	if err != nil {
-		return 0, "", err
+// signedValue the raw value as two's complement for signed (@N-) signals
+func (f passiveFormula) signedValue(raw uint64) float64 {
+	if !f.signed {
+		return float64(raw)
 	}
-	maxValue, err := strconv.ParseFloat(matches[7], 64)
-	if err != nil {
-		return 0, "", err
-	}
-	unit := matches[8]
-
-	// Apply the formula
-	decodedValue := float64(value)*scaleFactor + offsetAdjustment
+	return twosComplement(raw, f.lengthBits)
+}
 
-	// Validate the range
-	if decodedValue < minValue || decodedValue > maxValue {
-		return 0, "", fmt.Errorf("decoded value out of range: %.2f (expected range %.2f to %.2f)", decodedValue, minValue, maxValue)
+// twosComplement the value of the lowest bits as a signed integer
+func twosComplement(value uint64, bits int) float64 {
+	if bits <= 0 || bits >= 64 {
+		return float64(int64(value))
 	}
-
-	return roundToTwoDecimals(decodedValue), unit, nil
+	if value&(1<<(bits-1)) != 0 {
+		return float64(int64(value) - int64(1)<<bits)
+	}
+	return float64(value)
 }
 
 func roundToTwoDecimals(f float64) float64 {
@@ -38,6 +38,9 @@ func TestExtractAndDecodeWithFormula(t *testing.T) {
 		{"7e803410585aaaaaaaa", "05", "31|8@0+ (1,-40) [-40|215] \"degC\"", 93, "degC", ""}, // 0 padded pid
 		// mache odoemteter
 		{"7e80662dd01003f5acc", "dd01", "39|24@0+ (1,0) [0|2150000] \"km\"", 16218, "km", ""},
+		// signed, bolt pack current
+		{"7ec0562241400c8cc", "2414", "39|16@0- (-0.05,0) [-1000|1000] \"A\"", -10, "A", ""},
+		{"7ec05622414f830cc", "2414", "39|16@0- (-0.05,0) [-1000|1000] \"A\"", 100, "A", ""},
 	}
 
 	for _, test := range tests {
@@ -113,6 +116,28 @@ func TestParseBytesWithDBCFormula(t *testing.T) {
 			wantUnit:  "count",
 			wantErr:   assert.NoError,
 		},
+		{
+			name: "signed bolt pack current discharging",
+			args: args{
+				frameData: hexToByteArray("05 62 24 14 00 C8", t),
+				pid:       uint32(0x2414),
+				formula:   `39|16@0- (-0.05,0) [-1000|1000] "A"`,
+			},
+			wantValue: -10,
+			wantUnit:  "A",
+			wantErr:   assert.NoError,
+		},
+		{
+			name: "signed bolt pack current charging",
+			args: args{
+				frameData: hexToByteArray("05 62 24 14 F8 30", t),
+				pid:       uint32(0x2414),
+				formula:   `39|16@0- (-0.05,0) [-1000|1000] "A"`,
+			},
+			wantValue: 100,
+			wantUnit:  "A",
+			wantErr:   assert.NoError,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -171,6 +196,12 @@ func TestDecodePassiveFrame(t *testing.T) {
 		{name: "ford 1072 fusion 2018",
 			args: args{frameData: hexToByteArray("07 01 97 0F 91 01 16 90", t), dbcFormula: "15|24@0+ (1,0) [0|16777214] \"km\"  Vector_XXX"},
 			want: 104207, want1: "km", wantErr: assert.NoError},
+		{name: "signed pack current",
+			args: args{frameData: hexToByteArray("00 00 00 00 FF 38 00 00", t), dbcFormula: "39|16@0- (-0.05,0) [-1000|1000] \"A\""},
+			want: 10, want1: "A", wantErr: assert.NoError},
+		{name: "signed pack current negative",
+			args: args{frameData: hexToByteArray("00 00 00 00 00 C8 00 00", t), dbcFormula: "39|16@0- (-0.05,0) [-1000|1000] \"A\""},
+			want: -10, want1: "A", wantErr: assert.NoError},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -4,10 +4,13 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/DIMO-Network/edge-network/internal/clock"
 	"github.com/DIMO-Network/edge-network/internal/hooks"
 
 	"github.com/DIMO-Network/edge-network/internal/util"
@@ -27,7 +30,18 @@ type DBCPassiveLogger interface {
 	// ShouldNativeScanLogger uses a variety of logic to decide if we should enable DBC file support as well as native Request/Response scanning (they go hand in hand)
 	ShouldNativeScanLogger() bool
 	SendCANQuery(header uint32, mode uint32, pid uint32) error
+	// SetPIDs replaces the requests whose responses are filtered and decoded, eg. once the ev catalog is added. Does not
+	// change what ShouldNativeScanLogger returned once it was called.
+	SetPIDs(pids []models.PIDRequest)
 	StopScanning() error
+	// DiscoverDBCCandidates listens to all can traffic for the window and summarizes it to help write a dbc, see TrafficAnalyzer.
+	// The reference signals, eg. polled speed and rpm, are sampled from refs to find bit ranges that track them.
+	DiscoverDBCCandidates(window time.Duration, refs ReferenceSource, refNames []string) (*models.DBCDiscoveryReport, error)
+}
+
+// ReferenceSource gives the latest value of polled signals, eg. the worker runner signals queue
+type ReferenceSource interface {
+	LatestFloat(name string, maxAge time.Duration) (float64, bool)
 }
 
 type dbcPassiveLogger struct {
@@ -35,18 +49,28 @@ type dbcPassiveLogger struct {
 	dbcFile *string
 	// found that 5.2 hw did not work with this
 	hardwareSupport bool
-	pids            []models.PIDRequest
-	recv            *canbus.Socket
+	// mu guards pids, recv and the cached decision, the pids can be replaced while scanning
+	mu   sync.RWMutex
+	pids []models.PIDRequest
+	// dbcFilters the dbc file filters, kept to rebuild the hardware filters when the pids change
+	dbcFilters []dbcFilter
+	recv       *canbus.Socket
+	// canInterface to bind to, can0 on the autopi, eg. vcan0 for testing
+	canInterface string
 	// cache what we figure out
 	shouldNativeScanLogger *bool
 }
 
-func NewDBCPassiveLogger(logger zerolog.Logger, dbcFile *string, hwVersion string, pids *models.TemplatePIDs) DBCPassiveLogger {
+// NewDBCPassiveLogger canInterface defaults to can0 if empty
+func NewDBCPassiveLogger(logger zerolog.Logger, dbcFile *string, hwVersion string, pids *models.TemplatePIDs, canInterface string) DBCPassiveLogger {
 	v, err := strconv.Atoi(hwVersion)
 	if err != nil {
 		logger.Err(err).Msgf("unable to parse hardware version: %s", hwVersion)
 	}
-	dpl := &dbcPassiveLogger{logger: logger, dbcFile: dbcFile, hardwareSupport: v >= 6} // have only tested in 7+ working, for sure 5.2 nogo
+	if canInterface == "" {
+		canInterface = canbus.DefaultInterface
+	}
+	dpl := &dbcPassiveLogger{logger: logger, dbcFile: dbcFile, hardwareSupport: v >= 6, canInterface: canInterface} // have only tested in 7+ working, for sure 5.2 nogo
 	if pids != nil {
 		dpl.pids = pids.Requests
 	}
@@ -54,65 +78,112 @@ func NewDBCPassiveLogger(logger zerolog.Logger, dbcFile *string, hwVersion strin
 	return dpl
 }
 
+func (dpl *dbcPassiveLogger) SetPIDs(pids []models.PIDRequest) {
+	dpl.mu.Lock()
+	defer dpl.mu.Unlock()
+	dpl.pids = pids
+	// the native or autopi decision is kept once made, the native logger is only started if it was native when Run began
+	if dpl.recv == nil {
+		return
+	}
+	// already scanning, only let the responses to the new pids through
+	if err := dpl.recv.SetFilters(buildCanFilters(dpl.hardwareFilters())); err != nil {
+		dpl.logger.Err(err).Msg("cannot update canbus filters")
+	}
+}
+
+// requests the current pids, SetPIDs replaces the slice and never modifies it
+func (dpl *dbcPassiveLogger) requests() []models.PIDRequest {
+	dpl.mu.RLock()
+	defer dpl.mu.RUnlock()
+	return dpl.pids
+}
+
+// hardwareFilters the dbc file filters plus the response headers of the pids, the caller holds mu
+func (dpl *dbcPassiveLogger) hardwareFilters() []dbcFilter {
+	filters := slices.Clone(dpl.dbcFilters)
+	pidRespHdrs := getUniqueResponseHeaders(dpl.pids)
+	// add any PID or DID filters
+	for rh := range pidRespHdrs {
+		filters = append(filters, dbcFilter{
+			header: rh,
+		})
+	}
+	if slices.ContainsFunc(dpl.pids, func(p models.PIDRequest) bool { return p.IsBroadcast() && p.Header > 0xfff }) {
+		// any 29 bit ecu, 18DAF1xx
+		filters = append(filters, dbcFilter{header: 0x18daf100, mask: 0x1fffff00})
+	}
+	return filters
+}
+
 func (dpl *dbcPassiveLogger) StartScanning(ch chan<- models.SignalData) error {
 	if !dpl.hardwareSupport {
 		dpl.logger.Info().Msg("hardware support is not enabled due to old hw - not starting DBC passive logger")
 		return nil
 	}
-	filters := []dbcFilter{}
+	var dbcFilters []dbcFilter
 	if dpl.dbcFile != nil {
 		f, err := dpl.parseDBCHeaders(*dpl.dbcFile)
 		if err != nil {
 			return errors.Wrapf(err, "failed to parse dbc file: %s", *dpl.dbcFile)
 		}
-		filters = f
-	}
-	pidRespHdrs := getUniqueResponseHeaders(dpl.pids)
-	// add any PID or DID filters
-	for rh := range pidRespHdrs {
-		filters = append(filters, dbcFilter{
-			header: rh,
-		})
+		dbcFilters = f
 	}
+	// responses to broadcast requests are collected from every ecu, then selected per the request
+	collector := newECUCollector(ecuResponseWindow, func(signal models.SignalData) { ch <- signal })
 
-	dpl.recv, _ = canbus.New()
+	recv, _ := canbus.New()
 
 	// set hardware filters
-	uf := buildCanFilters(filters)
-	err := dpl.recv.SetFilters(uf)
+	dpl.mu.Lock()
+	dpl.dbcFilters = dbcFilters
+	uf := buildCanFilters(dpl.hardwareFilters())
+	dpl.recv = recv
+	dpl.mu.Unlock()
+	err := recv.SetFilters(uf)
 	if err != nil {
 		return fmt.Errorf("cannot set canbus filters: %w", err)
 	}
-	err = dpl.recv.Bind("can0")
+	err = recv.Bind(dpl.canInterface)
 	if err != nil {
-		return errors.Wrap(err, "could not bind recv socket")
+		return errors.Wrapf(err, "could not bind recv socket to %s", dpl.canInterface)
 	}
 	// loop for each frame
 	for {
-		frame, err := dpl.recv.Recv()
+		frame, err := recv.Recv()
 		if err != nil {
+			if errors.Is(err, unix.EBADF) {
+				// socket was closed by StopScanning
+				return nil
+			}
 			// todo improvement- dmytro - accumulate on this error and if happens too much report up to edge-logs
 			dpl.logger.Debug().Err(err).Msg("failed to read frame")
 			continue
 		}
 
 		// handle standard PID responses
-		if _, ok := pidRespHdrs[frame.ID]; ok {
+		if dpl.isPIDResponse(frame.ID) {
 			pid := dpl.matchPID(frame)
 			if pid != nil {
 				dpl.logger.Debug().Msgf("found pid match: %+v", pid)
-				floatVal, _, errFormula := ParsePIDBytesWithDBCFormula(frame.Data, pid.Pid, pid.Formula)
+				value, errFormula := decodePIDFrame(*pid, frame.Data)
 				if errFormula != nil {
 					msg := fmt.Sprintf("failed to extract PID data with formula: %s, resp data: %s, name: %s", pid.Formula, printBytesAsHex(frame.Data), pid.Name)
 					hooks.LogError(dpl.logger, errFormula, msg, hooks.WithThresholdWhenLogMqtt(1))
 					continue
 				}
-				dpl.logger.Debug().Msgf("%s value: %f", pid.Name, floatVal)
+				dpl.logger.Debug().Msgf("%s value: %v", pid.Name, value)
+				if pid.IsBroadcast() {
+					collector.add(*pid, frame.ID, value, clock.Now().UnixMilli())
+					continue
+				}
 				// push to channel
 				s := models.SignalData{
-					Timestamp: time.Now().UnixMilli(),
+					Timestamp: clock.Now().UnixMilli(),
 					Name:      pid.Name,
-					Value:     floatVal,
+					Value:     value,
+					Unit:      pid.Unit(),
+					Source:    models.SignalSourcePID,
 				}
 				ch <- s
 			} else {
@@ -124,17 +195,25 @@ func (dpl *dbcPassiveLogger) StartScanning(ch chan<- models.SignalData) error {
 		}
 		// todo can we get a test around this?
 		// handle DBC file - match the frame id to our filters so we can get the right formula
-		f := findFilter(filters, frame.ID)
+		f := findFilter(dbcFilters, frame.ID)
+		if f == nil {
+			// eg. a response in flight when its pid was removed
+			continue
+		}
 		hexStr := fmt.Sprintf("%02d", frame.Data)
 		for _, signal := range f.signals {
-			floatValue, _, err := DecodePassiveFrame(frame.Data, signal.formula)
+			floatValue, unit, state, err := decodeDBCSignal(frame.Data, signal)
 			if err != nil {
 				dpl.logger.Err(err).Msg("failed to extract float value. hex: " + hexStr)
 			}
 			s := models.SignalData{
-				Timestamp:      time.Now().UnixMilli(),
+				Timestamp:      clock.Now().UnixMilli(),
 				Name:           signal.signalName,
 				Value:          floatValue,
+				State:          state,
+				Unit:           unit,
+				Source:         models.SignalSourceDBC,
+				DecodeError:    err != nil,
 				LimitFrequency: true,
 			}
 			// push to channel
@@ -143,12 +222,55 @@ func (dpl *dbcPassiveLogger) StartScanning(ch chan<- models.SignalData) error {
 	}
 }
 
+func (dpl *dbcPassiveLogger) DiscoverDBCCandidates(window time.Duration, refs ReferenceSource, refNames []string) (*models.DBCDiscoveryReport, error) {
+	if !dpl.hardwareSupport {
+		return nil, fmt.Errorf("hardware support is not enabled due to old hw")
+	}
+	sck, err := canbus.New()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create canbus socket")
+	}
+	defer sck.Close() //nolint
+	// no hardware filters, we want everything. timeout so we keep sampling references on a quiet bus
+	if err := sck.SetRecvTimeout(500 * time.Millisecond); err != nil {
+		return nil, err
+	}
+	if err := sck.Bind(dpl.canInterface); err != nil {
+		return nil, errors.Wrapf(err, "could not bind discovery socket to %s", dpl.canInterface)
+	}
+
+	analyzer := NewTrafficAnalyzer()
+	end := time.Now().Add(window)
+	var lastRef time.Time
+	for time.Now().Before(end) {
+		frame, err := sck.Recv()
+		now := time.Now()
+		if err == nil {
+			analyzer.AddFrame(now, frame)
+		} else if !errors.Is(err, unix.EAGAIN) {
+			dpl.logger.Debug().Err(err).Msg("failed to read frame during dbc discovery")
+		}
+		if refs != nil && now.Sub(lastRef) >= 500*time.Millisecond {
+			lastRef = now
+			for _, name := range refNames {
+				if v, ok := refs.LatestFloat(name, discoveryMaxRefAge); ok {
+					analyzer.AddReference(name, now, v)
+				}
+			}
+		}
+	}
+	report := analyzer.Report()
+	return &report, nil
+}
+
 // buildCanFilters builds an array of unix.CanFilter objects based on the provided dbcFilter array
 func buildCanFilters(filters []dbcFilter) []unix.CanFilter {
 	uf := make([]unix.CanFilter, len(filters))
 	for i, filter := range filters {
 		uf[i].Id = filter.header // wants decimal representation of header - not hex
-		if filter.header > 0xfff {
+		if filter.mask != 0 {
+			uf[i].Mask = filter.mask
+		} else if filter.header > 0xfff {
 			uf[i].Mask = unix.CAN_EFF_MASK // extended frame
 		} else {
 			uf[i].Mask = unix.CAN_SFF_MASK // standard frame
@@ -159,6 +281,8 @@ func buildCanFilters(filters []dbcFilter) []unix.CanFilter {
 
 // ShouldNativeScanLogger decide if should enable native scanning / querying based on: hardware support for our impl and no python formulas
 func (dpl *dbcPassiveLogger) ShouldNativeScanLogger() bool {
+	dpl.mu.Lock()
+	defer dpl.mu.Unlock()
 	if dpl.shouldNativeScanLogger != nil {
 		return *dpl.shouldNativeScanLogger
 	}
@@ -178,26 +302,52 @@ func (dpl *dbcPassiveLogger) ShouldNativeScanLogger() bool {
 	return useNativeLogger
 }
 
+// decodePIDFrame decodes a single frame response with the request dbc or expr formula
+func decodePIDFrame(pid models.PIDRequest, data []byte) (any, error) {
+	if pid.FormulaType() == models.Expr {
+		messages := isoTPMessages([][]byte{data})
+		if len(messages) == 0 {
+			return nil, fmt.Errorf("not a single frame response: %s", printBytesAsHex(data))
+		}
+		return EvalExprFormula(pid, messages[0])
+	}
+	floatVal, _, err := ParsePIDBytesWithDBCFormula(data, pid.Pid, pid.Formula)
+	return floatVal, err
+}
+
 func (dpl *dbcPassiveLogger) StopScanning() error {
+	dpl.mu.Lock()
+	defer dpl.mu.Unlock()
 	if dpl.recv != nil {
 		errR := dpl.recv.Close()
 		if errR != nil {
 			return errR
 		}
+		dpl.recv = nil
 	}
 	return nil
 }
 
-// getUniqueResponseHeaders returns only the unique response headers in the pids
+// getUniqueResponseHeaders returns only the unique response headers in the pids, 7E8 to 7EF for 11 bit broadcast requests
 func getUniqueResponseHeaders(pids []models.PIDRequest) map[uint32]struct{} {
 	hdrs := make(map[uint32]struct{})
 	for _, pid := range pids {
+		if pid.IsBroadcast() && pid.Header == 0x7df {
+			for h := uint32(0x7e8); h <= 0x7ef; h++ {
+				hdrs[h] = struct{}{}
+			}
+			continue
+		}
 		hdrs[pid.ResponseHeader()] = struct{}{}
-		// todo if response header is 7e8 should we add the whole list
 	}
 	return hdrs
 }
 
+// isPIDResponse the frame answers one of the pids
+func (dpl *dbcPassiveLogger) isPIDResponse(id uint32) bool {
+	return slices.ContainsFunc(dpl.requests(), func(p models.PIDRequest) bool { return p.MatchesResponseHeader(id) })
+}
+
 // SendCANQuery calls SendCANFrame, just builds up the raw frame with some standards. fire and forget. Responses come in StartScanning filters.
 func (dpl *dbcPassiveLogger) SendCANQuery(header uint32, mode uint32, pid uint32) error {
 	//02 01 33 00 00 00 00 00 // length mode pid
@@ -228,7 +378,7 @@ func (dpl *dbcPassiveLogger) SendCANFrame(header uint32, data []byte) error {
 		return errors.Wrap(err, "cannot create canbus socket")
 	}
 	defer send.Close()
-	err = send.Bind("can0")
+	err = send.Bind(dpl.canInterface)
 	if err != nil {
 		return errors.Wrap(err, "cannot bind canbus socket")
 	}
@@ -264,6 +414,7 @@ func (dpl *dbcPassiveLogger) parseDBCHeaders(dbcFile string) ([]dbcFilter, error
 
 	var header string
 	headerSignals := make([]dbcSignal, 0)
+	definitions := newDBCValueDefinitions()
 
 	for _, line := range lines {
 		var err error
@@ -301,6 +452,11 @@ func (dpl *dbcPassiveLogger) parseDBCHeaders(dbcFile string) ([]dbcFilter, error
 				formula:    formula,
 			})
 		}
+
+		// value tables and float signals, after all the messages
+		if err := definitions.parseLine(line); err != nil {
+			return nil, err
+		}
 	}
 	// check if signals still need to be drained to add them
 	filters, err := addPrevFilter(header, headerSignals, filters)
@@ -312,12 +468,13 @@ func (dpl *dbcPassiveLogger) parseDBCHeaders(dbcFile string) ([]dbcFilter, error
 	if len(filters) == 0 {
 		return nil, fmt.Errorf("no header-formula pairs were found")
 	}
+	definitions.apply(filters)
 	return filters, nil
 }
 
 func (dpl *dbcPassiveLogger) matchPID(frame canbus.Frame) *models.PIDRequest {
-	for _, pid := range dpl.pids {
-		if pid.ResponseHeader() == frame.ID {
+	for _, pid := range dpl.requests() {
+		if pid.MatchesResponseHeader(frame.ID) {
 			if pid.Pid > 0x00 && pid.Pid < 0xff {
 				// obd2 standard PID, known position
 				if pid.Pid == uint32(frame.Data[2]) {
@@ -363,11 +520,17 @@ func printBytesAsHex(data []byte) string {
 }
 
 type dbcFilter struct {
-	header  uint32
+	header uint32
+	// mask zero matches the header exactly
+	mask    uint32
 	signals []dbcSignal
 }
 
 type dbcSignal struct {
 	formula    string
 	signalName string
+	// valueType from SIG_VALTYPE_
+	valueType dbcValueType
+	// states from VAL_, the text for each raw value of state signals, eg. gear position
+	states map[int64]string
 }
@@ -255,6 +255,24 @@ func Test_dbcPassiveLogger_matchPID(t *testing.T) {
 			wantPIDName: "coolantTemp",
 			pids:        pidsObd2,
 		},
+		{
+			name: "match coolant temp from another ecu",
+			frame: canbus.Frame{
+				ID:   0x7ea,
+				Data: hexToByteArray("03 41 05 53", t),
+			},
+			wantPIDName: "coolantTemp",
+			pids:        pidsObd2,
+		},
+		{
+			name: "match coolant temp EFF from another ecu",
+			frame: canbus.Frame{
+				ID:   0x18daf118,
+				Data: hexToByteArray("03 41 05 53", t),
+			},
+			wantPIDName: "coolantTemp",
+			pids:        pidsObd2,
+		},
 		{
 			name: "no match unregistered pid",
 			frame: canbus.Frame{
@@ -330,6 +348,20 @@ func TestParseUniqueResponseHeaders(t *testing.T) {
 				0x789: {},
 			},
 		},
+		{
+			name: "Broadcast PID",
+			pids: []models.PIDRequest{
+				{
+					Header: 0x7df,
+				},
+				{
+					Header: 0x7e0,
+				},
+			},
+			want: map[uint32]struct{}{
+				0x7e8: {}, 0x7e9: {}, 0x7ea: {}, 0x7eb: {}, 0x7ec: {}, 0x7ed: {}, 0x7ee: {}, 0x7ef: {},
+			},
+		},
 		{
 			name: "Multiple Duplicate PIDs",
 			pids: []models.PIDRequest{
@@ -438,3 +470,55 @@ func Test_dbcPassiveLogger_ShouldNativeScanLogger(t *testing.T) {
 		})
 	}
 }
+
+func Test_dbcPassiveLogger_SetPIDs(t *testing.T) {
+	template := &models.TemplatePIDs{Requests: []models.PIDRequest{
+		{Name: "rpm", Header: 0x7e0, Mode: 0x01, Pid: 0x0c, Formula: `dbc:31|16@0+ (0.25,0) [0|16383.75] "rpm"`},
+	}}
+	dpl := NewDBCPassiveLogger(zerolog.Nop(), nil, "7", template, "").(*dbcPassiveLogger)
+	assert.False(t, dpl.isPIDResponse(0x7ec), "bms responses are filtered out")
+
+	current := models.PIDRequest{Name: "hvBatteryCurrent", Header: 0x7e4, Mode: 0x22, Pid: 0x2414,
+		Formula: `dbc:39|16@0- (-0.05,0) [-1000|1000] "A"`}
+	dpl.SetPIDs(append(template.Requests, current))
+	assert.True(t, dpl.isPIDResponse(0x7ec))
+	assert.Contains(t, getUniqueResponseHeaders(dpl.pids), uint32(0x7ec))
+	pid := dpl.matchPID(canbus.Frame{ID: 0x7ec, Data: []byte{0x05, 0x62, 0x24, 0x14, 0x01, 0x90, 0xaa, 0xaa}})
+	require.NotNil(t, pid)
+	assert.Equal(t, "hvBatteryCurrent", pid.Name)
+}
+
+func Test_dbcPassiveLogger_SetPIDs_keepsNativeDecision(t *testing.T) {
+	rpm := models.PIDRequest{Name: "rpm", Header: 0x7e0, Mode: 0x01, Pid: 0x0c, Formula: `dbc:31|16@0+ (0.25,0) [0|16383.75] "rpm"`}
+	fuel := models.PIDRequest{Name: "fuelLevel", Header: 0x7e0, Mode: 0x22, Pid: 0x1234, Formula: "python:bytes_to_int(messages[0].data[-1:])"}
+	dpl := NewDBCPassiveLogger(zerolog.Nop(), nil, "7", &models.TemplatePIDs{Requests: []models.PIDRequest{rpm, fuel}}, "").(*dbcPassiveLogger)
+	// before the decision is made the pids can still change it
+	dpl.SetPIDs([]models.PIDRequest{rpm})
+	dpl.SetPIDs([]models.PIDRequest{rpm, fuel})
+	assert.False(t, dpl.ShouldNativeScanLogger())
+
+	// the python pid is pruned after Run decided not to start the native logger
+	dpl.SetPIDs([]models.PIDRequest{rpm})
+	assert.False(t, dpl.ShouldNativeScanLogger())
+}
+
+func Test_dbcPassiveLogger_hardwareFilters(t *testing.T) {
+	dpl := &dbcPassiveLogger{logger: zerolog.Nop(), dbcFilters: []dbcFilter{{header: 0x3e9}},
+		pids: []models.PIDRequest{
+			{Name: "rpm", Header: 0x7e0, Mode: 0x01, Pid: 0x0c},
+			{Name: "soc", Header: 0x7e4, Mode: 0x22, Pid: 0x8334},
+		}}
+	headers := func() []uint32 {
+		var h []uint32
+		for _, f := range dpl.hardwareFilters() {
+			h = append(h, f.header)
+		}
+		return h
+	}
+	assert.ElementsMatch(t, []uint32{0x3e9, 0x7e8, 0x7ec}, headers())
+
+	// pruned, eg. the vehicle doesn't support the soc did
+	dpl.SetPIDs(dpl.pids[:1])
+	assert.ElementsMatch(t, []uint32{0x3e9, 0x7e8}, headers())
+	assert.False(t, dpl.isPIDResponse(0x7ec))
+}
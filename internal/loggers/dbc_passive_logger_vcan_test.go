@@ -0,0 +1,179 @@
+package loggers
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/autopisim"
+	"github.com/DIMO-Network/edge-network/internal/canbus"
+	"github.com/DIMO-Network/edge-network/internal/ecusim"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const vcanInterface = "vcan0"
+
+// requireVCAN skips the test unless a virtual can interface is up, setup with:
+// sudo ip link add dev vcan0 type vcan && sudo ip link set up vcan0
+func requireVCAN(t *testing.T) {
+	if _, err := net.InterfaceByName(vcanInterface); err != nil {
+		t.Skipf("%s not available, skipping native logger integration test", vcanInterface)
+	}
+}
+
+// vcanSignal a value a fixture's frames should decode to
+type vcanSignal struct {
+	value       float64
+	state       string
+	decodeError bool
+}
+
+func Test_dbcPassiveLogger_vcan_ReplayAndQuery(t *testing.T) {
+	requireVCAN(t)
+	logger := zerolog.New(os.Stdout).Output(zerolog.ConsoleWriter{Out: os.Stdout})
+
+	responder := ecusim.NewResponder(logger, vcanInterface, autopisim.DefaultVehicle())
+	go func() { _ = responder.Run() }()
+	t.Cleanup(func() { _ = responder.Close() })
+
+	tests := []struct {
+		name   string
+		dbc    string
+		frames string
+		want   map[string]vcanSignal
+	}{
+		{
+			name:   "gm odometer",
+			dbc:    testgm120dbc,
+			frames: "(1436509052.249713) vcan0 120#0000100000\n",
+			want:   map[string]vcanSignal{"odometer": {value: 64}},
+		},
+		{
+			name: "gm odometer, tires and oil",
+			dbc:  testgmmultipledbc,
+			// the passive decoder reads little endian signals a byte early, the bytes either side carry the same value
+			frames: "(1436509052.249713) vcan0 120#0000100000\n" +
+				"(1436509052.249714) vcan0 52A#003C3C3C3C3C0000\n" +
+				"(1436509052.249715) vcan0 3F9#0000000000808000\n",
+			want: map[string]vcanSignal{
+				"odometer":        {value: 64},
+				"tiresFrontLeft":  {value: 240},
+				"tiresBackLeft":   {value: 240},
+				"tiresFrontRight": {value: 240},
+				"tiresBackRight":  {value: 240},
+				"oilLife":         {value: 50.2},
+			},
+		},
+		{
+			name: "acura ilx",
+			dbc:  testacurailxdbc,
+			// CAR_GAS is in both gas pedal messages, both carry the same value. The 2 bit COUNTER is under the byte the
+			// passive decoder works in, it is sent as a decode error
+			frames: "(1436509052.249713) vcan0 130#FF9C00642A000000\n" +
+				"(1436509052.249714) vcan0 13C#000000002A000020\n" +
+				"(1436509052.249715) vcan0 158#138807D013880C00\n",
+			want: map[string]vcanSignal{
+				"ENGINE_TORQUE_ESTIMATE": {value: -100},
+				"ENGINE_TORQUE_REQUEST":  {value: 100},
+				"CAR_GAS":                {value: 42},
+				"COUNTER":                {decodeError: true},
+				"XMISSION_SPEED":         {value: 50},
+				"ENGINE_RPM":             {value: 2000},
+				"XMISSION_SPEED2":        {value: 50},
+				"ODOMETER":               {value: 120},
+			},
+		},
+		{
+			name: "value tables and float signals",
+			dbc:  teststatesdbc,
+			frames: "(1436509052.249713) vcan0 3E8#0301000000000000\n" +
+				"(1436509052.249714) vcan0 3E9#43C7400000000000\n",
+			want: map[string]vcanSignal{
+				"GEAR":         {value: 3, state: "Drive"},
+				"DRIVER_DOOR":  {value: 1, state: "Open"},
+				"PACK_VOLTAGE": {value: 398.5},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pids := &models.TemplatePIDs{Requests: []models.PIDRequest{
+				{Name: "rpm", Header: 0x7df, Mode: 0x01, Pid: 0x0c, Formula: `dbc:31|16@0+ (0.25,0) [0|16383.75] "rpm"`},
+			}}
+			dpl := NewDBCPassiveLogger(logger, &tt.dbc, "7", pids, vcanInterface)
+			ch := make(chan models.SignalData, 20)
+			scanErr := make(chan error, 1)
+			go func() { scanErr <- dpl.StartScanning(ch) }()
+			time.Sleep(200 * time.Millisecond) // let both sockets bind
+
+			// passive dbc frames
+			sck, err := canbus.New()
+			require.NoError(t, err)
+			defer sck.Close() //nolint
+			require.NoError(t, sck.Bind(vcanInterface))
+			frames, err := canbus.ReadCandumpLog(strings.NewReader(tt.frames))
+			require.NoError(t, err)
+			require.NoError(t, canbus.Replay(sck, frames, 0, nil))
+
+			got := receiveSignals(t, ch, len(tt.want))
+			for name, want := range tt.want {
+				require.Contains(t, got, name)
+				assert.InDelta(t, want.value, got[name].Value, 0.001, name)
+				assert.Equal(t, want.state, got[name].State, name)
+				assert.Equal(t, want.decodeError, got[name].DecodeError, name)
+				assert.Equal(t, models.SignalSourceDBC, got[name].Source, name)
+			}
+
+			// pid request answered by the ecu simulator
+			require.NoError(t, dpl.SendCANQuery(0x7df, 0x01, 0x0c))
+			rpm := receiveSignal(t, ch, "rpm")
+			assert.InDelta(t, 800, rpm.Value, 50)
+
+			require.NoError(t, dpl.StopScanning())
+			// a pending Recv is only released by the next frame, after which the closed socket errors out
+			require.NoError(t, canbus.Replay(sck, frames[:1], 0, nil))
+			select {
+			case err := <-scanErr:
+				assert.NoError(t, err)
+			case <-time.After(2 * time.Second):
+				t.Fatal("StartScanning did not return after StopScanning")
+			}
+		})
+	}
+}
+
+// receiveSignals collects the dbc signals by name until n different names were received
+func receiveSignals(t *testing.T, ch <-chan models.SignalData, n int) map[string]models.SignalData {
+	got := map[string]models.SignalData{}
+	timeout := time.After(2 * time.Second)
+	for len(got) < n {
+		select {
+		case s := <-ch:
+			if s.Source == models.SignalSourceDBC {
+				got[s.Name] = s
+			}
+		case <-timeout:
+			t.Fatalf("received %d of %d signals: %v", len(got), n, got)
+		}
+	}
+	return got
+}
+
+func receiveSignal(t *testing.T, ch <-chan models.SignalData, name string) models.SignalData {
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case s := <-ch:
+			if s.Name == name {
+				return s
+			}
+		case <-timeout:
+			t.Fatalf("did not receive signal %s", name)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package loggers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// dbcValueType from SIG_VALTYPE_, signals are integers unless declared float or double
+type dbcValueType int
+
+const (
+	dbcValueInteger dbcValueType = iota
+	dbcValueFloat
+	dbcValueDouble
+)
+
+// dbcSignalKey signal names are only unique within a message, eg. a COUNTER in every message
+type dbcSignalKey struct {
+	header     uint32
+	signalName string
+}
+
+// dbcValueDefinitions the VAL_, VAL_TABLE_ and SIG_VALTYPE_ lines of a dbc file, they come after the messages and are
+// applied to their signals once the whole file is read
+type dbcValueDefinitions struct {
+	// tables the VAL_TABLE_ tables by name, a VAL_ can refer to one instead of listing the states
+	tables     map[string]map[int64]string
+	states     map[dbcSignalKey]map[int64]string
+	valueTypes map[dbcSignalKey]dbcValueType
+}
+
+func newDBCValueDefinitions() *dbcValueDefinitions {
+	return &dbcValueDefinitions{
+		tables:     map[string]map[int64]string{},
+		states:     map[dbcSignalKey]map[int64]string{},
+		valueTypes: map[dbcSignalKey]dbcValueType{},
+	}
+}
+
+// parseLine adds the definition if the line is one, eg.
+// VAL_ 1234 GEAR 0 "P" 1 "R" 2 "N" 3 "D" ;
+// VAL_ 1234 GEAR GearTable ;
+// VAL_TABLE_ GearTable 0 "P" 1 "R" ;
+// SIG_VALTYPE_ 1234 BATTERY_VOLTAGE : 1;
+func (d *dbcValueDefinitions) parseLine(line string) error {
+	fields := dbcLineFields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	switch fields[0] {
+	case "VAL_TABLE_":
+		if len(fields) < 2 {
+			return fmt.Errorf("invalid VAL_TABLE_ format: %s", line)
+		}
+		states, err := parseDBCStates(fields[2:])
+		if err != nil {
+			return fmt.Errorf("invalid VAL_TABLE_ %s: %w", fields[1], err)
+		}
+		d.tables[fields[1]] = states
+	case "VAL_":
+		if len(fields) < 4 {
+			return fmt.Errorf("invalid VAL_ format: %s", line)
+		}
+		key, err := parseDBCSignalKey(fields[1], fields[2])
+		if err != nil {
+			return err
+		}
+		if len(fields) == 4 {
+			table, ok := d.tables[fields[3]]
+			if !ok {
+				return fmt.Errorf("VAL_ %s refers to unknown table %s", fields[2], fields[3])
+			}
+			d.states[key] = table
+			return nil
+		}
+		states, err := parseDBCStates(fields[3:])
+		if err != nil {
+			return fmt.Errorf("invalid VAL_ %s: %w", fields[2], err)
+		}
+		d.states[key] = states
+	case "SIG_VALTYPE_":
+		// the colon can be its own field or stuck to the type
+		if len(fields) < 4 {
+			return fmt.Errorf("invalid SIG_VALTYPE_ format: %s", line)
+		}
+		key, err := parseDBCSignalKey(fields[1], fields[2])
+		if err != nil {
+			return err
+		}
+		valueType := strings.TrimPrefix(strings.Join(fields[3:], ""), ":")
+		switch valueType {
+		case "0":
+			d.valueTypes[key] = dbcValueInteger
+		case "1":
+			d.valueTypes[key] = dbcValueFloat
+		case "2":
+			d.valueTypes[key] = dbcValueDouble
+		default:
+			return fmt.Errorf("invalid SIG_VALTYPE_ type for %s: %s", fields[2], valueType)
+		}
+	}
+	return nil
+}
+
+// apply sets the states and value types on the signals of the filters
+func (d *dbcValueDefinitions) apply(filters []dbcFilter) {
+	for i := range filters {
+		for j := range filters[i].signals {
+			signal := &filters[i].signals[j]
+			key := dbcSignalKey{header: filters[i].header, signalName: signal.signalName}
+			signal.states = d.states[key]
+			signal.valueType = d.valueTypes[key]
+		}
+	}
+}
+
+func parseDBCSignalKey(header, signalName string) (dbcSignalKey, error) {
+	h, err := strconv.ParseUint(header, 10, 32)
+	if err != nil {
+		return dbcSignalKey{}, fmt.Errorf("error converting header to uint32: %w", err)
+	}
+	return dbcSignalKey{header: uint32(h), signalName: signalName}, nil
+}
+
+// parseDBCStates the value and description pairs, eg. 0 "P" 1 "R"
+func parseDBCStates(fields []string) (map[int64]string, error) {
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("value without description: %v", fields)
+	}
+	states := make(map[int64]string, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		v, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %s", fields[i])
+		}
+		states[v] = fields[i+1]
+	}
+	return states, nil
+}
+
+// dbcLineFields splits the line on spaces keeping quoted descriptions together, without the quotes and the ending ;
+func dbcLineFields(line string) []string {
+	var fields []string
+	var current strings.Builder
+	inQuotes, inField := false, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			inField = true
+		case !inQuotes && (r == ' ' || r == '\t' || r == '\r' || r == ';'):
+			if inField {
+				fields = append(fields, current.String())
+				current.Reset()
+				inField = false
+			}
+		default:
+			current.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
+
+// decodeDBCSignal decodes a dbc file signal and returns its unit and the VAL_ state of the raw value, empty if it has
+// none. Float and double signals are the IEEE 754 bits of the value.
+func decodeDBCSignal(frameData []byte, signal dbcSignal) (float64, string, string, error) {
+	if signal.valueType == dbcValueInteger && len(signal.states) == 0 {
+		value, unit, err := DecodePassiveFrame(frameData, signal.formula)
+		return value, unit, "", err
+	}
+	formula, err := parsePassiveFormula(signal.formula)
+	if err != nil {
+		return 0, "", "", err
+	}
+	raw, err := formula.rawValue(frameData)
+	if err != nil {
+		return 0, "", "", err
+	}
+	var value float64
+	switch signal.valueType {
+	case dbcValueFloat:
+		if formula.lengthBits != 32 {
+			return 0, "", "", fmt.Errorf("float signal %s must be 32 bits, got %d", signal.signalName, formula.lengthBits)
+		}
+		value = float64(math.Float32frombits(uint32(raw)))
+	case dbcValueDouble:
+		if formula.lengthBits != 64 {
+			return 0, "", "", fmt.Errorf("double signal %s must be 64 bits, got %d", signal.signalName, formula.lengthBits)
+		}
+		value = math.Float64frombits(raw)
+	default:
+		value = formula.signedValue(raw)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, "", "", fmt.Errorf("signal %s is not a number", signal.signalName)
+	}
+	decodedValue := value*formula.scale + formula.offset
+	// float signals often don't set a range, [0|0]
+	hasRange := formula.min != formula.max
+	if hasRange && (decodedValue < formula.min || decodedValue > formula.max) {
+		return 0, "", "", fmt.Errorf("decoded value out of range: %.2f (expected range %.2f to %.2f)", decodedValue, formula.min, formula.max)
+	}
+	state := ""
+	if signal.valueType == dbcValueInteger {
+		state = signal.states[int64(value)]
+	}
+	return roundToTwoDecimals(decodedValue), formula.unit, state, nil
+}
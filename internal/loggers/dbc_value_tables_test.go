@@ -0,0 +1,64 @@
+package loggers
+
+import (
+	_ "embed"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed test_states.dbc
+var teststatesdbc string
+
+func Test_dbcPassiveLogger_parseDBCHeaders_valueTables(t *testing.T) {
+	dpl := &dbcPassiveLogger{logger: zerolog.Nop()}
+	filters, err := dpl.parseDBCHeaders(teststatesdbc)
+	require.NoError(t, err)
+	require.Len(t, filters, 2)
+
+	gear := filters[0].signals[0]
+	assert.Equal(t, map[int64]string{0: "Park", 1: "Reverse", 2: "Neutral", 3: "Drive", 4: "Low gear"}, gear.states)
+	door := filters[0].signals[1]
+	assert.Equal(t, map[int64]string{0: "Closed", 1: "Open"}, door.states)
+	voltage := filters[1].signals[0]
+	assert.Equal(t, dbcValueFloat, voltage.valueType)
+	assert.Nil(t, voltage.states)
+
+	_, err = dpl.parseDBCHeaders(teststatesdbc + "\nVAL_ 1000 GEAR MissingTable ;")
+	assert.Error(t, err)
+}
+
+func Test_decodeDBCSignal(t *testing.T) {
+	gear := dbcSignal{signalName: "GEAR", formula: `7|8@0+ (1,0) [0|15] "" EON`, states: map[int64]string{0: "Park", 3: "Drive"}}
+	value, unit, state, err := decodeDBCSignal(hexToByteArray("03 00 00 00 00 00 00 00", t), gear)
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, value)
+	assert.Equal(t, "", unit)
+	assert.Equal(t, "Drive", state)
+
+	// not in the table
+	value, unit, state, err = decodeDBCSignal(hexToByteArray("07 00 00 00 00 00 00 00", t), gear)
+	require.NoError(t, err)
+	assert.Equal(t, 7.0, value)
+	assert.Equal(t, "", unit)
+	assert.Equal(t, "", state)
+
+	// 398.5 as a float32
+	voltage := dbcSignal{signalName: "PACK_VOLTAGE", formula: `7|32@0+ (1,0) [0|0] "V" BMS`, valueType: dbcValueFloat}
+	value, unit, state, err = decodeDBCSignal(hexToByteArray("43 C7 40 00 00 00 00 00", t), voltage)
+	require.NoError(t, err)
+	assert.Equal(t, 398.5, value)
+	assert.Equal(t, "V", unit)
+	assert.Equal(t, "", state)
+
+	voltage.formula = `7|16@0+ (1,0) [0|0] "V" BMS`
+	_, _, _, err = decodeDBCSignal(hexToByteArray("43 C7 40 00 00 00 00 00", t), voltage)
+	assert.Error(t, err, "float signals are 32 bits")
+}
+
+func Test_dbcLineFields(t *testing.T) {
+	assert.Equal(t, []string{"VAL_", "1000", "GEAR", "0", "Park", "4", "Low gear"}, dbcLineFields(`VAL_ 1000 GEAR 0 "Park" 4 "Low gear";`))
+	assert.Equal(t, []string{"SIG_VALTYPE_", "1001", "PACK_VOLTAGE", ":", "1"}, dbcLineFields("SIG_VALTYPE_ 1001 PACK_VOLTAGE : 1;"))
+}
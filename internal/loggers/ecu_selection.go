@@ -0,0 +1,195 @@
+package loggers
+
+import (
+	"cmp"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/util"
+	"github.com/pkg/errors"
+)
+
+// ecuResponseWindow responses to a broadcast request are collected for this long after the first one
+const ecuResponseWindow = 100 * time.Millisecond
+
+// ECUValue a decoded response and the header of the ecu it came from, the value is a float64 or with expr formulas
+// possibly a string
+type ECUValue struct {
+	Header uint32
+	Value  any
+}
+
+// DecodeECUResponses decodes the response frames with the request dbc or expr formula, the first response that decodes
+// for each ecu header. Returns the last decoding error if none does.
+func DecodeECUResponses(request models.PIDRequest, frames []string) ([]ECUValue, error) {
+	headerLen := 3
+	if request.Header > 0xfff {
+		headerLen = 8
+	}
+	if request.FormulaType() == models.Expr {
+		return decodeExprResponses(request, frames, headerLen)
+	}
+	var values []ECUValue
+	err := errors.New("no response frames")
+	for _, frame := range frames {
+		if len(frame) < headerLen {
+			continue
+		}
+		header, errHeader := util.HexToDecimal(frame[:headerLen])
+		if errHeader != nil || slices.ContainsFunc(values, func(v ECUValue) bool { return v.Header == header }) {
+			continue
+		}
+		var value float64
+		value, _, err = ExtractAndDecodeWithDBCFormula(frame, util.UintToHexStr(request.Pid), request.FormulaValue())
+		if err == nil {
+			values = append(values, ECUValue{Header: header, Value: value})
+		}
+	}
+	if len(values) == 0 {
+		return nil, err
+	}
+	return values, nil
+}
+
+// decodeExprResponses groups the frames by ecu so multi frame responses are reassembled before the formula is evaluated
+func decodeExprResponses(request models.PIDRequest, frames []string, headerLen int) ([]ECUValue, error) {
+	var headers []uint32
+	byHeader := map[uint32][][]byte{}
+	for _, frame := range frames {
+		if len(frame) < headerLen {
+			continue
+		}
+		header, errHeader := util.HexToDecimal(frame[:headerLen])
+		data, errData := hex.DecodeString(frame[headerLen:])
+		if errHeader != nil || errData != nil {
+			continue
+		}
+		if _, ok := byHeader[header]; !ok {
+			headers = append(headers, header)
+		}
+		byHeader[header] = append(byHeader[header], data)
+	}
+	var values []ECUValue
+	err := errors.New("no response frames")
+	for _, header := range headers {
+		for _, payload := range isoTPMessages(byHeader[header]) {
+			var value any
+			value, err = EvalExprFormula(request, payload)
+			if err == nil {
+				values = append(values, ECUValue{Header: header, Value: value})
+				break
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil, err
+	}
+	return values, nil
+}
+
+// SelectECUValues applies the request ecu selection to the values from each ecu that answered it, ts in unix millis.
+// Only broadcast requests are tagged with the ecu.
+func SelectECUValues(request models.PIDRequest, values []ECUValue, ts int64) []models.SignalData {
+	if len(values) == 0 {
+		return nil
+	}
+	if !request.IsBroadcast() {
+		return []models.SignalData{{Timestamp: ts, Name: request.Name, Value: values[0].Value, Unit: request.Unit(),
+			Source: models.SignalSourcePID}}
+	}
+	sorted := slices.SortedFunc(slices.Values(values), func(a, b ECUValue) int { return cmp.Compare(a.Header, b.Header) })
+	switch request.ECUSelection {
+	case models.ECUSelectionAverage:
+		// text values can't be averaged, those fall back to the engine selection
+		sum := 0.0
+		var numbers []ECUValue
+		for _, v := range sorted {
+			if f, ok := v.Value.(float64); ok {
+				sum += f
+				numbers = append(numbers, v)
+			}
+		}
+		if len(numbers) == 0 {
+			break
+		}
+		signal := models.SignalData{Timestamp: ts, Name: request.Name, Value: sum / float64(len(numbers)),
+			Unit: request.Unit(), Source: models.SignalSourcePID}
+		if len(numbers) == 1 {
+			signal.ECU = ecuName(numbers[0].Header)
+		}
+		return []models.SignalData{signal}
+	case models.ECUSelectionAll:
+		signals := make([]models.SignalData, 0, len(sorted))
+		for _, v := range sorted {
+			ecu := ecuName(v.Header)
+			signals = append(signals, models.SignalData{Timestamp: ts, Name: request.Name + "_" + ecu, Value: v.Value, ECU: ecu,
+				Unit: request.Unit(), Source: models.SignalSourcePID})
+		}
+		return signals
+	}
+	selected := sorted[0]
+	for _, v := range sorted {
+		if v.Header == 0x7e8 || v.Header == 0x18daf110 {
+			selected = v
+		}
+	}
+	return []models.SignalData{{Timestamp: ts, Name: request.Name, Value: selected.Value,
+		ECU: ecuName(selected.Header), Unit: request.Unit(), Source: models.SignalSourcePID}}
+}
+
+func ecuName(header uint32) string {
+	return fmt.Sprintf("%X", header)
+}
+
+// ecuCollector groups the responses to each broadcast request for the window after the first one, then sends the
+// signals selected from them. Safe for concurrent use.
+type ecuCollector struct {
+	window  time.Duration
+	send    func(signal models.SignalData)
+	pending map[string]*ecuResponses
+	mu      sync.Mutex
+}
+
+type ecuResponses struct {
+	request models.PIDRequest
+	values  []ECUValue
+	ts      int64
+}
+
+func newECUCollector(window time.Duration, send func(signal models.SignalData)) *ecuCollector {
+	return &ecuCollector{window: window, send: send, pending: map[string]*ecuResponses{}}
+}
+
+// add a response, a second one from the same ecu within the window replaces the first
+func (c *ecuCollector) add(request models.PIDRequest, header uint32, value any, ts int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	responses, ok := c.pending[request.Name]
+	if !ok {
+		responses = &ecuResponses{request: request, ts: ts}
+		c.pending[request.Name] = responses
+		time.AfterFunc(c.window, func() { c.flush(request.Name) })
+	}
+	if i := slices.IndexFunc(responses.values, func(v ECUValue) bool { return v.Header == header }); i >= 0 {
+		responses.values[i].Value = value
+		return
+	}
+	responses.values = append(responses.values, ECUValue{Header: header, Value: value})
+}
+
+func (c *ecuCollector) flush(name string) {
+	c.mu.Lock()
+	responses := c.pending[name]
+	delete(c.pending, name)
+	c.mu.Unlock()
+	if responses == nil {
+		return
+	}
+	for _, signal := range SelectECUValues(responses.request, responses.values, responses.ts) {
+		c.send(signal)
+	}
+}
@@ -0,0 +1,70 @@
+package loggers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var speedRequest = models.PIDRequest{Name: "speed", Header: 0x7df, Mode: 0x01, Pid: 0x0d, Formula: `dbc:31|8@0+ (1,0) [0|255] "km/h"`}
+
+func TestDecodeECUResponses(t *testing.T) {
+	// engine and abs answer, the engine twice
+	values, err := DecodeECUResponses(speedRequest, []string{"7e803410d32", "7eb03410d30", "7e803410d33", "7e9037f0112"})
+	require.NoError(t, err)
+	assert.Equal(t, []ECUValue{{Header: 0x7e8, Value: 50.0}, {Header: 0x7eb, Value: 48.0}}, values)
+
+	_, err = DecodeECUResponses(speedRequest, []string{"7e9037f0112"})
+	assert.Error(t, err)
+}
+
+func TestSelectECUValues(t *testing.T) {
+	values := []ECUValue{{Header: 0x7eb, Value: 48.0}, {Header: 0x7e8, Value: 50.0}, {Header: 0x7e9, Value: 55.0}}
+	ts := time.Now().UnixMilli()
+
+	assert.Equal(t, []models.SignalData{{Timestamp: ts, Name: "speed", Value: 50.0, ECU: "7E8", Unit: "km/h", Source: models.SignalSourcePID}},
+		SelectECUValues(speedRequest, values, ts), "the engine is the default")
+	assert.Equal(t, []models.SignalData{{Timestamp: ts, Name: "speed", Value: 48.0, ECU: "7EB", Unit: "km/h", Source: models.SignalSourcePID}},
+		SelectECUValues(speedRequest, values[:1], ts), "any ecu when the engine doesn't answer")
+
+	request := speedRequest
+	request.ECUSelection = models.ECUSelectionAverage
+	assert.Equal(t, []models.SignalData{{Timestamp: ts, Name: "speed", Value: 51.0, Unit: "km/h", Source: models.SignalSourcePID}}, SelectECUValues(request, values, ts))
+
+	request.ECUSelection = models.ECUSelectionAll
+	assert.Equal(t, []models.SignalData{
+		{Timestamp: ts, Name: "speed_7E8", Value: 50.0, ECU: "7E8", Unit: "km/h", Source: models.SignalSourcePID},
+		{Timestamp: ts, Name: "speed_7E9", Value: 55.0, ECU: "7E9", Unit: "km/h", Source: models.SignalSourcePID},
+		{Timestamp: ts, Name: "speed_7EB", Value: 48.0, ECU: "7EB", Unit: "km/h", Source: models.SignalSourcePID},
+	}, SelectECUValues(request, values, ts))
+
+	// physical requests have a single ecu
+	request = models.PIDRequest{Name: "speed", Header: 0x7e0, ECUSelection: models.ECUSelectionAll}
+	assert.Equal(t, []models.SignalData{{Timestamp: ts, Name: "speed", Value: 48.0, Source: models.SignalSourcePID}},
+		SelectECUValues(request, values[:1], ts))
+}
+
+func TestECUCollector(t *testing.T) {
+	var mu sync.Mutex
+	var sent []models.SignalData
+	c := newECUCollector(20*time.Millisecond, func(signal models.SignalData) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, signal)
+	})
+	c.add(speedRequest, 0x7e9, 55.0, 1)
+	c.add(speedRequest, 0x7e8, 49.0, 2)
+	c.add(speedRequest, 0x7e8, 50.0, 3)
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent) == 1
+	}, time.Second, 5*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, models.SignalData{Timestamp: 1, Name: "speed", Value: 50.0, ECU: "7E8", Unit: "km/h", Source: models.SignalSourcePID}, sent[0], "timestamped with the first response")
+}
@@ -0,0 +1,119 @@
+package loggers
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/DIMO-Network/edge-network/internal/expr"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// exprPrograms compiled expr formulas by source, templates have a few dozen so it stays small
+var exprPrograms sync.Map
+
+func compileExpr(formula string) (*expr.Program, error) {
+	if p, ok := exprPrograms.Load(formula); ok {
+		return p.(*expr.Program), nil
+	}
+	p, err := expr.Compile(formula)
+	if err != nil {
+		return nil, err
+	}
+	exprPrograms.Store(formula, p)
+	return p, nil
+}
+
+// EvalExprFormula evaluates the request expr formula on a response payload, the uds message after the pci bytes starting
+// with the service id. The result is a float64 or a string.
+func EvalExprFormula(request models.PIDRequest, payload []byte) (any, error) {
+	if len(payload) == 0 {
+		return nil, errors.New("empty response")
+	}
+	if payload[0] == 0x7f {
+		return nil, fmt.Errorf("negative response: %s", printBytesAsHex(payload))
+	}
+	if uint32(payload[0]) != request.Mode+0x40 {
+		return nil, fmt.Errorf("response to another service: %s", printBytesAsHex(payload))
+	}
+	// dids echo 2 bytes, pids 1
+	echo := 1
+	if request.Mode == 0x22 || request.Pid > 0xff {
+		echo = 2
+	}
+	if len(payload) < 1+echo {
+		return nil, fmt.Errorf("response too short: %s", printBytesAsHex(payload))
+	}
+	var pid uint32
+	for _, b := range payload[1 : 1+echo] {
+		pid = pid<<8 | uint32(b)
+	}
+	if pid != request.Pid {
+		return nil, fmt.Errorf("PID %d not found in response: %s", request.Pid, printBytesAsHex(payload))
+	}
+	program, err := compileExpr(request.FormulaValue())
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid formula %s", request.FormulaValue())
+	}
+	return program.Eval(expr.Env{Data: payload, Bytes: payload[1+echo:]})
+}
+
+// isoTPMessages reassembles the payloads from the frames of one ecu, data with the pci bytes. A single frame is a
+// message, a first frame and the consecutive frames after it are another. Flow control and incomplete messages are
+// skipped.
+func isoTPMessages(frames [][]byte) [][]byte {
+	var messages [][]byte
+	var pending []byte
+	pendingLen := 0
+	for _, frame := range frames {
+		if len(frame) == 0 {
+			continue
+		}
+		switch frame[0] >> 4 {
+		case 0: // single frame
+			n := int(frame[0] & 0x0f)
+			if n > 0 && n < len(frame) {
+				messages = append(messages, frame[1:1+n])
+			}
+			pending = nil
+		case 1: // first frame, 12 bit length
+			if len(frame) < 2 {
+				continue
+			}
+			pendingLen = int(frame[0]&0x0f)<<8 | int(frame[1])
+			pending = append([]byte{}, frame[2:]...)
+		case 2: // consecutive frame
+			if pending == nil {
+				continue
+			}
+			pending = append(pending, frame[1:]...)
+		default:
+			continue
+		}
+		if pending != nil && len(pending) >= pendingLen {
+			messages = append(messages, pending[:pendingLen])
+			pending = nil
+		}
+	}
+	return messages
+}
+
+// TranslatePythonFormulas rewrites the python formulas the expr engine can evaluate to expr formulas, so they're
+// decoded on the device and don't keep the native logger from running. The AutoPi formulas are mostly arithmetic on
+// messages[0].data, which expr supports as is. Returns a copy of the requests.
+func TranslatePythonFormulas(logger zerolog.Logger, requests []models.PIDRequest) []models.PIDRequest {
+	translated := make([]models.PIDRequest, len(requests))
+	copy(translated, requests)
+	for i, request := range translated {
+		if request.FormulaType() != models.Python {
+			continue
+		}
+		if _, err := compileExpr(request.FormulaValue()); err != nil {
+			logger.Debug().Err(err).Msgf("keeping python formula for %s", request.Name)
+			continue
+		}
+		translated[i].Formula = "expr:" + request.FormulaValue()
+	}
+	return translated
+}
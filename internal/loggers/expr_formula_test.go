@@ -0,0 +1,71 @@
+package loggers
+
+import (
+	"testing"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalExprFormula(t *testing.T) {
+	coolant := models.PIDRequest{Name: "coolantTemp", Header: 0x7df, Mode: 0x01, Pid: 0x05, Formula: "expr:bytes[0] - 40"}
+	value, err := EvalExprFormula(coolant, []byte{0x41, 0x05, 0x7b})
+	require.NoError(t, err)
+	assert.Equal(t, 83.0, value)
+
+	_, err = EvalExprFormula(coolant, []byte{0x41, 0x0c, 0x7b})
+	assert.Error(t, err, "another pid")
+	_, err = EvalExprFormula(coolant, []byte{0x7f, 0x01, 0x12})
+	assert.Error(t, err, "negative response")
+
+	// dids echo 2 bytes
+	soc := models.PIDRequest{Name: "soc", Header: 0x7e4, Mode: 0x22, Pid: 0x0101, Formula: "expr:bytes_to_int(bytes[0:2]) / 10"}
+	value, err = EvalExprFormula(soc, []byte{0x62, 0x01, 0x01, 0x02, 0x9e})
+	require.NoError(t, err)
+	assert.Equal(t, 67.0, value)
+}
+
+func TestDecodeECUResponses_expr(t *testing.T) {
+	vin := models.PIDRequest{Name: "vin", Header: 0x7df, Mode: 0x22, Pid: 0xf190, Formula: "expr:ascii(bytes)"}
+	// the abs ecu doesn't support it, the engine answers with a multi frame response
+	values, err := DecodeECUResponses(vin, []string{"7e9037f2231", "7e8101462f190314654", "7e82146573145543544", "7e82246433130333132"})
+	require.NoError(t, err)
+	assert.Equal(t, []ECUValue{{Header: 0x7e8, Value: "1FTFW1ET5DFC10312"}}, values)
+
+	_, err = DecodeECUResponses(vin, []string{"7e8101462f190314654", "7e82146573145543544"})
+	assert.Error(t, err, "incomplete response")
+}
+
+func Test_decodePIDFrame(t *testing.T) {
+	rpm := models.PIDRequest{Name: "rpm", Header: 0x7df, Mode: 0x01, Pid: 0x0c, Formula: "expr:(256 * bytes[0] + bytes[1]) / 4"}
+	value, err := decodePIDFrame(rpm, []byte{0x04, 0x41, 0x0c, 0x1a, 0xf8, 0xaa, 0xaa, 0xaa})
+	require.NoError(t, err)
+	assert.Equal(t, 1726.0, value)
+
+	rpm.Formula = `dbc:31|16@0+ (0.25,0) [0|16383.75] "rpm"`
+	value, err = decodePIDFrame(rpm, []byte{0x04, 0x41, 0x0c, 0x1a, 0xf8, 0xaa, 0xaa, 0xaa})
+	require.NoError(t, err)
+	assert.Equal(t, 1726.0, value)
+
+	// signed, the ev catalog bolt pack current
+	current := models.PIDRequest{Name: "hvBatteryCurrent", Header: 0x7e4, Mode: 0x22, Pid: 0x2414,
+		Formula: `dbc:39|16@0- (-0.05,0) [-1000|1000] "A"`}
+	value, err = decodePIDFrame(current, []byte{0x05, 0x62, 0x24, 0x14, 0x01, 0x90, 0xaa, 0xaa})
+	require.NoError(t, err)
+	assert.Equal(t, -20.0, value)
+}
+
+func TestTranslatePythonFormulas(t *testing.T) {
+	requests := []models.PIDRequest{
+		{Name: "oilTemp", Formula: "python:(bytes_to_int(messages[0].data[-1:]) - 50) * 1.8 + 32"},
+		{Name: "gear", Formula: "python:[g for g in messages[0].data][3]"},
+		{Name: "speed", Formula: `dbc:31|8@0+ (1,0) [0|255] "km/h"`},
+	}
+	translated := TranslatePythonFormulas(zerolog.Nop(), requests)
+	assert.Equal(t, "expr:(bytes_to_int(messages[0].data[-1:]) - 50) * 1.8 + 32", translated[0].Formula)
+	assert.Equal(t, requests[1].Formula, translated[1].Formula, "not supported, autopi evaluates it")
+	assert.Equal(t, requests[2].Formula, translated[2].Formula)
+	assert.Equal(t, models.Python, requests[0].FormulaType(), "the template is not modified")
+}
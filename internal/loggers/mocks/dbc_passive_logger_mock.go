@@ -5,12 +5,15 @@
 //
 //	mockgen -source dbc_passive_logger.go -destination mocks/dbc_passive_logger_mock.go
 //
+
 // Package mock_loggers is a generated GoMock package.
 package mock_loggers
 
 import (
 	reflect "reflect"
+	time "time"
 
+	loggers "github.com/DIMO-Network/edge-network/internal/loggers"
 	models "github.com/DIMO-Network/edge-network/internal/models"
 	gomock "go.uber.org/mock/gomock"
 )
@@ -38,6 +41,21 @@ func (m *MockDBCPassiveLogger) EXPECT() *MockDBCPassiveLoggerMockRecorder {
 	return m.recorder
 }
 
+// DiscoverDBCCandidates mocks base method.
+func (m *MockDBCPassiveLogger) DiscoverDBCCandidates(window time.Duration, refs loggers.ReferenceSource, refNames []string) (*models.DBCDiscoveryReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DiscoverDBCCandidates", window, refs, refNames)
+	ret0, _ := ret[0].(*models.DBCDiscoveryReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DiscoverDBCCandidates indicates an expected call of DiscoverDBCCandidates.
+func (mr *MockDBCPassiveLoggerMockRecorder) DiscoverDBCCandidates(window, refs, refNames any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DiscoverDBCCandidates", reflect.TypeOf((*MockDBCPassiveLogger)(nil).DiscoverDBCCandidates), window, refs, refNames)
+}
+
 // SendCANQuery mocks base method.
 func (m *MockDBCPassiveLogger) SendCANQuery(header, mode, pid uint32) error {
 	m.ctrl.T.Helper()
@@ -52,6 +70,32 @@ func (mr *MockDBCPassiveLoggerMockRecorder) SendCANQuery(header, mode, pid any)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendCANQuery", reflect.TypeOf((*MockDBCPassiveLogger)(nil).SendCANQuery), header, mode, pid)
 }
 
+// SetPIDs mocks base method.
+func (m *MockDBCPassiveLogger) SetPIDs(pids []models.PIDRequest) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetPIDs", pids)
+}
+
+// SetPIDs indicates an expected call of SetPIDs.
+func (mr *MockDBCPassiveLoggerMockRecorder) SetPIDs(pids any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPIDs", reflect.TypeOf((*MockDBCPassiveLogger)(nil).SetPIDs), pids)
+}
+
+// ShouldNativeScanLogger mocks base method.
+func (m *MockDBCPassiveLogger) ShouldNativeScanLogger() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ShouldNativeScanLogger")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// ShouldNativeScanLogger indicates an expected call of ShouldNativeScanLogger.
+func (mr *MockDBCPassiveLoggerMockRecorder) ShouldNativeScanLogger() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ShouldNativeScanLogger", reflect.TypeOf((*MockDBCPassiveLogger)(nil).ShouldNativeScanLogger))
+}
+
 // StartScanning mocks base method.
 func (m *MockDBCPassiveLogger) StartScanning(ch chan<- models.SignalData) error {
 	m.ctrl.T.Helper()
@@ -80,16 +124,40 @@ func (mr *MockDBCPassiveLoggerMockRecorder) StopScanning() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopScanning", reflect.TypeOf((*MockDBCPassiveLogger)(nil).StopScanning))
 }
 
-// UseNativeScanLogger mocks base method.
-func (m *MockDBCPassiveLogger) ShouldNativeScanLogger() bool {
+// MockReferenceSource is a mock of ReferenceSource interface.
+type MockReferenceSource struct {
+	ctrl     *gomock.Controller
+	recorder *MockReferenceSourceMockRecorder
+}
+
+// MockReferenceSourceMockRecorder is the mock recorder for MockReferenceSource.
+type MockReferenceSourceMockRecorder struct {
+	mock *MockReferenceSource
+}
+
+// NewMockReferenceSource creates a new mock instance.
+func NewMockReferenceSource(ctrl *gomock.Controller) *MockReferenceSource {
+	mock := &MockReferenceSource{ctrl: ctrl}
+	mock.recorder = &MockReferenceSourceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReferenceSource) EXPECT() *MockReferenceSourceMockRecorder {
+	return m.recorder
+}
+
+// LatestFloat mocks base method.
+func (m *MockReferenceSource) LatestFloat(name string, maxAge time.Duration) (float64, bool) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ShouldNativeScanLogger")
-	ret0, _ := ret[0].(bool)
-	return ret0
+	ret := m.ctrl.Call(m, "LatestFloat", name, maxAge)
+	ret0, _ := ret[0].(float64)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
 }
 
-// UseNativeScanLogger indicates an expected call of UseNativeScanLogger.
-func (mr *MockDBCPassiveLoggerMockRecorder) UseNativeScanLogger() *gomock.Call {
+// LatestFloat indicates an expected call of LatestFloat.
+func (mr *MockReferenceSourceMockRecorder) LatestFloat(name, maxAge any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ShouldNativeScanLogger", reflect.TypeOf((*MockDBCPassiveLogger)(nil).ShouldNativeScanLogger))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LatestFloat", reflect.TypeOf((*MockReferenceSource)(nil).LatestFloat), name, maxAge)
 }
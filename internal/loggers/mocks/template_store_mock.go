@@ -5,6 +5,7 @@
 //
 //	mockgen -source template_store.go -destination mocks/template_store_mock.go
 //
+
 // Package mock_loggers is a generated GoMock package.
 package mock_loggers
 
@@ -53,6 +54,50 @@ func (mr *MockSettingsStoreMockRecorder) DeleteAllSettings() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAllSettings", reflect.TypeOf((*MockSettingsStore)(nil).DeleteAllSettings))
 }
 
+// InvalidateVehicleSettings mocks base method.
+func (m *MockSettingsStore) InvalidateVehicleSettings() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InvalidateVehicleSettings")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InvalidateVehicleSettings indicates an expected call of InvalidateVehicleSettings.
+func (mr *MockSettingsStoreMockRecorder) InvalidateVehicleSettings() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InvalidateVehicleSettings", reflect.TypeOf((*MockSettingsStore)(nil).InvalidateVehicleSettings))
+}
+
+// ReadBatteryHealthState mocks base method.
+func (m *MockSettingsStore) ReadBatteryHealthState() (*models.BatteryHealthState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadBatteryHealthState")
+	ret0, _ := ret[0].(*models.BatteryHealthState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadBatteryHealthState indicates an expected call of ReadBatteryHealthState.
+func (mr *MockSettingsStoreMockRecorder) ReadBatteryHealthState() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadBatteryHealthState", reflect.TypeOf((*MockSettingsStore)(nil).ReadBatteryHealthState))
+}
+
+// ReadCANCaptureState mocks base method.
+func (m *MockSettingsStore) ReadCANCaptureState() (*models.CANCaptureState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadCANCaptureState")
+	ret0, _ := ret[0].(*models.CANCaptureState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadCANCaptureState indicates an expected call of ReadCANCaptureState.
+func (mr *MockSettingsStoreMockRecorder) ReadCANCaptureState() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadCANCaptureState", reflect.TypeOf((*MockSettingsStore)(nil).ReadCANCaptureState))
+}
+
 // ReadCANDumpInfo mocks base method.
 func (m *MockSettingsStore) ReadCANDumpInfo() (*models.CANDumpInfo, error) {
 	m.ctrl.T.Helper()
@@ -68,6 +113,21 @@ func (mr *MockSettingsStoreMockRecorder) ReadCANDumpInfo() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadCANDumpInfo", reflect.TypeOf((*MockSettingsStore)(nil).ReadCANDumpInfo))
 }
 
+// ReadCapabilities mocks base method.
+func (m *MockSettingsStore) ReadCapabilities() (*models.VehicleCapabilities, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadCapabilities")
+	ret0, _ := ret[0].(*models.VehicleCapabilities)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadCapabilities indicates an expected call of ReadCapabilities.
+func (mr *MockSettingsStoreMockRecorder) ReadCapabilities() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadCapabilities", reflect.TypeOf((*MockSettingsStore)(nil).ReadCapabilities))
+}
+
 // ReadDBCFile mocks base method.
 func (m *MockSettingsStore) ReadDBCFile() (*string, error) {
 	m.ctrl.T.Helper()
@@ -83,6 +143,36 @@ func (mr *MockSettingsStoreMockRecorder) ReadDBCFile() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadDBCFile", reflect.TypeOf((*MockSettingsStore)(nil).ReadDBCFile))
 }
 
+// ReadGeofenceState mocks base method.
+func (m *MockSettingsStore) ReadGeofenceState() (*models.GeofenceState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadGeofenceState")
+	ret0, _ := ret[0].(*models.GeofenceState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadGeofenceState indicates an expected call of ReadGeofenceState.
+func (mr *MockSettingsStoreMockRecorder) ReadGeofenceState() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadGeofenceState", reflect.TypeOf((*MockSettingsStore)(nil).ReadGeofenceState))
+}
+
+// ReadOdometerState mocks base method.
+func (m *MockSettingsStore) ReadOdometerState() (*models.OdometerState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadOdometerState")
+	ret0, _ := ret[0].(*models.OdometerState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadOdometerState indicates an expected call of ReadOdometerState.
+func (mr *MockSettingsStoreMockRecorder) ReadOdometerState() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadOdometerState", reflect.TypeOf((*MockSettingsStore)(nil).ReadOdometerState))
+}
+
 // ReadPIDsConfig mocks base method.
 func (m *MockSettingsStore) ReadPIDsConfig() (*models.TemplatePIDs, error) {
 	m.ctrl.T.Helper()
@@ -158,6 +248,34 @@ func (mr *MockSettingsStoreMockRecorder) ReadVehicleInfo() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadVehicleInfo", reflect.TypeOf((*MockSettingsStore)(nil).ReadVehicleInfo))
 }
 
+// WriteBatteryHealthState mocks base method.
+func (m *MockSettingsStore) WriteBatteryHealthState(state models.BatteryHealthState) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteBatteryHealthState", state)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteBatteryHealthState indicates an expected call of WriteBatteryHealthState.
+func (mr *MockSettingsStoreMockRecorder) WriteBatteryHealthState(state any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteBatteryHealthState", reflect.TypeOf((*MockSettingsStore)(nil).WriteBatteryHealthState), state)
+}
+
+// WriteCANCaptureState mocks base method.
+func (m *MockSettingsStore) WriteCANCaptureState(state models.CANCaptureState) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteCANCaptureState", state)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteCANCaptureState indicates an expected call of WriteCANCaptureState.
+func (mr *MockSettingsStoreMockRecorder) WriteCANCaptureState(state any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteCANCaptureState", reflect.TypeOf((*MockSettingsStore)(nil).WriteCANCaptureState), state)
+}
+
 // WriteCANDumpInfo mocks base method.
 func (m *MockSettingsStore) WriteCANDumpInfo() error {
 	m.ctrl.T.Helper()
@@ -172,6 +290,20 @@ func (mr *MockSettingsStoreMockRecorder) WriteCANDumpInfo() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteCANDumpInfo", reflect.TypeOf((*MockSettingsStore)(nil).WriteCANDumpInfo))
 }
 
+// WriteCapabilities mocks base method.
+func (m *MockSettingsStore) WriteCapabilities(capabilities models.VehicleCapabilities) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteCapabilities", capabilities)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteCapabilities indicates an expected call of WriteCapabilities.
+func (mr *MockSettingsStoreMockRecorder) WriteCapabilities(capabilities any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteCapabilities", reflect.TypeOf((*MockSettingsStore)(nil).WriteCapabilities), capabilities)
+}
+
 // WriteDBCFile mocks base method.
 func (m *MockSettingsStore) WriteDBCFile(dbcFile *string) error {
 	m.ctrl.T.Helper()
@@ -186,6 +318,34 @@ func (mr *MockSettingsStoreMockRecorder) WriteDBCFile(dbcFile any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteDBCFile", reflect.TypeOf((*MockSettingsStore)(nil).WriteDBCFile), dbcFile)
 }
 
+// WriteGeofenceState mocks base method.
+func (m *MockSettingsStore) WriteGeofenceState(state models.GeofenceState) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteGeofenceState", state)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteGeofenceState indicates an expected call of WriteGeofenceState.
+func (mr *MockSettingsStoreMockRecorder) WriteGeofenceState(state any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteGeofenceState", reflect.TypeOf((*MockSettingsStore)(nil).WriteGeofenceState), state)
+}
+
+// WriteOdometerState mocks base method.
+func (m *MockSettingsStore) WriteOdometerState(state models.OdometerState) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteOdometerState", state)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteOdometerState indicates an expected call of WriteOdometerState.
+func (mr *MockSettingsStoreMockRecorder) WriteOdometerState(state any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteOdometerState", reflect.TypeOf((*MockSettingsStore)(nil).WriteOdometerState), state)
+}
+
 // WritePIDsConfig mocks base method.
 func (m *MockSettingsStore) WritePIDsConfig(settings models.TemplatePIDs) error {
 	m.ctrl.T.Helper()
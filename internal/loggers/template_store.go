@@ -27,6 +27,11 @@ const (
 	VehicleInfoFile    = "/opt/autopi/vehicle-info.json"
 	DBCFile            = "/opt/autopi/dbc-settings.dbc"
 	CANDumpInfoFile    = "/opt/autopi/can-dump-info.json"
+	CANCaptureFile     = "/opt/autopi/can-capture-state.json"
+	GeofenceStateFile  = "/opt/autopi/geofence-state.json"
+	BatteryHealthFile  = "/opt/autopi/battery-health-state.json"
+	OdometerFile       = "/opt/autopi/odometer-state.json"
+	CapabilitiesFile   = "/opt/autopi/vehicle-capabilities.json"
 )
 
 //go:generate mockgen -source template_store.go -destination mocks/template_store_mock.go
@@ -49,10 +54,28 @@ type SettingsStore interface {
 	ReadVehicleInfo() (*models.VehicleInfo, error)
 	WriteVehicleInfo(settings models.VehicleInfo) error
 	DeleteAllSettings() error
+	// InvalidateVehicleSettings deletes the templates, vehicle info and state that belong to the paired vehicle, for
+	// when the device was moved to another one. The VIN config and CAN dump info are kept.
+	InvalidateVehicleSettings() error
 
 	ReadCANDumpInfo() (*models.CANDumpInfo, error)
 	// WriteCANDumpInfo sets current date on disk
 	WriteCANDumpInfo() error
+
+	ReadCANCaptureState() (*models.CANCaptureState, error)
+	WriteCANCaptureState(state models.CANCaptureState) error
+
+	ReadGeofenceState() (*models.GeofenceState, error)
+	WriteGeofenceState(state models.GeofenceState) error
+
+	ReadBatteryHealthState() (*models.BatteryHealthState, error)
+	WriteBatteryHealthState(state models.BatteryHealthState) error
+
+	ReadOdometerState() (*models.OdometerState, error)
+	WriteOdometerState(state models.OdometerState) error
+
+	ReadCapabilities() (*models.VehicleCapabilities, error)
+	WriteCapabilities(capabilities models.VehicleCapabilities) error
 }
 
 // settingsStore wraps reading and writing different configurations locally
@@ -70,6 +93,11 @@ func (ts *settingsStore) DeleteAllSettings() error {
 	errs = append(errs, ts.deleteConfig(TemplateURLsFile))
 	errs = append(errs, ts.deleteConfig(DBCFile))
 	errs = append(errs, ts.deleteConfig(CANDumpInfoFile))
+	errs = append(errs, ts.deleteConfig(CANCaptureFile))
+	errs = append(errs, ts.deleteConfig(GeofenceStateFile))
+	errs = append(errs, ts.deleteConfig(BatteryHealthFile))
+	errs = append(errs, ts.deleteConfig(OdometerFile))
+	errs = append(errs, ts.deleteConfig(CapabilitiesFile))
 
 	// Combine errors and print the result
 	if combinedErr := combineErrors(errs); combinedErr != nil {
@@ -78,6 +106,18 @@ func (ts *settingsStore) DeleteAllSettings() error {
 	return nil
 }
 
+func (ts *settingsStore) InvalidateVehicleSettings() error {
+	var errs []error
+	for _, file := range []string{PIDConfigFile, DeviceSettingsFile, VehicleInfoFile, TemplateURLsFile, DBCFile,
+		CANCaptureFile, GeofenceStateFile, BatteryHealthFile, OdometerFile, CapabilitiesFile} {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			continue
+		}
+		errs = append(errs, ts.deleteConfig(file))
+	}
+	return combineErrors(errs)
+}
+
 func (ts *settingsStore) ReadDBCFile() (*string, error) {
 	data, err := ts.readConfig(DBCFile)
 	if err != nil {
@@ -268,6 +308,126 @@ func (ts *settingsStore) WriteCANDumpInfo() error {
 	return nil
 }
 
+func (ts *settingsStore) ReadCANCaptureState() (*models.CANCaptureState, error) {
+	data, err := ts.readConfig(CANCaptureFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %s", err)
+	}
+	state := &models.CANCaptureState{}
+
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshall canCaptureState: %s", err)
+	}
+
+	return state, nil
+}
+
+func (ts *settingsStore) WriteCANCaptureState(state models.CANCaptureState) error {
+	err := ts.writeConfig(CANCaptureFile, state)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (ts *settingsStore) ReadGeofenceState() (*models.GeofenceState, error) {
+	data, err := ts.readConfig(GeofenceStateFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %s", err)
+	}
+	state := &models.GeofenceState{}
+
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshall geofenceState: %s", err)
+	}
+
+	return state, nil
+}
+
+func (ts *settingsStore) WriteGeofenceState(state models.GeofenceState) error {
+	err := ts.writeConfig(GeofenceStateFile, state)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (ts *settingsStore) ReadBatteryHealthState() (*models.BatteryHealthState, error) {
+	data, err := ts.readConfig(BatteryHealthFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %s", err)
+	}
+	state := &models.BatteryHealthState{}
+
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshall batteryHealthState: %s", err)
+	}
+
+	return state, nil
+}
+
+func (ts *settingsStore) WriteBatteryHealthState(state models.BatteryHealthState) error {
+	err := ts.writeConfig(BatteryHealthFile, state)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (ts *settingsStore) ReadOdometerState() (*models.OdometerState, error) {
+	data, err := ts.readConfig(OdometerFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %s", err)
+	}
+	state := &models.OdometerState{}
+
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshall odometerState: %s", err)
+	}
+
+	return state, nil
+}
+
+func (ts *settingsStore) WriteOdometerState(state models.OdometerState) error {
+	err := ts.writeConfig(OdometerFile, state)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (ts *settingsStore) ReadCapabilities() (*models.VehicleCapabilities, error) {
+	data, err := ts.readConfig(CapabilitiesFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %s", err)
+	}
+	capabilities := &models.VehicleCapabilities{}
+
+	err = json.Unmarshal(data, capabilities)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshall vehicleCapabilities: %s", err)
+	}
+
+	return capabilities, nil
+}
+
+func (ts *settingsStore) WriteCapabilities(capabilities models.VehicleCapabilities) error {
+	err := ts.writeConfig(CapabilitiesFile, capabilities)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (ts *settingsStore) readConfig(filePath string) ([]byte, error) {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
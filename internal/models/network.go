@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/DIMO-Network/edge-network/internal/api"
+	"github.com/DIMO-Network/edge-network/internal/clock"
 	"github.com/DIMO-Network/shared"
 )
 
@@ -16,6 +17,8 @@ type CanDumpData struct {
 type CommonData struct {
 	// Timestamp is in unix millis, when payload was sent
 	Timestamp int64 `json:"timestamp"`
+	// ClockQuality how far timestamps can be trusted: ntp, gnss or unsynced
+	ClockQuality clock.Quality `json:"clockQuality,omitempty"`
 }
 
 type DeviceStatusData struct {
@@ -46,6 +49,8 @@ type Device struct {
 
 type Vehicle struct {
 	Signals []SignalData `json:"signals,omitempty"`
+	// SignalMappingVersion set when the signal names are VSS paths, the version of the mapping table
+	SignalMappingVersion string `json:"signalMappingVersion,omitempty"`
 }
 
 type WiFi struct {
@@ -59,15 +64,54 @@ type Location struct {
 	Longitude float64 `json:"longitude,omitempty"`
 	Nsat      int64   `json:"nsat,omitempty"`
 	Altitude  float64 `json:"altitude,omitempty"`
+	// Fix 2D or 3D
+	Fix string `json:"fix,omitempty"`
+	// Cog course over ground in degrees
+	Cog float64 `json:"cog,omitempty"`
+	// SogKm speed over ground in km/h
+	SogKm float64 `json:"sogKm,omitempty"`
+	// NsatGlonass glonass satellites, Nsat is gps only on the le910cx
+	NsatGlonass int64 `json:"nsatGlonass,omitempty"`
+	// FixTime gnss utc time of the fix in unix millis
+	FixTime int64 `json:"fixTime,omitempty"`
+	// Estimated by dead reckoning, not a gps fix. AccuracyMeters is the estimated error radius
+	Estimated      bool    `json:"estimated,omitempty"`
+	AccuracyMeters float64 `json:"accuracyMeters,omitempty"`
 }
 
+// SignalSource where a signal value comes from
+type SignalSource string
+
+const (
+	SignalSourcePID    SignalSource = "pid"
+	SignalSourceDBC    SignalSource = "dbc"
+	SignalSourceGPS    SignalSource = "gps"
+	SignalSourceModem  SignalSource = "modem"
+	SignalSourceDevice SignalSource = "device"
+)
+
 type SignalData struct {
 	// Timestamp is in unix millis, when signal was queried
 	Timestamp int64  `json:"timestamp"`
 	Name      string `json:"name"`
 	Value     any    `json:"value"`
+	// State the text for the value of dbc state signals, eg. "Park" for a gear position
+	State string `json:"state,omitempty"`
+	// Unit of the value, eg. km from the dbc formula or the VSS unit once mapped. Within a payload Unit and Source are only
+	// sent on the first signal of a name and when they change, every payload starts over
+	Unit string `json:"unit,omitempty"`
+	// Source where the value comes from, eg. pid or gps
+	Source SignalSource `json:"source,omitempty"`
+	// DecodeError the frame was received but could not be decoded with the formula, the value is not valid
+	DecodeError bool `json:"decodeError,omitempty"`
+	// MappedFrom the name before the VSS mapping, eg. latitude, set when the signal was renamed
+	MappedFrom string `json:"-"`
 	// LimitFrequency does not get json serialized. Used for DBC scanning when we get the particular signal too often
 	LimitFrequency bool `json:"-"`
+	// TripID is set when the signal was queried during a trip
+	TripID string `json:"tripId,omitempty"`
+	// ECU the header of the ecu that answered a broadcast request, eg. 7E8
+	ECU string `json:"ecu,omitempty"`
 }
 
 type ErrorsData struct {
@@ -83,11 +127,21 @@ type ErrorsData struct {
 
 type FingerprintData struct {
 	CommonData
-	Device          Device  `json:"device,omitempty"`
-	Vin             string  `json:"vin"`
-	Protocol        string  `json:"protocol"`
-	Odometer        float64 `json:"odometer,omitempty"`
-	SoftwareVersion string  `json:"softwareVersion"`
+	Device   Device  `json:"device,omitempty"`
+	Vin      string  `json:"vin"`
+	Protocol string  `json:"protocol"`
+	Odometer float64 `json:"odometer,omitempty"`
+	// OdometerSource the strategy the odometer was read with, eg. obd_a6 or gps
+	OdometerSource  string `json:"odometerSource,omitempty"`
+	SoftwareVersion string `json:"softwareVersion"`
+}
+
+// VehicleChangedEvent the VIN read on boot is not the one the device was paired with, it was moved to another vehicle
+type VehicleChangedEvent struct {
+	CommonData
+	PreviousVIN     string `json:"previousVin"`
+	VIN             string `json:"vin"`
+	PreviousTokenID uint64 `json:"previousVehicleTokenId"`
 }
 
 type DtcErrorsData struct {
@@ -111,6 +165,207 @@ type CANDumpInfo struct {
 	DateExecuted time.Time `json:"dateExecuted"`
 }
 
+type CANCaptureStatus string
+
+const (
+	CANCapturePending   CANCaptureStatus = "pending"
+	CANCaptureUploading CANCaptureStatus = "uploading"
+	CANCaptureDone      CANCaptureStatus = "done"
+	CANCaptureFailed    CANCaptureStatus = "failed"
+	CANCaptureExpired   CANCaptureStatus = "expired"
+)
+
+// CANCaptureState is persisted so we don't repeat captures across restarts and can resume uploads, keyed by job id
+type CANCaptureState struct {
+	Jobs map[string]CANCaptureJobState `json:"jobs"`
+}
+
+type CANCaptureJobState struct {
+	Status CANCaptureStatus `json:"status"`
+	// File is the compressed recording waiting to be uploaded
+	File string `json:"file,omitempty"`
+	// NextChunk to upload, to resume after a failure
+	NextChunk int       `json:"nextChunk"`
+	Frames    int       `json:"frames"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type TripEventType string
+
+const (
+	TripStart TripEventType = "start"
+	TripEnd   TripEventType = "end"
+)
+
+// TripEvent is sent when a trip starts and when it ends. The summary fields are only set on end.
+type TripEvent struct {
+	CommonData
+	TripID    string        `json:"tripId"`
+	Type      TripEventType `json:"type"`
+	StartTime int64         `json:"startTime"`
+	EndTime   int64         `json:"endTime,omitempty"`
+	// DurationSecs from engine on to the last time the engine was seen on
+	DurationSecs  float64   `json:"durationSecs,omitempty"`
+	DistanceKm    float64   `json:"distanceKm,omitempty"`
+	StartLocation *Location `json:"startLocation,omitempty"`
+	EndLocation   *Location `json:"endLocation,omitempty"`
+	MaxSpeed      float64   `json:"maxSpeed,omitempty"`
+	// IdleSecs time with the engine on and speed 0
+	IdleSecs float64 `json:"idleSecs,omitempty"`
+	// FuelUsedPercent drop in fuel level, percent of the tank
+	FuelUsedPercent *float64 `json:"fuelUsedPercent,omitempty"`
+	// EnergyUsedPercent drop in state of charge for EVs
+	EnergyUsedPercent *float64 `json:"energyUsedPercent,omitempty"`
+}
+
+type DrivingEventType string
+
+const (
+	HarshBrake DrivingEventType = "harsh_brake"
+	HarshAccel DrivingEventType = "harsh_accel"
+	HarshTurn  DrivingEventType = "harsh_turn"
+	OverSpeed  DrivingEventType = "over_speed"
+)
+
+// DrivingEvent a single harsh driving event
+type DrivingEvent struct {
+	CommonData
+	Type DrivingEventType `json:"type"`
+	// Source what it was detected from: the speed signal name, gps or accelerometer
+	Source string `json:"source"`
+	// Value peak acceleration in g, or max speed in km/h for over-speed
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Speed     float64 `json:"speed,omitempty"`
+	// DurationSecs time above the limit, for over-speed
+	DurationSecs float64 `json:"durationSecs,omitempty"`
+	Latitude     float64 `json:"latitude,omitempty"`
+	Longitude    float64 `json:"longitude,omitempty"`
+	TripID       string  `json:"tripId,omitempty"`
+}
+
+// GeofenceState is persisted so fence state survives reboots, keyed by fence id
+type GeofenceState struct {
+	Fences map[string]GeofenceFenceState `json:"fences"`
+}
+
+type GeofenceFenceState struct {
+	Inside bool `json:"inside"`
+	// EnteredAt when the first fix inside was seen, set while pending entry too
+	EnteredAt time.Time `json:"enteredAt,omitempty"`
+	// ExitedAt when the last exit was reported
+	ExitedAt time.Time `json:"exitedAt,omitempty"`
+}
+
+type GeofenceEventType string
+
+const (
+	GeofenceEntry GeofenceEventType = "entry"
+	GeofenceExit  GeofenceEventType = "exit"
+)
+
+type GeofenceEvent struct {
+	CommonData
+	FenceID   string            `json:"fenceId"`
+	Name      string            `json:"name,omitempty"`
+	Type      GeofenceEventType `json:"type"`
+	Latitude  float64           `json:"latitude,omitempty"`
+	Longitude float64           `json:"longitude,omitempty"`
+	// DwellSecs time inside the fence: so far on entry, in total on exit
+	DwellSecs float64 `json:"dwellSecs"`
+	TripID    string  `json:"tripId,omitempty"`
+}
+
+type ChargingEventType string
+
+const (
+	ChargeStart ChargingEventType = "start"
+	ChargeEnd   ChargingEventType = "end"
+)
+
+// ChargingEvent is sent when an EV charging session starts and when it ends. The summary fields are only set on end.
+type ChargingEvent struct {
+	CommonData
+	SessionID string            `json:"sessionId"`
+	Type      ChargingEventType `json:"type"`
+	StartTime int64             `json:"startTime"`
+	EndTime   int64             `json:"endTime,omitempty"`
+	// DurationSecs from the first to the last time charging was seen
+	DurationSecs float64  `json:"durationSecs,omitempty"`
+	StartSOC     *float64 `json:"startSoc,omitempty"`
+	EndSOC       *float64 `json:"endSoc,omitempty"`
+	// EnergyAddedKwh integrated from pack voltage and current, or from the soc delta and the battery capacity
+	EnergyAddedKwh *float64 `json:"energyAddedKwh,omitempty"`
+	MaxPowerKw     float64  `json:"maxPowerKw,omitempty"`
+	// ChargerType ac or dc when the vehicle reports it
+	ChargerType string    `json:"chargerType,omitempty"`
+	Location    *Location `json:"location,omitempty"`
+}
+
+// BatteryHealthEvent daily summary of the 12v battery, sent for the previous UTC day on the first reading of a new one
+type BatteryHealthEvent struct {
+	CommonData
+	// Date YYYY-MM-DD UTC
+	Date       string  `json:"date"`
+	MinVoltage float64 `json:"minVoltage"`
+	MaxVoltage float64 `json:"maxVoltage"`
+	// RestingVoltage after the engine was off for RestingAfterHours
+	RestingVoltage *float64 `json:"restingVoltage,omitempty"`
+	Cranks         int      `json:"cranks"`
+	// CrankingMinVoltage lowest dip of the day, CrankingRecoverySecs the slowest recovery to the voltage before the crank
+	CrankingMinVoltage   *float64 `json:"crankingMinVoltage,omitempty"`
+	CrankingRecoverySecs *float64 `json:"crankingRecoverySecs,omitempty"`
+	// ChargingVoltage median of the alternator voltage while running
+	ChargingVoltage *float64 `json:"chargingVoltage,omitempty"`
+	// HealthScore 0 to 100 from the latest resting, cranking and charging measurements
+	HealthScore *float64 `json:"healthScore,omitempty"`
+}
+
+// BatteryHealthState is persisted so measurements that span sleep and reboots, eg. resting voltage, are not lost
+type BatteryHealthState struct {
+	// EngineOffSince when the engine was last seen stopping, zero while running
+	EngineOffSince time.Time `json:"engineOffSince,omitempty"`
+	// RestingReported the resting voltage of the current off period was taken
+	RestingReported bool `json:"restingReported,omitempty"`
+	// latest measurements, the health score is computed from them
+	RestingVoltage       *float64 `json:"restingVoltage,omitempty"`
+	CrankingMinVoltage   *float64 `json:"crankingMinVoltage,omitempty"`
+	CrankingRecoverySecs *float64 `json:"crankingRecoverySecs,omitempty"`
+	ChargingVoltage      *float64 `json:"chargingVoltage,omitempty"`
+	// Day summary in progress
+	Day *BatteryHealthEvent `json:"day,omitempty"`
+}
+
+// OdometerState is persisted so the strategy that works on this vehicle is tried first, and the gps fallback has an anchor
+type OdometerState struct {
+	// Strategy that last returned a reading, like the vin query name
+	Strategy string `json:"strategy,omitempty"`
+	// AnchorKm last reading from the vehicle, at AnchorTime
+	AnchorKm   float64   `json:"anchorKm,omitempty"`
+	AnchorTime time.Time `json:"anchorTime,omitempty"`
+	// GPSKm driven according to gps since the anchor
+	GPSKm float64 `json:"gpsKm,omitempty"`
+}
+
+// VehicleCapabilities what each ecu answered in the capability scan, sent once per vehicle
+type VehicleCapabilities struct {
+	CommonData
+	ECUs []ECUCapabilities `json:"ecus"`
+}
+
+// ECUCapabilities pids and dids are hex, eg. 0C or F190
+type ECUCapabilities struct {
+	// Header the ecu responds with, eg. 7E8 or 18DAF110
+	Header string `json:"header"`
+	// PIDs mode 01 pids the ecu reports as supported in the bitmaps
+	PIDs []string `json:"pids,omitempty"`
+	// VehicleInfoPIDs mode 09 pids the ecu reports as supported
+	VehicleInfoPIDs []string `json:"vehicleInfoPids,omitempty"`
+	// DIDs uds data identifiers the ecu answered with a positive response
+	DIDs []string `json:"dids,omitempty"`
+}
+
 type VehicleDefinition struct {
 	Make  string `json:"make"`
 	Model string `json:"model"`
@@ -138,3 +393,64 @@ type SignalCanFrameDump struct {
 	PythonFormula string `json:"pythonFormula"`
 	ActualValue   any    `json:"actualValue"`
 }
+
+// CanDumpFileChunk is a piece of a can log file (candump, asc or blf) uploaded over mqtt. Chunks share the DumpID and are
+// reassembled in Chunk order, the file is complete once TotalChunks have been received.
+type CanDumpFileChunk struct {
+	DumpID      string `json:"dumpId"`
+	FileName    string `json:"fileName"`
+	Format      string `json:"format"`
+	Chunk       int    `json:"chunk"`
+	TotalChunks int    `json:"totalChunks"`
+	// Data is base64 encoded in the json
+	Data []byte `json:"data"`
+}
+
+// DBCDiscoveryReport summarizes passive can traffic to help write a dbc for a vehicle we don't have one for
+type DBCDiscoveryReport struct {
+	Timestamp   int64            `json:"timestamp"`
+	WindowSecs  float64          `json:"windowSecs"`
+	TotalFrames int              `json:"totalFrames"`
+	IDs         []DBCCandidateID `json:"ids"`
+	// References qty of samples of each polled signal used for correlation
+	References   map[string]int `json:"references"`
+	TemplateName string         `json:"templateName,omitempty"`
+}
+
+// DBCCandidateID statistics for a single arbitration id
+type DBCCandidateID struct {
+	// ID in hex, eg. 3E9
+	ID          string  `json:"id"`
+	Extended    bool    `json:"extended"`
+	Count       int     `json:"count"`
+	FrequencyHz float64 `json:"frequencyHz"`
+	MinDLC      int     `json:"minDlc"`
+	MaxDLC      int     `json:"maxDlc"`
+	// ByteEntropy shannon entropy in bits (0-8) of each byte position, 0 is a constant byte
+	ByteEntropy []float64 `json:"byteEntropy"`
+	// CounterBytes positions that look like rolling counters, nibble counters are reported as eg. "2.lo"
+	CounterBytes []string `json:"counterBytes,omitempty"`
+	// Checksum is set when a byte looks like a checksum over the rest of the frame
+	Checksum     *DBCChecksumCandidate  `json:"checksum,omitempty"`
+	Correlations []DBCSignalCorrelation `json:"correlations,omitempty"`
+}
+
+type DBCChecksumCandidate struct {
+	Byte int `json:"byte"`
+	// Algorithm sum8 or xor8 over the other bytes
+	Algorithm string  `json:"algorithm"`
+	MatchRate float64 `json:"matchRate"`
+}
+
+// DBCSignalCorrelation a bit range that tracks a known polled pid, with the linear fit to use as dbc scale and offset
+type DBCSignalCorrelation struct {
+	Signal string `json:"signal"`
+	// StartBit and Length in dbc terms, for big endian the start bit is the msb as in the dbc Motorola notation
+	StartBit    int     `json:"startBit"`
+	Length      int     `json:"length"`
+	BigEndian   bool    `json:"bigEndian"`
+	Coefficient float64 `json:"coefficient"`
+	Scale       float64 `json:"scale"`
+	Offset      float64 `json:"offset"`
+	Samples     int     `json:"samples"`
+}
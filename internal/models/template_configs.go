@@ -2,6 +2,7 @@ package models
 
 import (
 	"strings"
+	"time"
 
 	"github.com/DIMO-Network/edge-network/internal/util"
 
@@ -25,21 +26,35 @@ type PIDRequest struct {
 	Protocol             string `json:"protocol"`
 	CanflowControlClear  bool   `json:"can_flow_control_clear"`
 	CanFlowControlIDPair string `json:"can_flow_control_id_pair"`
+	// ECUSelection applies to broadcast requests when more than one ecu answers, ECUSelectionEngine if empty
+	ECUSelection string `json:"ecu_selection,omitempty"`
 }
 
+// ecu selection rules for the responses to a broadcast request
+const (
+	// ECUSelectionEngine the value from the engine ecu, 7E8 or 18DAF110, else from the lowest header that answered
+	ECUSelectionEngine = "engine"
+	// ECUSelectionAverage the average of the values from every ecu
+	ECUSelectionAverage = "average"
+	// ECUSelectionAll a signal per ecu, named with the header as suffix, eg. speed_7E9
+	ECUSelectionAll = "all"
+)
+
 type FormulaType int
 
 const (
 	Unknown FormulaType = iota
 	Dbc
 	Python
+	// Expr evaluated on the device by the expr package, works with both the native and the autopi loggers
+	Expr
 )
 
 func (ft FormulaType) String() string {
-	return [...]string{"unknown", "dbc", "python"}[ft]
+	return [...]string{"unknown", "dbc", "python", "expr"}[ft]
 }
 
-// FormulaType gets the type of formula, currently only know of dbc and python
+// FormulaType gets the type of formula: dbc, python or expr
 func (p *PIDRequest) FormulaType() FormulaType {
 	if strings.HasPrefix(p.Formula, "dbc:") {
 		return Dbc
@@ -47,10 +62,13 @@ func (p *PIDRequest) FormulaType() FormulaType {
 	if strings.HasPrefix(p.Formula, "python:") {
 		return Python
 	}
+	if strings.HasPrefix(p.Formula, "expr:") {
+		return Expr
+	}
 	return Unknown
 }
 
-// FormulaValue gets the formula without the type characters at the beginning, eg. "dbc:" or "python:"
+// FormulaValue gets the formula without the type characters at the beginning, eg. "dbc:", "python:" or "expr:"
 func (p *PIDRequest) FormulaValue() string {
 	if strings.HasPrefix(p.Formula, "dbc:") {
 		return strings.TrimPrefix(p.Formula, "dbc:")
@@ -58,13 +76,50 @@ func (p *PIDRequest) FormulaValue() string {
 	if strings.HasPrefix(p.Formula, "python:") {
 		return strings.TrimPrefix(p.Formula, "python:")
 	}
+	if strings.HasPrefix(p.Formula, "expr:") {
+		return strings.TrimPrefix(p.Formula, "expr:")
+	}
 	return p.Formula
 }
 
+// Unit the unit in a dbc formula, eg. km/h in 31|8@0+ (1,0) [0|255] "km/h". Empty for other formula types.
+func (p *PIDRequest) Unit() string {
+	if p.FormulaType() != Dbc {
+		return ""
+	}
+	parts := strings.Split(p.Formula, `"`)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[1]
+}
+
+// IsBroadcast the request goes to every ecu, 7DF or 18DB33F1, and any of them may answer unless the rx is specified
+func (p *PIDRequest) IsBroadcast() bool {
+	return (p.Header == 0x7df || p.Header == 0x18db33f1) && !p.hasRx()
+}
+
+// MatchesResponseHeader whether a response with the header answers this request. For broadcast requests that is any
+// ecu, 7E8 to 7EF or 18DAF1xx, otherwise only ResponseHeader.
+func (p *PIDRequest) MatchesResponseHeader(header uint32) bool {
+	if p.IsBroadcast() {
+		if p.Header == 0x7df {
+			return header >= 0x7e8 && header <= 0x7ef
+		}
+		return header&0xffffff00 == 0x18daf100
+	}
+	return header == p.ResponseHeader()
+}
+
+// hasRx the rx is specified in the can pair field
+func (p *PIDRequest) hasRx() bool {
+	return len(p.CanFlowControlIDPair) > 2 && strings.Contains(p.CanFlowControlIDPair, ",")
+}
+
 // ResponseHeader checks the poorly name can_flow_control_id_pair second hex value to check if exists, otherwise does a 0x08 operation on Header if not 7df / 18db33f1. Returns 0 if bad data
 func (p *PIDRequest) ResponseHeader() uint32 {
 	// check for specific rx specified in can pair field
-	if len(p.CanFlowControlIDPair) > 2 && strings.Contains(p.CanFlowControlIDPair, ",") {
+	if p.hasRx() {
 		split := strings.Split(p.CanFlowControlIDPair, ",")
 		if len(split) == 2 {
 			if decimal, err := util.HexToDecimal(split[1]); err == nil {
@@ -104,6 +159,233 @@ type TemplateDeviceSettings struct {
 	WakeTriggerVoltageLevel                float64 `json:"wake_trigger_voltage_level"`
 	MinVoltageOBDLoggers                   float64 `json:"min_voltage_obd_loggers"`
 	LocationFrequencySecs                  float64 `json:"location_frequency_secs"`
+	// CANCaptureJobs are raw can bus recordings requested remotely, eg. to reverse engineer a new vehicle
+	CANCaptureJobs []CANCaptureJob `json:"can_capture_jobs,omitempty"`
+	// DBCDiscovery analyzes passive traffic once per start, for vehicles we don't have a dbc for yet
+	DBCDiscovery DBCDiscoverySettings `json:"dbc_discovery"`
+	// DrivingEvents harsh driving detection, sent as soon as detected
+	DrivingEvents DrivingEventSettings `json:"driving_events"`
+	// Geofencing fences evaluated against every gps fix
+	Geofencing GeofenceSettings `json:"geofencing"`
+	// LocationPrivacy is applied to every payload with coordinates before it is signed
+	LocationPrivacy LocationPrivacySettings `json:"location_privacy"`
+	// AdaptiveLocation replaces the fixed LocationFrequencySecs when enabled
+	AdaptiveLocation AdaptiveLocationSettings `json:"adaptive_location"`
+	// DeadReckoning estimates location from vehicle speed and heading while there is no gps fix
+	DeadReckoning DeadReckoningSettings `json:"dead_reckoning"`
+	// EV adds the ev signal catalog to the pids and detects charging sessions
+	EV EVSettings `json:"ev"`
+	// BatteryHealth analyzes the 12v battery: cranking dip, resting and charging voltage
+	BatteryHealth BatteryHealthSettings `json:"battery_health"`
+	// CapabilityScan learns which pids each ecu supports, once per vehicle, and skips template pids none supports
+	CapabilityScan CapabilityScanSettings `json:"capability_scan"`
+	// SignalMapping renames the signals to DIMO VSS paths on the device, converting units, before they are queued
+	SignalMapping SignalMapping `json:"signal_mapping"`
+	// Power how the device acts on the battery voltage trend and engine state
+	Power PowerSettings `json:"power"`
+}
+
+// PowerSettings the engine state and battery levels are always inferred, the autopi sleep timer is only set when enabled
+type PowerSettings struct {
+	SleepTimers bool `json:"sleep_timers"`
+}
+
+// SignalMapping from the names used in the templates, dbc files and by the device to VSS paths, eg. speed to
+// Vehicle.Speed. Empty Signals disables the mapping. Signals without a mapping are sent under UnmappedNamespace.
+type SignalMapping struct {
+	// Version sent with the status payload, so the backend knows which table the names come from
+	Version string             `json:"version"`
+	Signals []SignalMappingRow `json:"signals,omitempty"`
+	// UnmappedNamespace prefix for signals without a mapping, defaults to Unmapped, eg. Unmapped.wpa_state
+	UnmappedNamespace string `json:"unmapped_namespace,omitempty"`
+}
+
+// SignalMappingRow Unit is the VSS unit, eg. km/h. The value is converted from the unit the decoder reported, or FromUnit
+// for signals without one, eg. python formulas.
+type SignalMappingRow struct {
+	Name     string `json:"name"`
+	VSS      string `json:"vss"`
+	Unit     string `json:"unit,omitempty"`
+	FromUnit string `json:"from_unit,omitempty"`
+}
+
+// CapabilityScanSettings DIDs are optionally probed on every ecu found, in hex eg. F190
+type CapabilityScanSettings struct {
+	Enabled bool     `json:"enabled"`
+	DIDs    []string `json:"dids,omitempty"`
+}
+
+// BatteryHealthSettings zero values use the defaults
+type BatteryHealthSettings struct {
+	Enabled bool `json:"enabled"`
+	// RestingAfterHours the engine has to be off this long for the resting voltage, defaults to 4 so the surface charge is gone
+	RestingAfterHours float64 `json:"resting_after_hours"`
+}
+
+// EVSettings zero values use the defaults
+type EVSettings struct {
+	Enabled bool `json:"enabled"`
+	// BatteryCapacityKwh usable capacity, to estimate energy added from the soc when pack voltage and current are not available
+	BatteryCapacityKwh float64 `json:"battery_capacity_kwh"`
+	// ChargeCurrentPositive set if the vehicle reports charging current as positive, by default current into the pack is negative
+	ChargeCurrentPositive bool `json:"charge_current_positive"`
+	// OffQueryIntervalSecs how often ev signals are queried while the vehicle is off, defaults to 60. They are only queried
+	// while the battery voltage is above BatteryCriticalLevelVoltage
+	OffQueryIntervalSecs float64 `json:"off_query_interval_secs"`
+}
+
+// DeadReckoningSettings propagates the last gps fix with vehicle speed and heading during outages, eg. tunnels or parking
+// garages. Zero values use the defaults.
+type DeadReckoningSettings struct {
+	Enabled bool `json:"enabled"`
+	// MaxSecs how long after the last fix to keep estimating, defaults to 300
+	MaxSecs float64 `json:"max_secs"`
+	// SpeedSignals names of the pid or dbc signals in km/h, defaults to speed
+	SpeedSignals []string `json:"speed_signals"`
+	// YawRateSignal name of a yaw rate signal in deg/s, positive turning left. Empty if the vehicle has none
+	YawRateSignal string `json:"yaw_rate_signal"`
+	// SteeringAngleSignal name of a steering wheel angle signal in degrees, positive turning left. Only used without yaw rate
+	SteeringAngleSignal string `json:"steering_angle_signal"`
+	// WheelbaseMeters and SteeringRatio convert the steering angle to a turn rate, default to 2.8 and 15
+	WheelbaseMeters float64 `json:"wheelbase_meters"`
+	SteeringRatio   float64 `json:"steering_ratio"`
+}
+
+// AdaptiveLocationSettings polls gps often while moving and turning, and only a heartbeat while stationary. The track is
+// simplified before it is sent. Zero values use the defaults.
+type AdaptiveLocationSettings struct {
+	Enabled bool `json:"enabled"`
+	// MovingIntervalSecs poll interval while moving, defaults to 5
+	MovingIntervalSecs float64 `json:"moving_interval_secs"`
+	// TurnIntervalSecs poll interval after a heading change, defaults to 1
+	TurnIntervalSecs float64 `json:"turn_interval_secs"`
+	// HeartbeatSecs poll interval while stationary, defaults to 300
+	HeartbeatSecs float64 `json:"heartbeat_secs"`
+	// HeadingChangeDeg change of course that counts as a turn, defaults to 15
+	HeadingChangeDeg float64 `json:"heading_change_deg"`
+	// MovingSpeedKph gps speed above which we are moving, defaults to 5
+	MovingSpeedKph float64 `json:"moving_speed_kph"`
+	// SimplifyToleranceMeters douglas-peucker tolerance, points closer than this to the simplified track are dropped. Defaults to 10
+	SimplifyToleranceMeters float64 `json:"simplify_tolerance_meters"`
+}
+
+type LocationPrivacySettings struct {
+	Zones []PrivacyZone `json:"zones,omitempty"`
+	// Decimals rounds all coordinates, eg. 3 is ~110m. Not set keeps full precision
+	Decimals *int `json:"decimals,omitempty"`
+}
+
+type PrivacyZoneMode string
+
+const (
+	// PrivacyZoneBlank removes the coordinates
+	PrivacyZoneBlank PrivacyZoneMode = "blank"
+	// PrivacyZoneSnap snaps the coordinates to a grid
+	PrivacyZoneSnap PrivacyZoneMode = "snap"
+)
+
+// PrivacyZone eg. home or work
+type PrivacyZone struct {
+	Name         string          `json:"name"`
+	Latitude     float64         `json:"latitude"`
+	Longitude    float64         `json:"longitude"`
+	RadiusMeters float64         `json:"radius_meters"`
+	Mode         PrivacyZoneMode `json:"mode"`
+	// GridMeters cell size for snap, defaults to 1000
+	GridMeters float64 `json:"grid_meters,omitempty"`
+}
+
+type GeofenceSettings struct {
+	Fences []Geofence `json:"fences,omitempty"`
+	// MaxHdop fixes worse than this don't change fence state, defaults to 3
+	MaxHdop float64 `json:"max_hdop"`
+	// MinNsat fixes with fewer satellites don't change fence state, defaults to 4
+	MinNsat int64 `json:"min_nsat"`
+	// MarginMeters how far past the boundary a fix has to be to enter or exit, so gps jitter doesn't flap. Defaults to 15
+	MarginMeters float64 `json:"margin_meters"`
+}
+
+type GeofenceShape string
+
+const (
+	GeofenceCircle  GeofenceShape = "circle"
+	GeofencePolygon GeofenceShape = "polygon"
+)
+
+type Geofence struct {
+	ID    string        `json:"id"`
+	Name  string        `json:"name"`
+	Shape GeofenceShape `json:"shape"`
+	// Latitude, Longitude and RadiusMeters for circles
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	RadiusMeters float64 `json:"radius_meters"`
+	// Points for polygons, in order, at least 3
+	Points []GeoPoint `json:"points,omitempty"`
+	// MinDwellSecs time inside before the entry is reported, 0 reports on the first fix inside
+	MinDwellSecs float64 `json:"min_dwell_secs"`
+	// LocationFrequencySecs overrides the location frequency while inside
+	LocationFrequencySecs float64 `json:"location_frequency_secs,omitempty"`
+	// SuppressLocation does not send location while inside, eg. for a home privacy zone
+	SuppressLocation bool `json:"suppress_location,omitempty"`
+}
+
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// DrivingEventSettings thresholds for harsh driving events. Zero values use the defaults.
+type DrivingEventSettings struct {
+	Enabled bool `json:"enabled"`
+	// HarshBrakeG deceleration in g, defaults to 0.4
+	HarshBrakeG float64 `json:"harsh_brake_g"`
+	// HarshAccelG acceleration in g, defaults to 0.35
+	HarshAccelG float64 `json:"harsh_accel_g"`
+	// HarshTurnG lateral acceleration in g, defaults to 0.45
+	HarshTurnG float64 `json:"harsh_turn_g"`
+	// OverSpeedKph speed limit, 0 disables over-speed events
+	OverSpeedKph float64 `json:"over_speed_kph"`
+	// OverSpeedMinSecs how long above the limit before an event, defaults to 10
+	OverSpeedMinSecs float64 `json:"over_speed_min_secs"`
+	// SpeedSignals names of the pid or dbc signals in km/h to derive acceleration from, eg. wheel speeds. Defaults to speed
+	SpeedSignals []string `json:"speed_signals"`
+	// AccelerometerHz polling rate of the device accelerometer, 0 disables it
+	AccelerometerHz float64 `json:"accelerometer_hz"`
+}
+
+type DBCDiscoverySettings struct {
+	Enabled bool `json:"enabled"`
+	// WindowSecs how long to listen, defaults to 300
+	WindowSecs float64 `json:"window_secs"`
+	// ReferenceSignals polled signal names to correlate against, defaults to speed and rpm
+	ReferenceSignals []string `json:"reference_signals"`
+}
+
+// CANCaptureJob records raw frames from the can bus once the trigger conditions are met, then uploads them over the candump topic
+type CANCaptureJob struct {
+	ID string `json:"id"`
+	// Filters in candump syntax, eg. 7E8 or 7E0:7F0. Empty records everything
+	Filters []string `json:"filters"`
+	// DurationSecs and MaxFrames stop the recording, whichever comes first. At least one is required
+	DurationSecs float64           `json:"duration_secs"`
+	MaxFrames    int               `json:"max_frames"`
+	Trigger      CANCaptureTrigger `json:"trigger"`
+	// ExpiresAt jobs that have not started by this time are dropped
+	ExpiresAt time.Time `json:"expires_at"`
+	// Format candump, asc or blf. Defaults to candump
+	Format string `json:"format"`
+	// ChunkSizeBytes of each mqtt message when uploading, defaults to 64KB
+	ChunkSizeBytes int `json:"chunk_size_bytes"`
+	// MaxBytes stops the recording once the file reaches this size, defaults to and is capped at 50MB
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+// CANCaptureTrigger all set conditions must be met for a capture to start
+type CANCaptureTrigger struct {
+	EngineRunning  bool    `json:"engine_running"`
+	SpeedAboveZero bool    `json:"speed_above_zero"`
+	MinVoltage     float64 `json:"min_voltage"`
 }
 
 // VINLoggerSettings contains the settings we store locally related to the VIN (last VIN obtained and any other related info)
@@ -113,6 +395,9 @@ type VINLoggerSettings struct {
 	VINQueryName            string `json:"vin_query_name"`
 	VINLoggerVersion        int    `json:"vin_logger_version"`
 	VINLoggerFailedAttempts int    `json:"vin_logger_failed_attempts"`
+	// RepairingFromTokenID the vehicle token the device was paired to when a different VIN was read. Vehicle data is not
+	// published until identity-api shows the device paired to another vehicle.
+	RepairingFromTokenID uint64 `json:"repairing_from_token_id,omitempty"`
 }
 
 // UpdateDeviceConfig is the request to update the device config
@@ -33,6 +33,13 @@ func TestPIDRequest_FormulaType(t *testing.T) {
 			},
 			want: Python,
 		},
+		{
+			name: "expr formula type",
+			fields: fields{
+				Formula: `expr:(bytes[0] - 50) * 1.8 + 32`,
+			},
+			want: Expr,
+		},
 		{
 			name: "unknown formula type",
 			fields: fields{
@@ -92,6 +99,13 @@ func TestPIDRequest_FormulaValue(t *testing.T) {
 			},
 			want: `(bytes_to_int(messages[0].data[-1:]) - 50) * 1.8 + 32`,
 		},
+		{
+			name: "expr formula type",
+			fields: fields{
+				Formula: `expr:(bytes[0] - 50) * 1.8 + 32`,
+			},
+			want: `(bytes[0] - 50) * 1.8 + 32`,
+		},
 		{
 			name: "no formula type",
 			fields: fields{
@@ -186,3 +200,47 @@ func TestPIDRequest_ResponseHeader(t *testing.T) {
 		})
 	}
 }
+
+func TestPIDRequest_MatchesResponseHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		request PIDRequest
+		header  uint32
+		want    bool
+	}{
+		{name: "11b broadcast engine", request: PIDRequest{Header: 0x7df}, header: 0x7e8, want: true},
+		{name: "11b broadcast transmission", request: PIDRequest{Header: 0x7df}, header: 0x7e9, want: true},
+		{name: "11b broadcast out of range", request: PIDRequest{Header: 0x7df}, header: 0x7f0, want: false},
+		{name: "29b broadcast any ecu", request: PIDRequest{Header: 0x18db33f1}, header: 0x18daf118, want: true},
+		{name: "29b broadcast other tester", request: PIDRequest{Header: 0x18db33f1}, header: 0x18daf218, want: false},
+		{name: "broadcast with custom resp hdr", request: PIDRequest{Header: 0x7df, CanFlowControlIDPair: "7df,7e9"}, header: 0x7e8, want: false},
+		{name: "physical", request: PIDRequest{Header: 0x7e0}, header: 0x7e9, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.request.MatchesResponseHeader(tt.header); got != tt.want {
+				t.Errorf("MatchesResponseHeader() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPIDRequest_Unit(t *testing.T) {
+	tests := []struct {
+		name    string
+		formula string
+		want    string
+	}{
+		{name: "dbc unit", formula: `dbc:31|8@0+ (1,0) [0|255] "km/h"`, want: "km/h"},
+		{name: "dbc without unit", formula: `dbc:31|8@0+ (1,0) [0|255] ""`, want: ""},
+		{name: "expr formula", formula: `expr:bytes[0] - 40`, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &PIDRequest{Formula: tt.formula}
+			if got := p.Unit(); got != tt.want {
+				t.Errorf("Unit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
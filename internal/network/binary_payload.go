@@ -0,0 +1,171 @@
+package network
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strconv"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/fxamacker/cbor/v2"
+)
+
+// binaryPayloadVersion the schema version of the binary status payload, bump it on any change to the cbor keys
+const binaryPayloadVersion = 1
+
+// cborSelfDescribeTag prefixes the binary payloads once uncompressed, d9 d9 f7
+const cborSelfDescribeTag = 55799
+
+// binaryStatusEvent the status cloud event as a cbor map with integer keys.
+// The signature is over the keccak hash of the json of the data, the same as for the json payload. The data decodes back
+// to the same json, see canonicalValue.
+type binaryStatusEvent struct {
+	Version    int    `cbor:"0,keyasint"`
+	ID         string `cbor:"1,keyasint"`
+	Source     string `cbor:"2,keyasint"`
+	Subject    []byte `cbor:"3,keyasint"`
+	Time       int64  `cbor:"4,keyasint"` // unix millis
+	Type       string `cbor:"5,keyasint"`
+	DataSchema string `cbor:"6,keyasint"`
+	// TokenID is both the vehicleTokenId and the cloud event vehicle token id
+	TokenID   uint64           `cbor:"7,keyasint"`
+	Signature []byte           `cbor:"8,keyasint"`
+	Data      binaryStatusData `cbor:"9,keyasint"`
+}
+
+type binaryStatusData struct {
+	Timestamp    int64        `cbor:"0,keyasint"`
+	ClockQuality string       `cbor:"1,keyasint,omitempty"`
+	Device       binaryDevice `cbor:"2,keyasint"`
+	// Strings the dictionary of signal names and the other signal strings, index 0 is always the empty string
+	Strings              []string       `cbor:"3,keyasint"`
+	Signals              []binarySignal `cbor:"4,keyasint,omitempty"`
+	SignalMappingVersion string         `cbor:"5,keyasint,omitempty"`
+}
+
+type binaryDevice struct {
+	RpiUptimeSecs   int     `cbor:"0,keyasint,omitempty"`
+	BatteryVoltage  float64 `cbor:"1,keyasint,omitempty"`
+	SoftwareVersion string  `cbor:"2,keyasint,omitempty"`
+	HardwareVersion string  `cbor:"3,keyasint,omitempty"`
+	IMEI            string  `cbor:"4,keyasint,omitempty"`
+	UnitID          string  `cbor:"5,keyasint,omitempty"`
+}
+
+// binarySignal the strings are indexes in the dictionary. TimeDelta is the millis since the previous signal, the first
+// one since the data timestamp.
+type binarySignal struct {
+	Name        int   `cbor:"0,keyasint,omitempty"`
+	TimeDelta   int64 `cbor:"1,keyasint,omitempty"`
+	Value       any   `cbor:"2,keyasint"`
+	State       int   `cbor:"3,keyasint,omitempty"`
+	Unit        int   `cbor:"4,keyasint,omitempty"`
+	Source      int   `cbor:"5,keyasint,omitempty"`
+	DecodeError bool  `cbor:"6,keyasint,omitempty"`
+	TripID      int   `cbor:"7,keyasint,omitempty"`
+	ECU         int   `cbor:"8,keyasint,omitempty"`
+}
+
+// binaryEncMode floats that fit are sent as half or single precision, they decode to the same float64
+var binaryEncMode = func() cbor.EncMode {
+	em, err := cbor.EncOptions{ShortestFloat: cbor.ShortestFloat16}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	return em
+}()
+
+// stringDictionary indexes each distinct string once
+type stringDictionary struct {
+	strings []string
+	index   map[string]int
+}
+
+func newStringDictionary() *stringDictionary {
+	return &stringDictionary{strings: []string{""}, index: map[string]int{"": 0}}
+}
+
+func (d *stringDictionary) add(s string) int {
+	if i, ok := d.index[s]; ok {
+		return i
+	}
+	d.strings = append(d.strings, s)
+	d.index[s] = len(d.strings) - 1
+	return len(d.strings) - 1
+}
+
+func newBinaryStatusData(data models.DeviceStatusData) binaryStatusData {
+	b := binaryStatusData{
+		Timestamp:    data.Timestamp,
+		ClockQuality: string(data.ClockQuality),
+		Device: binaryDevice{
+			RpiUptimeSecs:   data.Device.RpiUptimeSecs,
+			BatteryVoltage:  data.Device.BatteryVoltage,
+			SoftwareVersion: data.Device.SoftwareVersion,
+			HardwareVersion: data.Device.HardwareVersion,
+			IMEI:            data.Device.IMEI,
+			UnitID:          data.Device.UnitID,
+		},
+		SignalMappingVersion: data.Vehicle.SignalMappingVersion,
+	}
+	dictionary := newStringDictionary()
+	previous := data.Timestamp
+	for _, s := range data.Vehicle.Signals {
+		b.Signals = append(b.Signals, binarySignal{
+			Name:        dictionary.add(s.Name),
+			TimeDelta:   s.Timestamp - previous,
+			Value:       canonicalValue(s.Value),
+			State:       dictionary.add(s.State),
+			Unit:        dictionary.add(s.Unit),
+			Source:      dictionary.add(string(s.Source)),
+			DecodeError: s.DecodeError,
+			TripID:      dictionary.add(s.TripID),
+			ECU:         dictionary.add(s.ECU),
+		})
+		previous = s.Timestamp
+	}
+	b.Strings = dictionary.strings
+	return b
+}
+
+// canonicalValue a float32 is sent as the float64 of its json, it decodes as a float64 that gets the same json back.
+// Other values decode to the same json as they are.
+func canonicalValue(value any) any {
+	if f, ok := value.(float32); ok {
+		v, err := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+		if err == nil {
+			return v
+		}
+	}
+	return value
+}
+
+func newBinaryStatusEvent(ce models.DeviceDataStatusCloudEvent[any], data models.DeviceStatusData) binaryStatusEvent {
+	return binaryStatusEvent{
+		Version:    binaryPayloadVersion,
+		ID:         ce.ID,
+		Source:     ce.Source,
+		Subject:    common.HexToAddress(ce.Subject).Bytes(),
+		Time:       ce.Time.UnixMilli(),
+		Type:       ce.Type,
+		DataSchema: ce.DataSchema,
+		TokenID:    ce.TokenID,
+		Data:       newBinaryStatusData(data),
+	}
+}
+
+// marshalBinaryStatusEvent the self described cbor, gzip compressed. Unlike the json payloads it is not base64 encoded.
+func marshalBinaryStatusEvent(event binaryStatusEvent) ([]byte, error) {
+	encoded, err := binaryEncMode.Marshal(cbor.Tag{Number: cborSelfDescribeTag, Content: event})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err = gz.Write(encoded)
+	_ = gz.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
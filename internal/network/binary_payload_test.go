@@ -0,0 +1,250 @@
+package network
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	dimoConfig "github.com/DIMO-Network/edge-network/config"
+	"github.com/DIMO-Network/edge-network/internal/clock"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	mock_network "github.com/DIMO-Network/edge-network/internal/network/mocks"
+	"github.com/DIMO-Network/shared"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+	"github.com/jarcoal/httpmock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func testStatusData(signals int) models.DeviceStatusData {
+	ts := int64(1709140771210)
+	data := models.DeviceStatusData{
+		CommonData: models.CommonData{Timestamp: ts, ClockQuality: clock.NTP},
+		Device:     models.Device{RpiUptimeSecs: 200, BatteryVoltage: 13.6, SoftwareVersion: "0.1.0"},
+		Vehicle:    models.Vehicle{SignalMappingVersion: "v1"},
+	}
+	names := []string{"Vehicle.Speed", "Vehicle.Powertrain.CombustionEngine.Speed", "Vehicle.CurrentLocation.Latitude",
+		"Vehicle.Powertrain.Transmission.CurrentGear"}
+	for i := 0; i < signals; i++ {
+		s := models.SignalData{Timestamp: ts - int64(signals-i)*250, Name: names[i%len(names)], Value: float64(i) * 1.5,
+			TripID: "2gDdmiTQhCBgDXqu84VS7mmySxH"}
+		switch i % len(names) {
+		case 0:
+			s.Unit, s.Source = "km/h", models.SignalSourcePID
+		case 1:
+			// eg. decoded by the expr engine
+			s.Value = float32(i) * 812.3
+		case 2:
+			s.Value, s.Source = 42.4971324, models.SignalSourceGPS
+		case 3:
+			s.Value, s.State, s.Source, s.ECU = 3, "D", models.SignalSourceDBC, "7E8"
+		}
+		data.Vehicle.Signals = append(data.Vehicle.Signals, s)
+	}
+	return data
+}
+
+func Test_binaryStatusData_roundTrip(t *testing.T) {
+	data := testStatusData(8)
+	data.Vehicle.Signals[1].DecodeError = true
+
+	b := newBinaryStatusData(data)
+	assert.Len(t, b.Strings, 12, "each string once")
+
+	encoded, err := binaryEncMode.Marshal(b)
+	require.NoError(t, err)
+	var decoded binaryStatusData
+	require.NoError(t, cbor.Unmarshal(encoded, &decoded))
+	roundTrip, err := decoded.decode()
+	require.NoError(t, err)
+	// eg. a float value sent as half precision decodes back to the same float64, the json is what gets signed
+	expected, err := json.Marshal(data)
+	require.NoError(t, err)
+	actual, err := json.Marshal(roundTrip)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+}
+
+func Test_binaryStatusData_badIndex(t *testing.T) {
+	b := newBinaryStatusData(testStatusData(1))
+	b.Signals[0].Name = len(b.Strings)
+	_, err := b.decode()
+	assert.Error(t, err)
+}
+
+func Test_dataSender_SendDeviceStatusData_cbor(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	const autoPiBaseURL = "http://192.168.4.1:9000"
+
+	mockClient := mock_network.NewMockClient(mockCtrl)
+	ds := &dataSender{
+		client:      mockClient,
+		unitID:      uuid.New(),
+		ethAddr:     common.HexToAddress("0x694C9A19e3644A9BFe1008857aeEd155F27b078e"),
+		logger:      zerolog.Nop(),
+		vehicleInfo: models.VehicleInfo{TokenID: 123},
+		mqtt: dimoConfig.Mqtt{Topics: dimoConfig.Topics{Status: "devices/%s/status",
+			Encodings: dimoConfig.TopicEncodings{Status: dimoConfig.EncodingCBOR}}},
+	}
+	var signRequests []string
+	path := fmt.Sprintf("/dongle/%s/execute_raw", ds.unitID.String())
+	httpmock.RegisterResponder(http.MethodPost, autoPiBaseURL+path, func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		signRequests = append(signRequests, string(body))
+		return httpmock.NewStringResponse(200, `{"value": "0xb794f5ea0ba39494ce"}`), nil
+	})
+	var published []byte
+	mockClient.EXPECT().Publish("devices/0x694C9A19e3644A9BFe1008857aeEd155F27b078e/status", uint8(1), false, gomock.Any()).
+		DoAndReturn(func(_ string, _ byte, _ bool, payload any) *mockedToken {
+			published = payload.([]byte)
+			return &mockedToken{}
+		}).Times(2)
+
+	data := testStatusData(40)
+	require.NoError(t, ds.SendDeviceStatusData(data))
+
+	// gzip, the json payloads start with {
+	assert.Equal(t, []byte{0x1f, 0x8b}, published[:2])
+	binary := published
+	ce, signature, err := decodeBinaryStatusEvent(binary)
+	require.NoError(t, err)
+	assert.Equal(t, ds.ethAddr.Hex(), ce.Subject)
+	assert.Equal(t, uint64(123), ce.TokenID)
+	assert.Equal(t, "com.dimo.device.status.v2", ce.Type)
+	assert.WithinDuration(t, time.Now(), ce.Time, time.Minute)
+	assert.Equal(t, common.FromHex("0xb794f5ea0ba39494ce"), signature)
+
+	// the backend verifies the signature over the json of the decoded data, as for the json payloads
+	signed, err := json.Marshal(ce.Data)
+	require.NoError(t, err)
+	require.Len(t, signRequests, 1)
+	assert.Contains(t, signRequests[0], hex.EncodeToString(crypto.Keccak256(signed)))
+
+	// the same data sent as json is signed the same
+	ds.mqtt.Topics.Encodings.Status = dimoConfig.EncodingJSON
+	require.NoError(t, ds.SendDeviceStatusData(data))
+	require.Len(t, signRequests, 2)
+	assert.Equal(t, signRequests[0], signRequests[1])
+
+	// smaller than the gzip compressed and base64 encoded json
+	ceJSON, err := json.Marshal(models.DeviceDataStatusCloudEvent[models.DeviceStatusData]{CloudEvent: ce.CloudEvent, TokenID: ce.TokenID})
+	require.NoError(t, err)
+	compressed, err := compressPayload(ceJSON)
+	require.NoError(t, err)
+	compressedJSON, err := json.Marshal(compressed)
+	require.NoError(t, err)
+	assert.Less(t, len(binary), len(compressedJSON))
+	t.Logf("binary %d bytes, compressed json %d bytes", len(binary), len(compressedJSON))
+}
+
+func Test_decodeBinaryStatusEvent_version(t *testing.T) {
+	event := newBinaryStatusEvent(models.DeviceDataStatusCloudEvent[any]{}, testStatusData(1))
+	event.Version = binaryPayloadVersion + 1
+	payload, err := marshalBinaryStatusEvent(event)
+	require.NoError(t, err)
+	_, _, err = decodeBinaryStatusEvent(payload)
+	assert.ErrorContains(t, err, "unsupported binary payload version")
+}
+
+// decode what the backend does with the data of a binary payload
+func (b binaryStatusData) decode() (models.DeviceStatusData, error) {
+	data := models.DeviceStatusData{
+		CommonData: models.CommonData{Timestamp: b.Timestamp, ClockQuality: clock.Quality(b.ClockQuality)},
+		Device: models.Device{
+			RpiUptimeSecs:   b.Device.RpiUptimeSecs,
+			BatteryVoltage:  b.Device.BatteryVoltage,
+			SoftwareVersion: b.Device.SoftwareVersion,
+			HardwareVersion: b.Device.HardwareVersion,
+			IMEI:            b.Device.IMEI,
+			UnitID:          b.Device.UnitID,
+		},
+		Vehicle: models.Vehicle{SignalMappingVersion: b.SignalMappingVersion},
+	}
+	lookup := func(i int) (string, error) {
+		if i < 0 || i >= len(b.Strings) {
+			return "", fmt.Errorf("string index %d out of the dictionary of %d", i, len(b.Strings))
+		}
+		return b.Strings[i], nil
+	}
+	timestamp := b.Timestamp
+	for _, s := range b.Signals {
+		var strs [6]string
+		for i, index := range []int{s.Name, s.State, s.Unit, s.Source, s.TripID, s.ECU} {
+			str, err := lookup(index)
+			if err != nil {
+				return models.DeviceStatusData{}, err
+			}
+			strs[i] = str
+		}
+		timestamp += s.TimeDelta
+		data.Vehicle.Signals = append(data.Vehicle.Signals, models.SignalData{
+			Timestamp:   timestamp,
+			Name:        strs[0],
+			Value:       s.Value,
+			State:       strs[1],
+			Unit:        strs[2],
+			Source:      models.SignalSource(strs[3]),
+			DecodeError: s.DecodeError,
+			TripID:      strs[4],
+			ECU:         strs[5],
+		})
+	}
+	return data, nil
+}
+
+// decodeBinaryStatusEvent the status cloud event and the signature of a binary payload, what the backend does
+func decodeBinaryStatusEvent(payload []byte) (models.DeviceDataStatusCloudEvent[models.DeviceStatusData], []byte, error) {
+	var ce models.DeviceDataStatusCloudEvent[models.DeviceStatusData]
+	gz, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return ce, nil, err
+	}
+	payload, err = io.ReadAll(gz)
+	if err != nil {
+		return ce, nil, err
+	}
+	if !bytes.HasPrefix(payload, []byte{0xd9, 0xd9, 0xf7}) {
+		return ce, nil, errors.New("payload is not self described cbor")
+	}
+	// the self describe tag is skipped
+	var event binaryStatusEvent
+	if err := cbor.Unmarshal(payload, &event); err != nil {
+		return ce, nil, err
+	}
+	if event.Version != binaryPayloadVersion {
+		return ce, nil, fmt.Errorf("unsupported binary payload version %d", event.Version)
+	}
+	data, err := event.Data.decode()
+	if err != nil {
+		return ce, nil, err
+	}
+	ce = models.DeviceDataStatusCloudEvent[models.DeviceStatusData]{
+		TokenID: event.TokenID,
+		CloudEvent: shared.CloudEvent[models.DeviceStatusData]{
+			ID:             event.ID,
+			Source:         event.Source,
+			SpecVersion:    "1.0",
+			Subject:        common.BytesToAddress(event.Subject).Hex(),
+			Time:           time.UnixMilli(event.Time).UTC(),
+			Type:           event.Type,
+			DataSchema:     event.DataSchema,
+			Data:           data,
+			VehicleTokenID: uint32(event.TokenID),
+		},
+	}
+	return ce, event.Signature, nil
+}
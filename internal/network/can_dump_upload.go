@@ -0,0 +1,59 @@
+package network
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/pkg/errors"
+)
+
+// SendCanDumpFile uploads a can log file through SendCanDumpData in chunks of chunkSize bytes, starting at startChunk so an
+// interrupted upload can be resumed. The file is read one chunk at a time. Returns the index of the next chunk to send, which
+// equals the total when done.
+func SendCanDumpFile(ds DataSender, dumpID, path, format string, chunkSize, startChunk int) (int, error) {
+	if chunkSize <= 0 {
+		return startChunk, errors.New("chunk size must be greater than 0")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return startChunk, errors.Wrapf(err, "failed to open can dump file %s", path)
+	}
+	defer f.Close() //nolint
+	info, err := f.Stat()
+	if err != nil {
+		return startChunk, errors.Wrapf(err, "failed to stat can dump file %s", path)
+	}
+	total := int((info.Size() + int64(chunkSize) - 1) / int64(chunkSize))
+	if startChunk >= total {
+		return total, nil
+	}
+	if _, err := f.Seek(int64(startChunk)*int64(chunkSize), io.SeekStart); err != nil {
+		return startChunk, errors.Wrapf(err, "failed to seek to chunk %d of %s", startChunk, path)
+	}
+	buf := make([]byte, chunkSize)
+	for i := startChunk; i < total; i++ {
+		n, err := io.ReadFull(f, buf)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) { // the last chunk is short
+			return i, errors.Wrapf(err, "failed to read chunk %d of %d from %s", i, total, path)
+		}
+		chunk := models.CanDumpFileChunk{
+			DumpID:      dumpID,
+			FileName:    filepath.Base(path),
+			Format:      format,
+			Chunk:       i,
+			TotalChunks: total,
+			Data:        buf[:n],
+		}
+		payload, err := json.Marshal(chunk)
+		if err != nil {
+			return i, errors.Wrap(err, "failed to marshal can dump chunk")
+		}
+		if err := ds.SendCanDumpData(payload); err != nil {
+			return i, errors.Wrapf(err, "failed to send chunk %d of %d for %s", i, total, path)
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,82 @@
+package network
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	mock_network "github.com/DIMO-Network/edge-network/internal/network/mocks"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSendCanDumpFile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	ds := mock_network.NewMockDataSender(mockCtrl)
+
+	path := filepath.Join(t.TempDir(), "dump.0.log")
+	content := []byte("(1436509052.249713) can0 120#0000100000\n") // 41 bytes
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+
+	var received []models.CanDumpFileChunk
+	ds.EXPECT().SendCanDumpData(gomock.Any()).Times(3).DoAndReturn(func(data json.RawMessage) error {
+		c := models.CanDumpFileChunk{}
+		require.NoError(t, json.Unmarshal(data, &c))
+		received = append(received, c)
+		return nil
+	})
+
+	next, err := SendCanDumpFile(ds, "dump1", path, "candump", 16, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, next)
+
+	var joined []byte
+	for i, c := range received {
+		assert.Equal(t, i, c.Chunk)
+		assert.Equal(t, 3, c.TotalChunks)
+		assert.Equal(t, "dump.0.log", c.FileName)
+		assert.Equal(t, "dump1", c.DumpID)
+		joined = append(joined, c.Data...)
+	}
+	assert.Equal(t, content, joined)
+}
+
+func TestSendCanDumpFile_Resume(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	ds := mock_network.NewMockDataSender(mockCtrl)
+
+	path := filepath.Join(t.TempDir(), "dump.0.asc")
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyzABCD")
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+
+	ds.EXPECT().SendCanDumpData(gomock.Any()).Return(nil)
+	ds.EXPECT().SendCanDumpData(gomock.Any()).Return(errors.New("mqtt offline"))
+	next, err := SendCanDumpFile(ds, "dump2", path, "asc", 10, 0)
+	require.Error(t, err)
+	assert.Equal(t, 1, next)
+
+	// resume from the failed chunk
+	var received []models.CanDumpFileChunk
+	ds.EXPECT().SendCanDumpData(gomock.Any()).Times(3).DoAndReturn(func(data json.RawMessage) error {
+		c := models.CanDumpFileChunk{}
+		require.NoError(t, json.Unmarshal(data, &c))
+		received = append(received, c)
+		return nil
+	})
+	next, err = SendCanDumpFile(ds, "dump2", path, "asc", 10, next)
+	require.NoError(t, err)
+	assert.Equal(t, 4, next)
+	require.Len(t, received, 3)
+	assert.Equal(t, 1, received[0].Chunk)
+	assert.Equal(t, content[10:20], received[0].Data)
+	assert.Equal(t, content[30:], received[2].Data)
+
+	// nothing left
+	next, err = SendCanDumpFile(ds, "dump2", path, "asc", 10, next)
+	require.NoError(t, err)
+	assert.Equal(t, 4, next)
+}
@@ -11,11 +11,13 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/DIMO-Network/edge-network/commands"
 	"github.com/DIMO-Network/edge-network/config"
 	"github.com/DIMO-Network/edge-network/internal/api"
+	"github.com/DIMO-Network/edge-network/internal/clock"
 	"github.com/DIMO-Network/edge-network/internal/models"
 	"github.com/DIMO-Network/shared"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -38,13 +40,34 @@ type DataSender interface {
 	// SendFingerprintData sends VIN and protocol over mqtt to corresponding topic, could add anything else to help identify vehicle
 	SendFingerprintData(data models.FingerprintData) error
 	SendCanDumpData(data json.RawMessage) error
+	// SendDBCDiscoveryReport sends the passive traffic analysis to the candump topic
+	SendDBCDiscoveryReport(report models.DBCDiscoveryReport) error
 	// SendDeviceStatusData sends queried vehicle data over mqtt, per configuration from vehicle-signal-decoding api.
 	// The data can be gzip compressed or not
 	SendDeviceStatusData(data any) error
 	// SendDeviceNetworkData sends queried network data over mqtt to a separate network topic
 	SendDeviceNetworkData(data models.DeviceNetworkData) error
+	// SendTripEvent sends trip start and trip end (with the trip summary) to the status topic
+	SendTripEvent(event models.TripEvent) error
+	// SendDrivingEvent sends a harsh driving event to the status topic as soon as it is detected
+	SendDrivingEvent(event models.DrivingEvent) error
+	// SendGeofenceEvent sends a fence entry or exit to the status topic
+	SendGeofenceEvent(event models.GeofenceEvent) error
+	// SendChargingEvent sends ev charge start and charge end (with the session summary) to the status topic
+	SendChargingEvent(event models.ChargingEvent) error
+	// SendBatteryHealthEvent sends the daily 12v battery summary to the status topic
+	SendBatteryHealthEvent(event models.BatteryHealthEvent) error
+	// SendVehicleChangedEvent sends a vehicle change to the fingerprint topic, it is sent even while vehicle data is paused
+	SendVehicleChangedEvent(event models.VehicleChangedEvent) error
+	// SendCapabilities sends the vehicle capability scan to the fingerprint topic
+	SendCapabilities(capabilities models.VehicleCapabilities) error
+	// PauseVehicleData stops or resumes publishing data attributed to the paired vehicle: status, network, fingerprint,
+	// capabilities and candump. The vehicle changed event and logs are still sent. Paused sends return ErrVehicleDataPaused
+	PauseVehicleData(paused bool)
 	// SetVehicleInfo sets the vehicle info for the data sender
 	SetVehicleInfo(vehicleInfo models.VehicleInfo)
+	// SetLocationPrivacy sets the privacy zones and precision applied to coordinates in status, network, trip and event payloads
+	SetLocationPrivacy(settings models.LocationPrivacySettings)
 }
 
 type dataSender struct {
@@ -54,12 +77,25 @@ type dataSender struct {
 	logger      zerolog.Logger
 	mqtt        config.Mqtt
 	vehicleInfo models.VehicleInfo
+	privacy     locationPrivacy
+	paused      atomic.Bool
 }
 
+// ErrVehicleDataPaused the device was moved to another vehicle and is waiting to be paired to it
+var ErrVehicleDataPaused = errors.New("vehicle data is paused until the device is paired to the new vehicle")
+
 func (ds *dataSender) SetVehicleInfo(vehicleInfo models.VehicleInfo) {
 	ds.vehicleInfo = vehicleInfo
 }
 
+func (ds *dataSender) PauseVehicleData(paused bool) {
+	ds.paused.Store(paused)
+}
+
+func (ds *dataSender) SetLocationPrivacy(settings models.LocationPrivacySettings) {
+	ds.privacy = locationPrivacy{settings: settings}
+}
+
 // NewDataSender instantiates new data sender, does not create a connection to broker
 func NewDataSender(unitID uuid.UUID, addr common.Address, logger zerolog.Logger, vehicleInfo models.VehicleInfo, conf config.Config) DataSender {
 	client := setupMqttConnection(conf, addr, logger)
@@ -140,15 +176,20 @@ func setupMqttConnection(conf config.Config, addr common.Address, logger zerolog
 }
 
 func (ds *dataSender) SendFingerprintData(data models.FingerprintData) error {
+	// the fingerprint topic also carries the vehicle changed event, so it is not paused by topic
+	if ds.paused.Load() {
+		return ErrVehicleDataPaused
+	}
 	if data.Timestamp == 0 {
-		data.Timestamp = time.Now().UTC().UnixMilli()
+		data.Timestamp = clock.Now().UTC().UnixMilli()
 	}
+	data.ClockQuality = clock.CurrentQuality()
 	ce := shared.CloudEvent[models.FingerprintData]{
 		ID:             ksuid.New().String(),
 		Source:         "aftermarket/device/fingerprint",
 		SpecVersion:    "1.0",
 		Subject:        ds.ethAddr.Hex(),
-		Time:           time.Now().UTC(),
+		Time:           clock.Now().UTC(),
 		Type:           "zone.dimo.aftermarket.device.fingerprint",
 		DataSchema:     "dimo.zone.status/v2.0",
 		VehicleTokenID: uint32(ds.vehicleInfo.TokenID),
@@ -171,6 +212,10 @@ func (ds *dataSender) SendFingerprintData(data models.FingerprintData) error {
 }
 
 func (ds *dataSender) SendDeviceStatusData(data any) error {
+	if status, ok := data.(models.DeviceStatusData); ok {
+		status.Vehicle.Signals = ds.privacy.signals(status.Vehicle.Signals)
+		data = status
+	}
 	ce := models.DeviceDataStatusCloudEvent[any]{
 		TokenID: ds.vehicleInfo.TokenID,
 		CloudEvent: shared.CloudEvent[any]{
@@ -178,7 +223,7 @@ func (ds *dataSender) SendDeviceStatusData(data any) error {
 			Source:         "dimo/integration/27qftVRWQYpVDcO5DltO5Ojbjxk",
 			SpecVersion:    "1.0",
 			Subject:        ds.ethAddr.Hex(),
-			Time:           time.Now().UTC(),
+			Time:           clock.Now().UTC(),
 			Type:           "com.dimo.device.status.v2",
 			DataSchema:     "dimo.zone.status/v2.0",
 			Data:           data,
@@ -186,13 +231,22 @@ func (ds *dataSender) SendDeviceStatusData(data any) error {
 		},
 	}
 
+	status := fmt.Sprintf(ds.mqtt.Topics.Status, ce.Subject)
+
+	if statusData, ok := data.(models.DeviceStatusData); ok && ds.mqtt.Topics.Encodings.Status == config.EncodingCBOR {
+		// signed the same as the json payload
+		signed, err := json.Marshal(statusData)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshall status data")
+		}
+		return ds.sendBinaryStatus(status, newBinaryStatusEvent(ce, statusData), signed)
+	}
+
 	payload, err := json.Marshal(ce)
 	if err != nil {
 		return errors.Wrap(err, "failed to marshall cloudevent")
 	}
 
-	status := fmt.Sprintf(ds.mqtt.Topics.Status, ce.Subject)
-
 	err = ds.sendPayload(status, payload, true)
 	if err != nil {
 		return err
@@ -202,7 +256,15 @@ func (ds *dataSender) SendDeviceStatusData(data any) error {
 
 func (ds *dataSender) SendDeviceNetworkData(data models.DeviceNetworkData) error {
 	if data.Timestamp == 0 {
-		data.Timestamp = time.Now().UTC().UnixMilli()
+		data.Timestamp = clock.Now().UTC().UnixMilli()
+	}
+	data.ClockQuality = clock.CurrentQuality()
+	if ds.privacy.enabled() {
+		loc := ds.privacy.location(&data.Location)
+		if loc == nil {
+			loc = &models.Location{Hdop: data.Hdop, Nsat: data.Nsat}
+		}
+		data.Location = *loc
 	}
 
 	ce := shared.CloudEvent[models.DeviceNetworkData]{
@@ -210,7 +272,7 @@ func (ds *dataSender) SendDeviceNetworkData(data models.DeviceNetworkData) error
 		Source:         "aftermarket/device/network",
 		SpecVersion:    "1.0",
 		Subject:        ds.ethAddr.Hex(),
-		Time:           time.Now().UTC(),
+		Time:           clock.Now().UTC(),
 		Type:           "com.dimo.device.network",
 		DataSchema:     "dimo.zone.status/v2.0",
 		Data:           data,
@@ -237,13 +299,13 @@ func (ds *dataSender) SendCanDumpData(data json.RawMessage) error {
 		Source:         "aftermarket/device/canbus/dump",
 		SpecVersion:    "1.0",
 		Subject:        ds.ethAddr.Hex(),
-		Time:           time.Now().UTC(),
+		Time:           clock.Now().UTC(),
 		Type:           "com.dimo.aftermarket.canbus.dump",
 		DataSchema:     "dimo.zone.dump/v1.0",
 		Data:           data,
 		VehicleTokenID: uint32(ds.vehicleInfo.TokenID),
 	}
-	ds.logger.Info().Msgf("Sending can dump data: %+v", ce)
+	ds.logger.Debug().Msgf("Sending can dump data %s: %d bytes", ce.ID, len(data))
 	payload, err := json.Marshal(ce)
 	if err != nil {
 		return errors.Wrap(err, "failed to marshall cloudevent")
@@ -257,10 +319,223 @@ func (ds *dataSender) SendCanDumpData(data json.RawMessage) error {
 	return nil
 }
 
+func (ds *dataSender) SendDBCDiscoveryReport(report models.DBCDiscoveryReport) error {
+	ce := shared.CloudEvent[models.DBCDiscoveryReport]{
+		ID:             ksuid.New().String(),
+		Source:         "aftermarket/device/canbus/discovery",
+		SpecVersion:    "1.0",
+		Subject:        ds.ethAddr.Hex(),
+		Time:           clock.Now().UTC(),
+		Type:           "com.dimo.aftermarket.canbus.discovery",
+		DataSchema:     "dimo.zone.discovery/v1.0",
+		Data:           report,
+		VehicleTokenID: uint32(ds.vehicleInfo.TokenID),
+	}
+	payload, err := json.Marshal(ce)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshall cloudevent")
+	}
+
+	candump := fmt.Sprintf(ds.mqtt.Topics.Candump, ce.Subject)
+	return ds.sendPayload(candump, payload, true)
+}
+
+func (ds *dataSender) SendTripEvent(event models.TripEvent) error {
+	if event.Timestamp == 0 {
+		event.Timestamp = clock.Now().UTC().UnixMilli()
+	}
+	event.ClockQuality = clock.CurrentQuality()
+	event.StartLocation = ds.privacy.location(event.StartLocation)
+	event.EndLocation = ds.privacy.location(event.EndLocation)
+	ce := shared.CloudEvent[models.TripEvent]{
+		ID:             ksuid.New().String(),
+		Source:         "aftermarket/device/trip",
+		SpecVersion:    "1.0",
+		Subject:        ds.ethAddr.Hex(),
+		Time:           clock.Now().UTC(),
+		Type:           "com.dimo.device.trip." + string(event.Type),
+		DataSchema:     "dimo.zone.status/v2.0",
+		Data:           event,
+		VehicleTokenID: uint32(ds.vehicleInfo.TokenID),
+	}
+	payload, err := json.Marshal(ce)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshall cloudevent")
+	}
+
+	status := fmt.Sprintf(ds.mqtt.Topics.Status, ce.Subject)
+	return ds.sendPayload(status, payload, true)
+}
+
+func (ds *dataSender) SendDrivingEvent(event models.DrivingEvent) error {
+	if event.Timestamp == 0 {
+		event.Timestamp = clock.Now().UTC().UnixMilli()
+	}
+	event.ClockQuality = clock.CurrentQuality()
+	if lat, lon, ok := ds.privacy.apply(event.Latitude, event.Longitude); ok {
+		event.Latitude, event.Longitude = lat, lon
+	} else {
+		event.Latitude, event.Longitude = 0, 0
+	}
+	ce := shared.CloudEvent[models.DrivingEvent]{
+		ID:             ksuid.New().String(),
+		Source:         "aftermarket/device/driving",
+		SpecVersion:    "1.0",
+		Subject:        ds.ethAddr.Hex(),
+		Time:           clock.Now().UTC(),
+		Type:           "com.dimo.device.driving." + string(event.Type),
+		DataSchema:     "dimo.zone.status/v2.0",
+		Data:           event,
+		VehicleTokenID: uint32(ds.vehicleInfo.TokenID),
+	}
+	payload, err := json.Marshal(ce)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshall cloudevent")
+	}
+
+	status := fmt.Sprintf(ds.mqtt.Topics.Status, ce.Subject)
+	return ds.sendPayload(status, payload, false)
+}
+
+func (ds *dataSender) SendGeofenceEvent(event models.GeofenceEvent) error {
+	if event.Timestamp == 0 {
+		event.Timestamp = clock.Now().UTC().UnixMilli()
+	}
+	event.ClockQuality = clock.CurrentQuality()
+	if lat, lon, ok := ds.privacy.apply(event.Latitude, event.Longitude); ok {
+		event.Latitude, event.Longitude = lat, lon
+	} else {
+		event.Latitude, event.Longitude = 0, 0
+	}
+	ce := shared.CloudEvent[models.GeofenceEvent]{
+		ID:             ksuid.New().String(),
+		Source:         "aftermarket/device/geofence",
+		SpecVersion:    "1.0",
+		Subject:        ds.ethAddr.Hex(),
+		Time:           clock.Now().UTC(),
+		Type:           "com.dimo.device.geofence." + string(event.Type),
+		DataSchema:     "dimo.zone.status/v2.0",
+		Data:           event,
+		VehicleTokenID: uint32(ds.vehicleInfo.TokenID),
+	}
+	payload, err := json.Marshal(ce)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshall cloudevent")
+	}
+
+	status := fmt.Sprintf(ds.mqtt.Topics.Status, ce.Subject)
+	return ds.sendPayload(status, payload, false)
+}
+
+func (ds *dataSender) SendChargingEvent(event models.ChargingEvent) error {
+	if event.Timestamp == 0 {
+		event.Timestamp = clock.Now().UTC().UnixMilli()
+	}
+	event.ClockQuality = clock.CurrentQuality()
+	event.Location = ds.privacy.location(event.Location)
+	ce := shared.CloudEvent[models.ChargingEvent]{
+		ID:             ksuid.New().String(),
+		Source:         "aftermarket/device/charging",
+		SpecVersion:    "1.0",
+		Subject:        ds.ethAddr.Hex(),
+		Time:           clock.Now().UTC(),
+		Type:           "com.dimo.device.charging." + string(event.Type),
+		DataSchema:     "dimo.zone.status/v2.0",
+		Data:           event,
+		VehicleTokenID: uint32(ds.vehicleInfo.TokenID),
+	}
+	payload, err := json.Marshal(ce)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshall cloudevent")
+	}
+
+	status := fmt.Sprintf(ds.mqtt.Topics.Status, ce.Subject)
+	return ds.sendPayload(status, payload, false)
+}
+
+func (ds *dataSender) SendBatteryHealthEvent(event models.BatteryHealthEvent) error {
+	if event.Timestamp == 0 {
+		event.Timestamp = clock.Now().UTC().UnixMilli()
+	}
+	event.ClockQuality = clock.CurrentQuality()
+	ce := shared.CloudEvent[models.BatteryHealthEvent]{
+		ID:             ksuid.New().String(),
+		Source:         "aftermarket/device/battery",
+		SpecVersion:    "1.0",
+		Subject:        ds.ethAddr.Hex(),
+		Time:           clock.Now().UTC(),
+		Type:           "com.dimo.device.battery.daily",
+		DataSchema:     "dimo.zone.status/v2.0",
+		Data:           event,
+		VehicleTokenID: uint32(ds.vehicleInfo.TokenID),
+	}
+	payload, err := json.Marshal(ce)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshall cloudevent")
+	}
+
+	status := fmt.Sprintf(ds.mqtt.Topics.Status, ce.Subject)
+	return ds.sendPayload(status, payload, false)
+}
+
+func (ds *dataSender) SendVehicleChangedEvent(event models.VehicleChangedEvent) error {
+	if event.Timestamp == 0 {
+		event.Timestamp = clock.Now().UTC().UnixMilli()
+	}
+	event.ClockQuality = clock.CurrentQuality()
+	ce := shared.CloudEvent[models.VehicleChangedEvent]{
+		ID:             ksuid.New().String(),
+		Source:         "aftermarket/device/fingerprint",
+		SpecVersion:    "1.0",
+		Subject:        ds.ethAddr.Hex(),
+		Time:           clock.Now().UTC(),
+		Type:           "com.dimo.device.vehicle.changed",
+		DataSchema:     "dimo.zone.status/v2.0",
+		Data:           event,
+		VehicleTokenID: uint32(event.PreviousTokenID),
+	}
+	payload, err := json.Marshal(ce)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshall cloudevent")
+	}
+
+	fingerprint := fmt.Sprintf(ds.mqtt.Topics.Fingerprint, ce.Subject)
+	return ds.sendPayload(fingerprint, payload, false)
+}
+
+func (ds *dataSender) SendCapabilities(capabilities models.VehicleCapabilities) error {
+	if ds.paused.Load() {
+		return ErrVehicleDataPaused
+	}
+	if capabilities.Timestamp == 0 {
+		capabilities.Timestamp = clock.Now().UTC().UnixMilli()
+	}
+	capabilities.ClockQuality = clock.CurrentQuality()
+	ce := shared.CloudEvent[models.VehicleCapabilities]{
+		ID:             ksuid.New().String(),
+		Source:         "aftermarket/device/capabilities",
+		SpecVersion:    "1.0",
+		Subject:        ds.ethAddr.Hex(),
+		Time:           clock.Now().UTC(),
+		Type:           "com.dimo.device.capabilities",
+		DataSchema:     "dimo.zone.status/v2.0",
+		Data:           capabilities,
+		VehicleTokenID: uint32(ds.vehicleInfo.TokenID),
+	}
+	payload, err := json.Marshal(ce)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshall cloudevent")
+	}
+
+	fingerprint := fmt.Sprintf(ds.mqtt.Topics.Fingerprint, ce.Subject)
+	return ds.sendPayload(fingerprint, payload, false)
+}
+
 func (ds *dataSender) SendLogsData(data models.ErrorsData) error {
 	if data.Timestamp == 0 {
-		data.Timestamp = time.Now().UTC().UnixMilli()
+		data.Timestamp = clock.Now().UTC().UnixMilli()
 	}
+	data.ClockQuality = clock.CurrentQuality()
 
 	// sending the serial number of the device
 	if ds.unitID != uuid.Nil {
@@ -275,7 +550,7 @@ func (ds *dataSender) SendLogsData(data models.ErrorsData) error {
 		Source:      "aftermarket/device/logs",
 		SpecVersion: "1.0",
 		Subject:     ds.ethAddr.Hex(),
-		Time:        time.Now().UTC(),
+		Time:        clock.Now().UTC(),
 		Type:        "zone.dimo.aftermarket.device.logs",
 		DataSchema:  "dimo.zone.status/v2.0",
 		Data:        data,
@@ -300,6 +575,9 @@ func (ds *dataSender) sendPayload(topic string, payload []byte, compress bool) e
 	if !gjson.GetBytes(payload, "subject").Exists() {
 		return fmt.Errorf("payload did not have expected subject cloud event property")
 	}
+	if ds.paused.Load() && ds.isVehicleDataTopic(topic) {
+		return ErrVehicleDataPaused
+	}
 
 	// signature for the payload
 	payload, err := ds.signPayload(payload, ds.unitID)
@@ -319,6 +597,27 @@ func (ds *dataSender) sendPayload(topic string, payload []byte, compress bool) e
 		}
 	}
 
+	return ds.publish(topic, payload)
+}
+
+// sendBinaryStatus signs the json of the data and publishes the binary payload
+func (ds *dataSender) sendBinaryStatus(topic string, event binaryStatusEvent, signed []byte) error {
+	if ds.paused.Load() && ds.isVehicleDataTopic(topic) {
+		return ErrVehicleDataPaused
+	}
+	var err error
+	event.Signature, err = ds.signData(signed, ds.unitID)
+	if err != nil {
+		return err
+	}
+	payload, err := marshalBinaryStatusEvent(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshall binary status payload")
+	}
+	return ds.publish(topic, payload)
+}
+
+func (ds *dataSender) publish(topic string, payload []byte) error {
 	// Publish the MQTT message
 	token := ds.client.Publish(topic, 1, false, payload)
 	// we should not wait for the message to be ack by broker, as this is blocking call
@@ -328,7 +627,7 @@ func (ds *dataSender) sendPayload(topic string, payload []byte, compress bool) e
 
 	// Check if the message was successfully published
 	if token.Error() != nil {
-		return errors.Wrap(err, "Failed to publish MQTT message")
+		return errors.Wrap(token.Error(), "Failed to publish MQTT message")
 	}
 
 	ds.logger.Debug().Msgf("sending mqtt payload to topic: %s with payload: %s", topic, string(payload))
@@ -336,6 +635,14 @@ func (ds *dataSender) sendPayload(topic string, payload []byte, compress bool) e
 	return nil
 }
 
+// isVehicleDataTopic the status, network and candump topics only carry data attributed to the paired vehicle, eg. can
+// captures and dbc discovery reports
+func (ds *dataSender) isVehicleDataTopic(topic string) bool {
+	subject := ds.ethAddr.Hex()
+	return topic == fmt.Sprintf(ds.mqtt.Topics.Status, subject) || topic == fmt.Sprintf(ds.mqtt.Topics.Network, subject) ||
+		topic == fmt.Sprintf(ds.mqtt.Topics.Candump, subject)
+}
+
 // DeviceStatusData is formatted as json, gzip compressed, then base64 compressed.
 // This is done to reduce the size of the payload sent to the cloud over MQTT.
 func compressPayload(payload []byte) (*models.CompressedPayload, error) {
@@ -360,11 +667,9 @@ func (ds *dataSender) signPayload(payload []byte, unitID uuid.UUID) ([]byte, err
 		return nil, fmt.Errorf("no data json path found to sign")
 	}
 
-	keccak256Hash := crypto.Keccak256Hash([]byte(dataResult.Raw))
-
-	sig, err := commands.SignHash(unitID, keccak256Hash.Bytes())
+	sig, err := ds.signData([]byte(dataResult.Raw), unitID)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to sign the status update")
+		return nil, err
 	}
 	signature := "0x" + hex.EncodeToString(sig)
 	// note the path should match the CloudEventHeaders signature name
@@ -375,6 +680,17 @@ func (ds *dataSender) signPayload(payload []byte, unitID uuid.UUID) ([]byte, err
 	return payload, nil
 }
 
+// signData signs the keccak hash of the json data
+func (ds *dataSender) signData(data []byte, unitID uuid.UUID) ([]byte, error) {
+	keccak256Hash := crypto.Keccak256Hash(data)
+
+	sig, err := commands.SignHash(unitID, keccak256Hash.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign the status update")
+	}
+	return sig, nil
+}
+
 func (ds *dataSender) SendErrorPayload(err error, powerStatus *api.PowerStatusResponse) error {
 	data := models.ErrorsData{}
 	if powerStatus != nil {
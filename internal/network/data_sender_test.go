@@ -176,3 +176,30 @@ func (t *mockedToken) Done() <-chan struct{} {
 func (t *mockedToken) Error() error {
 	return nil
 }
+
+func Test_dataSender_PauseVehicleData(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockClient := mock_network.NewMockClient(mockCtrl)
+	ds := &dataSender{
+		client:  mockClient,
+		unitID:  uuid.New(),
+		ethAddr: common.HexToAddress("0x694C9A19e3644A9BFe1008857aeEd155F27b078e"),
+		logger:  zerolog.Nop(),
+		mqtt: dimoConfig.Mqtt{Topics: dimoConfig.Topics{Status: "devices/%s/status", Network: "devices/%s/network",
+			Fingerprint: "devices/%s/fingerprint", Candump: "devices/%s/protocol/canbus/dump"}},
+	}
+	ds.PauseVehicleData(true)
+	// nothing is published
+	err := ds.SendDeviceStatusData(models.DeviceStatusData{})
+	assert.ErrorIs(t, err, ErrVehicleDataPaused)
+	err = ds.SendDeviceNetworkData(models.DeviceNetworkData{})
+	assert.ErrorIs(t, err, ErrVehicleDataPaused)
+	err = ds.SendFingerprintData(models.FingerprintData{})
+	assert.ErrorIs(t, err, ErrVehicleDataPaused)
+	err = ds.SendCapabilities(models.VehicleCapabilities{})
+	assert.ErrorIs(t, err, ErrVehicleDataPaused)
+	err = ds.SendCanDumpData(json.RawMessage(`{}`))
+	assert.ErrorIs(t, err, ErrVehicleDataPaused)
+	err = ds.SendDBCDiscoveryReport(models.DBCDiscoveryReport{})
+	assert.ErrorIs(t, err, ErrVehicleDataPaused)
+}
@@ -0,0 +1,147 @@
+package network
+
+import (
+	"math"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/util"
+)
+
+const (
+	defaultPrivacyGridMeters = 1000.0
+	metersPerDegreeLat       = util.EarthRadiusKm * 1000 * math.Pi / 180
+)
+
+// locationPrivacy blanks or snaps coordinates inside privacy zones and rounds the rest, before payloads are signed
+type locationPrivacy struct {
+	settings models.LocationPrivacySettings
+}
+
+func (p locationPrivacy) enabled() bool {
+	return len(p.settings.Zones) > 0 || p.settings.Decimals != nil
+}
+
+// apply returns the coordinates to send, ok false if they must not be sent at all. No fix (0,0) is returned as is.
+func (p locationPrivacy) apply(lat, lon float64) (float64, float64, bool) {
+	if lat == 0 && lon == 0 {
+		return lat, lon, true
+	}
+	for _, z := range p.settings.Zones {
+		if util.HaversineKm(z.Latitude, z.Longitude, lat, lon)*1000 > z.RadiusMeters {
+			continue
+		}
+		if z.Mode != models.PrivacyZoneSnap {
+			return 0, 0, false
+		}
+		grid := z.GridMeters
+		if grid <= 0 {
+			grid = defaultPrivacyGridMeters
+		}
+		latStep := grid / metersPerDegreeLat
+		lonStep := grid / (metersPerDegreeLat * math.Cos(lat*math.Pi/180))
+		lat = math.Round(lat/latStep) * latStep
+		lon = math.Round(lon/lonStep) * lonStep
+		break
+	}
+	if d := p.settings.Decimals; d != nil {
+		pow := math.Pow(10, float64(*d))
+		lat = math.Round(lat*pow) / pow
+		lon = math.Round(lon*pow) / pow
+	}
+	return lat, lon, true
+}
+
+// location returns a copy with coordinates applied, nil if they must not be sent
+func (p locationPrivacy) location(loc *models.Location) *models.Location {
+	if loc == nil || !p.enabled() {
+		return loc
+	}
+	lat, lon, ok := p.apply(loc.Latitude, loc.Longitude)
+	if !ok {
+		return nil
+	}
+	l := *loc
+	l.Latitude, l.Longitude = lat, lon
+	return &l
+}
+
+// signals applies to latitude and longitude signals queried at the same time, blanked ones are removed together with the
+// altitude. Returns a new slice, the original is not modified.
+func (p locationPrivacy) signals(signals []models.SignalData) []models.SignalData {
+	if !p.enabled() {
+		return signals
+	}
+	type pair struct{ lat, lon int }
+	pairs := map[int64]*pair{}
+	for i, s := range signals {
+		name := deviceSignalName(s)
+		if name != "latitude" && name != "longitude" {
+			continue
+		}
+		pr, ok := pairs[s.Timestamp]
+		if !ok {
+			pr = &pair{lat: -1, lon: -1}
+			pairs[s.Timestamp] = pr
+		}
+		if name == "latitude" {
+			pr.lat = i
+		} else {
+			pr.lon = i
+		}
+	}
+	out := make([]models.SignalData, len(signals))
+	copy(out, signals)
+	blanked := map[int64]bool{}
+	for ts, pr := range pairs {
+		if pr.lat < 0 || pr.lon < 0 {
+			// can't tell if it is in a zone without the other half
+			if len(p.settings.Zones) > 0 {
+				blanked[ts] = true
+			}
+			continue
+		}
+		lat, latOK := signalCoordinate(out[pr.lat].Value)
+		lon, lonOK := signalCoordinate(out[pr.lon].Value)
+		if !latOK || !lonOK {
+			blanked[ts] = true
+			continue
+		}
+		lat, lon, ok := p.apply(lat, lon)
+		if !ok {
+			blanked[ts] = true
+			continue
+		}
+		out[pr.lat].Value = lat
+		out[pr.lon].Value = lon
+	}
+	if len(blanked) == 0 {
+		return out
+	}
+	kept := out[:0]
+	for _, s := range out {
+		name := deviceSignalName(s)
+		if blanked[s.Timestamp] && (name == "latitude" || name == "longitude" || name == "altitude") {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// deviceSignalName the name before any VSS mapping
+func deviceSignalName(s models.SignalData) string {
+	if s.MappedFrom != "" {
+		return s.MappedFrom
+	}
+	return s.Name
+}
+
+func signalCoordinate(v any) (float64, bool) {
+	switch c := v.(type) {
+	case float64:
+		return c, true
+	case float32:
+		return float64(c), true
+	}
+	return 0, false
+}
@@ -0,0 +1,153 @@
+package network
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	dimoConfig "github.com/DIMO-Network/edge-network/config"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	mock_network "github.com/DIMO-Network/edge-network/internal/network/mocks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/jarcoal/httpmock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"go.uber.org/mock/gomock"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+var testPrivacy = locationPrivacy{settings: models.LocationPrivacySettings{
+	Zones: []models.PrivacyZone{
+		{Name: "home", Latitude: 40.4168, Longitude: -3.7038, RadiusMeters: 300, Mode: models.PrivacyZoneBlank},
+		{Name: "work", Latitude: 40.4530, Longitude: -3.6883, RadiusMeters: 500, Mode: models.PrivacyZoneSnap},
+	},
+	Decimals: intPtr(3),
+}}
+
+func Test_locationPrivacy_apply(t *testing.T) {
+	// inside home is blanked
+	_, _, ok := testPrivacy.apply(40.4170, -3.7040)
+	assert.False(t, ok)
+
+	// inside work snaps to the 1km grid, two nearby points end up in the same cell
+	lat1, lon1, ok := testPrivacy.apply(40.4531, -3.6884)
+	require.True(t, ok)
+	lat2, lon2, _ := testPrivacy.apply(40.4529, -3.6880)
+	assert.Equal(t, lat1, lat2)
+	assert.Equal(t, lon1, lon2)
+
+	// elsewhere only rounded
+	lat, lon, ok := testPrivacy.apply(41.38789, 2.16992)
+	require.True(t, ok)
+	assert.Equal(t, 41.388, lat)
+	assert.Equal(t, 2.17, lon)
+
+	// no fix is left alone
+	lat, lon, ok = testPrivacy.apply(0, 0)
+	assert.True(t, ok)
+	assert.Zero(t, lat)
+	assert.Zero(t, lon)
+
+	// nothing configured keeps full precision
+	lat, _, _ = locationPrivacy{}.apply(41.38789, 2.16992)
+	assert.Equal(t, 41.38789, lat)
+}
+
+func Test_locationPrivacy_signals(t *testing.T) {
+	signals := []models.SignalData{
+		{Timestamp: 1, Name: "latitude", Value: 40.4170},
+		{Timestamp: 1, Name: "longitude", Value: -3.7040},
+		{Timestamp: 1, Name: "altitude", Value: 650.0},
+		{Timestamp: 1, Name: "speed", Value: 0.0},
+		{Timestamp: 2, Name: "latitude", Value: 41.38789},
+		{Timestamp: 2, Name: "longitude", Value: 2.16992},
+		{Timestamp: 2, Name: "altitude", Value: 12.0},
+	}
+	out := testPrivacy.signals(signals)
+	assert.Equal(t, []models.SignalData{
+		{Timestamp: 1, Name: "speed", Value: 0.0},
+		{Timestamp: 2, Name: "latitude", Value: 41.388},
+		{Timestamp: 2, Name: "longitude", Value: 2.17},
+		{Timestamp: 2, Name: "altitude", Value: 12.0},
+	}, out)
+	// the caller's signals are untouched
+	assert.Equal(t, 40.4170, signals[0].Value)
+	assert.Equal(t, 41.38789, signals[4].Value)
+}
+
+func Test_locationPrivacy_signals_mapped(t *testing.T) {
+	// names mapped to vss are matched by the device name
+	signals := []models.SignalData{
+		{Timestamp: 1, Name: "Vehicle.CurrentLocation.Latitude", MappedFrom: "latitude", Value: 40.4170},
+		{Timestamp: 1, Name: "Vehicle.CurrentLocation.Longitude", MappedFrom: "longitude", Value: -3.7040},
+		{Timestamp: 2, Name: "Vehicle.CurrentLocation.Latitude", MappedFrom: "latitude", Value: 41.38789},
+		{Timestamp: 2, Name: "Vehicle.CurrentLocation.Longitude", MappedFrom: "longitude", Value: 2.16992},
+	}
+	out := testPrivacy.signals(signals)
+	assert.Equal(t, []models.SignalData{
+		{Timestamp: 2, Name: "Vehicle.CurrentLocation.Latitude", MappedFrom: "latitude", Value: 41.388},
+		{Timestamp: 2, Name: "Vehicle.CurrentLocation.Longitude", MappedFrom: "longitude", Value: 2.17},
+	}, out)
+}
+
+func Test_dataSender_SendDeviceNetworkDataWithPrivacy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	const autoPiBaseURL = "http://192.168.4.1:9000"
+
+	config, err := dimoConfig.ReadConfigFromPath("../../config-dev.yaml")
+	require.NoError(t, err)
+	mockClient := mock_network.NewMockClient(mockCtrl)
+	ds := &dataSender{
+		client:  mockClient,
+		unitID:  uuid.New(),
+		ethAddr: common.HexToAddress("0x694C9A19e3644A9BFe1008857aeEd155F27b078e"),
+		logger:  zerolog.Nop(),
+		mqtt:    config.Mqtt,
+	}
+	ds.SetLocationPrivacy(testPrivacy.settings)
+
+	httpmock.RegisterResponder(http.MethodPost, autoPiBaseURL+fmt.Sprintf("/dongle/%s/execute_raw", ds.unitID.String()),
+		httpmock.NewStringResponder(200, `{"value": "b794f5ea0ba39494ce"}`))
+
+	var published [][]byte
+	mockClient.EXPECT().Publish(gomock.Any(), uint8(1), false, gomock.Any()).Times(2).
+		DoAndReturn(func(_ string, _ byte, _ bool, payload any) *mockedToken {
+			published = append(published, payload.([]byte))
+			return &mockedToken{}
+		})
+
+	require.NoError(t, ds.SendDeviceNetworkData(models.DeviceNetworkData{Location: models.Location{Latitude: 40.4170, Longitude: -3.7040, Altitude: 650, Hdop: 1, Nsat: 7}}))
+	require.NoError(t, ds.SendDeviceNetworkData(models.DeviceNetworkData{Location: models.Location{Latitude: 41.38789, Longitude: 2.16992, Hdop: 1, Nsat: 7}}))
+
+	data := decodePublished(t, published[0])
+	assert.False(t, data.Get("latitude").Exists())
+	assert.False(t, data.Get("altitude").Exists())
+	assert.Equal(t, int64(7), data.Get("nsat").Int())
+
+	data = decodePublished(t, published[1])
+	assert.Equal(t, 41.388, data.Get("latitude").Float())
+	assert.Equal(t, 2.17, data.Get("longitude").Float())
+}
+
+// decodePublished returns the cloudevent data of a compressed payload
+func decodePublished(t *testing.T, payload []byte) gjson.Result {
+	compressed := models.CompressedPayload{}
+	require.NoError(t, json.Unmarshal(payload, &compressed))
+	decoded, err := base64.StdEncoding.DecodeString(compressed.Payload)
+	require.NoError(t, err)
+	raw, err := decompressGzip(decoded)
+	require.NoError(t, err)
+	return gjson.GetBytes(raw, "data")
+}
@@ -5,6 +5,7 @@
 //
 //	mockgen -source data_sender.go -destination mocks/data_sender_mock.go
 //
+
 // Package mock_network is a generated GoMock package.
 package mock_network
 
@@ -40,6 +41,32 @@ func (m *MockDataSender) EXPECT() *MockDataSenderMockRecorder {
 	return m.recorder
 }
 
+// PauseVehicleData mocks base method.
+func (m *MockDataSender) PauseVehicleData(paused bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "PauseVehicleData", paused)
+}
+
+// PauseVehicleData indicates an expected call of PauseVehicleData.
+func (mr *MockDataSenderMockRecorder) PauseVehicleData(paused any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PauseVehicleData", reflect.TypeOf((*MockDataSender)(nil).PauseVehicleData), paused)
+}
+
+// SendBatteryHealthEvent mocks base method.
+func (m *MockDataSender) SendBatteryHealthEvent(event models.BatteryHealthEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendBatteryHealthEvent", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendBatteryHealthEvent indicates an expected call of SendBatteryHealthEvent.
+func (mr *MockDataSenderMockRecorder) SendBatteryHealthEvent(event any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendBatteryHealthEvent", reflect.TypeOf((*MockDataSender)(nil).SendBatteryHealthEvent), event)
+}
+
 // SendCanDumpData mocks base method.
 func (m *MockDataSender) SendCanDumpData(data json.RawMessage) error {
 	m.ctrl.T.Helper()
@@ -54,6 +81,48 @@ func (mr *MockDataSenderMockRecorder) SendCanDumpData(data any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendCanDumpData", reflect.TypeOf((*MockDataSender)(nil).SendCanDumpData), data)
 }
 
+// SendCapabilities mocks base method.
+func (m *MockDataSender) SendCapabilities(capabilities models.VehicleCapabilities) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendCapabilities", capabilities)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendCapabilities indicates an expected call of SendCapabilities.
+func (mr *MockDataSenderMockRecorder) SendCapabilities(capabilities any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendCapabilities", reflect.TypeOf((*MockDataSender)(nil).SendCapabilities), capabilities)
+}
+
+// SendChargingEvent mocks base method.
+func (m *MockDataSender) SendChargingEvent(event models.ChargingEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendChargingEvent", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendChargingEvent indicates an expected call of SendChargingEvent.
+func (mr *MockDataSenderMockRecorder) SendChargingEvent(event any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendChargingEvent", reflect.TypeOf((*MockDataSender)(nil).SendChargingEvent), event)
+}
+
+// SendDBCDiscoveryReport mocks base method.
+func (m *MockDataSender) SendDBCDiscoveryReport(report models.DBCDiscoveryReport) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendDBCDiscoveryReport", report)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendDBCDiscoveryReport indicates an expected call of SendDBCDiscoveryReport.
+func (mr *MockDataSenderMockRecorder) SendDBCDiscoveryReport(report any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendDBCDiscoveryReport", reflect.TypeOf((*MockDataSender)(nil).SendDBCDiscoveryReport), report)
+}
+
 // SendDeviceNetworkData mocks base method.
 func (m *MockDataSender) SendDeviceNetworkData(data models.DeviceNetworkData) error {
 	m.ctrl.T.Helper()
@@ -82,6 +151,20 @@ func (mr *MockDataSenderMockRecorder) SendDeviceStatusData(data any) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendDeviceStatusData", reflect.TypeOf((*MockDataSender)(nil).SendDeviceStatusData), data)
 }
 
+// SendDrivingEvent mocks base method.
+func (m *MockDataSender) SendDrivingEvent(event models.DrivingEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendDrivingEvent", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendDrivingEvent indicates an expected call of SendDrivingEvent.
+func (mr *MockDataSenderMockRecorder) SendDrivingEvent(event any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendDrivingEvent", reflect.TypeOf((*MockDataSender)(nil).SendDrivingEvent), event)
+}
+
 // SendErrorPayload mocks base method.
 func (m *MockDataSender) SendErrorPayload(err error, powerStatus *api.PowerStatusResponse) error {
 	m.ctrl.T.Helper()
@@ -110,6 +193,20 @@ func (mr *MockDataSenderMockRecorder) SendFingerprintData(data any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendFingerprintData", reflect.TypeOf((*MockDataSender)(nil).SendFingerprintData), data)
 }
 
+// SendGeofenceEvent mocks base method.
+func (m *MockDataSender) SendGeofenceEvent(event models.GeofenceEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendGeofenceEvent", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendGeofenceEvent indicates an expected call of SendGeofenceEvent.
+func (mr *MockDataSenderMockRecorder) SendGeofenceEvent(event any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendGeofenceEvent", reflect.TypeOf((*MockDataSender)(nil).SendGeofenceEvent), event)
+}
+
 // SendLogsData mocks base method.
 func (m *MockDataSender) SendLogsData(data models.ErrorsData) error {
 	m.ctrl.T.Helper()
@@ -124,6 +221,46 @@ func (mr *MockDataSenderMockRecorder) SendLogsData(data any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendLogsData", reflect.TypeOf((*MockDataSender)(nil).SendLogsData), data)
 }
 
+// SendTripEvent mocks base method.
+func (m *MockDataSender) SendTripEvent(event models.TripEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendTripEvent", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendTripEvent indicates an expected call of SendTripEvent.
+func (mr *MockDataSenderMockRecorder) SendTripEvent(event any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendTripEvent", reflect.TypeOf((*MockDataSender)(nil).SendTripEvent), event)
+}
+
+// SendVehicleChangedEvent mocks base method.
+func (m *MockDataSender) SendVehicleChangedEvent(event models.VehicleChangedEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendVehicleChangedEvent", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendVehicleChangedEvent indicates an expected call of SendVehicleChangedEvent.
+func (mr *MockDataSenderMockRecorder) SendVehicleChangedEvent(event any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendVehicleChangedEvent", reflect.TypeOf((*MockDataSender)(nil).SendVehicleChangedEvent), event)
+}
+
+// SetLocationPrivacy mocks base method.
+func (m *MockDataSender) SetLocationPrivacy(settings models.LocationPrivacySettings) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetLocationPrivacy", settings)
+}
+
+// SetLocationPrivacy indicates an expected call of SetLocationPrivacy.
+func (mr *MockDataSenderMockRecorder) SetLocationPrivacy(settings any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetLocationPrivacy", reflect.TypeOf((*MockDataSender)(nil).SetLocationPrivacy), settings)
+}
+
 // SetVehicleInfo mocks base method.
 func (m *MockDataSender) SetVehicleInfo(vehicleInfo models.VehicleInfo) {
 	m.ctrl.T.Helper()
@@ -0,0 +1,274 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/commands"
+	"github.com/DIMO-Network/edge-network/internal/loggers"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/util"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// odometer sources, reported along with the value
+const (
+	// OdometerSourceTemplate a pid or dbc signal named odometer in the vehicle template
+	OdometerSourceTemplate = "template"
+	// OdometerSourceGPS the last reading from the vehicle plus the distance driven according to gps since
+	OdometerSourceGPS = "gps"
+)
+
+const (
+	// odometerRefreshEvery the vehicle is queried at most this often
+	odometerRefreshEvery = time.Minute
+	// odometerProbeEvery when the remembered strategy fails, the others are tried at most this often
+	odometerProbeEvery = 10 * time.Minute
+	// odometerTemplateMaxAge a template reading older than this doesn't count
+	odometerTemplateMaxAge = 5 * time.Minute
+	// odometerPersistKm gps distance is persisted every this many km, so a reboot loses little
+	odometerPersistKm = 1.0
+	// gps fixes further apart than odometerMaxGap, slower than odometerMinSpeed (parked jitter) or faster than
+	// odometerMaxSpeed (jumps) are not integrated, km/h
+	odometerMaxGap   = time.Minute
+	odometerMinSpeed = 3.0
+	odometerMaxSpeed = 250.0
+)
+
+// ErrNoOdometer no strategy worked and there is no reading to anchor the gps distance to
+var ErrNoOdometer = errors.New("no odometer reading")
+
+// odometerStrategy an obd query for the odometer, Makes empty is a standard pid queried on any vehicle
+type odometerStrategy struct {
+	Name    string
+	Makes   []string
+	Request models.PIDRequest
+}
+
+// odometerStrategies in order of preference, after the template signal which costs nothing to read
+var odometerStrategies = []odometerStrategy{
+	{Name: "obd_a6", Request: models.PIDRequest{Name: "odometer", Header: 0x7df, Mode: 0x01, Pid: 0xa6,
+		Formula: `dbc:31|32@0+ (0.1,0) [1|429496729.5] "km"`}},
+	{Name: "ford_dd01", Makes: []string{"Ford", "Lincoln"}, Request: models.PIDRequest{Name: "odometer", Header: 0x7e0, Mode: 0x22,
+		Pid: 0xdd01, Formula: `dbc:39|24@0+ (1,0) [0|2150000] "km"`}},
+}
+
+// OdometerReading km and the source it came from
+type OdometerReading struct {
+	Km     float64
+	Source string
+}
+
+// OdometerReader tries the odometer strategies for the vehicle until one works and remembers it, and integrates gps
+// distance from the last reading when none does. Safe for concurrent use.
+type OdometerReader struct {
+	logger      zerolog.Logger
+	lss         loggers.SettingsStore
+	vehicleMake string
+	query       func(request models.PIDRequest) (float64, error)
+	state       models.OdometerState
+	persistedKm float64
+	lastRefresh time.Time
+	nextProbe   time.Time
+	// latest template odometer signal
+	templateKm   float64
+	templateAt   time.Time
+	lastLocation *models.Location
+	lastFixAt    time.Time
+	mu           sync.Mutex
+}
+
+// NewOdometerReader queries the vehicle through the autopi with unitID
+func NewOdometerReader(logger zerolog.Logger, unitID uuid.UUID, lss loggers.SettingsStore, vehicleInfo *models.VehicleInfo) *OdometerReader {
+	vehicleMake := ""
+	if vehicleInfo != nil {
+		vehicleMake = vehicleInfo.VehicleDefinition.Make
+	}
+	return newOdometerReader(logger, lss, vehicleMake, func(request models.PIDRequest) (float64, error) {
+		resp, _, err := commands.RequestPIDRaw(&logger, unitID, request)
+		if err != nil {
+			return 0, err
+		}
+		if !resp.IsHex {
+			return 0, fmt.Errorf("unexpected response: %v", resp.Value)
+		}
+		for _, hex := range resp.ValueHex {
+			km, _, err := loggers.ExtractAndDecodeWithDBCFormula(hex, util.UintToHexStr(request.Pid), request.FormulaValue())
+			if err == nil {
+				return km, nil
+			}
+		}
+		return 0, fmt.Errorf("could not decode odometer from %v", resp.ValueHex)
+	})
+}
+
+func newOdometerReader(logger zerolog.Logger, lss loggers.SettingsStore, vehicleMake string, query func(request models.PIDRequest) (float64, error)) *OdometerReader {
+	od := &OdometerReader{logger: logger, lss: lss, vehicleMake: vehicleMake, query: query}
+	state, err := lss.ReadOdometerState()
+	if err != nil || state == nil {
+		state = &models.OdometerState{}
+	}
+	od.state = *state
+	od.persistedKm = state.GPSKm
+	if state.Strategy != "" {
+		od.logger.Debug().Msgf("found previous odometer strategy: %s", state.Strategy)
+	}
+	return od
+}
+
+// ObserveSignal feeds signals from the template pids or dbc, an odometer signal is the template strategy
+func (od *OdometerReader) ObserveSignal(name string, ts time.Time, value float64) {
+	if name != "odometer" || value <= 0 {
+		return
+	}
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	od.templateKm, od.templateAt = value, ts
+}
+
+// ObserveLocation integrates the distance driven since the last reading
+func (od *OdometerReader) ObserveLocation(ts time.Time, loc models.Location) {
+	if loc.Estimated || (loc.Latitude == 0 && loc.Longitude == 0) || loc.Hdop > tripMaxHdop {
+		return
+	}
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	if od.lastLocation != nil && !od.state.AnchorTime.IsZero() {
+		km := haversineKm(*od.lastLocation, loc)
+		elapsed := ts.Sub(od.lastFixAt)
+		if elapsed > 0 && elapsed <= odometerMaxGap {
+			if speed := km / elapsed.Hours(); speed >= odometerMinSpeed && speed <= odometerMaxSpeed {
+				od.state.GPSKm += km
+			}
+		}
+		if od.state.GPSKm-od.persistedKm >= odometerPersistKm {
+			od.persist()
+		}
+	}
+	l := loc
+	od.lastLocation, od.lastFixAt = &l, ts
+}
+
+// Refresh reads the odometer from the vehicle, at most once every odometerRefreshEvery. Only call while it is ok to query obd.
+// The vehicle is queried without holding the lock, so Current and ObserveLocation don't wait on it.
+func (od *OdometerReader) Refresh(now time.Time) {
+	od.mu.Lock()
+	if now.Sub(od.lastRefresh) < odometerRefreshEvery {
+		od.mu.Unlock()
+		return
+	}
+	od.lastRefresh = now
+	remembered, probe := od.state.Strategy, !now.Before(od.nextProbe)
+	names := od.strategyNames()
+	od.mu.Unlock()
+
+	if od.tryStrategy(remembered, now) || !probe {
+		return
+	}
+	od.mu.Lock()
+	od.nextProbe = now.Add(odometerProbeEvery)
+	od.mu.Unlock()
+	for _, name := range names {
+		if name != remembered && od.tryStrategy(name, now) {
+			return
+		}
+	}
+}
+
+// Current the last reading plus the gps distance since, ErrNoOdometer if there never was one
+func (od *OdometerReader) Current() (OdometerReading, error) {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	if od.state.AnchorTime.IsZero() {
+		return OdometerReading{}, ErrNoOdometer
+	}
+	reading := OdometerReading{Km: math.Round((od.state.AnchorKm+od.state.GPSKm)*10) / 10, Source: od.state.Strategy}
+	if od.state.GPSKm > 0 {
+		reading.Source = OdometerSourceGPS
+	}
+	return reading, nil
+}
+
+// Reset forgets the strategy, readings and gps distance of the previous vehicle, after the device was moved to another
+// one. Its make is not known until the restart with the new templates, only the standard strategies are tried until then.
+func (od *OdometerReader) Reset() {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	od.vehicleMake = ""
+	od.state = models.OdometerState{}
+	od.persistedKm = 0
+	od.lastRefresh, od.nextProbe = time.Time{}, time.Time{}
+	od.templateKm, od.templateAt = 0, time.Time{}
+	od.lastLocation, od.lastFixAt = nil, time.Time{}
+}
+
+// strategyNames for the make, in order of preference. Must hold the lock.
+func (od *OdometerReader) strategyNames() []string {
+	names := []string{OdometerSourceTemplate}
+	for _, s := range odometerStrategies {
+		if len(s.Makes) == 0 || containsFold(s.Makes, od.vehicleMake) {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// tryStrategy anchors to the reading and remembers the strategy if it worked. Must not hold the lock.
+func (od *OdometerReader) tryStrategy(name string, now time.Time) bool {
+	km, ok := od.read(name, now)
+	if !ok {
+		return false
+	}
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	if name != od.state.Strategy {
+		od.logger.Info().Msgf("odometer strategy %s works on this vehicle: %.1f km", name, km)
+	}
+	changed := name != od.state.Strategy || math.Abs(km-od.state.AnchorKm) >= odometerPersistKm || od.state.GPSKm > 0
+	od.state.Strategy, od.state.AnchorKm, od.state.AnchorTime, od.state.GPSKm = name, km, now, 0
+	if changed {
+		od.persist()
+	}
+	return true
+}
+
+// read the odometer with the strategy, the obd query is done without the lock
+func (od *OdometerReader) read(name string, now time.Time) (float64, bool) {
+	switch name {
+	case "":
+		return 0, false
+	case OdometerSourceTemplate:
+		od.mu.Lock()
+		defer od.mu.Unlock()
+		if od.templateAt.IsZero() || now.Sub(od.templateAt) > odometerTemplateMaxAge {
+			return 0, false
+		}
+		return od.templateKm, true
+	}
+	var request *models.PIDRequest
+	for _, s := range odometerStrategies {
+		if s.Name == name {
+			request = &s.Request
+		}
+	}
+	if request == nil {
+		return 0, false
+	}
+	km, err := od.query(*request)
+	if err != nil || km <= 0 {
+		return 0, false
+	}
+	return km, true
+}
+
+// persist must hold the lock
+func (od *OdometerReader) persist() {
+	od.persistedKm = od.state.GPSKm
+	if err := od.lss.WriteOdometerState(od.state); err != nil {
+		od.logger.Err(err).Msg("failed to persist odometer state")
+	}
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	mock_loggers "github.com/DIMO-Network/edge-network/internal/loggers/mocks"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/util"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+type fakeOdometerQuery struct {
+	km      map[uint32]float64
+	queried []uint32
+}
+
+func (f *fakeOdometerQuery) query(request models.PIDRequest) (float64, error) {
+	f.queried = append(f.queried, request.Pid)
+	if km, ok := f.km[request.Pid]; ok {
+		return km, nil
+	}
+	return 0, fmt.Errorf("no response")
+}
+
+func newTestOdometerReader(t *testing.T, state *models.OdometerState, vehicleMake string, q *fakeOdometerQuery) (*OdometerReader, *models.OdometerState) {
+	ctrl := gomock.NewController(t)
+	lss := mock_loggers.NewMockSettingsStore(ctrl)
+	if state == nil {
+		lss.EXPECT().ReadOdometerState().Return(nil, fmt.Errorf("not found"))
+	} else {
+		lss.EXPECT().ReadOdometerState().Return(state, nil)
+	}
+	saved := &models.OdometerState{}
+	lss.EXPECT().WriteOdometerState(gomock.Any()).AnyTimes().DoAndReturn(func(s models.OdometerState) error {
+		*saved = s
+		return nil
+	})
+	return newOdometerReader(zerolog.Nop(), lss, vehicleMake, q.query), saved
+}
+
+func TestOdometerReader_strategies(t *testing.T) {
+	q := &fakeOdometerQuery{km: map[uint32]float64{0xdd01: 16218}}
+	od, saved := newTestOdometerReader(t, nil, "Ford", q)
+	now := time.Now()
+
+	_, err := od.Current()
+	assert.ErrorIs(t, err, ErrNoOdometer)
+
+	od.Refresh(now)
+	assert.Equal(t, []uint32{0xa6, 0xdd01}, q.queried)
+	reading, err := od.Current()
+	require.NoError(t, err)
+	assert.Equal(t, OdometerReading{Km: 16218, Source: "ford_dd01"}, reading)
+	assert.Equal(t, "ford_dd01", saved.Strategy)
+
+	// rate limited, then the remembered strategy goes first
+	od.Refresh(now.Add(time.Second))
+	assert.Len(t, q.queried, 2)
+	q.queried = nil
+	od.Refresh(now.Add(time.Minute))
+	assert.Equal(t, []uint32{0xdd01}, q.queried)
+
+	// another make doesn't get the ford did
+	q = &fakeOdometerQuery{}
+	od, _ = newTestOdometerReader(t, &models.OdometerState{}, "Toyota", q)
+	od.Refresh(now)
+	assert.Equal(t, []uint32{0xa6}, q.queried)
+}
+
+func TestOdometerReader_refreshDoesNotBlockCurrent(t *testing.T) {
+	od, _ := newTestOdometerReader(t, &models.OdometerState{Strategy: "obd_a6", AnchorKm: 1000, AnchorTime: time.Now()}, "", &fakeOdometerQuery{})
+	querying, answer := make(chan struct{}), make(chan struct{})
+	od.query = func(models.PIDRequest) (float64, error) {
+		close(querying)
+		<-answer
+		return 1002, nil
+	}
+	refreshed := make(chan struct{})
+	go func() {
+		od.Refresh(time.Now())
+		close(refreshed)
+	}()
+	<-querying
+
+	// the status payload and location loop read the odometer while the vehicle is queried
+	reading, err := od.Current()
+	require.NoError(t, err)
+	assert.Equal(t, OdometerReading{Km: 1000, Source: "obd_a6"}, reading)
+	od.ObserveLocation(time.Now(), fix(40, -3))
+
+	close(answer)
+	<-refreshed
+	reading, _ = od.Current()
+	assert.Equal(t, OdometerReading{Km: 1002, Source: "obd_a6"}, reading)
+}
+
+func TestOdometerReader_template(t *testing.T) {
+	q := &fakeOdometerQuery{km: map[uint32]float64{0xa6: 1000}}
+	od, saved := newTestOdometerReader(t, nil, "", q)
+	now := time.Now()
+	od.ObserveSignal("odometer", now, 52000.5)
+	od.Refresh(now)
+	assert.Empty(t, q.queried, "the template signal costs nothing")
+	reading, err := od.Current()
+	require.NoError(t, err)
+	assert.Equal(t, OdometerReading{Km: 52000.5, Source: OdometerSourceTemplate}, reading)
+	assert.Equal(t, OdometerSourceTemplate, saved.Strategy)
+}
+
+func TestOdometerReader_gps(t *testing.T) {
+	q := &fakeOdometerQuery{}
+	anchor := time.Now().Add(-time.Hour)
+	od, saved := newTestOdometerReader(t, &models.OdometerState{Strategy: "obd_a6", AnchorKm: 1000, AnchorTime: anchor}, "", q)
+	start := time.Now()
+
+	// parked jitter is ignored
+	od.ObserveLocation(start, fix(40, -3))
+	od.ObserveLocation(start.Add(10*time.Second), fix(40.00001, -3))
+	reading, _ := od.Current()
+	assert.Equal(t, OdometerReading{Km: 1000, Source: "obd_a6"}, reading)
+
+	// 1.5 km north in a minute, 90 km/h
+	lat, lon := util.Destination(40.00001, -3, 0, 750)
+	od.ObserveLocation(start.Add(40*time.Second), fix(lat, lon))
+	lat, lon = util.Destination(lat, lon, 0, 750)
+	od.ObserveLocation(start.Add(70*time.Second), fix(lat, lon))
+	reading, _ = od.Current()
+	assert.Equal(t, OdometerReading{Km: 1001.5, Source: OdometerSourceGPS}, reading)
+	assert.InDelta(t, 1.5, saved.GPSKm, 0.01, "persisted every km")
+
+	// the vehicle answers again
+	q.km = map[uint32]float64{0xa6: 1001.7}
+	od.Refresh(start.Add(2 * time.Minute))
+	reading, _ = od.Current()
+	assert.Equal(t, OdometerReading{Km: 1001.7, Source: "obd_a6"}, reading)
+	assert.Zero(t, saved.GPSKm)
+}
@@ -0,0 +1,263 @@
+package internal
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/commands"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// EngineState inferred from the 12v battery voltage
+type EngineState string
+
+const (
+	EngineOff      EngineState = "off"
+	EngineCranking EngineState = "cranking"
+	EngineRunning  EngineState = "running"
+)
+
+const (
+	// powerWindow voltage samples kept for the trend
+	powerWindow = 2 * time.Minute
+	// powerSmoothing samples this recent are smoothed with the median, one bad reading doesn't change the state
+	powerSmoothing = 5 * time.Second
+	// crankDrop volts below the recent maximum that is the starter motor pulling on the battery
+	crankDrop = 1.0
+	// crankHold how long after the dip the engine may still be starting
+	crankHold = 15 * time.Second
+	// powerHysteresis volts above a level the battery has to recover to before the level is cleared
+	powerHysteresis = 0.2
+	// defaultRunningVoltage when the template has no MinVoltageOBDLoggers, alternators charge above this. Obd is still
+	// queried at any voltage then, see workerRunner.isOkToQueryOBD
+	defaultRunningVoltage = 13.2
+	// sleepTimerName our timer, so other timers eg. pairing are not touched
+	sleepTimerName = "edge_power"
+	// criticalSleepSecs and cutOutSleepSecs how soon the device goes to sleep when the battery is low
+	criticalSleepSecs = 60
+	cutOutSleepSecs   = 5
+	// sleepTimerCleared sleepTimer value when our timer is not set
+	sleepTimerCleared = 0
+	sleepTimerUnknown = -1
+)
+
+// PowerState of the vehicle 12v battery, consulted before querying obd, gps or starting can captures
+type PowerState struct {
+	Engine EngineState
+	// Voltage recent median
+	Voltage float64
+	// Trend volts per minute over the last couple minutes
+	Trend float64
+	// Critical the battery is below BatteryCriticalLevelVoltage with the engine off, only essentials run
+	Critical bool
+	// CutOut the battery is below SafetyCutOutVoltage, the device is being put to sleep
+	CutOut bool
+}
+
+// OkToQueryOBD the engine is running and the battery is not being protected
+func (s PowerState) OkToQueryOBD() bool {
+	return s.Engine == EngineRunning && !s.CutOut
+}
+
+// LowPower anything optional should be skipped to save the battery
+func (s PowerState) LowPower() bool {
+	return s.Critical || s.CutOut
+}
+
+type voltageSample struct {
+	at      time.Time
+	voltage float64
+}
+
+// PowerManager tracks the battery voltage series to infer the engine state, enforces the critical and safety cut out levels,
+// and drives the autopi sleep timer to match when the template enables it. Safe for concurrent use.
+type PowerManager struct {
+	logger         zerolog.Logger
+	runningVoltage float64
+	criticalLevel  float64
+	cutOutLevel    float64
+	// afterSleepSecs sleep timer while the engine hasn't run since the device woke, fallbackSecs once it has
+	afterSleepSecs int
+	fallbackSecs   int
+	// setSleepTimer nil when the sleep timers are left to the autopi
+	setSleepTimer func(period int) error
+	samples       []voltageSample
+	state         PowerState
+	crankingUntil time.Time
+	engineHasRun  bool
+	sleepTimer    int
+	mu            sync.Mutex
+}
+
+// NewPowerManager for the template settings, sleep timers are set on the device with unitID
+func NewPowerManager(logger zerolog.Logger, unitID uuid.UUID, settings models.TemplateDeviceSettings) *PowerManager {
+	return newPowerManager(logger, settings, func(period int) error {
+		if period == sleepTimerCleared {
+			return commands.ClearSleepTimer(unitID, sleepTimerName)
+		}
+		return commands.SetSleepTimer(unitID, sleepTimerName, period)
+	})
+}
+
+func newPowerManager(logger zerolog.Logger, settings models.TemplateDeviceSettings, setSleepTimer func(period int) error) *PowerManager {
+	running := settings.MinVoltageOBDLoggers
+	if running <= 0 {
+		running = defaultRunningVoltage
+	}
+	if !settings.Power.SleepTimers {
+		setSleepTimer = nil
+	}
+	return &PowerManager{
+		logger:         logger,
+		runningVoltage: running,
+		criticalLevel:  settings.BatteryCriticalLevelVoltage,
+		cutOutLevel:    settings.SafetyCutOutVoltage,
+		afterSleepSecs: int(settings.SleepTimerInactivityAfterSleepInterval),
+		fallbackSecs:   int(settings.SleepTimerInactivityFallbackInterval),
+		setSleepTimer:  setSleepTimer,
+		state:          PowerState{Engine: EngineOff},
+		sleepTimer:     sleepTimerUnknown,
+	}
+}
+
+// State the last inferred power state
+func (pm *PowerManager) State() PowerState {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.state
+}
+
+// Observe feeds a voltage reading and returns the updated state. The sleep timer is updated when the state requires a
+// different one, failures are retried with the next reading.
+func (pm *PowerManager) Observe(at time.Time, voltage float64) PowerState {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if voltage <= 0 {
+		return pm.state
+	}
+
+	recentMax := 0.0
+	kept := pm.samples[:0]
+	for _, s := range pm.samples {
+		if at.Sub(s.at) > powerWindow {
+			continue
+		}
+		kept = append(kept, s)
+		if at.Sub(s.at) <= powerSmoothing {
+			recentMax = math.Max(recentMax, s.voltage)
+		}
+	}
+	pm.samples = append(kept, voltageSample{at: at, voltage: voltage})
+
+	previous := pm.state
+	state := PowerState{Voltage: pm.median(at), Trend: pm.trend()}
+	switch {
+	case state.Voltage >= pm.runningVoltage:
+		state.Engine = EngineRunning
+		pm.engineHasRun = true
+	case previous.Engine == EngineOff && recentMax < pm.runningVoltage && recentMax-voltage >= crankDrop:
+		// a dip from a resting battery, not the alternator stopping
+		state.Engine = EngineCranking
+		pm.crankingUntil = at.Add(crankHold)
+	case previous.Engine == EngineCranking && at.Before(pm.crankingUntil):
+		state.Engine = EngineCranking
+	default:
+		state.Engine = EngineOff
+	}
+	if state.Engine == EngineOff {
+		state.Critical = belowLevel(state.Voltage, pm.criticalLevel, previous.Critical)
+		state.CutOut = belowLevel(state.Voltage, pm.cutOutLevel, previous.CutOut)
+		state.Critical = state.Critical || state.CutOut
+	}
+	pm.state = state
+
+	if state.Engine != previous.Engine || state.Critical != previous.Critical || state.CutOut != previous.CutOut {
+		pm.logger.Info().Msgf("power state: engine %s, %.2fV (%+.2fV/min), critical: %t, cut out: %t", state.Engine,
+			state.Voltage, state.Trend, state.Critical, state.CutOut)
+	}
+	pm.updateSleepTimer()
+	return state
+}
+
+// belowLevel with hysteresis, a level of 0 is not set
+func belowLevel(voltage, level float64, wasBelow bool) bool {
+	if level <= 0 {
+		return false
+	}
+	if wasBelow {
+		return voltage < level+powerHysteresis
+	}
+	return voltage < level
+}
+
+// median of the samples within powerSmoothing of at. Must hold the lock.
+func (pm *PowerManager) median(at time.Time) float64 {
+	var recent []float64
+	for _, s := range pm.samples {
+		if at.Sub(s.at) <= powerSmoothing {
+			recent = append(recent, s.voltage)
+		}
+	}
+	sort.Float64s(recent)
+	n := len(recent)
+	if n%2 == 1 {
+		return recent[n/2]
+	}
+	return (recent[n/2-1] + recent[n/2]) / 2
+}
+
+// trend least squares slope of the samples in volts per minute. Must hold the lock.
+func (pm *PowerManager) trend() float64 {
+	if len(pm.samples) < 2 {
+		return 0
+	}
+	first := pm.samples[0].at
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range pm.samples {
+		x := s.at.Sub(first).Minutes()
+		sumX += x
+		sumY += s.voltage
+		sumXY += x * s.voltage
+		sumXX += x * x
+	}
+	n := float64(len(pm.samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+// updateSleepTimer keeps the device awake while the engine runs, and otherwise sets the sleep timer for the battery level.
+// Must hold the lock.
+func (pm *PowerManager) updateSleepTimer() {
+	if pm.setSleepTimer == nil {
+		return
+	}
+	period := sleepTimerCleared
+	switch {
+	case pm.state.CutOut:
+		period = cutOutSleepSecs
+	case pm.state.Critical:
+		period = criticalSleepSecs
+	case pm.state.Engine == EngineOff && pm.engineHasRun:
+		period = pm.fallbackSecs
+	case pm.state.Engine == EngineOff:
+		period = pm.afterSleepSecs
+	}
+	if period < 0 {
+		period = sleepTimerCleared
+	}
+	if period == pm.sleepTimer {
+		return
+	}
+	if err := pm.setSleepTimer(period); err != nil {
+		pm.logger.Err(err).Msgf("failed to set sleep timer to %ds", period)
+		return
+	}
+	pm.sleepTimer = period
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+var testPowerSettings = models.TemplateDeviceSettings{
+	MinVoltageOBDLoggers:                   13.3,
+	BatteryCriticalLevelVoltage:            12.0,
+	SafetyCutOutVoltage:                    11.6,
+	SleepTimerInactivityAfterSleepInterval: 600,
+	SleepTimerInactivityFallbackInterval:   3600,
+	Power:                                  models.PowerSettings{SleepTimers: true},
+}
+
+func TestPowerManager_engine(t *testing.T) {
+	var timers []int
+	pm := newPowerManager(zerolog.Nop(), testPowerSettings, func(period int) error {
+		timers = append(timers, period)
+		return nil
+	})
+	start := time.Now()
+	at := func(secs int, voltage float64) PowerState {
+		return pm.Observe(start.Add(time.Duration(secs)*time.Second), voltage)
+	}
+
+	state := at(0, 12.6)
+	assert.Equal(t, EngineOff, state.Engine)
+	assert.False(t, state.OkToQueryOBD())
+	// woke up without the engine running yet
+	assert.Equal(t, []int{600}, timers)
+
+	at(2, 12.6)
+	assert.Equal(t, EngineCranking, at(4, 10.2).Engine)
+	assert.Equal(t, EngineCranking, at(6, 12.9).Engine)
+	at(8, 14.1)
+	state = at(10, 14.2)
+	assert.Equal(t, EngineRunning, state.Engine)
+	assert.True(t, state.OkToQueryOBD())
+	assert.Equal(t, []int{600, 0}, timers)
+
+	// a single bad reading doesn't stop querying
+	assert.True(t, at(12, 12.5).OkToQueryOBD())
+
+	// engine stops, the drop from the alternator voltage is not cranking
+	at(20, 12.7)
+	state = at(22, 12.7)
+	assert.Equal(t, EngineOff, state.Engine)
+	assert.Equal(t, EngineOff, at(24, 12.6).Engine)
+	assert.Equal(t, []int{600, 0, 3600}, timers)
+}
+
+func TestPowerManager_levels(t *testing.T) {
+	var timers []int
+	fail := true
+	pm := newPowerManager(zerolog.Nop(), testPowerSettings, func(period int) error {
+		if fail {
+			return errors.New("autopi not reachable")
+		}
+		timers = append(timers, period)
+		return nil
+	})
+	start := time.Now()
+	at := func(secs int, voltage float64) PowerState {
+		return pm.Observe(start.Add(time.Duration(secs)*time.Minute), voltage)
+	}
+
+	state := at(0, 11.9)
+	assert.True(t, state.Critical)
+	assert.False(t, state.CutOut)
+	assert.True(t, state.LowPower())
+	// retried with the next reading
+	fail = false
+	at(1, 11.9)
+	assert.Equal(t, []int{criticalSleepSecs}, timers)
+
+	state = at(2, 11.5)
+	assert.True(t, state.CutOut)
+	assert.Equal(t, []int{criticalSleepSecs, cutOutSleepSecs}, timers)
+
+	// recovers only with some margin
+	assert.True(t, at(3, 11.7).CutOut)
+	state = at(4, 12.1)
+	assert.False(t, state.CutOut)
+	assert.True(t, state.Critical)
+	state = at(5, 12.3)
+	assert.False(t, state.Critical)
+	assert.InDelta(t, 0.3, state.Trend, 0.0001)
+	assert.Equal(t, []int{criticalSleepSecs, cutOutSleepSecs, criticalSleepSecs, 600}, timers)
+}
+
+func TestPowerManager_sleepTimersDisabled(t *testing.T) {
+	settings := testPowerSettings
+	settings.Power.SleepTimers = false
+	pm := newPowerManager(zerolog.Nop(), settings, func(period int) error {
+		t.Fatalf("sleep timer set to %ds while disabled", period)
+		return nil
+	})
+	start := time.Now()
+	assert.Equal(t, EngineOff, pm.Observe(start, 12.6).Engine)
+	assert.True(t, pm.Observe(start.Add(time.Minute), 11.5).CutOut)
+}
@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+)
+
+// defaultUnmappedNamespace signals without a mapping row are sent as Unmapped.<name>
+const defaultUnmappedNamespace = "Unmapped"
+
+// SignalMapper renames signals to VSS paths per the template mapping table and converts their values to the VSS unit.
+// A nil mapper, or an empty table, leaves the signals as they are.
+type SignalMapper struct {
+	version   string
+	rows      map[string]models.SignalMappingRow
+	namespace string
+}
+
+// NewSignalMapper nil if the table has no signals
+func NewSignalMapper(mapping models.SignalMapping) *SignalMapper {
+	if len(mapping.Signals) == 0 {
+		return nil
+	}
+	m := &SignalMapper{version: mapping.Version, rows: make(map[string]models.SignalMappingRow, len(mapping.Signals)),
+		namespace: mapping.UnmappedNamespace}
+	if m.namespace == "" {
+		m.namespace = defaultUnmappedNamespace
+	}
+	for _, row := range mapping.Signals {
+		m.rows[row.Name] = row
+	}
+	return m
+}
+
+// Version of the mapping table, empty for a nil mapper
+func (m *SignalMapper) Version() string {
+	if m == nil {
+		return ""
+	}
+	return m.version
+}
+
+// Map the signal to its VSS path. Signals without a row, or whose unit can't be converted to the VSS one, go to the
+// unmapped namespace with the value untouched.
+func (m *SignalMapper) Map(signal models.SignalData) models.SignalData {
+	if m == nil {
+		return signal
+	}
+	row, ok := m.rows[signal.Name]
+	if !ok {
+		return m.unmapped(signal)
+	}
+	from := signal.Unit
+	if from == "" {
+		from = row.FromUnit
+	}
+	if row.Unit != "" && from != "" {
+		if f, isNumber := signalFloat(signal.Value); isNumber {
+			converted, ok := convertUnit(f, from, row.Unit)
+			if !ok {
+				return m.unmapped(signal)
+			}
+			signal.Value = converted
+		}
+	}
+	signal.MappedFrom = signal.Name
+	signal.Name = row.VSS
+	if row.Unit != "" {
+		signal.Unit = row.Unit
+	}
+	return signal
+}
+
+func (m *SignalMapper) unmapped(signal models.SignalData) models.SignalData {
+	signal.MappedFrom = signal.Name
+	signal.Name = m.namespace + "." + signal.Name
+	return signal
+}
+
+// MapAll maps the signals in place
+func (m *SignalMapper) MapAll(signals []models.SignalData) {
+	if m == nil {
+		return
+	}
+	for i := range signals {
+		signals[i] = m.Map(signals[i])
+	}
+}
+
+// unitAliases the spellings used in dbc files and templates for the VSS units
+var unitAliases = map[string]string{
+	"kph":     "km/h",
+	"kmh":     "km/h",
+	"km/hr":   "km/h",
+	"kpa":     "kPa",
+	"c":       "celsius",
+	"°c":      "celsius",
+	"degc":    "celsius",
+	"deg c":   "celsius",
+	"f":       "fahrenheit",
+	"°f":      "fahrenheit",
+	"degf":    "fahrenheit",
+	"miles":   "mi",
+	"mile":    "mi",
+	"meters":  "m",
+	"v":       "V",
+	"volts":   "V",
+	"a":       "A",
+	"amps":    "A",
+	"kw":      "kW",
+	"kwh":     "kWh",
+	"l":       "l",
+	"liters":  "l",
+	"litres":  "l",
+	"gal":     "gal",
+	"percent": "percent",
+	"%":       "percent",
+	"rpm":     "rpm",
+	"s":       "s",
+	"sec":     "s",
+	"min":     "min",
+	"h":       "h",
+	"hours":   "h",
+	"deg":     "degrees",
+	"°":       "degrees",
+	"nm":      "Nm",
+}
+
+func normalizeUnit(unit string) string {
+	u := strings.TrimSpace(unit)
+	if alias, ok := unitAliases[strings.ToLower(u)]; ok {
+		return alias
+	}
+	return u
+}
+
+// linearConversion value * scale + offset
+type linearConversion struct {
+	scale  float64
+	offset float64
+}
+
+// unitConversions the inverse of each is derived
+var unitConversions = map[[2]string]linearConversion{
+	{"km", "m"}:               {scale: 1000},
+	{"km", "mi"}:              {scale: 0.621371192},
+	{"m", "mi"}:               {scale: 0.000621371192},
+	{"km/h", "mph"}:           {scale: 0.621371192},
+	{"km/h", "m/s"}:           {scale: 1 / 3.6},
+	{"celsius", "fahrenheit"}: {scale: 1.8, offset: 32},
+	{"kPa", "psi"}:            {scale: 0.145037738},
+	{"kPa", "bar"}:            {scale: 0.01},
+	{"l", "gal"}:              {scale: 0.264172052},
+	{"kWh", "Wh"}:             {scale: 1000},
+	{"kW", "W"}:               {scale: 1000},
+	{"h", "min"}:              {scale: 60},
+	{"h", "s"}:                {scale: 3600},
+	{"min", "s"}:              {scale: 60},
+}
+
+// convertUnit false if there is no conversion between the units
+func convertUnit(value float64, from, to string) (float64, bool) {
+	from, to = normalizeUnit(from), normalizeUnit(to)
+	if from == to {
+		return value, true
+	}
+	if c, ok := unitConversions[[2]string{from, to}]; ok {
+		return value*c.scale + c.offset, true
+	}
+	if c, ok := unitConversions[[2]string{to, from}]; ok {
+		return (value - c.offset) / c.scale, true
+	}
+	return value, false
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSignalMapping = models.SignalMapping{
+	Version: "1.2.0",
+	Signals: []models.SignalMappingRow{
+		{Name: "speed", VSS: "Vehicle.Speed", Unit: "km/h"},
+		{Name: "odometer", VSS: "Vehicle.TraveledDistance", Unit: "km"},
+		{Name: "coolantTemp", VSS: "Vehicle.Powertrain.CombustionEngine.ECT", Unit: "celsius", FromUnit: "F"},
+		{Name: "gear", VSS: "Vehicle.Powertrain.Transmission.SelectedGear"},
+		{Name: "latitude", VSS: "Vehicle.CurrentLocation.Latitude"},
+	},
+}
+
+func TestSignalMapper_Map(t *testing.T) {
+	m := NewSignalMapper(testSignalMapping)
+	require.NotNil(t, m)
+	assert.Equal(t, "1.2.0", m.Version())
+
+	tests := []struct {
+		name   string
+		signal models.SignalData
+		want   models.SignalData
+	}{
+		{
+			name:   "same unit",
+			signal: models.SignalData{Name: "speed", Value: 50.0, Unit: "kph"},
+			want:   models.SignalData{Name: "Vehicle.Speed", Value: 50.0, Unit: "km/h", MappedFrom: "speed"},
+		},
+		{
+			name:   "converted from the decoder unit",
+			signal: models.SignalData{Name: "odometer", Value: 1000.0, Unit: "m"},
+			want:   models.SignalData{Name: "Vehicle.TraveledDistance", Value: 1.0, Unit: "km", MappedFrom: "odometer"},
+		},
+		{
+			name:   "converted from the row unit",
+			signal: models.SignalData{Name: "coolantTemp", Value: 212.0},
+			want:   models.SignalData{Name: "Vehicle.Powertrain.CombustionEngine.ECT", Value: 100.0, Unit: "celsius", MappedFrom: "coolantTemp"},
+		},
+		{
+			name:   "text value",
+			signal: models.SignalData{Name: "gear", Value: 3.0, State: "Drive"},
+			want:   models.SignalData{Name: "Vehicle.Powertrain.Transmission.SelectedGear", Value: 3.0, State: "Drive", MappedFrom: "gear"},
+		},
+		{
+			name:   "no conversion between the units",
+			signal: models.SignalData{Name: "speed", Value: 50.0, Unit: "rpm"},
+			want:   models.SignalData{Name: "Unmapped.speed", Value: 50.0, Unit: "rpm", MappedFrom: "speed"},
+		},
+		{
+			name:   "no mapping",
+			signal: models.SignalData{Name: "wpa_state", Value: "COMPLETED"},
+			want:   models.SignalData{Name: "Unmapped.wpa_state", Value: "COMPLETED", MappedFrom: "wpa_state"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := m.Map(tt.signal)
+			if f, ok := tt.want.Value.(float64); ok {
+				assert.InDelta(t, f, got.Value, 0.0001)
+				got.Value = tt.want.Value
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSignalMapper_disabled(t *testing.T) {
+	m := NewSignalMapper(models.SignalMapping{Version: "1.0.0"})
+	assert.Nil(t, m)
+	signal := models.SignalData{Name: "speed", Value: 50.0}
+	assert.Equal(t, signal, m.Map(signal))
+	assert.Equal(t, "", m.Version())
+}
+
+func TestSignalsQueue_Enqueue_mapped(t *testing.T) {
+	sq := &SignalsQueue{lastTimeChecked: make(map[string]time.Time), failureCount: make(map[string]int),
+		signals: make(map[string][]models.SignalData), mapper: NewSignalMapper(testSignalMapping)}
+	sq.Enqueue(models.SignalData{Timestamp: time.Now().UnixMilli(), Name: "speed", Value: 50.0, Unit: "km/h"})
+
+	// lookups keep the device names
+	speed, ok := sq.LatestFloat("speed", time.Minute)
+	assert.True(t, ok)
+	assert.Equal(t, 50.0, speed)
+	_, ok = sq.lastEnqueuedTime("speed")
+	assert.True(t, ok)
+
+	signals := sq.Dequeue()
+	require.Len(t, signals, 1)
+	assert.Equal(t, "Vehicle.Speed", signals[0].Name)
+}
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"github.com/DIMO-Network/edge-network/internal/models"
+)
+
+type signalMetadataKey struct {
+	unit   string
+	source models.SignalSource
+}
+
+// compactSignalMetadata keeps the status payload small by clearing the unit and source of a signal when an earlier
+// signal of the same name in the payload already carries the same ones. Every payload is self-contained, so nothing is
+// lost if one is not delivered.
+func compactSignalMetadata(signals []models.SignalData) {
+	sent := map[string]signalMetadataKey{}
+	for i := range signals {
+		key := signalMetadataKey{unit: signals[i].Unit, source: signals[i].Source}
+		if key == (signalMetadataKey{}) {
+			continue
+		}
+		if prev, ok := sent[signals[i].Name]; ok && prev == key {
+			signals[i].Unit = ""
+			signals[i].Source = ""
+			continue
+		}
+		sent[signals[i].Name] = key
+	}
+}
@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_compactSignalMetadata(t *testing.T) {
+	signals := []models.SignalData{
+		{Name: "speed", Value: 50.0, Unit: "km/h", Source: models.SignalSourcePID},
+		{Name: "speed", Value: 51.0, Unit: "km/h", Source: models.SignalSourcePID},
+		{Name: "hdop", Value: 0.9, Source: models.SignalSourceGPS},
+		{Name: "hdop", Value: 1.1, Unit: "m", Source: models.SignalSourceGPS},
+		{Name: "tripDistance", Value: 1.0},
+	}
+	compactSignalMetadata(signals)
+	assert.Equal(t, []models.SignalData{
+		{Name: "speed", Value: 50.0, Unit: "km/h", Source: models.SignalSourcePID},
+		{Name: "speed", Value: 51.0},
+		{Name: "hdop", Value: 0.9, Source: models.SignalSourceGPS},
+		{Name: "hdop", Value: 1.1, Unit: "m", Source: models.SignalSourceGPS},
+		{Name: "tripDistance", Value: 1.0},
+	}, signals, "only the first of a name carries it, unless it changes")
+
+	compactSignalMetadata(signals)
+	assert.Equal(t, "km/h", signals[0].Unit, "every payload carries it")
+	assert.Equal(t, models.SignalSourcePID, signals[0].Source, "every payload carries it")
+}
@@ -0,0 +1,232 @@
+package internal
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/util"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	// tripEndAfter engine has to be off this long before a trip ends, so short stops eg. start-stop systems don't split trips
+	tripEndAfter = 60 * time.Second
+	// tripMovingSpeed km/h derived from gps above which we consider the vehicle moving, when we have nothing else
+	tripMovingSpeed = 10.0
+	// tripMaxGap between observations that are still integrated into idle time and distance
+	tripMaxGap = 30 * time.Second
+	// tripMaxHdop ignore gps fixes worse than this for distance
+	tripMaxHdop        = 5.0
+	tripLocationMaxAge = time.Minute
+)
+
+// TripObservation is the vehicle state at a point in time, nil values are not known
+type TripObservation struct {
+	Time      time.Time
+	Voltage   float64
+	RPM       *float64
+	Speed     *float64
+	FuelLevel *float64
+	SOC       *float64
+}
+
+// TripDetector infers ignition from rpm, speed and the alternator voltage rise, with gps movement as a fallback, and
+// builds trip summaries. Safe for concurrent use, observations come from the obd loop and locations from the gps query.
+type TripDetector struct {
+	// minVoltage at or above this the engine is considered running, same as the threshold used to query obd
+	minVoltage float64
+	current    *tripState
+	// last finished trip, so signals dequeued after the trip ended still get its id
+	lastID         string
+	lastStart      time.Time
+	lastEnd        time.Time
+	lastLocation   *models.Location
+	lastLocationAt time.Time
+	// gpsMoving is set when the last two fixes show movement
+	gpsMoving bool
+	mu        sync.Mutex
+}
+
+type tripState struct {
+	id            string
+	start         time.Time
+	lastOn        time.Time
+	lastObs       time.Time
+	startLocation *models.Location
+	endLocation   *models.Location
+	gpsKm         float64
+	speedKm       float64
+	maxSpeed      float64
+	idle          time.Duration
+	startFuel     *float64
+	endFuel       *float64
+	startSOC      *float64
+	endSOC        *float64
+}
+
+func NewTripDetector(minVoltage float64) *TripDetector {
+	return &TripDetector{minVoltage: minVoltage}
+}
+
+// Observe feeds the current vehicle state. Returns the trip start or end event if this observation starts or ends a trip.
+func (td *TripDetector) Observe(obs TripObservation) *models.TripEvent {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+
+	on := td.engineOn(obs)
+	trip := td.current
+	if trip == nil {
+		if !on {
+			return nil
+		}
+		trip = &tripState{id: ksuid.New().String(), start: obs.Time, lastOn: obs.Time, lastObs: obs.Time,
+			startFuel: obs.FuelLevel, startSOC: obs.SOC}
+		if td.lastLocation != nil && obs.Time.Sub(td.lastLocationAt) <= tripLocationMaxAge {
+			loc := *td.lastLocation
+			trip.startLocation = &loc
+		}
+		td.current = trip
+		trip.observe(obs, on)
+		return &models.TripEvent{
+			CommonData:    models.CommonData{Timestamp: obs.Time.UTC().UnixMilli()},
+			TripID:        trip.id,
+			Type:          models.TripStart,
+			StartTime:     trip.start.UTC().UnixMilli(),
+			StartLocation: trip.startLocation,
+		}
+	}
+
+	trip.observe(obs, on)
+	if on || obs.Time.Sub(trip.lastOn) < tripEndAfter {
+		return nil
+	}
+	td.current = nil
+	td.lastID, td.lastStart, td.lastEnd = trip.id, trip.start, trip.lastOn
+	return trip.summary(obs.Time)
+}
+
+// ObserveLocation feeds a gps fix, used for distance, start and end location and as a movement fallback
+func (td *TripDetector) ObserveLocation(ts time.Time, loc models.Location) {
+	if loc.Latitude == 0 && loc.Longitude == 0 {
+		return
+	}
+	td.mu.Lock()
+	defer td.mu.Unlock()
+
+	usable := loc.Hdop == 0 || loc.Hdop <= tripMaxHdop
+	if td.lastLocation != nil && usable {
+		km := haversineKm(*td.lastLocation, loc)
+		elapsed := ts.Sub(td.lastLocationAt)
+		td.gpsMoving = elapsed > 0 && elapsed <= tripLocationMaxAge && km/elapsed.Hours() >= tripMovingSpeed
+		if td.current != nil && elapsed <= tripLocationMaxAge {
+			td.current.gpsKm += km
+		}
+	}
+	if !usable {
+		return
+	}
+	l := loc
+	td.lastLocation = &l
+	td.lastLocationAt = ts
+	if td.current != nil {
+		if td.current.startLocation == nil {
+			td.current.startLocation = &l
+		}
+		td.current.endLocation = &l
+	}
+}
+
+// TripIDAt returns the id of the trip in progress at ts, or of the last trip if ts falls within it
+func (td *TripDetector) TripIDAt(ts time.Time) string {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	if td.current != nil && !ts.Before(td.current.start) {
+		return td.current.id
+	}
+	if td.lastID != "" && !ts.Before(td.lastStart) && !ts.After(td.lastEnd) {
+		return td.lastID
+	}
+	return ""
+}
+
+// engineOn in order of preference: rpm, moving by speed, alternator voltage, moving by gps. Must hold the lock.
+func (td *TripDetector) engineOn(obs TripObservation) bool {
+	if obs.RPM != nil {
+		return *obs.RPM > 0
+	}
+	if obs.Speed != nil && *obs.Speed > 0 {
+		return true
+	}
+	if td.minVoltage > 0 && obs.Voltage >= td.minVoltage {
+		return true
+	}
+	return td.gpsMoving && obs.Time.Sub(td.lastLocationAt) <= tripLocationMaxAge
+}
+
+func (t *tripState) observe(obs TripObservation, on bool) {
+	elapsed := obs.Time.Sub(t.lastObs)
+	if elapsed > tripMaxGap {
+		elapsed = 0 // don't integrate over a long gap, eg. device was busy or rebooted
+	}
+	t.lastObs = obs.Time
+	if !on {
+		return
+	}
+	t.lastOn = obs.Time
+	if obs.Speed != nil {
+		t.maxSpeed = math.Max(t.maxSpeed, *obs.Speed)
+		t.speedKm += *obs.Speed * elapsed.Hours()
+		if *obs.Speed == 0 {
+			t.idle += elapsed
+		}
+	}
+	if obs.FuelLevel != nil {
+		t.endFuel = obs.FuelLevel
+		if t.startFuel == nil {
+			t.startFuel = obs.FuelLevel
+		}
+	}
+	if obs.SOC != nil {
+		t.endSOC = obs.SOC
+		if t.startSOC == nil {
+			t.startSOC = obs.SOC
+		}
+	}
+}
+
+func (t *tripState) summary(now time.Time) *models.TripEvent {
+	// prefer gps distance, speed integration misses distance between sparse samples
+	distance := t.gpsKm
+	if distance == 0 {
+		distance = t.speedKm
+	}
+	event := &models.TripEvent{
+		CommonData:    models.CommonData{Timestamp: now.UTC().UnixMilli()},
+		TripID:        t.id,
+		Type:          models.TripEnd,
+		StartTime:     t.start.UTC().UnixMilli(),
+		EndTime:       t.lastOn.UTC().UnixMilli(),
+		DurationSecs:  t.lastOn.Sub(t.start).Seconds(),
+		DistanceKm:    math.Round(distance*1000) / 1000,
+		StartLocation: t.startLocation,
+		EndLocation:   t.endLocation,
+		MaxSpeed:      t.maxSpeed,
+		IdleSecs:      t.idle.Seconds(),
+	}
+	if t.startFuel != nil && t.endFuel != nil {
+		used := *t.startFuel - *t.endFuel
+		event.FuelUsedPercent = &used
+	}
+	if t.startSOC != nil && t.endSOC != nil {
+		used := *t.startSOC - *t.endSOC
+		event.EnergyUsedPercent = &used
+	}
+	return event
+}
+
+// haversineKm great circle distance between two fixes
+func haversineKm(a, b models.Location) float64 {
+	return util.HaversineKm(a.Latitude, a.Longitude, b.Latitude, b.Longitude)
+}
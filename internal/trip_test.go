@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr(v float64) *float64 {
+	return &v
+}
+
+func TestTripDetector_StartAndEnd(t *testing.T) {
+	td := NewTripDetector(13.3)
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	assert.Nil(t, td.Observe(TripObservation{Time: start.Add(-10 * time.Second), Voltage: 12.4}))
+
+	td.ObserveLocation(start, models.Location{Latitude: 40.0, Longitude: -3.0, Hdop: 1})
+	ev := td.Observe(TripObservation{Time: start, Voltage: 14.1, RPM: ptr(800), Speed: ptr(0), FuelLevel: ptr(60)})
+	require.NotNil(t, ev)
+	assert.Equal(t, models.TripStart, ev.Type)
+	assert.Equal(t, start.UnixMilli(), ev.StartTime)
+	require.NotNil(t, ev.StartLocation)
+	assert.Equal(t, 40.0, ev.StartLocation.Latitude)
+	tripID := ev.TripID
+	assert.NotEmpty(t, tripID)
+
+	// idle 10s then drive 2 minutes at 60km/h
+	assert.Nil(t, td.Observe(TripObservation{Time: start.Add(10 * time.Second), Voltage: 14.1, RPM: ptr(800), Speed: ptr(0)}))
+	for i := 1; i <= 12; i++ {
+		ts := start.Add(10*time.Second + time.Duration(i)*10*time.Second)
+		assert.Nil(t, td.Observe(TripObservation{Time: ts, Voltage: 14.1, RPM: ptr(2000), Speed: ptr(60), FuelLevel: ptr(59)}))
+	}
+	// ~2km north
+	td.ObserveLocation(start.Add(50*time.Second), models.Location{Latitude: 40.009, Longitude: -3.0, Hdop: 1})
+	td.ObserveLocation(start.Add(100*time.Second), models.Location{Latitude: 40.018, Longitude: -3.0, Hdop: 1})
+	// a bad fix is not counted
+	td.ObserveLocation(start.Add(131*time.Second), models.Location{Latitude: 41, Longitude: -3.0, Hdop: 20})
+
+	assert.Equal(t, tripID, td.TripIDAt(start.Add(time.Minute)))
+	assert.Empty(t, td.TripIDAt(start.Add(-time.Minute)))
+
+	lastOn := start.Add(130 * time.Second)
+	// engine off, short stop does not end the trip
+	assert.Nil(t, td.Observe(TripObservation{Time: lastOn.Add(30 * time.Second), Voltage: 12.4, RPM: ptr(0)}))
+	ev = td.Observe(TripObservation{Time: lastOn.Add(61 * time.Second), Voltage: 12.4, RPM: ptr(0)})
+	require.NotNil(t, ev)
+	assert.Equal(t, models.TripEnd, ev.Type)
+	assert.Equal(t, tripID, ev.TripID)
+	assert.Equal(t, lastOn.UnixMilli(), ev.EndTime)
+	assert.Equal(t, 130.0, ev.DurationSecs)
+	assert.InDelta(t, 2.0, ev.DistanceKm, 0.01)
+	assert.Equal(t, 60.0, ev.MaxSpeed)
+	assert.Equal(t, 10.0, ev.IdleSecs)
+	require.NotNil(t, ev.FuelUsedPercent)
+	assert.Equal(t, 1.0, *ev.FuelUsedPercent)
+	assert.Nil(t, ev.EnergyUsedPercent)
+	require.NotNil(t, ev.EndLocation)
+	assert.Equal(t, 40.018, ev.EndLocation.Latitude)
+
+	// signals dequeued after the trip ended still get the id, but not after it
+	assert.Equal(t, tripID, td.TripIDAt(lastOn))
+	assert.Empty(t, td.TripIDAt(lastOn.Add(time.Second)))
+}
+
+func TestTripDetector_SpeedDistanceWithoutGPS(t *testing.T) {
+	td := NewTripDetector(13.3)
+	start := time.Now()
+	// no rpm, voltage not known: speed alone starts the trip
+	require.NotNil(t, td.Observe(TripObservation{Time: start, Speed: ptr(36)}))
+	for i := 1; i <= 10; i++ {
+		td.Observe(TripObservation{Time: start.Add(time.Duration(i) * 10 * time.Second), Speed: ptr(36), SOC: ptr(80 - float64(i))})
+	}
+	assert.Nil(t, td.Observe(TripObservation{Time: start.Add(110 * time.Second), Speed: ptr(0)}))
+	ev := td.Observe(TripObservation{Time: start.Add(170 * time.Second), Speed: ptr(0)})
+	require.NotNil(t, ev)
+	// 36km/h for 100s
+	assert.InDelta(t, 1.0, ev.DistanceKm, 0.001)
+	require.NotNil(t, ev.EnergyUsedPercent)
+	assert.Equal(t, 9.0, *ev.EnergyUsedPercent)
+}
+
+func TestTripDetector_GPSMovementFallback(t *testing.T) {
+	td := NewTripDetector(13.3)
+	start := time.Now()
+	td.ObserveLocation(start, models.Location{Latitude: 40.0, Longitude: -3.0})
+	assert.Nil(t, td.Observe(TripObservation{Time: start, Voltage: 12.5}))
+	// 1km in 60s
+	td.ObserveLocation(start.Add(time.Minute), models.Location{Latitude: 40.009, Longitude: -3.0})
+	ev := td.Observe(TripObservation{Time: start.Add(time.Minute), Voltage: 12.5})
+	require.NotNil(t, ev)
+	assert.Equal(t, models.TripStart, ev.Type)
+}
+
+func TestTripDetector_VoltageRise(t *testing.T) {
+	td := NewTripDetector(13.3)
+	start := time.Now()
+	require.NotNil(t, td.Observe(TripObservation{Time: start, Voltage: 14.2}))
+	assert.Nil(t, td.Observe(TripObservation{Time: start.Add(2 * time.Second), Voltage: 14.2}))
+	// a second observation with the engine still on does not start another trip
+	assert.NotEmpty(t, td.TripIDAt(start.Add(time.Second)))
+}
@@ -0,0 +1,25 @@
+package util
+
+import "math"
+
+// EarthRadiusKm mean earth radius
+const EarthRadiusKm = 6371.0
+
+// HaversineKm great circle distance between two coordinates in decimal degrees
+func HaversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dPhi := phi2 - phi1
+	dLambda := (lon2 - lon1) * math.Pi / 180
+	h := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// Destination the coordinates reached travelling meters from lat, lon on the given course (degrees clockwise from north)
+func Destination(lat, lon, course, meters float64) (float64, float64) {
+	phi1, lambda1 := lat*math.Pi/180, lon*math.Pi/180
+	theta := course * math.Pi / 180
+	delta := meters / (EarthRadiusKm * 1000)
+	phi2 := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta))
+	lambda2 := lambda1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(phi1), math.Cos(delta)-math.Sin(phi1)*math.Sin(phi2))
+	return phi2 * 180 / math.Pi, math.Mod(lambda2*180/math.Pi+540, 360) - 180
+}
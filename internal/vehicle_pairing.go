@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/gateways"
+	"github.com/DIMO-Network/edge-network/internal/hooks"
+	"github.com/DIMO-Network/edge-network/internal/loggers"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	"github.com/DIMO-Network/edge-network/internal/network"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rs/zerolog"
+)
+
+// pairingQueryEvery how often identity-api is queried while waiting for the device to be paired to the new vehicle
+const pairingQueryEvery = 5 * time.Minute
+
+// VehiclePairing handles the device being moved to another vehicle: the templates and state of the previous vehicle
+// are invalidated and vehicle data is paused, so it is not attributed to the previous vehicle, until identity-api shows
+// the device paired to a different vehicle. Then Restart is closed so the service exits and is restarted with the
+// templates for the new one.
+type VehiclePairing struct {
+	logger     zerolog.Logger
+	lss        loggers.SettingsStore
+	dataSender network.DataSender
+	identity   gateways.IdentityAPI
+	ethAddr    common.Address
+	// tokenID the vehicle the device is paired to on start
+	tokenID    uint64
+	queryEvery time.Duration
+	restart    chan struct{}
+	waiting    bool
+	// onChange called when the vehicle changed, after its settings were invalidated
+	onChange []func()
+	mu       sync.Mutex
+}
+
+func NewVehiclePairing(logger zerolog.Logger, lss loggers.SettingsStore, dataSender network.DataSender, identity gateways.IdentityAPI,
+	ethAddr common.Address, vehicleInfo *models.VehicleInfo) *VehiclePairing {
+	vp := &VehiclePairing{logger: logger, lss: lss, dataSender: dataSender, identity: identity, ethAddr: ethAddr,
+		queryEvery: pairingQueryEvery, restart: make(chan struct{})}
+	if vehicleInfo != nil {
+		vp.tokenID = vehicleInfo.TokenID
+	}
+	return vp
+}
+
+// Restart is closed once the device is paired to the new vehicle
+func (vp *VehiclePairing) Restart() <-chan struct{} {
+	return vp.restart
+}
+
+// OnVehicleChanged registers f to be called when the vehicle changed, to drop the state kept in memory for the previous one
+func (vp *VehiclePairing) OnVehicleChanged(f func()) {
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	vp.onChange = append(vp.onChange, f)
+}
+
+// Resume keeps vehicle data paused if the device was still waiting for the new pairing before a restart. Call once on start.
+func (vp *VehiclePairing) Resume() {
+	config, err := vp.lss.ReadVINConfig()
+	if err != nil || config.RepairingFromTokenID == 0 {
+		return
+	}
+	if config.RepairingFromTokenID != vp.tokenID {
+		vp.logger.Info().Msgf("device was re-paired from vehicle %d to %d", config.RepairingFromTokenID, vp.tokenID)
+		config.RepairingFromTokenID = 0
+		if err := vp.lss.WriteVINConfig(*config); err != nil {
+			vp.logger.Err(err).Msg("failed to clear pending pairing from vin config")
+		}
+		return
+	}
+	vp.logger.Info().Msgf("still waiting for the device to be paired to a vehicle other than %d", vp.tokenID)
+	vp.wait()
+}
+
+// VehicleChanged the fingerprint read vin while the device was paired to the vehicle with previousVIN. Expects the vin
+// config to already have the new VIN.
+func (vp *VehiclePairing) VehicleChanged(previousVIN, vin string) {
+	vp.logger.Warn().Ctx(context.WithValue(context.Background(), hooks.LogToMqtt, "true")).
+		Msgf("vehicle changed from %s to %s, pausing vehicle data until the device is paired again", previousVIN, vin)
+
+	err := vp.dataSender.SendVehicleChangedEvent(models.VehicleChangedEvent{PreviousVIN: previousVIN, VIN: vin, PreviousTokenID: vp.tokenID})
+	if err != nil {
+		vp.logger.Err(err).Msg("failed to send vehicle changed event")
+	}
+	if err := vp.lss.InvalidateVehicleSettings(); err != nil {
+		vp.logger.Err(err).Msg("there was one or more errors invalidating vehicle settings, continuing")
+	}
+	vp.mu.Lock()
+	onChange := vp.onChange
+	vp.mu.Unlock()
+	for _, f := range onChange {
+		f()
+	}
+	config, err := vp.lss.ReadVINConfig()
+	if err != nil {
+		config = &models.VINLoggerSettings{VIN: vin}
+	}
+	config.RepairingFromTokenID = vp.tokenID
+	if err := vp.lss.WriteVINConfig(*config); err != nil {
+		vp.logger.Err(err).Msg("failed to save pending pairing in vin config")
+	}
+	vp.wait()
+}
+
+// wait pauses vehicle data and starts querying identity-api, only once
+func (vp *VehiclePairing) wait() {
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+	vp.dataSender.PauseVehicleData(true)
+	if vp.waiting {
+		return
+	}
+	vp.waiting = true
+	go func() {
+		for !vp.paired() {
+			time.Sleep(vp.queryEvery)
+		}
+	}()
+}
+
+// paired queries identity-api, when the device is paired to another vehicle its info is saved and the service restarted.
+// Vehicle data stays paused until then, the new vehicle's data starts with its templates.
+func (vp *VehiclePairing) paired() bool {
+	vehicleInfo, err := vp.identity.QueryIdentityAPIForVehicle(vp.ethAddr)
+	if err != nil {
+		vp.logger.Err(err).Msg("failed to query identity-api for the new pairing")
+		return false
+	}
+	if vehicleInfo == nil || vehicleInfo.TokenID == 0 || vehicleInfo.TokenID == vp.tokenID {
+		return false
+	}
+	vp.logger.Info().Ctx(context.WithValue(context.Background(), hooks.LogToMqtt, "true")).
+		Msgf("device paired to vehicle %d, restarting to load its templates", vehicleInfo.TokenID)
+	if err := vp.lss.WriteVehicleInfo(*vehicleInfo); err != nil {
+		vp.logger.Err(err).Msg("failed to save vehicle info")
+	}
+	config, err := vp.lss.ReadVINConfig()
+	if err == nil {
+		config.RepairingFromTokenID = 0
+		if err := vp.lss.WriteVINConfig(*config); err != nil {
+			vp.logger.Err(err).Msg("failed to clear pending pairing from vin config")
+		}
+	}
+	close(vp.restart)
+	return true
+}
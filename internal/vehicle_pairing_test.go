@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/edge-network/internal/api"
+	mock_gateways "github.com/DIMO-Network/edge-network/internal/gateways/mocks"
+	"github.com/DIMO-Network/edge-network/internal/loggers"
+	mock_loggers "github.com/DIMO-Network/edge-network/internal/loggers/mocks"
+	"github.com/DIMO-Network/edge-network/internal/models"
+	mock_network "github.com/DIMO-Network/edge-network/internal/network/mocks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/jarcoal/httpmock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_fingerprintRunner_vehicleChanged(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	const previousVIN = "5TFCZ5AN0HX073768"
+	const newVIN = "1FTFW1ET5DFC10312"
+	ctrl := gomock.NewController(t)
+	vl := mock_loggers.NewMockVINLogger(ctrl)
+	ds := mock_network.NewMockDataSender(ctrl)
+	ts := mock_loggers.NewMockSettingsStore(ctrl)
+	identity := mock_gateways.NewMockIdentityAPI(ctrl)
+	unitID := uuid.New()
+	ethAddr := common.HexToAddress("0x694C9A19e3644A9BFe1008857aeEd155F27b078e")
+
+	pairing := NewVehiclePairing(zerolog.Nop(), ts, ds, identity, ethAddr, &models.VehicleInfo{TokenID: 7})
+	pairing.queryEvery = time.Millisecond
+
+	// the previous vehicle's odometer is neither sent with the new vin nor written back to disk
+	ts.EXPECT().ReadOdometerState().Return(&models.OdometerState{Strategy: "obd_a6", AnchorKm: 84000, AnchorTime: time.Now()}, nil)
+	odometer := newOdometerReader(zerolog.Nop(), ts, "Toyota", func(models.PIDRequest) (float64, error) {
+		return 84000, nil
+	})
+	pairing.OnVehicleChanged(odometer.Reset)
+
+	queryName := "vin_7DF_09_02"
+	ts.EXPECT().ReadVINConfig().Return(&models.VINLoggerSettings{VIN: previousVIN, VINQueryName: queryName}, nil)
+	fpr := NewFingerprintRunner(unitID, vl, ds, ts, zerolog.Nop(), odometer, pairing)
+
+	// the query that worked on the previous vehicle doesn't on this one
+	vl.EXPECT().GetVIN(unitID, &queryName).Return(nil, assert.AnError)
+	vl.EXPECT().GetVIN(unitID, nil).Return(&loggers.VINResponse{VIN: newVIN, Protocol: "6", QueryName: "vin_7E0_22_F190"}, nil)
+	saved := models.VINLoggerSettings{VIN: newVIN, VINQueryName: "vin_7E0_22_F190"}
+	ts.EXPECT().WriteVINConfig(saved).Return(nil)
+	ds.EXPECT().SendVehicleChangedEvent(gomock.Any()).DoAndReturn(func(event models.VehicleChangedEvent) error {
+		assert.Equal(t, models.VehicleChangedEvent{PreviousVIN: previousVIN, VIN: newVIN, PreviousTokenID: 7}, event)
+		return nil
+	})
+	ts.EXPECT().InvalidateVehicleSettings().Return(nil)
+	ts.EXPECT().ReadVINConfig().Return(&saved, nil)
+	pending := saved
+	pending.RepairingFromTokenID = 7
+	ts.EXPECT().WriteVINConfig(pending).Return(nil)
+	ds.EXPECT().PauseVehicleData(true)
+	ds.EXPECT().SendFingerprintData(gomock.Any()).DoAndReturn(func(data models.FingerprintData) error {
+		assert.Equal(t, newVIN, data.Vin)
+		assert.Zero(t, data.Odometer)
+		assert.Empty(t, data.OdometerSource)
+		return nil
+	})
+
+	// still paired to the previous vehicle, then to the new one
+	gomock.InOrder(
+		identity.EXPECT().QueryIdentityAPIForVehicle(ethAddr).Return(&models.VehicleInfo{TokenID: 7}, nil),
+		identity.EXPECT().QueryIdentityAPIForVehicle(ethAddr).Return(&models.VehicleInfo{TokenID: 8}, nil),
+	)
+	ts.EXPECT().WriteVehicleInfo(models.VehicleInfo{TokenID: 8}).Return(nil)
+	ts.EXPECT().ReadVINConfig().Return(&pending, nil)
+	ts.EXPECT().WriteVINConfig(saved).Return(nil)
+
+	err := fpr.FingerprintSimple(api.PowerStatusResponse{VoltageFound: 13.7})
+	assert.NoError(t, err)
+	_, err = odometer.Current()
+	assert.ErrorIs(t, err, ErrNoOdometer)
+	select {
+	case <-pairing.Restart():
+	case <-time.After(time.Second):
+		t.Fatal("not restarted once paired to the new vehicle")
+	}
+}
+
+func TestVehiclePairing_Resume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ds := mock_network.NewMockDataSender(ctrl)
+	ts := mock_loggers.NewMockSettingsStore(ctrl)
+	identity := mock_gateways.NewMockIdentityAPI(ctrl)
+	ethAddr := common.HexToAddress("0x694C9A19e3644A9BFe1008857aeEd155F27b078e")
+
+	// re-paired while the service was down
+	pairing := NewVehiclePairing(zerolog.Nop(), ts, ds, identity, ethAddr, &models.VehicleInfo{TokenID: 8})
+	ts.EXPECT().ReadVINConfig().Return(&models.VINLoggerSettings{VIN: "1FTFW1ET5DFC10312", RepairingFromTokenID: 7}, nil)
+	ts.EXPECT().WriteVINConfig(models.VINLoggerSettings{VIN: "1FTFW1ET5DFC10312"}).Return(nil)
+	pairing.Resume()
+
+	// still waiting, vehicle data stays paused
+	pairing = NewVehiclePairing(zerolog.Nop(), ts, ds, identity, ethAddr, &models.VehicleInfo{TokenID: 7})
+	pairing.queryEvery = time.Hour
+	ts.EXPECT().ReadVINConfig().Return(&models.VINLoggerSettings{VIN: "1FTFW1ET5DFC10312", RepairingFromTokenID: 7}, nil)
+	ds.EXPECT().PauseVehicleData(true)
+	queried := make(chan struct{})
+	identity.EXPECT().QueryIdentityAPIForVehicle(ethAddr).DoAndReturn(func(common.Address) (*models.VehicleInfo, error) {
+		close(queried)
+		return &models.VehicleInfo{TokenID: 7}, nil
+	})
+	pairing.Resume()
+	<-queried
+}
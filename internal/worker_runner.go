@@ -2,6 +2,7 @@ package internal
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -12,16 +13,20 @@ import (
 
 	"github.com/DIMO-Network/edge-network/commands"
 	"github.com/DIMO-Network/edge-network/internal/api"
+	"github.com/DIMO-Network/edge-network/internal/clock"
 	"github.com/DIMO-Network/edge-network/internal/loggers"
 	"github.com/DIMO-Network/edge-network/internal/models"
 	"github.com/DIMO-Network/edge-network/internal/network"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 )
 
 type WorkerRunner interface {
 	Run()
+	// ResetVehicleState forgets the state kept for the paired vehicle, for when the device was moved to another one
+	ResetVehicleState()
 }
 
 // Device represents the device information that is used in the worker runner
@@ -45,24 +50,86 @@ type workerRunner struct {
 	signalsQueue        *SignalsQueue
 	signalDumpFramesQ   *SignalFrameDumpQueue
 	stop                chan bool
+	stopAdjust          func()
 	sendPayloadInterval time.Duration
 	device              Device
 	vehicleInfo         *models.VehicleInfo
 	dbcScanner          loggers.DBCPassiveLogger
+	canCapture          *CANCaptureRunner
+	trips               *TripDetector
+	driving             *DrivingEventDetector
+	geofences           *GeofenceEvaluator
+	adaptiveLocation    *AdaptiveLocationSampler
+	deadReckoning       *DeadReckoning
+	charging            *ChargingSessionDetector
+	power               *PowerManager
+	batteryHealth       *BatteryHealthMonitor
+	odometer            *OdometerReader
+	capabilities        *CapabilityScanner
+	gnss                gnssFilter
+	signalMapper        *SignalMapper
 }
 
 func NewWorkerRunner(addr *common.Address, loggerSettingsSvc loggers.SettingsStore,
 	dataSender network.DataSender, logger zerolog.Logger, fpRunner FingerprintRunner,
 	pids *models.TemplatePIDs, settings *models.TemplateDeviceSettings, device Device, vehicleInfo *models.VehicleInfo,
-	dbcScanner loggers.DBCPassiveLogger, dtcRunner DtcErrorsRunner) WorkerRunner {
-	signalsQueue := &SignalsQueue{lastTimeChecked: make(map[string]time.Time), failureCount: make(map[string]int), signals: make(map[string][]models.SignalData)}
+	dbcScanner loggers.DBCPassiveLogger, dtcRunner DtcErrorsRunner, canCapture *CANCaptureRunner, odometer *OdometerReader) WorkerRunner {
+	// signals are renamed to vss paths as they are queued, the queue keeps the device names for the lookups
+	signalMapper := NewSignalMapper(settings.SignalMapping)
+	signalsQueue := &SignalsQueue{lastTimeChecked: make(map[string]time.Time), failureCount: make(map[string]int),
+		signals: make(map[string][]models.SignalData), mapper: signalMapper}
+	// signals queried before the clock was known to be right get their timestamps fixed before they are sent
+	stopAdjust := clock.OnAdjust(signalsQueue.AdjustTimestamps)
 	// Interval for sending status payload to cloud. Status payload contains obd signals and non-obd signals.
 	interval := 20 * time.Second
 	sdfq := NewSignalFrameDumpQueue(logger, dataSender, loggerSettingsSvc)
+	var driving *DrivingEventDetector
+	if settings.DrivingEvents.Enabled {
+		driving = NewDrivingEventDetector(settings.DrivingEvents)
+	}
+	var adaptiveLocation *AdaptiveLocationSampler
+	if settings.AdaptiveLocation.Enabled {
+		adaptiveLocation = NewAdaptiveLocationSampler(settings.AdaptiveLocation, interval)
+	}
+	var deadReckoning *DeadReckoning
+	if settings.DeadReckoning.Enabled {
+		deadReckoning = NewDeadReckoning(settings.DeadReckoning)
+	}
+	var charging *ChargingSessionDetector
+	if settings.EV.Enabled {
+		charging = NewChargingSessionDetector(settings.EV)
+		// the catalog fills in the ev signals the template doesn't define
+		if pids != nil && vehicleInfo != nil {
+			pids.Requests = append(pids.Requests, EVRequests(vehicleInfo.VehicleDefinition.Make, pids.Requests)...)
+		}
+	}
+	var batteryHealth *BatteryHealthMonitor
+	if settings.BatteryHealth.Enabled {
+		batteryHealth = NewBatteryHealthMonitor(logger, loggerSettingsSvc, settings.BatteryHealth)
+	}
+	var capabilities *CapabilityScanner
+	if settings.CapabilityScan.Enabled {
+		capabilities = NewCapabilityScanner(logger, device.UnitID, loggerSettingsSvc, dataSender, settings.CapabilityScan)
+		if cached := capabilities.Cached(); cached != nil && pids != nil {
+			pids.Requests = PruneUnsupported(pids.Requests, *cached)
+		}
+	}
+	var geofences *GeofenceEvaluator
+	if len(settings.Geofencing.Fences) > 0 {
+		geofences = NewGeofenceEvaluator(logger, loggerSettingsSvc, settings.Geofencing)
+	}
+	if pids != nil && dbcScanner != nil {
+		// the scanner was built with the template requests, it filters and matches the responses with these
+		dbcScanner.SetPIDs(pids.Requests)
+	}
 	return &workerRunner{ethAddr: addr, loggerSettingsSvc: loggerSettingsSvc,
 		dataSender: dataSender, logger: logger, fingerprintRunner: fpRunner, pids: pids, deviceSettings: settings,
 		signalsQueue: signalsQueue, sendPayloadInterval: interval, device: device, vehicleInfo: vehicleInfo,
-		dbcScanner: dbcScanner, signalDumpFramesQ: sdfq, dtcErrorsRunner: dtcRunner}
+		dbcScanner: dbcScanner, signalDumpFramesQ: sdfq, dtcErrorsRunner: dtcRunner, canCapture: canCapture,
+		trips: NewTripDetector(settings.MinVoltageOBDLoggers), driving: driving, geofences: geofences, adaptiveLocation: adaptiveLocation,
+		deadReckoning: deadReckoning, charging: charging, power: NewPowerManager(logger, device.UnitID, *settings),
+		batteryHealth: batteryHealth, odometer: odometer, capabilities: capabilities, signalMapper: signalMapper,
+		stopAdjust: stopAdjust}
 }
 
 // Max failures allowed for a PID before sending an error to the cloud
@@ -106,6 +173,7 @@ func (wr *workerRunner) Run() {
 			// any signals picked up by can0 hardware filter logger gets enqueued to be sent
 			for signal := range dbcCh {
 				wr.signalsQueue.Enqueue(signal)
+				wr.observeSignal(signal)
 			}
 		}()
 	} else {
@@ -118,9 +186,23 @@ func (wr *workerRunner) Run() {
 	go func() {
 		fingerprintDone := false
 		dtcErrorsDone := false
+		dbcDiscoveryStarted := false
+		capabilitiesDone := false
 		for {
 			// we will need to check the voltage before we query obd, and then we can query obd if voltage is ok
 			queryOBD, powerStatus := wr.isOkToQueryOBD()
+			if wr.canCapture != nil {
+				wr.canCapture.Check(wr.captureConditions(powerStatus))
+			}
+			if wr.trips != nil {
+				wr.observeTrip(powerStatus)
+			}
+			if wr.charging != nil {
+				if !queryOBD {
+					wr.queryEVWhileOff(powerStatus)
+				}
+				wr.observeCharging()
+			}
 			if queryOBD {
 				// do fingerprint but only once, until max failure reached or completed
 				if !fingerprintDone && wr.fingerprintRunner.CurrentFailureCount() <= maxFingerprintFailures {
@@ -140,6 +222,11 @@ func (wr *workerRunner) Run() {
 						// note that FingerprintSimple stores success and reports to edge logs when first time success
 					}
 				}
+				// once per boot until the vehicle was scanned, before any goroutine reads the pids
+				if !capabilitiesDone && wr.capabilities != nil && wr.capabilities.Cached() == nil {
+					capabilitiesDone = true
+					wr.scanCapabilities()
+				}
 				if !dtcErrorsDone {
 					// try getting DTC errors from vehicle and send them as signals
 					errDtc := wr.dtcErrorsRunner.DtcErrors()
@@ -153,8 +240,16 @@ func (wr *workerRunner) Run() {
 						dtcErrorsDone = true
 					}
 				}
+				// listen while the car is on, in parallel to querying so we have speed and rpm to correlate against
+				if !dbcDiscoveryStarted && wr.deviceSettings.DBCDiscovery.Enabled {
+					dbcDiscoveryStarted = true
+					go wr.runDBCDiscovery()
+				}
 				// query OBD signals
 				wr.queryOBD(&powerStatus)
+				if wr.odometer != nil {
+					wr.odometer.Refresh(clock.Now())
+				}
 			} else {
 				msg := fmt.Sprintf("voltage not enough to query obd: %.1f", powerStatus.VoltageFound)
 				hooks.LogInfo(wr.logger, msg, hooks.WithStopLogAfter(1))
@@ -164,10 +259,19 @@ func (wr *workerRunner) Run() {
 		}
 	}()
 
+	if wr.driving != nil && wr.deviceSettings.DrivingEvents.AccelerometerHz > 0 {
+		go wr.pollAccelerometer()
+	}
+	if wr.batteryHealth != nil {
+		go wr.sampleBatteryHealth()
+	}
+
 	// start the location query if the frequency is set
 	// float e.g. 0.5 would be 2x per second
 	// do not start the location query if the frequency is 0 or sendPayloadInterval (which is 20s)
-	if wr.deviceSettings.LocationFrequencySecs > 0 && wr.deviceSettings.LocationFrequencySecs != wr.sendPayloadInterval.Seconds() {
+	// geofences may increase the location frequency while inside them
+	if (wr.deviceSettings.LocationFrequencySecs > 0 && wr.deviceSettings.LocationFrequencySecs != wr.sendPayloadInterval.Seconds()) ||
+		(wr.geofences != nil && wr.geofences.HasLocationFrequency()) || wr.adaptiveLocation != nil {
 		wr.startLocationQuery(modem)
 	}
 
@@ -184,13 +288,16 @@ func (wr *workerRunner) Run() {
 			_, powerStatus := wr.isOkToQueryOBD()
 			// query non-obd signals even if voltage is not enough
 			wifi, wifiErr, location, locationErr, cellInfo, cellErr := wr.queryNonObd(modem)
+			if wr.trips != nil && locationErr == nil {
+				wr.trips.ObserveLocation(clock.Now(), *location)
+			}
 			// compose the device event
 			s := wr.composeDeviceEvent(powerStatus, locationErr, location, wifiErr, wifi)
 
 			// send the cloud event only if signals array is not empty
 			if len(s.Vehicle.Signals) > 0 {
 				err = wr.dataSender.SendDeviceStatusData(s)
-				if err != nil {
+				if err != nil && !errors.Is(err, network.ErrVehicleDataPaused) {
 					wr.logger.Err(err).Msg("failed to send device status")
 				}
 			} else {
@@ -202,15 +309,11 @@ func (wr *workerRunner) Run() {
 				// compose the device network event
 				networkData := models.DeviceNetworkData{
 					CommonData: models.CommonData{
-						Timestamp: time.Now().UTC().UnixMilli(),
+						Timestamp: clock.Now().UTC().UnixMilli(),
 					},
 				}
-				if locationErr == nil {
-					networkData.Altitude = location.Altitude
-					networkData.Hdop = location.Hdop
-					networkData.Nsat = location.Nsat
-					networkData.Latitude = location.Latitude
-					networkData.Longitude = location.Longitude
+				if locationErr == nil && !wr.locationSuppressed() {
+					networkData.Location = *location
 				}
 				if cellErr == nil {
 					networkData.Cell = models.CellInfo{
@@ -219,7 +322,7 @@ func (wr *workerRunner) Run() {
 				}
 
 				err = wr.dataSender.SendDeviceNetworkData(networkData)
-				if err != nil {
+				if err != nil && !errors.Is(err, network.ErrVehicleDataPaused) {
 					wr.logger.Err(err).Msg("failed to send device network data")
 				}
 			}
@@ -230,61 +333,192 @@ func (wr *workerRunner) Run() {
 	}
 }
 
+// runDBCDiscovery analyzes passive can traffic per the template settings and sends the report
+func (wr *workerRunner) runDBCDiscovery() {
+	settings := wr.deviceSettings.DBCDiscovery
+	window := time.Duration(settings.WindowSecs * float64(time.Second))
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+	refs := settings.ReferenceSignals
+	if len(refs) == 0 {
+		refs = []string{"speed", "rpm"}
+	}
+	wr.logger.Info().Msgf("starting dbc discovery for %s, correlating against: %v", window, refs)
+	report, err := wr.dbcScanner.DiscoverDBCCandidates(window, wr.signalsQueue, refs)
+	if err != nil {
+		hooks.LogError(wr.logger, err, "failed dbc discovery", hooks.WithThresholdWhenLogMqtt(1))
+		return
+	}
+	if wr.pids != nil {
+		report.TemplateName = wr.pids.TemplateName
+	}
+	wr.logger.Info().Msgf("dbc discovery found %d ids in %d frames", len(report.IDs), report.TotalFrames)
+	if err := wr.dataSender.SendDBCDiscoveryReport(*report); err != nil {
+		wr.logger.Err(err).Msg("failed to send dbc discovery report")
+	}
+}
+
 func (wr *workerRunner) startLocationQuery(modem string) {
+	if wr.adaptiveLocation != nil {
+		go wr.runAdaptiveLocationQuery(modem)
+		return
+	}
 	go func() {
 		wr.logger.Info().Msgf("Start query location data with every %.2f sec", wr.deviceSettings.LocationFrequencySecs)
 		for {
+			frequency := wr.locationFrequency()
+			if frequency <= 0 || wr.lowPower() {
+				// only querying because of a geofence override, the status payload queries location while outside them
+				time.Sleep(5 * time.Second)
+				continue
+			}
 			location, locationErr := wr.queryLocation(modem)
 			if locationErr == nil {
-				ts := time.Now().UTC().UnixMilli()
-				wr.signalsQueue.Enqueue(models.SignalData{
-					Timestamp: ts,
-					Name:      "longitude",
-					Value:     location.Longitude,
-				})
-
-				wr.signalsQueue.Enqueue(models.SignalData{
-					Timestamp: ts,
-					Name:      "latitude",
-					Value:     location.Latitude,
-				})
-
-				wr.signalsQueue.Enqueue(models.SignalData{
-					Timestamp: ts,
-					Name:      "hdop",
-					Value:     location.Hdop,
-				})
-
-				wr.signalsQueue.Enqueue(models.SignalData{
-					Timestamp: ts,
-					Name:      "nsat",
-					Value:     location.Nsat,
-				})
-
-				wr.signalsQueue.Enqueue(models.SignalData{
-					Timestamp: ts,
-					Name:      "altitude",
-					Value:     location.Altitude,
-				})
+				if wr.trips != nil {
+					wr.trips.ObserveLocation(clock.Now(), *location)
+				}
+			}
+			if locationErr != nil {
+				location = wr.estimatedLocation()
+			}
+			if location != nil && !wr.locationSuppressed() {
+				wr.enqueueLocation(locationTimestamp(*location, clock.Now()), *location)
 				wr.logger.Debug().Msg("location data sent")
 			}
 			// convert float seconds to int nanoseconds
-			intNanoseconds := int(wr.deviceSettings.LocationFrequencySecs * 1e9)
+			intNanoseconds := int(frequency * 1e9)
 			time.Sleep(time.Duration(intNanoseconds))
 		}
 	}()
 }
 
+// runAdaptiveLocationQuery polls gps as often as the motion requires, and enqueues the simplified track
+func (wr *workerRunner) runAdaptiveLocationQuery(modem string) {
+	wr.logger.Info().Msgf("Start adaptive location query: %+v", wr.deviceSettings.AdaptiveLocation)
+	for {
+		if wr.lowPower() {
+			// the status payload still queries location every sendPayloadInterval
+			time.Sleep(wr.sendPayloadInterval)
+			continue
+		}
+		location, locationErr := wr.queryLocation(modem)
+		if locationErr != nil {
+			if estimated := wr.estimatedLocation(); estimated != nil && !wr.locationSuppressed() {
+				wr.enqueueLocation(clock.Now().UTC().UnixMilli(), *estimated)
+			}
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		now := clock.Now()
+		if wr.trips != nil {
+			wr.trips.ObserveLocation(now, *location)
+		}
+		next, track := wr.adaptiveLocation.Add(now, *location)
+		if !wr.locationSuppressed() {
+			for _, p := range track {
+				wr.enqueueLocation(locationTimestamp(p.Location, p.Time), p.Location)
+			}
+		}
+		if frequency := wr.geofenceLocationFrequency(); frequency > 0 && seconds(frequency) < next {
+			next = seconds(frequency)
+		}
+		wr.waitForMotion(next, wr.adaptiveLocation.Moving())
+	}
+}
+
+// waitForMotion sleeps d, but while stationary wakes up as soon as the vehicle reports speed so the start of a trip is not missed
+func (wr *workerRunner) waitForMotion(d time.Duration, moving bool) {
+	if moving {
+		time.Sleep(d)
+		return
+	}
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+		if speed, ok := wr.signalsQueue.LatestFloat("speed", 5*time.Second); ok && speed > 0 {
+			return
+		}
+	}
+}
+
+func (wr *workerRunner) enqueueLocation(ts int64, location models.Location) {
+	for _, s := range appendLocationSignals(nil, location, ts) {
+		wr.signalsQueue.Enqueue(s)
+	}
+}
+
+// locationUnits of the location signals, hdop and nsat have none
+var locationUnits = map[string]string{
+	"longitude":        "degrees",
+	"latitude":         "degrees",
+	"altitude":         "m",
+	"locationAccuracy": "m",
+	"gpsSpeed":         "km/h",
+	"gpsHeading":       "degrees",
+}
+
+// appendLocationSignals adds the location signals with their units
+func appendLocationSignals(signals []models.SignalData, location models.Location, ts int64) []models.SignalData {
+	start := len(signals)
+	signals = appendLocationValues(signals, location, ts)
+	for i := start; i < len(signals); i++ {
+		signals[i].Unit = locationUnits[signals[i].Name]
+		signals[i].Source = models.SignalSourceGPS
+	}
+	return signals
+}
+
+// appendLocationValues speed and heading only when the modem reports the fix type as older firmwares don't report them
+// either
+func appendLocationValues(signals []models.SignalData, location models.Location, ts int64) []models.SignalData {
+	signals = appendSignalData(signals, "longitude", location.Longitude, ts)
+	signals = appendSignalData(signals, "latitude", location.Latitude, ts)
+	if location.Estimated {
+		// dead reckoning, no hdop nor satellites to report
+		signals = appendSignalData(signals, "locationEstimated", true, ts)
+		return appendSignalData(signals, "locationAccuracy", location.AccuracyMeters, ts)
+	}
+	signals = appendSignalData(signals, "hdop", location.Hdop, ts)
+	signals = appendSignalData(signals, "nsat", location.Nsat, ts)
+	signals = appendSignalData(signals, "altitude", location.Altitude, ts)
+	if location.Fix != "" {
+		signals = appendSignalData(signals, "gpsSpeed", location.SogKm, ts)
+		signals = appendSignalData(signals, "gpsHeading", location.Cog, ts)
+	}
+	return signals
+}
+
+// ResetVehicleState drops the in-memory odometer, geofence, battery and capability state when the vehicle changes
+func (wr *workerRunner) ResetVehicleState() {
+	if wr.odometer != nil {
+		wr.odometer.Reset()
+	}
+	if wr.geofences != nil {
+		wr.geofences.Reset()
+	}
+	if wr.batteryHealth != nil {
+		wr.batteryHealth.Reset()
+	}
+	if wr.capabilities != nil {
+		wr.capabilities.Reset()
+	}
+}
+
 // Stop is used only for functional tests
 func (wr *workerRunner) Stop() {
+	if wr.stopAdjust != nil {
+		wr.stopAdjust()
+	}
 	wr.stop <- true
 }
 
 func (wr *workerRunner) composeDeviceEvent(powerStatus api.PowerStatusResponse, locationErr error, location *models.Location, wifiErr error, wifi *models.WiFi) models.DeviceStatusData {
-	ts := time.Now().UTC().UnixMilli()
+	ts := clock.Now().UTC().UnixMilli()
 	statusData := models.DeviceStatusData{
 		CommonData: models.CommonData{
-			Timestamp: ts,
+			Timestamp:    ts,
+			ClockQuality: clock.CurrentQuality(),
 		},
 		Device: models.Device{
 			RpiUptimeSecs:   powerStatus.Rpi.Uptime.Seconds,
@@ -295,30 +529,62 @@ func (wr *workerRunner) composeDeviceEvent(powerStatus api.PowerStatusResponse,
 			IMEI:            wr.device.IMEI,
 		},
 		Vehicle: models.Vehicle{
-			Signals: wr.signalsQueue.Dequeue(),
+			Signals:              wr.signalsQueue.Dequeue(),
+			SignalMappingVersion: wr.signalMapper.Version(),
 		},
 	}
+	// the queued signals are already mapped
+	queued := len(statusData.Vehicle.Signals)
 	// add batteryVoltage to signals
-	statusData.Vehicle.Signals = appendSignalData(statusData.Vehicle.Signals, "batteryVoltage", powerStatus.VoltageFound, ts)
+	statusData.Vehicle.Signals = appendSourceSignal(statusData.Vehicle.Signals, models.SignalSourceDevice, "batteryVoltage",
+		powerStatus.VoltageFound, "V", ts)
 	// only update location if no error
-	if locationErr == nil {
-		statusData.Vehicle.Signals = appendSignalData(statusData.Vehicle.Signals, "longitude", location.Longitude, ts)
-		statusData.Vehicle.Signals = appendSignalData(statusData.Vehicle.Signals, "latitude", location.Latitude, ts)
-		statusData.Vehicle.Signals = appendSignalData(statusData.Vehicle.Signals, "hdop", location.Hdop, ts)
-		statusData.Vehicle.Signals = appendSignalData(statusData.Vehicle.Signals, "nsat", location.Nsat, ts)
-		statusData.Vehicle.Signals = appendSignalData(statusData.Vehicle.Signals, "altitude", location.Altitude, ts)
+	if locationErr == nil && !wr.locationSuppressed() {
+		statusData.Vehicle.Signals = appendLocationSignals(statusData.Vehicle.Signals, *location, locationTimestamp(*location, time.UnixMilli(ts)))
+	} else if estimated := wr.estimatedLocation(); estimated != nil && !wr.locationSuppressed() {
+		statusData.Vehicle.Signals = appendLocationSignals(statusData.Vehicle.Signals, *estimated, ts)
+	}
+
+	if wr.odometer != nil {
+		if odometer, err := wr.odometer.Current(); err == nil {
+			// the template signal is already in the payload
+			if odometer.Source != OdometerSourceTemplate {
+				statusData.Vehicle.Signals = appendSourceSignal(statusData.Vehicle.Signals, models.SignalSourceDevice, "odometer",
+					odometer.Km, "km", ts)
+			}
+			statusData.Vehicle.Signals = appendSignalData(statusData.Vehicle.Signals, "odometerSource", odometer.Source, ts)
+		}
 	}
 
 	// only update Wi-Fi if no error and if Wi-Fi is available
 	if wifiErr == nil && !strings.EqualFold(wifi.WPAState, "disconnected") {
-		statusData.Vehicle.Signals = appendSignalData(statusData.Vehicle.Signals, "wpa_state", wifi.WPAState, ts)
-		statusData.Vehicle.Signals = appendSignalData(statusData.Vehicle.Signals, "ssid", wifi.SSID, ts)
+		statusData.Vehicle.Signals = appendSourceSignal(statusData.Vehicle.Signals, models.SignalSourceModem, "wpa_state", wifi.WPAState, "", ts)
+		statusData.Vehicle.Signals = appendSourceSignal(statusData.Vehicle.Signals, models.SignalSourceModem, "ssid", wifi.SSID, "", ts)
+	}
+	wr.signalMapper.MapAll(statusData.Vehicle.Signals[queued:])
+	compactSignalMetadata(statusData.Vehicle.Signals)
+
+	if wr.trips != nil {
+		for i := range statusData.Vehicle.Signals {
+			statusData.Vehicle.Signals[i].TripID = wr.trips.TripIDAt(time.UnixMilli(statusData.Vehicle.Signals[i].Timestamp))
+		}
 	}
 
 	return statusData
 }
 
-// appendSignalData utility to add signals to the data example for ts: time.Now().UTC().UnixMilli()
+// appendSourceSignal appendSignalData with the source and unit of the value
+func appendSourceSignal(signals []models.SignalData, source models.SignalSource, name string, value any, unit string, ts int64) []models.SignalData {
+	return append(signals, models.SignalData{
+		Timestamp: ts,
+		Name:      name,
+		Value:     value,
+		Unit:      unit,
+		Source:    source,
+	})
+}
+
+// appendSignalData utility to add signals to the data example for ts: clock.Now().UTC().UnixMilli()
 func appendSignalData(signals []models.SignalData, name string, value interface{}, ts int64) []models.SignalData {
 	return append(signals, models.SignalData{
 		Timestamp: ts,
@@ -354,22 +620,37 @@ func (wr *workerRunner) queryWiFi() (*models.WiFi, error) {
 
 func (wr *workerRunner) queryLocation(modem string) (*models.Location, error) {
 	gspLocation, err := commands.GetGPSLocation(wr.device.UnitID, modem)
-	location := models.Location{}
 	if err != nil {
 		// stop send to mqtt to reduce excessive logging
 		hooks.LogError(wr.logger, err, "failed to get gps location", hooks.WithStopLogAfter(1))
 		return nil, err
 	}
-	// location fields mapped to separate struct
-	location = models.Location{
-		Hdop:      gspLocation.Hdop,
-		Nsat:      gspLocation.Nsat,
-		Latitude:  gspLocation.Lat,
-		Longitude: gspLocation.Lon,
-		Altitude:  gspLocation.Alt,
+	// no fix during cold starts or when the fix is lost, rather send nothing than 0,0 or an old position
+	queriedAt := time.Now()
+	location, err := wr.gnss.location(gspLocation, queriedAt)
+	if err != nil {
+		wr.logger.Debug().Err(err).Msgf("ignoring gps location: %+v", gspLocation)
+		return nil, err
+	}
+	if location.FixTime > 0 {
+		clock.ObserveGNSS(time.UnixMilli(location.FixTime), queriedAt)
+	}
+	if wr.deadReckoning != nil {
+		if drift, ok := wr.deadReckoning.Fix(clock.Now(), *location); ok {
+			wr.logger.Debug().Msgf("gps fix is back, dead reckoning was %.0fm off", drift)
+		}
+	}
+	if wr.geofences != nil {
+		wr.sendGeofenceEvents(wr.geofences.Evaluate(clock.Now(), *location))
+	}
+	if wr.driving != nil {
+		wr.sendDrivingEvents(wr.driving.ObserveGPS(clock.Now(), location.Latitude, location.Longitude, location.Cog, location.SogKm))
+	}
+	if wr.odometer != nil {
+		wr.odometer.ObserveLocation(clock.Now(), *location)
 	}
 
-	return &location, nil
+	return location, nil
 }
 
 // queryOBD queries OBD signals based on their designated intervals and power status.
@@ -404,6 +685,9 @@ func (wr *workerRunner) queryOBD(powerStatus *api.PowerStatusResponse) {
 			err := wr.dbcScanner.SendCANQuery(request.Header, request.Mode, request.Pid)
 			if err != nil {
 				hooks.LogError(wr.logger, err, "failed to send CAN query", hooks.WithThresholdWhenLogMqtt(5), hooks.WithPowerStatus(*powerStatus))
+			} else if request.IsBroadcast() && request.ECUSelection == models.ECUSelectionAll {
+				// the responses are named per ecu, they don't keep the interval of the request
+				wr.signalsQueue.MarkChecked(request.Name)
 			}
 		} else {
 			// Python formulas to DBC project - CAN frame dumps for first 2 requests.
@@ -420,6 +704,26 @@ func (wr *workerRunner) queryOBD(powerStatus *api.PowerStatusResponse) {
 	}
 }
 
+// scanCapabilities learns what the vehicle supports and stops querying the template pids it doesn't
+func (wr *workerRunner) scanCapabilities() {
+	capabilities, err := wr.capabilities.Scan()
+	if err != nil {
+		wr.logger.Err(err).Msg("failed to scan vehicle capabilities")
+		return
+	}
+	if wr.pids == nil {
+		return
+	}
+	pruned := *wr.pids
+	pruned.Requests = PruneUnsupported(wr.pids.Requests, *capabilities)
+	if removed := len(wr.pids.Requests) - len(pruned.Requests); removed > 0 {
+		wr.logger.Info().Msgf("not querying %d template pids the vehicle doesn't support", removed)
+	}
+	wr.pids = &pruned
+	// the native scanner stops filtering and matching the responses of the pruned pids
+	wr.dbcScanner.SetPIDs(pruned.Requests)
+}
+
 // queryOBDWithAP calls autopi obd.query, waits for response and enques the resp value if any
 func (wr *workerRunner) queryOBDWithAP(request models.PIDRequest, powerStatus *api.PowerStatusResponse) {
 	obdResp, ts, err := commands.RequestPIDRaw(&wr.logger, wr.device.UnitID, request)
@@ -437,27 +741,21 @@ func (wr *workerRunner) queryOBDWithAP(request models.PIDRequest, powerStatus *a
 		}
 		return
 	}
-	// future: new formula type that could work for proprietary PIDs and could support text, int or float
-	var value interface{}
-	if request.FormulaType() == models.Dbc && obdResp.IsHex {
-		// in case there are multiple responses
-		lastHex := ""
-		for _, hex := range obdResp.ValueHex {
-			value, _, err = loggers.ExtractAndDecodeWithDBCFormula(hex, util.UintToHexStr(request.Pid), request.FormulaValue())
-			lastHex = hex
-			if err == nil {
-				break // if no error just continue
-			}
-		}
-		// the last error will be set
+	var signals []models.SignalData
+	formulaType := request.FormulaType()
+	if (formulaType == models.Dbc || formulaType == models.Expr) && obdResp.IsHex {
+		// in case there are multiple responses, eg. every ecu answering a broadcast request
+		values, err := loggers.DecodeECUResponses(request, obdResp.ValueHex)
 		if err != nil {
+			lastHex := obdResp.ValueHex[len(obdResp.ValueHex)-1]
 			msg := fmt.Sprintf("failed to convert hex response with formula: %s. signal: %s. hex: %s. template: %s",
 				request.FormulaValue(), request.Name, lastHex, wr.pids.TemplateName)
 			hooks.LogError(wr.logger, err, msg, hooks.WithThresholdWhenLogMqtt(10), hooks.WithStopLogAfter(1))
 			return
 		}
+		signals = loggers.SelectECUValues(request, values, ts.UnixMilli())
 	} else if !obdResp.IsHex {
-		value = obdResp.Value
+		signals = []models.SignalData{{Timestamp: ts.UnixMilli(), Name: request.Name, Value: obdResp.Value, Source: models.SignalSourcePID}}
 		// future todo, check what other types conversion we should handle
 	} else {
 		wr.logger.Error().Msgf("no recognized formula type found: %s. signal: %s. template: %s", request.Formula, request.Name, wr.pids.TemplateName)
@@ -466,11 +764,12 @@ func (wr *workerRunner) queryOBDWithAP(request models.PIDRequest, powerStatus *a
 
 	// reset the failure count
 	wr.signalsQueue.failureCount[request.Name] = 0
-	wr.signalsQueue.Enqueue(models.SignalData{
-		Timestamp: ts.UnixMilli(),
-		Name:      request.Name,
-		Value:     value,
-	})
+	for _, signal := range signals {
+		wr.signalsQueue.Enqueue(signal)
+		wr.observeSignal(signal)
+	}
+	// the interval is kept by request name, signals selected from every ecu are named per ecu
+	wr.signalsQueue.MarkChecked(request.Name)
 }
 
 // queryPIDAndCaptureDump does a obd.query with a blank formula and logs the hex the response in dump queue
@@ -484,7 +783,7 @@ func (wr *workerRunner) queryPIDAndCaptureDump(request models.PIDRequest) {
 	obdRespWithValue, _, _ := commands.RequestPIDRaw(&wr.logger, wr.device.UnitID, request)
 
 	scfr := models.SignalCanFrameDump{
-		Timestamp:     time.Now().UnixMilli(),
+		Timestamp:     clock.Now().UnixMilli(),
 		Name:          request.Name,
 		PidHex:        util.UintToHexStr(request.Pid),
 		PythonFormula: f,
@@ -505,19 +804,302 @@ func (wr *workerRunner) isOkToQueryOBD() (bool, api.PowerStatusResponse) {
 		wr.logger.Err(err).Msg("failed to get powerStatus for worker runner check")
 		return false, status
 	}
+	if wr.power != nil {
+		state := wr.power.Observe(clock.Now(), status.VoltageFound)
+		// templates without a min voltage query at any voltage the battery isn't being protected at
+		if wr.deviceSettings.MinVoltageOBDLoggers <= 0 {
+			return !state.CutOut, status
+		}
+		return state.OkToQueryOBD(), status
+	}
 	if status.VoltageFound >= wr.deviceSettings.MinVoltageOBDLoggers {
 		return true, status
 	}
 	return false, status
 }
 
+// captureConditions vehicle state for can capture triggers. Engine running is rpm > 0 if we have it recently, otherwise
+// the same voltage threshold we use to decide if ok to query obd
+func (wr *workerRunner) captureConditions(powerStatus api.PowerStatusResponse) CaptureConditions {
+	conditions := CaptureConditions{
+		Voltage:       powerStatus.VoltageFound,
+		EngineRunning: powerStatus.VoltageFound >= wr.deviceSettings.MinVoltageOBDLoggers,
+	}
+	if wr.power != nil {
+		state := wr.power.State()
+		conditions.EngineRunning = state.Engine == EngineRunning
+		conditions.LowPower = state.LowPower()
+	}
+	if rpm, ok := wr.signalsQueue.LatestFloat("rpm", time.Minute); ok {
+		conditions.EngineRunning = rpm > 0
+	}
+	if speed, ok := wr.signalsQueue.LatestFloat("speed", time.Minute); ok {
+		conditions.Speed = speed
+	}
+	return conditions
+}
+
+// observeTrip feeds the trip detector with the latest vehicle state and sends trip start / end events
+func (wr *workerRunner) observeTrip(powerStatus api.PowerStatusResponse) {
+	obs := TripObservation{Time: clock.Now(), Voltage: powerStatus.VoltageFound}
+	latest := func(names ...string) *float64 {
+		for _, name := range names {
+			if v, ok := wr.signalsQueue.LatestFloat(name, time.Minute); ok {
+				return &v
+			}
+		}
+		return nil
+	}
+	obs.RPM = latest("rpm")
+	obs.Speed = latest("speed")
+	obs.FuelLevel = latest("fuelLevel", "fuellevel")
+	obs.SOC = latest("soc")
+
+	event := wr.trips.Observe(obs)
+	if event == nil {
+		return
+	}
+	wr.logger.Info().Msgf("trip %s %s", event.TripID, event.Type)
+	if err := wr.dataSender.SendTripEvent(*event); err != nil {
+		wr.logger.Err(err).Msgf("failed to send trip %s event", event.Type)
+	}
+}
+
+// queryEVWhileOff keeps querying the ev signals while the vehicle is off so charging is tracked, as long as the 12v
+// battery is above the critical level
+func (wr *workerRunner) queryEVWhileOff(powerStatus api.PowerStatusResponse) {
+	critical := powerStatus.VoltageFound <= wr.deviceSettings.BatteryCriticalLevelVoltage
+	if wr.power != nil {
+		critical = wr.power.State().LowPower()
+	}
+	if wr.pids == nil || critical {
+		return
+	}
+	interval := wr.deviceSettings.EV.OffQueryIntervalSecs
+	if interval <= 0 {
+		interval = 60
+	}
+	for _, request := range wr.pids.Requests {
+		if !slices.Contains(EVSignalNames, request.Name) {
+			continue
+		}
+		if lastChecked, ok := wr.signalsQueue.lastEnqueuedTime(request.Name); ok && time.Since(lastChecked).Seconds() < interval {
+			continue
+		}
+		if wr.signalsQueue.failureCount[request.Name] > maxPidFailures {
+			continue
+		}
+		wr.queryOBDWithAP(request, &powerStatus)
+	}
+}
+
+// observeCharging feeds the charging session detector with the latest ev signals and sends charge start / end events
+func (wr *workerRunner) observeCharging() {
+	latest := func(name string) *float64 {
+		if v, ok := wr.signalsQueue.LatestFloat(name, 2*time.Minute); ok {
+			return &v
+		}
+		return nil
+	}
+	obs := ChargingObservation{
+		Time:           clock.Now(),
+		SOC:            latest(EVSignalSOC),
+		PackVoltage:    latest(EVSignalPackVoltage),
+		PackCurrent:    latest(EVSignalPackCurrent),
+		ChargingStatus: latest(EVSignalChargingStatus),
+		Speed:          latest("speed"),
+	}
+	if chargerType, ok := wr.signalsQueue.LatestFloat(EVSignalChargerType, 2*time.Minute); ok {
+		obs.ChargerType = fmt.Sprintf("%.0f", chargerType)
+	}
+	lat, latOk := wr.signalsQueue.LatestFloat("latitude", 10*time.Minute)
+	lon, lonOk := wr.signalsQueue.LatestFloat("longitude", 10*time.Minute)
+	if latOk && lonOk {
+		obs.Location = &models.Location{Latitude: lat, Longitude: lon}
+	}
+
+	event := wr.charging.Observe(obs)
+	if event == nil {
+		return
+	}
+	wr.logger.Info().Msgf("charging session %s %s", event.SessionID, event.Type)
+	if err := wr.dataSender.SendChargingEvent(*event); err != nil {
+		wr.logger.Err(err).Msgf("failed to send charging %s event", event.Type)
+	}
+}
+
+// sampleBatteryHealth polls the battery voltage every second, and as fast as possible around ignition to catch the
+// cranking dip. Measurements are enqueued as signals.
+func (wr *workerRunner) sampleBatteryHealth() {
+	for {
+		interval := time.Second
+		if wr.batteryHealth.HighRate(clock.Now()) {
+			interval = 100 * time.Millisecond
+		}
+		status, err := commands.GetPowerStatus(wr.device.UnitID)
+		if err == nil {
+			engine := EngineOff
+			if wr.power != nil {
+				engine = wr.power.State().Engine
+			}
+			signals, daily := wr.batteryHealth.Observe(clock.Now(), status.VoltageFound, engine)
+			for _, signal := range signals {
+				wr.signalsQueue.Enqueue(signal)
+			}
+			if daily != nil {
+				if err := wr.dataSender.SendBatteryHealthEvent(*daily); err != nil {
+					wr.logger.Err(err).Msg("failed to send battery health summary")
+				}
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// lowPower true while the battery is being protected, optional work like high frequency location is skipped
+func (wr *workerRunner) lowPower() bool {
+	return wr.power != nil && wr.power.State().LowPower()
+}
+
+// locationFrequency is the geofence override while inside one, otherwise the template setting
+func (wr *workerRunner) locationFrequency() float64 {
+	if frequency := wr.geofenceLocationFrequency(); frequency > 0 {
+		return frequency
+	}
+	if wr.deviceSettings.LocationFrequencySecs == wr.sendPayloadInterval.Seconds() {
+		return 0
+	}
+	return wr.deviceSettings.LocationFrequencySecs
+}
+
+func (wr *workerRunner) geofenceLocationFrequency() float64 {
+	if wr.geofences == nil {
+		return 0
+	}
+	frequency, _ := wr.geofences.Behavior()
+	return frequency
+}
+
+// locationSuppressed true while inside a geofence that does not want location sent
+func (wr *workerRunner) locationSuppressed() bool {
+	if wr.geofences == nil {
+		return false
+	}
+	_, suppress := wr.geofences.Behavior()
+	return suppress
+}
+
+func (wr *workerRunner) sendGeofenceEvents(events []models.GeofenceEvent) {
+	for _, ev := range events {
+		if wr.trips != nil {
+			ev.TripID = wr.trips.TripIDAt(time.UnixMilli(ev.Timestamp))
+		}
+		wr.logger.Info().Msgf("geofence %s %s after %.0fs", ev.FenceID, ev.Type, ev.DwellSecs)
+		if err := wr.dataSender.SendGeofenceEvent(ev); err != nil {
+			wr.logger.Err(err).Msgf("failed to send geofence %s event", ev.Type)
+		}
+	}
+}
+
+// observeSignal feeds signals from pids or the dbc logger to the driving event detector, dead reckoning and the odometer
+func (wr *workerRunner) observeSignal(signal models.SignalData) {
+	if wr.driving == nil && wr.deadReckoning == nil && wr.odometer == nil {
+		return
+	}
+	value, ok := signalFloat(signal.Value)
+	if !ok {
+		return
+	}
+	if wr.driving != nil && wr.driving.IsSpeedSignal(signal.Name) {
+		wr.sendDrivingEvents(wr.driving.ObserveSpeed(signal.Name, time.UnixMilli(signal.Timestamp), value))
+	}
+	if wr.deadReckoning != nil {
+		wr.deadReckoning.ObserveSignal(signal.Name, time.UnixMilli(signal.Timestamp), value)
+	}
+	if wr.odometer != nil {
+		wr.odometer.ObserveSignal(signal.Name, time.UnixMilli(signal.Timestamp), value)
+	}
+}
+
+// estimatedLocation dead reckoning estimate while gps has no fix, nil if not enabled or nothing to estimate from
+func (wr *workerRunner) estimatedLocation() *models.Location {
+	if wr.deadReckoning == nil {
+		return nil
+	}
+	location := wr.deadReckoning.Estimate(clock.Now())
+	if location != nil && wr.trips != nil {
+		wr.trips.ObserveLocation(clock.Now(), *location)
+	}
+	return location
+}
+
+// pollAccelerometer feeds the driving event detector, stops if the device does not have an accelerometer
+func (wr *workerRunner) pollAccelerometer() {
+	interval := time.Duration(float64(time.Second) / wr.deviceSettings.DrivingEvents.AccelerometerHz)
+	failures := 0
+	for {
+		acc, err := commands.GetAccelerometer(wr.device.UnitID)
+		if err != nil {
+			failures++
+			if failures >= 5 {
+				wr.logger.Warn().Err(err).Msg("accelerometer not available, not using it for driving events")
+				return
+			}
+		} else {
+			failures = 0
+			wr.sendDrivingEvents(wr.driving.ObserveAccelerometer(clock.Now(), acc.X, acc.Y, acc.Z))
+		}
+		time.Sleep(interval)
+	}
+}
+
+// sendDrivingEvents sends right away rather than with the next status payload
+func (wr *workerRunner) sendDrivingEvents(events []models.DrivingEvent) {
+	for _, ev := range events {
+		if wr.trips != nil {
+			ev.TripID = wr.trips.TripIDAt(time.UnixMilli(ev.Timestamp))
+		}
+		wr.logger.Info().Msgf("driving event %s from %s: %.3f", ev.Type, ev.Source, ev.Value)
+		if err := wr.dataSender.SendDrivingEvent(ev); err != nil {
+			wr.logger.Err(err).Msgf("failed to send driving event %s", ev.Type)
+		}
+	}
+}
+
 type SignalsQueue struct {
 	signals         map[string][]models.SignalData
 	lastTimeChecked map[string]time.Time
 	failureCount    map[string]int
+	// latest value per signal, kept after Dequeue
+	latest map[string]models.SignalData
+	// mapper renames the queued signals to vss paths, latest and the checked times keep the device names. nil to disable
+	mapper *SignalMapper
 	sync.RWMutex
 }
 
+// LatestFloat returns the last enqueued value of a numeric signal if it is no older than maxAge
+func (sq *SignalsQueue) LatestFloat(name string, maxAge time.Duration) (float64, bool) {
+	sq.RLock()
+	defer sq.RUnlock()
+	s, ok := sq.latest[name]
+	if !ok || clock.Now().Sub(time.UnixMilli(s.Timestamp)) > maxAge {
+		return 0, false
+	}
+	return signalFloat(s.Value)
+}
+
+func signalFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
 func (sq *SignalsQueue) lastEnqueuedTime(key string) (time.Time, bool) {
 	sq.Lock()
 	defer sq.Unlock()
@@ -528,18 +1110,23 @@ func (sq *SignalsQueue) lastEnqueuedTime(key string) (time.Time, bool) {
 func (sq *SignalsQueue) Enqueue(signal models.SignalData) {
 	sq.Lock()
 	defer sq.Unlock()
+	mapped := sq.mapper.Map(signal)
 	// only enqueue limit freq signals once if same value
 	if signal.LimitFrequency {
-		if data, ok := sq.signals[signal.Name]; ok {
+		if data, ok := sq.signals[mapped.Name]; ok {
 			for _, s := range data {
-				if s.Value == signal.Value {
+				if s.Value == mapped.Value {
 					return
 				}
 			}
 		}
 	}
 	sq.lastTimeChecked[signal.Name] = time.Now()
-	sq.signals[signal.Name] = append(sq.signals[signal.Name], signal)
+	sq.signals[mapped.Name] = append(sq.signals[mapped.Name], mapped)
+	if sq.latest == nil {
+		sq.latest = make(map[string]models.SignalData)
+	}
+	sq.latest[signal.Name] = signal
 }
 
 func (sq *SignalsQueue) Dequeue() []models.SignalData {
@@ -556,6 +1143,28 @@ func (sq *SignalsQueue) Dequeue() []models.SignalData {
 	return data
 }
 
+// AdjustTimestamps rewrites the timestamps of buffered signals once the device clock is corrected
+func (sq *SignalsQueue) AdjustTimestamps(adj clock.Adjustment) {
+	sq.Lock()
+	defer sq.Unlock()
+	for _, signals := range sq.signals {
+		for i := range signals {
+			signals[i].Timestamp = adj.Apply(signals[i].Timestamp)
+		}
+	}
+	for name, s := range sq.latest {
+		s.Timestamp = adj.Apply(s.Timestamp)
+		sq.latest[name] = s
+	}
+}
+
+// MarkChecked the request was queried now
+func (sq *SignalsQueue) MarkChecked(requestName string) {
+	sq.Lock()
+	defer sq.Unlock()
+	sq.lastTimeChecked[requestName] = time.Now()
+}
+
 func (sq *SignalsQueue) IncrementFailureCount(requestName string) {
 	sq.Lock()
 	defer sq.Unlock()
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"sync"
@@ -14,6 +15,8 @@ import (
 	"github.com/DIMO-Network/edge-network/internal/hooks"
 
 	"github.com/DIMO-Network/edge-network/internal/api"
+	"github.com/DIMO-Network/edge-network/internal/autopisim"
+	"github.com/DIMO-Network/edge-network/internal/clock"
 	"github.com/DIMO-Network/edge-network/internal/loggers"
 	mockloggers "github.com/DIMO-Network/edge-network/internal/loggers/mocks"
 	"github.com/DIMO-Network/edge-network/internal/models"
@@ -22,24 +25,51 @@ import (
 	"github.com/jarcoal/httpmock"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
 
 const autoPiBaseURL = "http://192.168.4.1:9000"
 
+// startAutoPiSim serves the autopi api from the simulator, for a running vehicle with a steady 13.3V and no dtcs
+func startAutoPiSim(t *testing.T, unitID uuid.UUID) *autopisim.Server {
+	vehicle := autopisim.DefaultVehicle()
+	vehicle.Voltage = []autopisim.Point{{AtSecs: 0, Value: 13.3}}
+	vehicle.DTCs = nil
+	sim, err := autopisim.NewServer(zerolog.Nop(), unitID, vehicle)
+	require.NoError(t, err)
+	now := time.Date(2024, 2, 29, 17, 17, 30, 0, time.UTC)
+	sim.SetClock(func() time.Time { return now })
+
+	srv := httptest.NewServer(sim)
+	api.SetBaseURL(srv.URL)
+	t.Cleanup(func() {
+		srv.Close()
+		api.SetBaseURL("")
+	})
+	return sim
+}
+
+// fuelLevelRequest a pid the simulated vehicle answers, 75% at the fixed clock
+var fuelLevelRequest = models.PIDRequest{
+	Name:            "fuellevel",
+	Header:          0x7df,
+	Mode:            0x01,
+	Pid:             0x2f,
+	IntervalSeconds: 10,
+	Formula:         "dbc:31|8@0+ (0.392156862745098,0) [0|100] \"%\"",
+}
+
 func TestQueryNonObd(t *testing.T) {
 	// when
-	httpmock.Activate()
-	defer httpmock.DeactivateAndReset()
 	unitID := uuid.New()
+	startAutoPiSim(t, unitID)
 
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	_, ds, ts, dbcS, ls, dr := mockComponents(mockCtrl, unitID)
 
-	registerResponders(unitID, false, false, false, false)
-
 	// Initialize workerRunner here with mocked dependencies
 	wr := createWorkerRunner(ts, ds, dbcS, ls, dr, unitID)
 
@@ -50,31 +80,27 @@ func TestQueryNonObd(t *testing.T) {
 	assert.NotNil(t, cellInfo)
 	assert.Equal(t, -122.4194, location.Longitude)
 	assert.Equal(t, 37.7749, location.Latitude)
-	assert.Equal(t, "test", wifi.SSID)
+	assert.Equal(t, "autopi-sim", wifi.SSID)
 	assert.Equal(t, "COMPLETED", wifi.WPAState)
 }
 
 func TestQueryOBD(t *testing.T) {
 	// when
-	httpmock.Activate()
-	defer httpmock.DeactivateAndReset()
-
 	unitID := uuid.New()
+	startAutoPiSim(t, unitID)
 
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	_, ds, ts, dbcS, ls, dr := mockComponents(mockCtrl, unitID)
-	registerResponders(unitID, false, false, false, false)
 
 	requests := []models.PIDRequest{
-		{
-			Name:            "fuellevel",
-			IntervalSeconds: 10,
-			Formula:         "dbc:31|8@0+ (0.392156862745098,0) [0|100] \"%\"",
-		},
+		fuelLevelRequest,
 		{
 			Name:            "rpm",
+			Header:          0x7df,
+			Mode:            0x01,
+			Pid:             0x0c,
 			IntervalSeconds: 5,
 			Formula:         "dbc: 31|16@0+ (0.25,0) [0|16383.75] \"%\"",
 		},
@@ -88,13 +114,49 @@ func TestQueryOBD(t *testing.T) {
 	_, _ = wr.isOkToQueryOBD()
 	wr.queryOBD(nil)
 
-	fmt.Printf("wr.signalsQueue.signals: %+v\n", wr.signalsQueue.signals)
 	// verify
 	assert.Equal(t, "fuellevel", wr.signalsQueue.signals["fuellevel"][0].Name)
+	assert.InDelta(t, 75.0, wr.signalsQueue.signals["fuellevel"][0].Value, 0.5)
+	assert.Equal(t, 800.0, wr.signalsQueue.signals["rpm"][0].Value)
 	assert.Equal(t, 2, len(wr.signalsQueue.signals))
 	assert.Equal(t, 2, len(wr.signalsQueue.lastTimeChecked))
 }
 
+func TestIsOkToQueryOBD_noMinVoltage(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	unitID := uuid.New()
+	mockCtrl := gomock.NewController(t)
+	_, ds, ts, dbcS, ls, dr := mockComponents(mockCtrl, unitID)
+	registerResponders(unitID, false, false, false, true)
+
+	wr := createWorkerRunner(ts, ds, dbcS, ls, dr, unitID)
+	wr.power = newPowerManager(zerolog.Nop(), *wr.deviceSettings, nil)
+	ok, powerStatus := wr.isOkToQueryOBD()
+	assert.True(t, ok, "templates without min_voltage_obd_loggers query at any voltage")
+	assert.Equal(t, 12.3, powerStatus.VoltageFound)
+
+	wr.deviceSettings.MinVoltageOBDLoggers = 13.2
+	ok, _ = wr.isOkToQueryOBD()
+	assert.False(t, ok)
+}
+
+func TestIsOkToQueryOBD_noMinVoltageUnderCutOut(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	unitID := uuid.New()
+	mockCtrl := gomock.NewController(t)
+	_, ds, ts, dbcS, ls, dr := mockComponents(mockCtrl, unitID)
+	registerResponders(unitID, false, false, false, true)
+
+	wr := createWorkerRunner(ts, ds, dbcS, ls, dr, unitID)
+	wr.deviceSettings.SafetyCutOutVoltage = 12.5
+	wr.power = newPowerManager(zerolog.Nop(), *wr.deviceSettings, nil)
+	ok, powerStatus := wr.isOkToQueryOBD()
+	assert.False(t, ok, "the safety cut out applies without min_voltage_obd_loggers too")
+	assert.Equal(t, 12.3, powerStatus.VoltageFound)
+}
+
 func TestQueryObdWithPythonFormula(t *testing.T) {
 	// when
 	httpmock.Activate()
@@ -144,30 +206,22 @@ func TestQueryObdWithPythonFormula(t *testing.T) {
 // test for both obd and non-obd signals which executes synchronously and not concurrently
 func TestQueryObdANDNonObd(t *testing.T) {
 	// when
-	httpmock.Activate()
-	defer httpmock.DeactivateAndReset()
-
 	unitID := uuid.New()
+	startAutoPiSim(t, unitID)
 
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	vl, ds, ts, dbcS, ls, dr := mockComponents(mockCtrl, unitID)
 
-	registerResponders(unitID, false, false, false, false)
 	expectOnMocks(ts, vl, unitID, ds, 0)
 
 	// Initialize workerRunner here with mocked dependencies
-	requests := []models.PIDRequest{
-		{
-			Name:            "fuellevel",
-			IntervalSeconds: 60,
-			Formula:         "dbc:31|8@0+ (0.392156862745098,0) [0|100] \"%\"",
-		},
-	}
+	request := fuelLevelRequest
+	request.IntervalSeconds = 60
 
 	wr := createWorkerRunner(ts, ds, dbcS, ls, dr, unitID)
-	wr.pids.Requests = requests
+	wr.pids.Requests = []models.PIDRequest{request}
 
 	// then
 	_, powerStatus := wr.isOkToQueryOBD()
@@ -187,26 +241,26 @@ func TestQueryObdANDNonObd(t *testing.T) {
 // test for both obd and non-obd which executes concurrently as is in code
 func TestRun(t *testing.T) {
 	// when
-	httpmock.Activate()
-	defer httpmock.DeactivateAndReset()
-
 	unitID := uuid.New()
+	sim := startAutoPiSim(t, unitID)
+	// the gps fix has to move on, a fix time that doesn't is stale
+	sim.SetClock(time.Now)
 
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	vl, ds, ts, dbcS, ls, dr := mockComponents(mockCtrl, unitID)
 
-	registerResponders(unitID, false, false, false, false)
 	expectOnMocks(ts, vl, unitID, ds, 1)
 
 	// assert data sender is called twice with expected payload
 	ds.EXPECT().SendDeviceStatusData(gomock.Any()).Times(1).Do(func(data models.DeviceStatusData) {
 		assert.Equal(t, "fuellevel", data.Vehicle.Signals[0].Name)
-		assert.Equal(t, 9, len(data.Vehicle.Signals))
+		assert.Equal(t, 11, len(data.Vehicle.Signals))
 	}).Return(nil)
 	ds.EXPECT().SendDeviceStatusData(gomock.Any()).Times(1).Do(func(data models.DeviceStatusData) {
-		assert.Equal(t, 8, len(data.Vehicle.Signals))
+		// fuellevel is not due yet
+		assert.Equal(t, 10, len(data.Vehicle.Signals))
 	}).Return(nil)
 
 	ds.EXPECT().SendDeviceNetworkData(gomock.Any()).Times(2).Do(func(data models.DeviceNetworkData) {
@@ -214,16 +268,11 @@ func TestRun(t *testing.T) {
 		assert.NotNil(t, data.Longitude)
 	}).Return(nil)
 	// Initialize workerRunner here with mocked dependencies
-	requests := []models.PIDRequest{
-		{
-			Name:            "fuellevel",
-			IntervalSeconds: 6,
-			Formula:         "dbc:31|8@0+ (0.392156862745098,0) [0|100] \"%\"",
-		},
-	}
+	request := fuelLevelRequest
+	request.IntervalSeconds = 6
 
 	wr := createWorkerRunner(ts, ds, dbcS, ls, dr, unitID)
-	wr.pids.Requests = requests
+	wr.pids.Requests = []models.PIDRequest{request}
 	wr.sendPayloadInterval = 5 * time.Second
 	wr.stop = make(chan bool)
 
@@ -550,15 +599,15 @@ func TestRunFailedToQueryPidButRecover(t *testing.T) {
 	fh := hooks.NewLogRateLimiterHook(ds)
 	wr.logger = wr.logger.Hook(fh)
 
-	// assert data sender is called without fuel level signal
+	// assert data sender is called without fuel level signal, nor location as the gps response has no position
 	ds.EXPECT().SendDeviceStatusData(gomock.Any()).Times(1).Do(func(data models.DeviceStatusData) {
-		assert.Equal(t, 8, len(data.Vehicle.Signals))
+		assert.Equal(t, 3, len(data.Vehicle.Signals))
 	}).Return(nil)
 	ds.EXPECT().SendDeviceStatusData(gomock.Any()).Times(1).Do(func(data models.DeviceStatusData) {
-		assert.Equal(t, 10, len(data.Vehicle.Signals))
+		assert.Equal(t, 5, len(data.Vehicle.Signals))
 	}).Return(nil)
 	ds.EXPECT().SendDeviceStatusData(gomock.Any()).Times(1).Do(func(data models.DeviceStatusData) {
-		assert.Equal(t, 13, len(data.Vehicle.Signals))
+		assert.Equal(t, 8, len(data.Vehicle.Signals))
 		found := false
 		for _, signal := range data.Vehicle.Signals {
 			if signal.Name == "foo" {
@@ -861,9 +910,9 @@ func mockComponents(mockCtrl *gomock.Controller, unitID uuid.UUID) (*mockloggers
 
 	ts.EXPECT().ReadVINConfig().Times(1).Return(nil, fmt.Errorf("error reading file: open /tmp/logger-settings.json: no such file or directory"))
 
-	ls := NewFingerprintRunner(unitID, vl, ds, ts, logger)
+	ls := NewFingerprintRunner(unitID, vl, ds, ts, logger, nil, nil)
 	dr := NewDtcErrorsRunner(unitID, ds, logger)
-	dbcS.EXPECT().UseNativeScanLogger().AnyTimes().Return(false)
+	dbcS.EXPECT().ShouldNativeScanLogger().AnyTimes().Return(false)
 	return vl, ds, ts, dbcS, ls, dr
 }
 
@@ -1056,3 +1105,30 @@ func TestSignalsQueue_Enqueue(t *testing.T) {
 	})
 	assert.Equal(t, 2, len(sq.signals["odometer"]))
 }
+
+func Test_workerRunner_runDBCDiscovery(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	unitID := uuid.New()
+	_, ds, ts, dbcS, ls, dr := mockComponents(mockCtrl, unitID)
+	wr := createWorkerRunner(ts, ds, dbcS, ls, dr, unitID)
+	wr.deviceSettings.DBCDiscovery = models.DBCDiscoverySettings{Enabled: true, WindowSecs: 30}
+
+	report := &models.DBCDiscoveryReport{TotalFrames: 10, IDs: []models.DBCCandidateID{{ID: "3E9", Count: 10}}}
+	dbcS.EXPECT().DiscoverDBCCandidates(30*time.Second, wr.signalsQueue, []string{"speed", "rpm"}).Return(report, nil)
+	ds.EXPECT().SendDBCDiscoveryReport(models.DBCDiscoveryReport{TotalFrames: 10, IDs: report.IDs, TemplateName: "test"}).Return(nil)
+
+	wr.runDBCDiscovery()
+}
+
+func TestSignalsQueue_AdjustTimestamps(t *testing.T) {
+	sq := &SignalsQueue{lastTimeChecked: make(map[string]time.Time), failureCount: make(map[string]int), signals: make(map[string][]models.SignalData)}
+	sq.Enqueue(models.SignalData{Timestamp: 1000, Name: "speed", Value: 10.0})
+	sq.Enqueue(models.SignalData{Timestamp: 5000, Name: "speed", Value: 12.0})
+
+	sq.AdjustTimestamps(clock.Adjustment{Before: 2000, Delta: 100})
+
+	signals := sq.Dequeue()
+	require.Len(t, signals, 2)
+	assert.Equal(t, int64(1100), signals[0].Timestamp)
+	assert.Equal(t, int64(5000), signals[1].Timestamp)
+}
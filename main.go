@@ -26,6 +26,8 @@ import (
 
 	"github.com/DIMO-Network/edge-network/commands"
 	"github.com/DIMO-Network/edge-network/internal"
+	"github.com/DIMO-Network/edge-network/internal/api"
+	"github.com/DIMO-Network/edge-network/internal/clock"
 	"github.com/DIMO-Network/edge-network/internal/loggers"
 	"github.com/DIMO-Network/edge-network/internal/network"
 	"github.com/google/uuid"
@@ -38,6 +40,9 @@ var ENV = "prod"
 
 const bleUnsupportedHW = "5.2"
 
+// shutdownWait how long a restart waits for a can capture upload to save its progress
+const shutdownWait = 30 * time.Second
+
 var unitID uuid.UUID
 var name string
 
@@ -67,6 +72,19 @@ func main() {
 			fmt.Printf("Version: %s \n", Version)
 			os.Exit(0)
 		}
+		// the simulators stand in for the autopi and the car, so they must run before we query anything from the device
+		if s == autopiSimCmdName || s == canReplayCmdName || s == ecuSimCmdName {
+			subcommands.Register(&autopiSimCmd{logger: logger}, "development")
+			subcommands.Register(&canReplayCmd{logger: logger}, "development")
+			subcommands.Register(&ecuSimCmd{logger: logger}, "development")
+			flag.Parse()
+			os.Exit(int(subcommands.Execute(context.Background())))
+		}
+	}
+	// point to a different autopi api, eg. the autopi-sim subcommand when running on a laptop
+	if baseURL := os.Getenv("AUTOPI_BASE_URL"); baseURL != "" {
+		api.SetBaseURL(baseURL)
+		logger.Info().Msgf("using autopi api at: %s", baseURL)
 	}
 	// Used by go-bluetooth, and we use this to set how much it logs. Not for this project.
 	logrus.SetLevel(logrus.InfoLevel)
@@ -111,7 +129,8 @@ func main() {
 	subcommands.Register(&scanVINCmd{unitID: unitID, logger: logger}, "decode loggers")
 	subcommands.Register(&buildInfoCmd{logger: logger}, "info")
 	subcommands.Register(&dbcScanCmd{logger: logger}, "decode loggers")
-	subcommands.Register(&canDumpV2Cmd{logger: logger}, "decode loggers")
+	subcommands.Register(&dbcDiscoverCmd{logger: logger}, "decode loggers")
+	subcommands.Register(&canDumpV2Cmd{unitID: unitID, logger: logger}, "decode loggers")
 
 	if len(os.Args) > 1 {
 		ctx := context.Background()
@@ -119,6 +138,14 @@ func main() {
 		os.Exit(int(subcommands.Execute(ctx)))
 	}
 
+	// set to exit with an error after the deferred cleanup, runs last
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
 	// define environment
 	var env gateways.Environment
 	var confFileName string
@@ -141,6 +168,8 @@ func main() {
 	logger.Info().Msgf("Bluetooth name: %s", name)
 	logger.Info().Msgf("Version: %s", Version)
 	logger.Info().Msgf("Environment: %s", env)
+	// the pi has no rtc, track whether the clock can be trusted and fix signal timestamps once it can
+	go clock.Watch(10*time.Second, nil)
 
 	coldBoot, err := isColdBoot(logger, unitID)
 	if err != nil {
@@ -205,6 +234,8 @@ func main() {
 		hooks.LogFatal(logger, err, "unable to get device settings (pids, dbc, settings)")
 	}
 	if pids != nil {
+		// python formulas the expr engine supports are decoded on the device
+		pids.Requests = loggers.TranslatePythonFormulas(logger, pids.Requests)
 		pj, err := json.Marshal(pids)
 		if err != nil {
 			logger.Info().RawJSON("pids", pj).Msg("pids pulled from config")
@@ -223,9 +254,13 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
 
-	fingerprintRunner := internal.NewFingerprintRunner(unitID, vinLogger, ds, lss, logger)
+	odometer := internal.NewOdometerReader(logger, unitID, lss, vehicleInfo)
+	// vehicle data stays paused if the device was moved to another vehicle and is not paired to it yet
+	pairing := internal.NewVehiclePairing(logger, lss, ds, gateways.NewIdentityAPIService(logger, *config), *ethAddr, vehicleInfo)
+	pairing.Resume()
+	fingerprintRunner := internal.NewFingerprintRunner(unitID, vinLogger, ds, lss, logger, odometer, pairing)
 	dtcRunner := internal.NewDtcErrorsRunner(unitID, ds, logger)
-	dbcScanner := loggers.NewDBCPassiveLogger(logger, dbcFile, hwRevision, pids)
+	dbcScanner := loggers.NewDBCPassiveLogger(logger, dbcFile, hwRevision, pids, config.CAN.Interface)
 
 	// query imei
 	imei, err := commands.GetIMEI(unitID)
@@ -240,12 +275,41 @@ func main() {
 		HardwareVersion: hwRevision,
 		IMEI:            imei,
 	}
+	var captureJobs []models.CANCaptureJob
+	if deviceSettings != nil {
+		ds.SetLocationPrivacy(deviceSettings.LocationPrivacy)
+		captureJobs = deviceSettings.CANCaptureJobs
+	}
+	canCapture := internal.NewCANCaptureRunner(logger, ds, lss, captureJobs, config.CAN.Interface)
 	// Execute Worker in background.
-	runnerSvc := internal.NewWorkerRunner(ethAddr, lss, ds, logger, fingerprintRunner, pids, deviceSettings, deviceConf, vehicleInfo, dbcScanner, dtcRunner)
-	runnerSvc.Run() // not sure if this will block always. if it does do we need to have a cancel when catch os.Interrupt, ie. stop tasks?
+	runnerSvc := internal.NewWorkerRunner(ethAddr, lss, ds, logger, fingerprintRunner, pids, deviceSettings, deviceConf, vehicleInfo, dbcScanner, dtcRunner, canCapture, odometer)
+	pairing.OnVehicleChanged(runnerSvc.ResetVehicleState)
+	// the worker loops forever, main waits for an interrupt or the device being paired to a new vehicle
+	go runnerSvc.Run()
 
-	sig := <-sigChan
-	logger.Info().Msgf("Terminating from signal: %s", sig)
+	exitCode = awaitShutdown(logger, sigChan, pairing.Restart(), canCapture)
+}
+
+// captureWaiter is the part of the can capture runner the shutdown waits on
+type captureWaiter interface {
+	Wait(timeout time.Duration) bool
+}
+
+// awaitShutdown blocks until an interrupt or until restart is closed, returns the exit code for after the deferred cleanup
+func awaitShutdown(logger zerolog.Logger, sigChan <-chan os.Signal, restart <-chan struct{}, canCapture captureWaiter) int {
+	select {
+	case sig := <-sigChan:
+		logger.Info().Msgf("Terminating from signal: %s", sig)
+		return 0
+	case <-restart:
+		// vehicle data is paused, an upload in progress stops at its next chunk and saves where to resume
+		if !canCapture.Wait(shutdownWait) {
+			logger.Warn().Msg("can capture job still running, exiting anyway")
+		}
+		logger.Info().Msg("Terminating to restart with the templates of the new vehicle")
+		// the service is restarted on failure, exit once the deferred cleanup has run
+		return 1
+	}
 }
 
 func setupBluez(name string) error {
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCaptureWaiter struct {
+	waited bool
+}
+
+func (f *fakeCaptureWaiter) Wait(_ time.Duration) bool {
+	f.waited = true
+	return true
+}
+
+func Test_awaitShutdown_restart(t *testing.T) {
+	sigChan := make(chan os.Signal, 1)
+	restart := make(chan struct{})
+	capture := &fakeCaptureWaiter{}
+
+	done := make(chan int)
+	go func() {
+		done <- awaitShutdown(zerolog.Nop(), sigChan, restart, capture)
+	}()
+	close(restart)
+
+	select {
+	case exitCode := <-done:
+		assert.Equal(t, 1, exitCode)
+		assert.True(t, capture.waited)
+	case <-time.After(time.Second):
+		t.Fatal("shutdown did not run after restart was closed")
+	}
+}
+
+func Test_awaitShutdown_signal(t *testing.T) {
+	sigChan := make(chan os.Signal, 1)
+	capture := &fakeCaptureWaiter{}
+	sigChan <- syscall.SIGINT
+
+	exitCode := awaitShutdown(zerolog.Nop(), sigChan, make(chan struct{}), capture)
+
+	assert.Equal(t, 0, exitCode)
+	assert.False(t, capture.waited)
+}